@@ -232,6 +232,11 @@ func calcNextRequiredDifficulty(lastNode HeaderCtx, newBlockTime time.Time,
 		return c.ChainParams().PowLimitBits, nil
 	}
 
+	// Networks using LWMA retarget every block.
+	if c.ChainParams().LWMAWindow > 0 {
+		return calcLWMARequiredDifficulty(lastNode, c)
+	}
+
 	// Return the previous block's difficulty requirements if this block
 	// is not at a difficulty retarget interval.
 	if (lastNode.Height()+1)%c.BlocksPerRetarget() != 0 {
@@ -307,6 +312,76 @@ func calcNextRequiredDifficulty(lastNode HeaderCtx, newBlockTime time.Time,
 	return newTargetBits, nil
 }
 
+// calcLWMARequiredDifficulty calculates the required difficulty for the block
+// after the passed previous HeaderCtx with zawy's linearly weighted moving
+// average (LWMA-1) over the last LWMAWindow blocks.  The average target of the
+// window is scaled by how long its blocks took compared to the target spacing,
+// with the solve time of the most recent block weighted the most, so the
+// difficulty follows changes in hashrate within a few blocks.
+//
+// Solve times are capped at six times the target spacing so a single long
+// pause can't collapse the difficulty, and timestamps that go backwards are
+// treated as one second after the previous block so a miner can't make up
+// negative solve times.  Until the chain is longer than the window the
+// minimum difficulty is used.
+func calcLWMARequiredDifficulty(lastNode HeaderCtx, c ChainCtx) (uint32, error) {
+	params := c.ChainParams()
+	window := params.LWMAWindow
+	if int64(lastNode.Height()) < window {
+		return params.PowLimitBits, nil
+	}
+
+	// Collect the window and the block before it, oldest first.
+	nodes := make([]HeaderCtx, window+1)
+	node := lastNode
+	for i := window; i >= 0; i-- {
+		if node == nil {
+			return 0, AssertError("unable to obtain LWMA window blocks")
+		}
+		nodes[i] = node
+		node = node.Parent()
+	}
+
+	targetSpacing := int64(params.TargetTimePerBlock / time.Second)
+	maxSolveTime := 6 * targetSpacing
+	sumTargets := new(big.Int)
+	var weightedSolveTimes int64
+	prevTimestamp := nodes[0].Timestamp()
+	for i := int64(1); i <= window; i++ {
+		timestamp := nodes[i].Timestamp()
+		if timestamp <= prevTimestamp {
+			timestamp = prevTimestamp + 1
+		}
+		solveTime := timestamp - prevTimestamp
+		if solveTime > maxSolveTime {
+			solveTime = maxSolveTime
+		}
+		prevTimestamp = timestamp
+
+		weightedSolveTimes += solveTime * i
+		sumTargets.Add(sumTargets, CompactToBig(nodes[i].Bits()))
+	}
+
+	// The weighted solve times add up to k when every block takes exactly
+	// the target spacing, so the new target is:
+	//  averageTarget * weightedSolveTimes / k
+	k := window * (window + 1) * targetSpacing / 2
+	newTarget := new(big.Int).Mul(sumTargets, big.NewInt(weightedSolveTimes))
+	newTarget.Div(newTarget, big.NewInt(window*k))
+
+	// Limit new value to the proof of work limit.
+	if newTarget.Cmp(params.PowLimit) > 0 {
+		newTarget.Set(params.PowLimit)
+	}
+
+	newTargetBits := BigToCompact(newTarget)
+	log.Debugf("LWMA difficulty retarget at block height %d", lastNode.Height()+1)
+	log.Debugf("New target %08x (%064x)", newTargetBits, CompactToBig(newTargetBits))
+	log.Debugf("Weighted solve times %d, on target %d", weightedSolveTimes, k)
+
+	return newTargetBits, nil
+}
+
 // CalcNextRequiredDifficulty calculates the required difficulty for the block
 // after the end of the current best chain based on the difficulty retarget
 // rules.
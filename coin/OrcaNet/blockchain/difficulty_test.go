@@ -5,8 +5,13 @@
 package blockchain
 
 import (
+	"errors"
 	"math/big"
 	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
 )
 
 // TestBigToCompact ensures BigToCompact converts big integers to the expected
@@ -73,3 +78,135 @@ func TestCalcWork(t *testing.T) {
 		}
 	}
 }
+
+// TestCalcLWMARequiredDifficulty ensures the LWMA retarget keeps the
+// difficulty while blocks arrive on time, follows blocks that come faster or
+// slower and caps the solve times it counts.
+func TestCalcLWMARequiredDifficulty(t *testing.T) {
+	params := chaincfg.FreshNetParams
+	params.LWMAWindow = 10
+	params.TargetTimePerBlock = 30 * time.Second
+	const bits = 0x1d00ffff
+	target := CompactToBig(bits)
+
+	tests := []struct {
+		name string
+		// Solve times of the blocks after the genesis block, in seconds.
+		solveTimes []int64
+		// Expected target divided by the target of the blocks, as a
+		// fraction.
+		num, den int64
+	}{
+		{
+			name:       "window not filled",
+			solveTimes: []int64{30, 30, 30},
+		},
+		{
+			name:       "on time",
+			solveTimes: []int64{30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+			num:        1, den: 1,
+		},
+		{
+			name:       "twice as fast",
+			solveTimes: []int64{15, 15, 15, 15, 15, 15, 15, 15, 15, 15, 15},
+			num:        1, den: 2,
+		},
+		{
+			name:       "twice as slow",
+			solveTimes: []int64{60, 60, 60, 60, 60, 60, 60, 60, 60, 60, 60},
+			num:        2, den: 1,
+		},
+		{
+			// The last block weighs 10/55 and its solve time counts
+			// as 180 seconds, 6 times the target spacing:
+			// (45 * 30 + 10 * 180) / (55 * 30) = 21 / 11.
+			name:       "long pause capped",
+			solveTimes: []int64{30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 100000},
+			num:        21, den: 11,
+		},
+		{
+			// The block 100 seconds in the past counts as 1 second
+			// and the next one as 30 seconds after it:
+			// (36 * 30 + 9 * 1 + 10 * 30) / (55 * 30) = 463 / 550.
+			name:       "timestamp going back",
+			solveTimes: []int64{30, 30, 30, 30, 30, 30, 30, 30, 30, -100, 131},
+			num:        463, den: 550,
+		},
+		{
+			// A block dated 150 seconds ahead, within the 180 seconds
+			// freshnet allows, counts as 180 seconds and the block on
+			// time after it as 1 second:
+			// (36 * 30 + 9 * 180 + 10 * 1) / (55 * 30) = 271 / 165.
+			name:       "forward dated block",
+			solveTimes: []int64{30, 30, 30, 30, 30, 30, 30, 30, 30, 180, -150},
+			num:        271, den: 165,
+		},
+	}
+
+	for _, test := range tests {
+		chain := newFakeChain(&params)
+		node := chain.bestChain.Tip()
+		timestamp := time.Unix(node.timestamp, 0)
+		for _, solveTime := range test.solveTimes {
+			timestamp = timestamp.Add(time.Duration(solveTime) * time.Second)
+			node = newFakeNode(node, 4, bits, timestamp)
+		}
+
+		got, err := calcNextRequiredDifficulty(node, timestamp, chain)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if test.den == 0 {
+			if got != params.PowLimitBits {
+				t.Errorf("%s: got %08x, want the minimum difficulty %08x",
+					test.name, got, params.PowLimitBits)
+			}
+			continue
+		}
+		want := new(big.Int).Mul(target, big.NewInt(test.num))
+		want.Div(want, big.NewInt(test.den))
+		if got != BigToCompact(want) {
+			t.Errorf("%s: got %08x, want %08x", test.name, got,
+				BigToCompact(want))
+		}
+	}
+}
+
+// TestMaxTimeOffset ensures freshnet only accepts block times a few block
+// times ahead of the current time, so a block dated in the future can't make
+// the LWMA retarget count the blocks after it as solved in a second for hours,
+// while the other networks keep the two hours of the Bitcoin rules.
+func TestMaxTimeOffset(t *testing.T) {
+	timeSource := NewMedianTime()
+	now := time.Unix(timeSource.AdjustedTime().Unix(), 0)
+
+	tests := []struct {
+		name   string
+		params *chaincfg.Params
+		ahead  time.Duration
+		valid  bool
+	}{
+		{"freshnet within the limit", &chaincfg.FreshNetParams, 3*time.Minute - 10*time.Second, true},
+		{"freshnet past the limit", &chaincfg.FreshNetParams, 3*time.Minute + 10*time.Second, false},
+		{"freshnet two hours ahead", &chaincfg.FreshNetParams, 2 * time.Hour, false},
+		{"mainnet an hour ahead", &chaincfg.MainNetParams, time.Hour, true},
+		{"mainnet past two hours", &chaincfg.MainNetParams, 2*time.Hour + 10*time.Second, false},
+	}
+	for _, test := range tests {
+		header := wire.BlockHeader{
+			Bits:      test.params.PowLimitBits,
+			Timestamp: now.Add(test.ahead),
+		}
+		err := checkBlockHeaderSanity(&header, test.params.PowLimit,
+			timeSource, MaxTimeOffset(test.params), BFNoPoWCheck)
+		if test.valid && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+		if !test.valid {
+			var ruleErr RuleError
+			if !errors.As(err, &ruleErr) || ruleErr.ErrorCode != ErrTimeTooNew {
+				t.Errorf("%s: got %v, want ErrTimeTooNew", test.name, err)
+			}
+		}
+	}
+}
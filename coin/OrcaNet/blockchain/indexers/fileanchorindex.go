@@ -0,0 +1,349 @@
+package indexers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+const (
+	// fileAnchorIndexName is the human-readable name for the index.
+	fileAnchorIndexName = "file anchor index"
+
+	// FileAnchorKeySize is the size of the keys that can be anchored.  File
+	// keys and storage contracts are identified by their SHA-256 hash.
+	FileAnchorKeySize = 32
+
+	// fileAnchorTag starts the data of every anchor output so anchors can
+	// be told apart from other uses of OP_RETURN.
+	fileAnchorTag = "ORCA"
+
+	// fileAnchorDataSize is the size of the data pushed by an anchor
+	// output: the tag, the kind and the key.
+	fileAnchorDataSize = len(fileAnchorTag) + 1 + FileAnchorKeySize
+
+	// fileAnchorIndexKeySize is the size of a key in the index bucket: the
+	// kind, the anchored key, the height and the position of the
+	// transaction in its block.
+	fileAnchorIndexKeySize = 1 + FileAnchorKeySize + 4 + 4
+
+	// fileAnchorIndexValueSize is the size of a value in the index bucket:
+	// the transaction hash and the block hash.
+	fileAnchorIndexValueSize = chainhash.HashSize * 2
+)
+
+// FileAnchorKind identifies what an anchored key refers to.
+type FileAnchorKind byte
+
+const (
+	// FileAnchorFile anchors the key of a file.
+	FileAnchorFile FileAnchorKind = 1
+
+	// FileAnchorContract anchors the hash of a storage contract.
+	FileAnchorContract FileAnchorKind = 2
+)
+
+// String returns the name of the kind as used by the searchfileanchors RPC.
+func (k FileAnchorKind) String() string {
+	switch k {
+	case FileAnchorFile:
+		return "file"
+	case FileAnchorContract:
+		return "contract"
+	}
+	return fmt.Sprintf("unknown(%d)", byte(k))
+}
+
+// ParseFileAnchorKind returns the kind with the passed name.
+func ParseFileAnchorKind(name string) (FileAnchorKind, error) {
+	switch name {
+	case "file":
+		return FileAnchorFile, nil
+	case "contract":
+		return FileAnchorContract, nil
+	}
+	return 0, fmt.Errorf("unknown file anchor kind %q", name)
+}
+
+var (
+	// fileAnchorIndexKey is the key of the file anchor index and the db
+	// bucket used to house it.
+	fileAnchorIndexKey = []byte("fileanchoridx")
+)
+
+// -----------------------------------------------------------------------------
+// A file anchor is a transaction output with a public key script of the form:
+//
+//   OP_RETURN <"ORCA"><kind><key>
+//
+//   Field           Type              Size
+//   tag             [4]byte           4 bytes
+//   kind            FileAnchorKind    1 byte
+//   key             [32]byte          32 bytes
+//
+// The output carries no coins.  Since the transaction is mined in a block, its
+// block gives a tamper-proof "first published at" time for the key, which
+// doesn't depend on the DHT.
+//
+// The index has an entry for every anchor output in the main chain.  Entries
+// are sorted by kind, key, height and position within the block, so all the
+// anchors of a key are next to each other, the oldest first.
+//
+// The serialized format for the keys and values in the file anchor bucket is:
+//
+//   <kind><key><height><tx index> = <txhash><block hash>
+//
+//   Field           Type              Size
+//   kind            FileAnchorKind    1 byte
+//   key             [32]byte          32 bytes
+//   height          uint32            4 bytes (big endian)
+//   tx index        uint32            4 bytes (big endian)
+//   txhash          chainhash.Hash    32 bytes
+//   block hash      chainhash.Hash    32 bytes
+//   -----
+//   Total: 105 bytes
+// -----------------------------------------------------------------------------
+
+// FileAnchorScript returns a public key script anchoring key with the passed
+// kind.  It's meant for a zero value output.
+func FileAnchorScript(kind FileAnchorKind, key [FileAnchorKeySize]byte) ([]byte, error) {
+	data := make([]byte, 0, fileAnchorDataSize)
+	data = append(data, fileAnchorTag...)
+	data = append(data, byte(kind))
+	data = append(data, key[:]...)
+	return txscript.NullDataScript(data)
+}
+
+// ExtractFileAnchor returns the kind and key anchored by the passed public key
+// script.  The last return value is false when the script is not an anchor.
+func ExtractFileAnchor(pkScript []byte) (FileAnchorKind, [FileAnchorKeySize]byte, bool) {
+	var key [FileAnchorKeySize]byte
+	if !txscript.IsNullData(pkScript) {
+		return 0, key, false
+	}
+	pushes, err := txscript.PushedData(pkScript)
+	if err != nil || len(pushes) != 1 {
+		return 0, key, false
+	}
+	data := pushes[0]
+	if len(data) != fileAnchorDataSize || !bytes.HasPrefix(data, []byte(fileAnchorTag)) {
+		return 0, key, false
+	}
+	kind := FileAnchorKind(data[len(fileAnchorTag)])
+	if kind != FileAnchorFile && kind != FileAnchorContract {
+		return 0, key, false
+	}
+	copy(key[:], data[len(fileAnchorTag)+1:])
+	return kind, key, true
+}
+
+// FileAnchor is an anchor of a key found in the main chain.
+type FileAnchor struct {
+	Kind      FileAnchorKind
+	Key       [FileAnchorKeySize]byte
+	TxHash    chainhash.Hash
+	BlockHash chainhash.Hash
+	Height    int32
+}
+
+// fileAnchorPrefix returns the prefix shared by the index keys of all the
+// anchors of key.
+func fileAnchorPrefix(kind FileAnchorKind, key *[FileAnchorKeySize]byte) []byte {
+	prefix := make([]byte, 1+FileAnchorKeySize, fileAnchorIndexKeySize)
+	prefix[0] = byte(kind)
+	copy(prefix[1:], key[:])
+	return prefix
+}
+
+// serializeFileAnchorKey returns the key of the index entry for an anchor of key
+// in the transaction at position txIdx of the block at height.
+func serializeFileAnchorKey(kind FileAnchorKind, key *[FileAnchorKeySize]byte,
+	height int32, txIdx int) []byte {
+
+	serialized := fileAnchorPrefix(kind, key)
+	serialized = serialized[:fileAnchorIndexKeySize]
+	binary.BigEndian.PutUint32(serialized[1+FileAnchorKeySize:], uint32(height))
+	binary.BigEndian.PutUint32(serialized[1+FileAnchorKeySize+4:], uint32(txIdx))
+	return serialized
+}
+
+// deserializeFileAnchor returns the anchor of an index entry.
+func deserializeFileAnchor(k, v []byte) (FileAnchor, error) {
+	var anchor FileAnchor
+	if len(k) != fileAnchorIndexKeySize || len(v) != fileAnchorIndexValueSize {
+		return anchor, errDeserialize("unexpected file anchor entry size")
+	}
+	anchor.Kind = FileAnchorKind(k[0])
+	copy(anchor.Key[:], k[1:1+FileAnchorKeySize])
+	anchor.Height = int32(binary.BigEndian.Uint32(k[1+FileAnchorKeySize:]))
+	copy(anchor.TxHash[:], v[:chainhash.HashSize])
+	copy(anchor.BlockHash[:], v[chainhash.HashSize:])
+	return anchor, nil
+}
+
+// fileAnchorEntries calls fn with the index key of every anchor output in the
+// passed block, an output anchoring the same key twice in a transaction is
+// only passed once.
+func fileAnchorEntries(block *btcutil.Block, fn func(k []byte, txHash *chainhash.Hash) error) error {
+	for txIdx, tx := range block.Transactions() {
+		seen := make(map[string]struct{})
+		for _, txOut := range tx.MsgTx().TxOut {
+			kind, key, ok := ExtractFileAnchor(txOut.PkScript)
+			if !ok {
+				continue
+			}
+			k := serializeFileAnchorKey(kind, &key, block.Height(), txIdx)
+			if _, ok := seen[string(k)]; ok {
+				continue
+			}
+			seen[string(k)] = struct{}{}
+			if err := fn(k, tx.Hash()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// FileAnchorIndex implements an index of the keys anchored by OP_RETURN outputs
+// of the form described above, to the transactions and blocks that anchored
+// them.
+type FileAnchorIndex struct {
+	db database.DB
+}
+
+// Ensure the FileAnchorIndex type implements the Indexer interface.
+var _ Indexer = (*FileAnchorIndex)(nil)
+
+// Init is only provided to satisfy the Indexer interface as there is nothing to
+// initialize for this index.
+//
+// This is part of the Indexer interface.
+func (idx *FileAnchorIndex) Init() error {
+	return nil
+}
+
+// Key returns the database key to use for the index as a byte slice.
+//
+// This is part of the Indexer interface.
+func (idx *FileAnchorIndex) Key() []byte {
+	return fileAnchorIndexKey
+}
+
+// Name returns the human-readable name of the index.
+//
+// This is part of the Indexer interface.
+func (idx *FileAnchorIndex) Name() string {
+	return fileAnchorIndexName
+}
+
+// Create is invoked when the indexer manager determines the index needs to be
+// created for the first time.  It creates the bucket for the file anchor index.
+//
+// This is part of the Indexer interface.
+func (idx *FileAnchorIndex) Create(dbTx database.Tx) error {
+	_, err := dbTx.Metadata().CreateBucket(fileAnchorIndexKey)
+	return err
+}
+
+// ConnectBlock is invoked by the index manager when a new block has been
+// connected to the main chain.  This indexer adds an entry for every anchor
+// output in the passed block.
+//
+// This is part of the Indexer interface.
+func (idx *FileAnchorIndex) ConnectBlock(dbTx database.Tx, block *btcutil.Block,
+	stxos []blockchain.SpentTxOut) error {
+
+	bucket := dbTx.Metadata().Bucket(fileAnchorIndexKey)
+	return fileAnchorEntries(block, func(k []byte, txHash *chainhash.Hash) error {
+		v := make([]byte, fileAnchorIndexValueSize)
+		copy(v, txHash[:])
+		copy(v[chainhash.HashSize:], block.Hash()[:])
+		return bucket.Put(k, v)
+	})
+}
+
+// DisconnectBlock is invoked by the index manager when a block has been
+// disconnected from the main chain.  This indexer removes the entries of the
+// anchor outputs in the passed block.
+//
+// This is part of the Indexer interface.
+func (idx *FileAnchorIndex) DisconnectBlock(dbTx database.Tx, block *btcutil.Block,
+	stxos []blockchain.SpentTxOut) error {
+
+	bucket := dbTx.Metadata().Bucket(fileAnchorIndexKey)
+	return fileAnchorEntries(block, func(k []byte, txHash *chainhash.Hash) error {
+		return bucket.Delete(k)
+	})
+}
+
+// AnchorsForKey returns the anchors of key with the passed kind in the main
+// chain, the oldest first.  The first skip anchors are left out and at most
+// count are returned.
+//
+// This function is safe for concurrent access.
+func (idx *FileAnchorIndex) AnchorsForKey(kind FileAnchorKind,
+	key [FileAnchorKeySize]byte, skip, count int) ([]FileAnchor, error) {
+
+	var anchors []FileAnchor
+	prefix := fileAnchorPrefix(kind, &key)
+	err := idx.db.View(func(dbTx database.Tx) error {
+		cursor := dbTx.Metadata().Bucket(fileAnchorIndexKey).Cursor()
+		for ok := cursor.Seek(prefix); ok && len(anchors) < count; ok = cursor.Next() {
+			if !bytes.HasPrefix(cursor.Key(), prefix) {
+				break
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			anchor, err := deserializeFileAnchor(cursor.Key(), cursor.Value())
+			if err != nil {
+				return database.Error{
+					ErrorCode: database.ErrCorruption,
+					Description: fmt.Sprintf("corrupt file anchor "+
+						"index entry for %x: %v", key, err),
+				}
+			}
+			anchors = append(anchors, anchor)
+		}
+		return nil
+	})
+	return anchors, err
+}
+
+// NewFileAnchorIndex returns a new instance of an indexer that is used to create
+// a mapping of the keys anchored by OP_RETURN outputs to the transactions and
+// blocks that anchored them.
+//
+// It implements the Indexer interface which plugs into the IndexManager that in
+// turn is used by the blockchain package.  This allows the index to be
+// seamlessly maintained along with the chain.
+func NewFileAnchorIndex(db database.DB) *FileAnchorIndex {
+	return &FileAnchorIndex{db: db}
+}
+
+// DropFileAnchorIndex drops the file anchor index from the provided database if
+// it exists.
+func DropFileAnchorIndex(db database.DB, interrupt <-chan struct{}) error {
+	return dropIndex(db, fileAnchorIndexKey, fileAnchorIndexName, interrupt)
+}
+
+// FileAnchorIndexInitialized returns true if the file anchor index has been
+// created previously.
+func FileAnchorIndexInitialized(db database.DB) bool {
+	var exists bool
+	db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(fileAnchorIndexKey)
+		exists = bucket != nil
+		return nil
+	})
+
+	return exists
+}
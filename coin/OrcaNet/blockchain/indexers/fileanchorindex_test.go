@@ -0,0 +1,107 @@
+package indexers
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// TestFileAnchorScript ensures anchor scripts are recognized and other null
+// data scripts are not.
+func TestFileAnchorScript(t *testing.T) {
+	t.Parallel()
+
+	var key [FileAnchorKeySize]byte
+	for i := range key {
+		key[i] = byte(i)
+	}
+	for _, kind := range []FileAnchorKind{FileAnchorFile, FileAnchorContract} {
+		script, err := FileAnchorScript(kind, key)
+		if err != nil {
+			t.Fatalf("FileAnchorScript(%v): %v", kind, err)
+		}
+		gotKind, gotKey, ok := ExtractFileAnchor(script)
+		if !ok || gotKind != kind || gotKey != key {
+			t.Errorf("ExtractFileAnchor(%v) = %v, %x, %v", kind,
+				gotKind, gotKey, ok)
+		}
+	}
+
+	data := append([]byte(fileAnchorTag), byte(FileAnchorFile))
+	data = append(data, key[:]...)
+	nullData := func(data []byte) []byte {
+		script, err := txscript.NullDataScript(data)
+		if err != nil {
+			t.Fatalf("NullDataScript: %v", err)
+		}
+		return script
+	}
+	tests := []struct {
+		name   string
+		script []byte
+	}{
+		{"no data", nullData(nil)},
+		{"short key", nullData(data[:len(data)-1])},
+		{"long key", nullData(append(data, 0))},
+		{"other tag", nullData(append([]byte("ORCB"), data[4:]...))},
+		{"unknown kind", nullData(append(append([]byte(fileAnchorTag), 3), key[:]...))},
+		{"not null data", append([]byte{txscript.OP_TRUE}, data...)},
+	}
+	for _, test := range tests {
+		if _, _, ok := ExtractFileAnchor(test.script); ok {
+			t.Errorf("%s: script was taken for an anchor", test.name)
+		}
+	}
+}
+
+// TestFileAnchorSerialization ensures index entries round trip and that the
+// keys of the anchors of a key sort by height, then position in the block.
+func TestFileAnchorSerialization(t *testing.T) {
+	t.Parallel()
+
+	var key, otherKey [FileAnchorKeySize]byte
+	key[0] = 1
+	otherKey[0] = 2
+	want := FileAnchor{
+		Kind:      FileAnchorContract,
+		Key:       key,
+		TxHash:    chainhash.Hash{3},
+		BlockHash: chainhash.Hash{4},
+		Height:    300,
+	}
+	k := serializeFileAnchorKey(want.Kind, &want.Key, want.Height, 7)
+	v := append(want.TxHash[:], want.BlockHash[:]...)
+	got, err := deserializeFileAnchor(k, v)
+	if err != nil {
+		t.Fatalf("deserializeFileAnchor: %v", err)
+	}
+	if got != want {
+		t.Errorf("deserializeFileAnchor = %+v, want %+v", got, want)
+	}
+	if _, err := deserializeFileAnchor(k[:len(k)-1], v); !isDeserializeErr(err) {
+		t.Errorf("short key deserialized with %v", err)
+	}
+
+	prefix := fileAnchorPrefix(FileAnchorContract, &key)
+	ordered := [][]byte{
+		serializeFileAnchorKey(FileAnchorContract, &key, 2, 9),
+		serializeFileAnchorKey(FileAnchorContract, &key, 256, 1),
+		serializeFileAnchorKey(FileAnchorContract, &key, 256, 2),
+		serializeFileAnchorKey(FileAnchorContract, &otherKey, 1, 0),
+	}
+	for i := 1; i < len(ordered); i++ {
+		if bytes.Compare(ordered[i-1], ordered[i]) >= 0 {
+			t.Errorf("key %d doesn't sort before key %d", i-1, i)
+		}
+	}
+	for i, k := range ordered {
+		if bytes.HasPrefix(k, prefix) != (i < 3) {
+			t.Errorf("key %d prefix match is wrong", i)
+		}
+	}
+	if bytes.HasPrefix(serializeFileAnchorKey(FileAnchorFile, &key, 2, 9), prefix) {
+		t.Error("file anchor matches the prefix of a contract anchor")
+	}
+}
@@ -65,6 +65,16 @@ var (
 	block91880Hash = newHashFromStr("00000000000743f190a18c5577a3c2d2a1f610ae9601ac046a38084ccb7cd721")
 )
 
+// MaxTimeOffset returns how far ahead of the current time a block time is
+// allowed to be on the network, MaxTimeOffsetSeconds unless the network sets
+// its own limit.
+func MaxTimeOffset(params *chaincfg.Params) time.Duration {
+	if params.MaxTimeOffset != 0 {
+		return params.MaxTimeOffset
+	}
+	return time.Second * MaxTimeOffsetSeconds
+}
+
 // isNullOutpoint determines whether or not a previous transaction output point
 // is set.
 func isNullOutpoint(outpoint *wire.OutPoint) bool {
@@ -435,6 +445,16 @@ func CountP2SHSigOps(tx *btcutil.Tx, isCoinBaseTx bool, utxoView *UtxoViewpoint)
 func CheckBlockHeaderSanity(header *wire.BlockHeader, powLimit *big.Int,
 	timeSource MedianTimeSource, flags BehaviorFlags) error {
 
+	return checkBlockHeaderSanity(header, powLimit, timeSource,
+		time.Second*MaxTimeOffsetSeconds, flags)
+}
+
+// checkBlockHeaderSanity performs the checks of CheckBlockHeaderSanity, with
+// block times allowed up to maxTimeOffset ahead of the current time.
+func checkBlockHeaderSanity(header *wire.BlockHeader, powLimit *big.Int,
+	timeSource MedianTimeSource, maxTimeOffset time.Duration,
+	flags BehaviorFlags) error {
+
 	// Ensure the proof of work bits in the block header is in min/max range
 	// and the block hash is less than the target value described by the
 	// bits.
@@ -455,8 +475,7 @@ func CheckBlockHeaderSanity(header *wire.BlockHeader, powLimit *big.Int,
 	}
 
 	// Ensure the block time is not too far in the future.
-	maxTimestamp := timeSource.AdjustedTime().Add(time.Second *
-		MaxTimeOffsetSeconds)
+	maxTimestamp := timeSource.AdjustedTime().Add(maxTimeOffset)
 	if header.Timestamp.After(maxTimestamp) {
 		str := fmt.Sprintf("block timestamp of %v is too far in the "+
 			"future", header.Timestamp)
@@ -471,10 +490,10 @@ func CheckBlockHeaderSanity(header *wire.BlockHeader, powLimit *big.Int,
 //
 // The flags do not modify the behavior of this function directly, however they
 // are needed to pass along to checkBlockHeaderSanity.
-func checkBlockSanity(block *btcutil.Block, powLimit *big.Int, timeSource MedianTimeSource, flags BehaviorFlags) error {
+func checkBlockSanity(block *btcutil.Block, powLimit *big.Int, timeSource MedianTimeSource, maxTimeOffset time.Duration, flags BehaviorFlags) error {
 	msgBlock := block.MsgBlock()
 	header := &msgBlock.Header
-	err := CheckBlockHeaderSanity(header, powLimit, timeSource, flags)
+	err := checkBlockHeaderSanity(header, powLimit, timeSource, maxTimeOffset, flags)
 	if err != nil {
 		return err
 	}
@@ -578,7 +597,8 @@ func checkBlockSanity(block *btcutil.Block, powLimit *big.Int, timeSource Median
 // CheckBlockSanity performs some preliminary checks on a block to ensure it is
 // sane before continuing with block processing.  These checks are context free.
 func CheckBlockSanity(block *btcutil.Block, powLimit *big.Int, timeSource MedianTimeSource) error {
-	return checkBlockSanity(block, powLimit, timeSource, BFNone)
+	return checkBlockSanity(block, powLimit, timeSource,
+		time.Second*MaxTimeOffsetSeconds, BFNone)
 }
 
 // ExtractCoinbaseHeight attempts to extract the height of the block from the
@@ -1320,7 +1340,8 @@ func (b *BlockChain) CheckConnectBlockTemplate(block *btcutil.Block) error {
 		return ruleError(ErrPrevBlockNotBest, str)
 	}
 
-	err := checkBlockSanity(block, b.chainParams.PowLimit, b.timeSource, flags)
+	err := checkBlockSanity(block, b.chainParams.PowLimit, b.timeSource,
+		MaxTimeOffset(b.chainParams), flags)
 	if err != nil {
 		return err
 	}
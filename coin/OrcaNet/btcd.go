@@ -156,6 +156,14 @@ func btcdMain(serverChan chan<- *server) error {
 
 		return nil
 	}
+	if cfg.DropFileAnchorIndex {
+		if err := indexers.DropFileAnchorIndex(db, interrupt); err != nil {
+			btcdLog.Errorf("%v", err)
+			return err
+		}
+
+		return nil
+	}
 
 	// Check if the database had previously been pruned.  If it had been, it's
 	// not possible to newly generate the tx index and addr index.
@@ -189,6 +197,15 @@ func btcdMain(serverChan chan<- *server) error {
 		btcdLog.Errorf("%v", err)
 		return err
 	}
+	// The file anchor index keeps up with a pruned node once it exists, but
+	// building it needs every block since genesis.
+	if beenPruned && cfg.FileAnchorIndex && !indexers.FileAnchorIndexInitialized(db) {
+		err = fmt.Errorf("--fileanchorindex cannot be enabled as the node has been "+
+			"previously pruned. You must delete the files in the datadir: \"%s\" "+
+			"and sync from the beginning to enable the desired index", cfg.DataDir)
+		btcdLog.Errorf("%v", err)
+		return err
+	}
 	// If we've previously been pruned and the cfindex isn't present, it means that the
 	// user wants to enable the cfindex after the node has already synced up and been
 	// pruned.
@@ -128,6 +128,39 @@ func NewGetHeadersCmd(blockLocators []string, hashStop string) *GetHeadersCmd {
 	}
 }
 
+// GetStratumInfoCmd defines the getstratuminfo JSON-RPC command.  This
+// command is not a standard Bitcoin command.  It is an extension for OrcaNet.
+type GetStratumInfoCmd struct{}
+
+// NewGetStratumInfoCmd returns a new instance which can be used to issue a
+// getstratuminfo JSON-RPC command.
+func NewGetStratumInfoCmd() *GetStratumInfoCmd {
+	return &GetStratumInfoCmd{}
+}
+
+// SearchFileAnchorsCmd defines the searchfileanchors JSON-RPC command.  This
+// command is not a standard Bitcoin command.  It is an extension for OrcaNet.
+type SearchFileAnchorsCmd struct {
+	Key   string
+	Kind  *string `jsonrpcdefault:"\"file\"" jsonrpcusage:"\"file|contract\""`
+	Skip  *int    `jsonrpcdefault:"0"`
+	Count *int    `jsonrpcdefault:"100"`
+}
+
+// NewSearchFileAnchorsCmd returns a new instance which can be used to issue a
+// searchfileanchors JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewSearchFileAnchorsCmd(key string, kind *string, skip, count *int) *SearchFileAnchorsCmd {
+	return &SearchFileAnchorsCmd{
+		Key:   key,
+		Kind:  kind,
+		Skip:  skip,
+		Count: count,
+	}
+}
+
 // VersionCmd defines the version JSON-RPC command.
 //
 // NOTE: This is a btcsuite extension ported from
@@ -152,5 +185,7 @@ func init() {
 	MustRegisterCmd("getbestblock", (*GetBestBlockCmd)(nil), flags)
 	MustRegisterCmd("getcurrentnet", (*GetCurrentNetCmd)(nil), flags)
 	MustRegisterCmd("getheaders", (*GetHeadersCmd)(nil), flags)
+	MustRegisterCmd("getstratuminfo", (*GetStratumInfoCmd)(nil), flags)
+	MustRegisterCmd("searchfileanchors", (*SearchFileAnchorsCmd)(nil), flags)
 	MustRegisterCmd("version", (*VersionCmd)(nil), flags)
 }
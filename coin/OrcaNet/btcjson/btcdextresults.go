@@ -18,3 +18,63 @@ type VersionResult struct {
 	Prerelease    string `json:"prerelease"`
 	BuildMetadata string `json:"buildmetadata"`
 }
+
+// SearchFileAnchorsResult models an anchor returned by the searchfileanchors
+// command.  This is an extension for OrcaNet.
+type SearchFileAnchorsResult struct {
+	Kind          string `json:"kind"`
+	Key           string `json:"key"`
+	TxID          string `json:"txid"`
+	BlockHash     string `json:"blockhash"`
+	Height        int32  `json:"height"`
+	BlockTime     int64  `json:"blocktime"`
+	Confirmations int64  `json:"confirmations"`
+}
+
+// StratumWorkerResult models a worker of the stratum pool returned by the
+// getstratuminfo command.
+type StratumWorkerResult struct {
+	Name         string  `json:"name"`
+	Address      string  `json:"address"`
+	Connected    bool    `json:"connected"`
+	Accepted     uint64  `json:"accepted"`
+	Rejected     uint64  `json:"rejected"`
+	Stale        uint64  `json:"stale"`
+	Blocks       uint64  `json:"blocks"`
+	LastShare    int64   `json:"lastshare"`
+	HashesPerSec float64 `json:"hashespersec"`
+}
+
+// StratumBlockResult models a block found by the stratum pool returned by the
+// getstratuminfo command.
+type StratumBlockResult struct {
+	Hash    string             `json:"hash"`
+	Height  int32              `json:"height"`
+	Time    int64              `json:"time"`
+	Reward  float64            `json:"reward"`
+	Fee     float64            `json:"fee"`
+	Status  string             `json:"status"`
+	Credits map[string]float64 `json:"credits"`
+}
+
+// StratumPayoutResult models a payout of the stratum pool returned by the
+// getstratuminfo command.
+type StratumPayoutResult struct {
+	TxID    string             `json:"txid"`
+	Time    int64              `json:"time"`
+	Amounts map[string]float64 `json:"amounts"`
+}
+
+// GetStratumInfoResult models the data returned from the getstratuminfo
+// command.  This is an extension for OrcaNet.
+type GetStratumInfoResult struct {
+	Listeners         []string              `json:"listeners"`
+	Clients           int                   `json:"clients"`
+	Height            int32                 `json:"height"`
+	Difficulty        float64               `json:"difficulty"`
+	NetworkDifficulty float64               `json:"networkdifficulty"`
+	Workers           []StratumWorkerResult `json:"workers"`
+	Blocks            []StratumBlockResult  `json:"blocks"`
+	Balances          map[string]float64    `json:"balances"`
+	Payouts           []StratumPayoutResult `json:"payouts"`
+}
@@ -908,6 +908,7 @@ func NewBitcoindSendRawTransactionCmd(hexTx string, maxFeeRate int32) *SendRawTr
 type SetGenerateCmd struct {
 	Generate     bool
 	GenProcLimit *int `jsonrpcdefault:"-1"`
+	MiningAddr   *string
 }
 
 // NewSetGenerateCmd returns a new instance which can be used to issue a
@@ -915,10 +916,11 @@ type SetGenerateCmd struct {
 //
 // The parameters which are pointers indicate they are optional.  Passing nil
 // for optional parameters will use the default value.
-func NewSetGenerateCmd(generate bool, genProcLimit *int) *SetGenerateCmd {
+func NewSetGenerateCmd(generate bool, genProcLimit *int, miningAddr *string) *SetGenerateCmd {
 	return &SetGenerateCmd{
 		Generate:     generate,
 		GenProcLimit: genProcLimit,
+		MiningAddr:   miningAddr,
 	}
 }
 
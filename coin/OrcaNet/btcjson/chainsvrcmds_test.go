@@ -1276,7 +1276,7 @@ func TestChainSvrCmds(t *testing.T) {
 				return btcjson.NewCmd("setgenerate", true)
 			},
 			staticCmd: func() interface{} {
-				return btcjson.NewSetGenerateCmd(true, nil)
+				return btcjson.NewSetGenerateCmd(true, nil, nil)
 			},
 			marshalled: `{"jsonrpc":"1.0","method":"setgenerate","params":[true],"id":1}`,
 			unmarshalled: &btcjson.SetGenerateCmd{
@@ -1290,7 +1290,7 @@ func TestChainSvrCmds(t *testing.T) {
 				return btcjson.NewCmd("setgenerate", true, 6)
 			},
 			staticCmd: func() interface{} {
-				return btcjson.NewSetGenerateCmd(true, btcjson.Int(6))
+				return btcjson.NewSetGenerateCmd(true, btcjson.Int(6), nil)
 			},
 			marshalled: `{"jsonrpc":"1.0","method":"setgenerate","params":[true,6],"id":1}`,
 			unmarshalled: &btcjson.SetGenerateCmd{
@@ -1298,6 +1298,21 @@ func TestChainSvrCmds(t *testing.T) {
 				GenProcLimit: btcjson.Int(6),
 			},
 		},
+		{
+			name: "setgenerate mining address",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("setgenerate", true, 2, "1Address")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewSetGenerateCmd(true, btcjson.Int(2), btcjson.String("1Address"))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"setgenerate","params":[true,2,"1Address"],"id":1}`,
+			unmarshalled: &btcjson.SetGenerateCmd{
+				Generate:     true,
+				GenProcLimit: btcjson.Int(2),
+				MiningAddr:   btcjson.String("1Address"),
+			},
+		},
 		{
 			name: "signmessagewithprivkey",
 			newCmd: func() (interface{}, error) {
@@ -681,18 +681,19 @@ type Vout struct {
 
 // GetMiningInfoResult models the data from the getmininginfo command.
 type GetMiningInfoResult struct {
-	Blocks             int64   `json:"blocks"`
-	CurrentBlockSize   uint64  `json:"currentblocksize"`
-	CurrentBlockWeight uint64  `json:"currentblockweight"`
-	CurrentBlockTx     uint64  `json:"currentblocktx"`
-	Difficulty         float64 `json:"difficulty"`
-	Errors             string  `json:"errors"`
-	Generate           bool    `json:"generate"`
-	GenProcLimit       int32   `json:"genproclimit"`
-	HashesPerSec       float64 `json:"hashespersec"`
-	NetworkHashPS      float64 `json:"networkhashps"`
-	PooledTx           uint64  `json:"pooledtx"`
-	TestNet            bool    `json:"testnet"`
+	Blocks             int64    `json:"blocks"`
+	CurrentBlockSize   uint64   `json:"currentblocksize"`
+	CurrentBlockWeight uint64   `json:"currentblockweight"`
+	CurrentBlockTx     uint64   `json:"currentblocktx"`
+	Difficulty         float64  `json:"difficulty"`
+	Errors             string   `json:"errors"`
+	Generate           bool     `json:"generate"`
+	GenProcLimit       int32    `json:"genproclimit"`
+	HashesPerSec       float64  `json:"hashespersec"`
+	MiningAddrs        []string `json:"miningaddrs,omitempty"`
+	NetworkHashPS      float64  `json:"networkhashps"`
+	PooledTx           uint64   `json:"pooledtx"`
+	TestNet            bool     `json:"testnet"`
 }
 
 // GetWorkResult models the data from the getwork command.
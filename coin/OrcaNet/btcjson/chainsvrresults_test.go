@@ -207,7 +207,7 @@ func TestChainSvrMiningInfoResults(t *testing.T) {
 				test.name, err)
 			continue
 		}
-		if miningInfoResult != test.expected {
+		if !reflect.DeepEqual(miningInfoResult, test.expected) {
 			t.Errorf("Test #%d (%s) unexpected marhsalled data - "+
 				"got %+v, want %+v", i, test.name, miningInfoResult,
 				test.expected)
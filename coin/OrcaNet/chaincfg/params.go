@@ -27,7 +27,9 @@ var (
 	// have for the main network.  It is the value 2^224 - 1.
 	mainPowLimit = new(big.Int).Sub(new(big.Int).Lsh(bigOne, 224), bigOne)
 
-	freshNetPowLimit = mainPowLimit
+	// freshNetPowLimit is the highest proof of work value a block can have
+	// for the fresh network.  It is the value 2^255 - 1.
+	freshNetPowLimit = new(big.Int).Sub(new(big.Int).Lsh(bigOne, 255), bigOne)
 
 	// regressionPowLimit is the highest proof of work value a Bitcoin block
 	// can have for the regression test network.  It is the value 2^255 - 1.
@@ -190,6 +192,20 @@ type Params struct {
 	// regtest like networks.
 	PoWNoRetargeting bool
 
+	// LWMAWindow, when non-zero, retargets the difficulty for every block
+	// with a linearly weighted moving average (LWMA-1) of the targets and
+	// solve times of this many previous blocks, instead of once every
+	// TargetTimespan.  It follows quick changes in hashrate, which suits
+	// small networks whose miners come and go.
+	LWMAWindow int64
+
+	// MaxTimeOffset, when non-zero, is how far ahead of the current time a
+	// block time may be, instead of the two hours of the Bitcoin rules.
+	// Networks retargeting with LWMA keep it to a few block times, since
+	// every block after a block dated in the future counts as solved in a
+	// second until the clock catches up with it.
+	MaxTimeOffset time.Duration
+
 	// These fields define the block heights at which the specified softfork
 	// BIP became active.
 	BIP0034Height int32
@@ -550,42 +566,53 @@ var FreshNetParams = Params{
 	// Chain parameters
 	GenesisBlock: &freshNetGenesisBlock,
 	GenesisHash:  &freshNetGenesisHash,
+	// the network is mined by a handful of CPUs, so the easiest difficulty is the
+	// one of the genesis block and the LWMA retarget below raises it from there
 	PowLimit:     freshNetPowLimit,
-	// determines how difficult to mine
-	PowLimitBits:  0x1d00ffff,
-	BIP0034Height: 227931, // 000000000000024b89b42a942fe0d9fea3bb44ab7bd1b19115dd6a759c0808b8
-	BIP0065Height: 388381, // 000000000000000004c2b624ed5d7756c508d90fd0da2c7c679febfa6c4735f0
-	BIP0066Height: 363725, // 00000000000000000379eaa19dce8c9b722d46ae6a57c2f1a988119488b50931
+	PowLimitBits: 0x207fffff,
+	// soft forks are enforced from the first block
+	BIP0034Height: 1,
+	BIP0065Height: 1,
+	BIP0066Height: 1,
 	// defines the number of confirmations required before newly mined coins can be spent.
 	// Lowering this value reduces the waiting time for miners to spend their rewards, which can incentivize mining
-	CoinbaseMaturity:         1,
-	SubsidyReductionInterval: 210000,
-	// widens the window for difficulty adjustments.
-	TargetTimespan: time.Hour * 24 * 14, // 14 days
-	// to slow down the block production rate
-	TargetTimePerBlock: time.Minute * 10, // 10 minutes
+	CoinbaseMaturity: 1,
+	// halves the reward about every 4 years like Bitcoin does, blocks are 20 times as frequent
+	SubsidyReductionInterval: 4_200_000,
+	// a block every 30 seconds, so a payment is confirmed while the download it pays for runs.
+	// The difficulty is retargeted for every block from the last LWMAWindow blocks,
+	// TargetTimespan only sets the window of the Bitcoin retarget it replaces
+	TargetTimePerBlock: time.Second * 30,
+	TargetTimespan:     time.Second * 30 * 60,
+	LWMAWindow:         60,
+	// blocks may be dated at most as far ahead as the longest solve time LWMA
+	// counts, so a block in the future only makes a few blocks after it count
+	// as solved in a second
+	MaxTimeOffset: time.Second * 30 * 6,
 
 	// controls how much the difficulty can adjust in each retargeting period.
 	// Lowering this value allows for more significant adjustments,
 	// which can help the network quickly adapt to changes in mining power or difficulty
 	RetargetAdjustmentFactor: 4, // 25% less, 400% more
-	ReduceMinDifficulty:      true,
-	MinDiffReductionTime:     0,
+	// LWMA already lowers the difficulty after slow blocks
+	ReduceMinDifficulty:  false,
+	MinDiffReductionTime: 0,
 	// can use generate command from RPC to generate blocks in lieu of standard mining procedures
-	GenerateSupported: false,
+	GenerateSupported: true,
 
 	// Checkpoints ordered from oldest to newest.
 	// these are specific blocks as the chain grows to maintain stability and security
 	Checkpoints: nil,
 
 	// Consensus rule change deployments.
-	// The miner confirmation window is defined as:
-	//   target proof of work timespan / target proof of work spacing
-	RuleChangeActivationThreshold: 1916, // 95% of MinerConfirmationWindow
-	MinerConfirmationWindow:       2016, //
+	// The miner confirmation window is 72 minutes of blocks and 75% of
+	// them have to signal a deployment to lock it in.
+	RuleChangeActivationThreshold: 108, // 75% of MinerConfirmationWindow
+	MinerConfirmationWindow:       144,
 
-	// can leave this as is, unless we want to change the consensus rules
-	// these are rules that everyone must follows to reach an agreeable state of the network
+	// CSV, segwit and taproot can be voted on from the genesis block and never
+	// expire, miners signal them by default so they activate within a few
+	// confirmation windows
 	Deployments: [DefinedDeployments]ConsensusDeployment{
 		DeploymentTestDummy: {
 			BitNumber: 28,
@@ -598,8 +625,8 @@ var FreshNetParams = Params{
 		},
 		DeploymentTestDummyMinActivation: {
 			BitNumber:                 22,
-			CustomActivationThreshold: 1815,    // Only needs 90% hash rate.
-			MinActivationHeight:       10_0000, // Can only activate after height 10k.
+			CustomActivationThreshold: 130,   // Only needs 90% hash rate.
+			MinActivationHeight:       1_000, // Can only activate after height 1000.
 			DeploymentStarter: NewMedianTimeDeploymentStarter(
 				time.Time{}, // Always available for vote
 			),
@@ -610,31 +637,29 @@ var FreshNetParams = Params{
 		DeploymentCSV: {
 			BitNumber: 0,
 			DeploymentStarter: NewMedianTimeDeploymentStarter(
-				time.Unix(1462060800, 0), // May 1st, 2016
+				time.Time{}, // Always available for vote
 			),
 			DeploymentEnder: NewMedianTimeDeploymentEnder(
-				time.Unix(1493596800, 0), // May 1st, 2017
+				time.Time{}, // Never expires
 			),
 		},
 		DeploymentSegwit: {
 			BitNumber: 1,
 			DeploymentStarter: NewMedianTimeDeploymentStarter(
-				time.Unix(1479168000, 0), // November 15, 2016 UTC
+				time.Time{}, // Always available for vote
 			),
 			DeploymentEnder: NewMedianTimeDeploymentEnder(
-				time.Unix(1510704000, 0), // November 15, 2017 UTC.
+				time.Time{}, // Never expires
 			),
 		},
 		DeploymentTaproot: {
 			BitNumber: 2,
 			DeploymentStarter: NewMedianTimeDeploymentStarter(
-				time.Unix(1619222400, 0), // April 24th, 2021 UTC.
+				time.Time{}, // Always available for vote
 			),
 			DeploymentEnder: NewMedianTimeDeploymentEnder(
-				time.Unix(1628640000, 0), // August 11th, 2021 UTC.
+				time.Time{}, // Never expires
 			),
-			CustomActivationThreshold: 1815, // 90%
-			MinActivationHeight:       709_632,
 		},
 	},
 
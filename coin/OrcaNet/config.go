@@ -68,6 +68,10 @@ const (
 	defaultTxIndex               = false
 	defaultAddrIndex             = false
 	pruneMinSize                 = 1536
+	defaultStratumPort           = "3335"
+	defaultStratumDifficulty     = 0.01
+	defaultStratumPPLNS          = 2.0
+	defaultStratumMinPayout      = 1.0
 )
 
 var (
@@ -78,6 +82,8 @@ var (
 	defaultRPCKeyFile  = filepath.Join(defaultHomeDir, "rpc.key")
 	defaultRPCCertFile = filepath.Join(defaultHomeDir, "rpc.cert")
 	defaultLogDir      = filepath.Join(defaultHomeDir, defaultLogDirname)
+
+	defaultStratumWalletCert = filepath.Join(btcutil.AppDataDir("btcwallet", false), "rpc.cert")
 )
 
 // runServiceCommand is only set to a real function on Windows.  It is used
@@ -119,8 +125,10 @@ type config struct {
 	DebugLevel           string        `short:"d" long:"debuglevel" description:"Logging level for all subsystems {trace, debug, info, warn, error, critical} -- You may also specify <subsystem>=<level>,<subsystem2>=<level>,... to set the log level for individual subsystems -- Use show to list available subsystems"`
 	DropAddrIndex        bool          `long:"dropaddrindex" description:"Deletes the address-based transaction index from the database on start up and then exits."`
 	DropCfIndex          bool          `long:"dropcfindex" description:"Deletes the index used for committed filtering (CF) support from the database on start up and then exits."`
+	DropFileAnchorIndex  bool          `long:"dropfileanchorindex" description:"Deletes the index of anchored file keys and storage contracts from the database on start up and then exits."`
 	DropTxIndex          bool          `long:"droptxindex" description:"Deletes the hash-based transaction index from the database on start up and then exits."`
 	ExternalIPs          []string      `long:"externalip" description:"Add an ip to the list of local addresses we claim to listen on to peers"`
+	FileAnchorIndex      bool          `long:"fileanchorindex" description:"Maintain an index of the file keys and storage contracts anchored by OP_RETURN outputs which makes the searchfileanchors RPC available"`
 	Generate             bool          `long:"generate" description:"Generate (mine) bitcoins using the CPU"`
 	FreeTxRelayLimit     float64       `long:"limitfreerelay" description:"Limit relay of transactions with no transaction fee to the given amount in thousands of bytes per minute"`
 	Listeners            []string      `long:"listen" description:"Add an interface/port to listen for connections (default all interfaces port: 8333, testnet: 18333)"`
@@ -153,6 +161,7 @@ type config struct {
 	RejectNonStd         bool          `long:"rejectnonstd" description:"Reject non-standard transactions regardless of the default settings for the active network."`
 	RejectReplacement    bool          `long:"rejectreplacement" description:"Reject transactions that attempt to replace existing transactions within the mempool through the Replace-By-Fee (RBF) signaling policy."`
 	RelayNonStd          bool          `long:"relaynonstd" description:"Relay non-standard transactions regardless of the default settings for the active network."`
+	REST                 bool          `long:"rest" description:"Serve the block explorer REST interface under /rest/ on the RPC listeners -- NOTE: It answers without authentication"`
 	RPCCert              string        `long:"rpccert" description:"File containing the certificate file"`
 	RPCKey               string        `long:"rpckey" description:"File containing the certificate key"`
 	RPCLimitPass         string        `long:"rpclimitpass" default-mask:"-" description:"Password for limited RPC connections"`
@@ -169,7 +178,17 @@ type config struct {
 	SigNet               bool          `long:"signet" description:"Use the signet test network"`
 	SigNetChallenge      string        `long:"signetchallenge" description:"Connect to a custom signet network defined by this challenge instead of using the global default signet test network -- Can be specified multiple times"`
 	SigNetSeedNode       []string      `long:"signetseednode" description:"Specify a seed node for the signet network instead of using the global default signet network seed nodes"`
+	StratumListeners     []string      `long:"stratum" description:"Add an interface/port to serve stratum miners on, which runs a mining pool paying the blocks found to --stratumaddr (default port: 3335)"`
+	StratumAddr          string        `long:"stratumaddr" description:"Pool address the blocks found by the stratum miners pay to -- Defaults to the first --miningaddr.  The wallet making the payouts must own it"`
+	StratumDifficulty    float64       `long:"stratumdifficulty" description:"Difficulty of the shares the stratum miners submit"`
+	StratumFee           float64       `long:"stratumfee" description:"Percent of each block reward the stratum pool keeps"`
+	StratumMinPayout     float64       `long:"stratumminpayout" description:"Smallest balance in BTC paid to a stratum miner"`
+	StratumPPLNS         float64       `long:"stratumpplns" description:"Multiple of the block difficulty worth of the last shares a block reward is split between"`
+	StratumWallet        string        `long:"stratumwallet" description:"Wallet RPC server (host:port) paying the balances of the stratum miners, using the --rpcuser and --rpcpass credentials -- Balances are not paid out when unset"`
+	StratumWalletCert    string        `long:"stratumwalletcert" description:"File containing the certificate of the stratum wallet RPC server"`
+	StratumWalletPass    string        `long:"stratumwalletpass" default-mask:"-" description:"Passphrase unlocking the stratum wallet for payouts"`
 	Freshnet 			 bool          `long:"freshnet" description:"Use the fresh test network"`
+	FreshnetOverrides    string        `long:"freshnet-overrides" description:"Comma separated name=value changes to the freshnet parameters for test deployments, e.g. blocktime=5s,lwmawindow=20 -- Every node of the deployment must use the same (blocktime, lwmawindow, powlimitbits, coinbasematurity, subsidyinterval, confirmationwindow, activationthreshold)"`
 	TestNet3             bool          `long:"testnet" description:"Use the test network"`
 	TorIsolation         bool          `long:"torisolation" description:"Enable Tor stream isolation by randomizing user credentials for each connection."`
 	TrickleInterval      time.Duration `long:"trickleinterval" description:"Minimum time between attempts to send new inventory to a connected peer"`
@@ -185,6 +204,8 @@ type config struct {
 	addCheckpoints       []chaincfg.Checkpoint
 	miningAddrs          []btcutil.Address
 	minRelayTxFee        btcutil.Amount
+	stratumAddr          btcutil.Address
+	stratumMinPayout     btcutil.Amount
 	whitelists           []*net.IPNet
 }
 
@@ -446,6 +467,10 @@ func loadConfig() (*config, []string, error) {
 		Generate:             defaultGenerate,
 		TxIndex:              defaultTxIndex,
 		AddrIndex:            defaultAddrIndex,
+		StratumDifficulty:    defaultStratumDifficulty,
+		StratumPPLNS:         defaultStratumPPLNS,
+		StratumMinPayout:     defaultStratumMinPayout,
+		StratumWalletCert:    defaultStratumWalletCert,
 	}
 
 	// Service options which are only added on Windows.
@@ -556,6 +581,25 @@ func loadConfig() (*config, []string, error) {
 	if cfg.Freshnet {
 		numNets++
 		activeNetParams = &FreshNetParams
+
+		if cfg.FreshnetOverrides != "" {
+			chainParams, err := freshNetOverrides(
+				&chaincfg.FreshNetParams, cfg.FreshnetOverrides,
+			)
+			if err != nil {
+				err := fmt.Errorf("%s: %v", funcName, err)
+				fmt.Fprintln(os.Stderr, err)
+				fmt.Fprintln(os.Stderr, usageMessage)
+				return nil, nil, err
+			}
+			activeNetParams.Params = chainParams
+		}
+	} else if cfg.FreshnetOverrides != "" {
+		str := "%s: freshnet-overrides can only be used with freshnet"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
 	}
 	if cfg.RegressionTest {
 		numNets++
@@ -935,6 +979,16 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// --fileanchorindex and --dropfileanchorindex do not mix.
+	if cfg.FileAnchorIndex && cfg.DropFileAnchorIndex {
+		err := fmt.Errorf("%s: the --fileanchorindex and "+
+			"--dropfileanchorindex options may not be activated "+
+			"at the same time", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Check mining addresses are valid and saved parsed versions.
 	cfg.miningAddrs = make([]btcutil.Address, 0, len(cfg.MiningAddrs))
 	for _, strAddr := range cfg.MiningAddrs {
@@ -967,11 +1021,68 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Check the stratum pool options when the stratum server is enabled.
+	// The blocks found by the pool pay to the first mining address unless
+	// a pool address is specified.
+	if len(cfg.StratumListeners) > 0 {
+		var err error
+		switch {
+		case cfg.StratumAddr != "":
+			cfg.stratumAddr, err = btcutil.DecodeAddress(cfg.StratumAddr,
+				activeNetParams.Params)
+			if err == nil && !cfg.stratumAddr.IsForNet(activeNetParams.Params) {
+				err = errors.New("address is on the wrong network")
+			}
+			if err != nil {
+				err = fmt.Errorf("%s: stratum address '%s' is "+
+					"invalid: %v", funcName, cfg.StratumAddr, err)
+			}
+		case len(cfg.miningAddrs) > 0:
+			cfg.stratumAddr = cfg.miningAddrs[0]
+		default:
+			err = fmt.Errorf("%s: the stratum option is set, but "+
+				"there is no stratum address or mining address "+
+				"specified", funcName)
+		}
+		if err == nil && !(cfg.StratumDifficulty > 0) {
+			err = fmt.Errorf("%s: the stratumdifficulty option must "+
+				"be positive", funcName)
+		}
+		if err == nil && !(cfg.StratumPPLNS > 0) {
+			err = fmt.Errorf("%s: the stratumpplns option must be "+
+				"positive", funcName)
+		}
+		if err == nil && !(cfg.StratumFee >= 0 && cfg.StratumFee < 100) {
+			err = fmt.Errorf("%s: the stratumfee option must be a "+
+				"percentage below 100", funcName)
+		}
+		if err == nil {
+			cfg.stratumMinPayout, err = btcutil.NewAmount(cfg.StratumMinPayout)
+			if err == nil && cfg.stratumMinPayout < 0 {
+				err = errors.New("amount is negative")
+			}
+			if err != nil {
+				err = fmt.Errorf("%s: invalid stratumminpayout: %v",
+					funcName, err)
+			}
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
 	// Add default port to all listener addresses if needed and remove
 	// duplicate addresses.
 	cfg.Listeners = normalizeAddresses(cfg.Listeners,
 		activeNetParams.DefaultPort)
 
+	// Add default port to all stratum listener addresses if needed and
+	// remove duplicate addresses.
+	cfg.StratumListeners = normalizeAddresses(cfg.StratumListeners,
+		defaultStratumPort)
+
 	// Add default port to all rpc listener addresses if needed and remove
 	// duplicate addresses.
 	cfg.RPCListeners = normalizeAddresses(cfg.RPCListeners,
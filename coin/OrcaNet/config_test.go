@@ -7,6 +7,9 @@ import (
 	"regexp"
 	"runtime"
 	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
 )
 
 var (
@@ -70,3 +73,45 @@ func TestCreateDefaultConfigFile(t *testing.T) {
 		t.Error("Could not find rpcpass in generated default config file.")
 	}
 }
+
+// TestFreshNetOverrides ensures the freshnet overrides change a copy of the
+// parameters and reject unknown or invalid settings.
+func TestFreshNetOverrides(t *testing.T) {
+	params, err := freshNetOverrides(&chaincfg.FreshNetParams,
+		"blocktime=5s, lwmawindow=20,powlimitbits=1f00ffff,confirmationwindow=40")
+	if err != nil {
+		t.Fatalf("freshNetOverrides: %v", err)
+	}
+	if params.TargetTimePerBlock != 5*time.Second || params.LWMAWindow != 20 ||
+		params.PowLimitBits != 0x1f00ffff {
+		t.Errorf("overrides not applied: %v, %d, %08x",
+			params.TargetTimePerBlock, params.LWMAWindow,
+			params.PowLimitBits)
+	}
+	if params.TargetTimespan != 100*time.Second {
+		t.Errorf("target timespan is %v, want 100s", params.TargetTimespan)
+	}
+	if params.MaxTimeOffset != 30*time.Second {
+		t.Errorf("max time offset is %v, want 6 block times",
+			params.MaxTimeOffset)
+	}
+	if params.RuleChangeActivationThreshold != 30 {
+		t.Errorf("activation threshold is %d, want 75%% of 40",
+			params.RuleChangeActivationThreshold)
+	}
+	if chaincfg.FreshNetParams.LWMAWindow == 20 {
+		t.Error("the freshnet parameters were changed")
+	}
+
+	for _, overrides := range []string{
+		"blocktime=100ms",
+		"lwmawindow=0",
+		"difficulty=1",
+		"blocktime",
+		"confirmationwindow=10,activationthreshold=11",
+	} {
+		if _, err := freshNetOverrides(&chaincfg.FreshNetParams, overrides); err == nil {
+			t.Errorf("%q was accepted", overrides)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// This file is ignored during the regular tests due to the following build tag.
+//go:build rpctest
+// +build rpctest
+
+package integration
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain/indexers"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/integration/rpctest"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSearchFileAnchors checks that the file keys anchored by mined transactions
+// are found by searchfileanchors, the oldest anchor first.
+func TestSearchFileAnchors(t *testing.T) {
+	t.Parallel()
+
+	args := []string{"--fileanchorindex"}
+	r, err := rpctest.New(&chaincfg.SimNetParams, nil, args, "")
+	require.NoError(t, err)
+	require.NoError(t, r.SetUp(true, 5))
+	t.Cleanup(func() {
+		require.NoError(t, r.TearDown())
+	})
+
+	fileKey := sha256.Sum256([]byte("file"))
+	hexKey := hex.EncodeToString(fileKey[:])
+	anchor := func(kind indexers.FileAnchorKind) string {
+		script, err := indexers.FileAnchorScript(kind, fileKey)
+		require.NoError(t, err)
+		txid, err := r.SendOutputs([]*wire.TxOut{wire.NewTxOut(0, script)}, 10)
+		require.NoError(t, err)
+		hashes, err := r.Client.Generate(1)
+		require.NoError(t, err)
+		block, err := r.Client.GetBlock(hashes[0])
+		require.NoError(t, err)
+		require.Len(t, block.Transactions, 2, "anchor was not mined")
+		return txid.String()
+	}
+
+	anchors, err := r.Client.SearchFileAnchors(hexKey, "file", 0, 100)
+	require.NoError(t, err)
+	require.Empty(t, anchors)
+
+	first := anchor(indexers.FileAnchorFile)
+	contract := anchor(indexers.FileAnchorContract)
+	second := anchor(indexers.FileAnchorFile)
+
+	anchors, err = r.Client.SearchFileAnchors(hexKey, "file", 0, 100)
+	require.NoError(t, err)
+	require.Len(t, anchors, 2)
+	require.Equal(t, first, anchors[0].TxID)
+	require.Equal(t, second, anchors[1].TxID)
+	require.Equal(t, "file", anchors[0].Kind)
+	require.Equal(t, hexKey, anchors[0].Key)
+	require.Equal(t, int64(3), anchors[0].Confirmations)
+	require.Less(t, anchors[0].Height, anchors[1].Height)
+
+	// The contract anchor of the same key is kept apart.
+	anchors, err = r.Client.SearchFileAnchors(hexKey, "contract", 0, 100)
+	require.NoError(t, err)
+	require.Len(t, anchors, 1)
+	require.Equal(t, contract, anchors[0].TxID)
+
+	// Skip and count page through the anchors.
+	anchors, err = r.Client.SearchFileAnchors(hexKey, "file", 1, 1)
+	require.NoError(t, err)
+	require.Len(t, anchors, 1)
+	require.Equal(t, second, anchors[0].TxID)
+
+	_, err = r.Client.SearchFileAnchors("abcd", "file", 0, 100)
+	require.Error(t, err, "short key was accepted")
+}
@@ -0,0 +1,87 @@
+// This file is ignored during the regular tests due to the following build tag.
+//go:build rpctest
+// +build rpctest
+
+package integration
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/integration/rpctest"
+	"github.com/stretchr/testify/require"
+)
+
+// freshNetTarget returns the target of the block with the passed hash.
+func freshNetTarget(t *testing.T, r *rpctest.Harness, hash *chainhash.Hash) *big.Int {
+	header, err := r.Client.GetBlockHeader(hash)
+	require.NoError(t, err)
+	return blockchain.CompactToBig(header.Bits)
+}
+
+// TestFreshNetRetarget checks that the freshnet LWMA retarget raises the
+// difficulty of every block while blocks come faster than the target spacing,
+// lowers it again once they come slower, and that the node rejects blocks that
+// don't meet it.
+func TestFreshNetRetarget(t *testing.T) {
+	t.Parallel()
+
+	// A short window and block time keep the test fast, the retarget works
+	// the same with the 30 second blocks and 60 block window of freshnet.
+	const window = 5
+	const blockTime = 2 * time.Second
+	args := []string{fmt.Sprintf(
+		"--freshnet-overrides=blocktime=%s,lwmawindow=%d", blockTime, window,
+	)}
+	r, err := rpctest.New(&chaincfg.FreshNetParams, nil, args, "")
+	require.NoError(t, err)
+	require.NoError(t, r.SetUp(false, 0))
+	t.Cleanup(func() {
+		require.NoError(t, r.TearDown())
+	})
+
+	// Until the chain is longer than the window every block has the
+	// easiest difficulty.
+	powLimit := blockchain.CompactToBig(chaincfg.FreshNetParams.PowLimitBits)
+	hashes, err := r.Client.Generate(window)
+	require.NoError(t, err)
+	for _, hash := range hashes {
+		require.Zero(t, freshNetTarget(t, r, hash).Cmp(powLimit),
+			"block %v is not at the minimum difficulty", hash)
+	}
+
+	// Blocks generated back to back are a second apart at most, faster
+	// than the target spacing, so each one must be harder than the last.
+	target := powLimit
+	for i := 0; i < 2*window; i++ {
+		hashes, err := r.Client.Generate(1)
+		require.NoError(t, err)
+		next := freshNetTarget(t, r, hashes[0])
+		require.Negative(t, next.Cmp(target),
+			"fast block %d is not harder than the one before", i)
+		target = next
+	}
+	fastTarget := target
+
+	// A block that ignores the retarget is rejected.
+	_, err = r.GenerateAndSubmitBlock(nil, -1, time.Time{})
+	require.Error(t, err, "block at the minimum difficulty was accepted")
+
+	// Blocks three times slower than the target spacing make the
+	// difficulty drop again.
+	for i := 0; i < window; i++ {
+		time.Sleep(3 * blockTime)
+		hashes, err = r.Client.Generate(1)
+		require.NoError(t, err)
+	}
+	slowTarget := freshNetTarget(t, r, hashes[0])
+	require.Positive(t, slowTarget.Cmp(fastTarget),
+		"slow blocks did not lower the difficulty")
+	require.Negative(t, slowTarget.Cmp(powLimit),
+		"slow blocks fell back to the minimum difficulty")
+}
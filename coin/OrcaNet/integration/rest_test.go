@@ -0,0 +1,154 @@
+// This file is ignored during the regular tests due to the following build tag.
+//go:build rpctest
+// +build rpctest
+
+package integration
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/integration/rpctest"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+)
+
+// TestREST checks the REST interface serves blocks, transactions, the
+// transactions of an address, headers and the mempool in JSON and binary.
+func TestREST(t *testing.T) {
+	t.Parallel()
+
+	args := []string{"--txindex", "--addrindex", "--rest"}
+	r, err := rpctest.New(&chaincfg.SimNetParams, nil, args, "")
+	require.NoError(t, err)
+	require.NoError(t, r.SetUp(true, 5))
+	t.Cleanup(func() {
+		require.NoError(t, r.TearDown())
+	})
+
+	config := r.RPCConfig()
+	pool := x509.NewCertPool()
+	require.True(t, pool.AppendCertsFromPEM(config.Certificates))
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: pool},
+	}}
+	get := func(path string, wantStatus int) []byte {
+		resp, err := client.Get("https://" + config.Host + "/rest/" + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, wantStatus, resp.StatusCode, "%s: %s", path, body)
+		return body
+	}
+	getJSON := func(path string, v interface{}) {
+		require.NoError(t, json.Unmarshal(get(path, http.StatusOK), v))
+	}
+
+	// Pay an address and mine the payment.
+	addr, err := r.NewAddress()
+	require.NoError(t, err)
+	script, err := txscript.PayToAddrScript(addr)
+	require.NoError(t, err)
+	txid, err := r.SendOutputs([]*wire.TxOut{wire.NewTxOut(1e8, script)}, 10)
+	require.NoError(t, err)
+	hashes, err := r.Client.Generate(1)
+	require.NoError(t, err)
+	blockHash := hashes[0]
+
+	var chainInfo btcjson.GetBlockChainInfoResult
+	getJSON("chaininfo.json", &chainInfo)
+	require.Equal(t, blockHash.String(), chainInfo.BestBlockHash)
+
+	// The block in JSON, binary and hex.
+	var block btcjson.GetBlockVerboseTxResult
+	getJSON("block/"+blockHash.String()+".json", &block)
+	require.Equal(t, blockHash.String(), block.Hash)
+	require.Len(t, block.RawTx, 2)
+	require.Equal(t, txid.String(), block.RawTx[1].Txid)
+	var noTxDetails btcjson.GetBlockVerboseResult
+	getJSON("block/notxdetails/"+blockHash.String()+".json", &noTxDetails)
+	require.Equal(t, []string{block.RawTx[0].Txid, txid.String()},
+		noTxDetails.Tx)
+	var msgBlock wire.MsgBlock
+	raw := get("block/"+blockHash.String()+".bin", http.StatusOK)
+	require.NoError(t, msgBlock.Deserialize(bytes.NewReader(raw)))
+	require.Equal(t, *blockHash, msgBlock.BlockHash())
+	hexBlock := get("block/"+blockHash.String()+".hex", http.StatusOK)
+	require.Equal(t, hex.EncodeToString(raw), strings.TrimSpace(string(hexBlock)))
+
+	// The payment is found with the transaction index.
+	var tx btcjson.TxRawResult
+	getJSON("tx/"+txid.String()+".json", &tx)
+	require.Equal(t, blockHash.String(), tx.BlockHash)
+	require.Equal(t, uint64(1), tx.Confirmations)
+	var msgTx wire.MsgTx
+	raw = get("tx/"+txid.String()+".bin", http.StatusOK)
+	require.NoError(t, msgTx.Deserialize(bytes.NewReader(raw)))
+	require.Equal(t, *txid, msgTx.TxHash())
+
+	// And with the address index.
+	var txns []btcjson.SearchRawTransactionsResult
+	getJSON("address/"+addr.EncodeAddress()+"/txs.json", &txns)
+	require.Len(t, txns, 1)
+	require.Equal(t, txid.String(), txns[0].Txid)
+	require.Equal(t, uint64(1), txns[0].Confirmations)
+	raw = get("address/"+addr.EncodeAddress()+"/txs.bin", http.StatusOK)
+	count, err := wire.ReadVarInt(bytes.NewReader(raw), 0)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), count)
+
+	// An address which was never paid has no transactions.
+	unused, err := btcutil.NewAddressPubKeyHash(
+		btcutil.Hash160([]byte("unused")), &chaincfg.SimNetParams)
+	require.NoError(t, err)
+	getJSON("address/"+unused.EncodeAddress()+"/txs.json", &txns)
+	require.Empty(t, txns)
+
+	// Headers from the genesis block on.
+	genesis := chaincfg.SimNetParams.GenesisHash.String()
+	raw = get("headers/"+genesis+".bin?count=3", http.StatusOK)
+	require.Len(t, raw, 3*wire.MaxBlockHeaderPayload)
+	var headers []btcjson.GetBlockHeaderVerboseResult
+	getJSON("headers/2/"+genesis+".json", &headers)
+	require.Len(t, headers, 2)
+	require.Equal(t, genesis, headers[0].Hash)
+	require.Equal(t, int32(1), headers[1].Height)
+	getJSON("headers/"+blockHash.String()+".json?count=10", &headers)
+	require.Len(t, headers, 1)
+
+	// An unmined payment is in the mempool.
+	txid, err = r.SendOutputs([]*wire.TxOut{wire.NewTxOut(1e8, script)}, 10)
+	require.NoError(t, err)
+	var mempoolInfo btcjson.GetMempoolInfoResult
+	getJSON("mempool/info.json", &mempoolInfo)
+	require.Equal(t, int64(1), mempoolInfo.Size)
+	var contents map[string]btcjson.GetRawMempoolVerboseResult
+	getJSON("mempool/contents.json", &contents)
+	require.Contains(t, contents, txid.String())
+	var unmined btcjson.TxRawResult
+	getJSON("tx/"+txid.String()+".json", &unmined)
+	require.Empty(t, unmined.BlockHash)
+	require.Equal(t, uint64(0), unmined.Confirmations)
+
+	// Failures.
+	get("tx/"+strings.Repeat("00", 32)+".json", http.StatusNotFound)
+	get("tx/nothex.json", http.StatusBadRequest)
+	get("tx/"+txid.String(), http.StatusBadRequest)
+	get("block/"+strings.Repeat("00", 32)+".bin", http.StatusNotFound)
+	get("address/notanaddress/txs.json", http.StatusBadRequest)
+	get("headers/"+genesis+".json?count=0", http.StatusBadRequest)
+	get("mempool/info.bin", http.StatusBadRequest)
+	get("nothing.json", http.StatusNotFound)
+}
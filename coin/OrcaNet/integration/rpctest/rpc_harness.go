@@ -141,6 +141,8 @@ func New(activeNet *chaincfg.Params, handlers *rpcclient.NotificationHandlers,
 		extraArgs = append(extraArgs, "--regtest")
 	case wire.SimNet:
 		extraArgs = append(extraArgs, "--simnet")
+	case wire.FreshNet:
+		extraArgs = append(extraArgs, "--freshnet")
 	default:
 		return nil, fmt.Errorf("rpctest.New must be called with one " +
 			"of the supported chain networks")
@@ -0,0 +1,58 @@
+// This file is ignored during the regular tests due to the following build tag.
+//go:build rpctest
+// +build rpctest
+
+package integration
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/integration/rpctest"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSetGenerateMiningAddr checks that the block templates of
+// getblocktemplate pay to the address given to setgenerate.
+func TestSetGenerateMiningAddr(t *testing.T) {
+	t.Parallel()
+
+	r, err := rpctest.New(&chaincfg.SimNetParams, nil, nil, "")
+	require.NoError(t, err)
+	require.NoError(t, r.SetUp(true, 1))
+	t.Cleanup(func() {
+		require.NoError(t, r.TearDown())
+	})
+
+	coinbasePayee := func() string {
+		template, err := r.Client.GetBlockTemplate(&btcjson.TemplateRequest{
+			Mode:         "template",
+			Capabilities: []string{"coinbasetxn"},
+		})
+		require.NoError(t, err)
+		require.NotNil(t, template.CoinbaseTxn)
+		serialized, err := hex.DecodeString(template.CoinbaseTxn.Data)
+		require.NoError(t, err)
+		var coinbase wire.MsgTx
+		require.NoError(t, coinbase.Deserialize(bytes.NewReader(serialized)))
+		_, addrs, _, err := txscript.ExtractPkScriptAddrs(
+			coinbase.TxOut[0].PkScript, &chaincfg.SimNetParams)
+		require.NoError(t, err)
+		require.Len(t, addrs, 1)
+		return addrs[0].EncodeAddress()
+	}
+	// The template is generated for the address given with --miningaddr.
+	coinbasePayee()
+
+	addr, err := btcutil.NewAddressPubKeyHash(
+		btcutil.Hash160([]byte("setgenerate")), &chaincfg.SimNetParams)
+	require.NoError(t, err)
+	require.NoError(t, r.Client.SetGenerateToAddress(false, 1, addr))
+	require.Equal(t, addr.EncodeAddress(), coinbasePayee())
+}
@@ -0,0 +1,253 @@
+// This file is ignored during the regular tests due to the following build tag.
+//go:build rpctest
+// +build rpctest
+
+package integration
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/integration/rpctest"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+)
+
+// stratumMessage is a stratum message in either direction.
+type stratumMessage struct {
+	ID     *int              `json:"id"`
+	Method string            `json:"method,omitempty"`
+	Params []json.RawMessage `json:"params,omitempty"`
+	Result json.RawMessage   `json:"result,omitempty"`
+	Error  json.RawMessage   `json:"error,omitempty"`
+}
+
+// stratumMiner is a stratum client solving work for a single worker.
+type stratumMiner struct {
+	t           *testing.T
+	conn        net.Conn
+	scanner     *bufio.Scanner
+	nextID      int
+	extraNonce1 []byte
+	notify      []json.RawMessage
+}
+
+// call sends a request and returns the response, keeping the last work
+// notified in between.
+func (m *stratumMiner) call(method string, params ...interface{}) *stratumMessage {
+	m.nextID++
+	id := m.nextID
+	request, err := json.Marshal(map[string]interface{}{
+		"id": id, "method": method, "params": params,
+	})
+	require.NoError(m.t, err)
+	_, err = m.conn.Write(append(request, '\n'))
+	require.NoError(m.t, err)
+	for {
+		msg := m.read()
+		if msg.ID != nil && *msg.ID == id {
+			return msg
+		}
+	}
+}
+
+// read reads the next message and keeps the work it notifies.
+func (m *stratumMiner) read() *stratumMessage {
+	m.conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+	require.True(m.t, m.scanner.Scan(), "stratum connection closed: %v",
+		m.scanner.Err())
+	var msg stratumMessage
+	require.NoError(m.t, json.Unmarshal(m.scanner.Bytes(), &msg))
+	if msg.Method == "mining.notify" {
+		m.notify = msg.Params
+	}
+	return &msg
+}
+
+// waitWork reads messages until new work shows up.
+func (m *stratumMiner) waitWork() {
+	for m.notify == nil {
+		m.read()
+	}
+}
+
+// solve looks for a nonce of the current work whose header hash is below the
+// block target when wantBlock is set, or above it otherwise.  It returns the
+// submit parameters and the header.
+func (m *stratumMiner) solve(wantBlock bool) ([]interface{}, wire.BlockHeader) {
+	var jobID, prevHash, coinbase1, coinbase2, version, bits, ntime string
+	var branch []string
+	for i, v := range []interface{}{&jobID, &prevHash, &coinbase1,
+		&coinbase2, &branch, &version, &bits, &ntime} {
+		require.NoError(m.t, json.Unmarshal(m.notify[i], v))
+	}
+	decode := func(s string) []byte {
+		b, err := hex.DecodeString(s)
+		require.NoError(m.t, err)
+		return b
+	}
+	word := func(s string) uint32 {
+		n, err := strconv.ParseUint(s, 16, 32)
+		require.NoError(m.t, err)
+		return uint32(n)
+	}
+
+	extraNonce2 := []byte{0, 0, 0, 1}
+	coinbase := append(decode(coinbase1), m.extraNonce1...)
+	coinbase = append(coinbase, extraNonce2...)
+	coinbase = append(coinbase, decode(coinbase2)...)
+	root := chainhash.DoubleHashH(coinbase)
+	for _, h := range branch {
+		var hash chainhash.Hash
+		copy(hash[:], decode(h))
+		root = blockchain.HashMerkleBranches(&root, &hash)
+	}
+	var prev chainhash.Hash
+	for i, b := range decode(prevHash) {
+		prev[i/4*4+3-i%4] = b
+	}
+	header := wire.BlockHeader{
+		Version:    int32(word(version)),
+		PrevBlock:  prev,
+		MerkleRoot: root,
+		Timestamp:  time.Unix(int64(word(ntime)), 0),
+		Bits:       word(bits),
+	}
+	target := blockchain.CompactToBig(header.Bits)
+	for {
+		hash := header.BlockHash()
+		if (blockchain.HashToBig(&hash).Cmp(target) <= 0) == wantBlock {
+			break
+		}
+		header.Nonce++
+	}
+	var nonce [4]byte
+	binary.BigEndian.PutUint32(nonce[:], header.Nonce)
+	return []interface{}{"", jobID, hex.EncodeToString(extraNonce2), ntime,
+		hex.EncodeToString(nonce[:])}, header
+}
+
+// TestStratum checks a stratum miner gets work, that its shares are checked
+// and that a block it solves is accepted and credited to its address.
+func TestStratum(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	stratumAddr := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	args := []string{"--stratum=" + stratumAddr, "--stratumfee=10"}
+	r, err := rpctest.New(&chaincfg.SimNetParams, nil, args, "")
+	require.NoError(t, err)
+	require.NoError(t, r.SetUp(false, 0))
+	t.Cleanup(func() {
+		require.NoError(t, r.TearDown())
+	})
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	addr, err := btcutil.NewAddressPubKeyHash(
+		btcutil.Hash160(key.PubKey().SerializeCompressed()),
+		&chaincfg.SimNetParams)
+	require.NoError(t, err)
+	worker := addr.EncodeAddress() + ".rig1"
+
+	var conn net.Conn
+	require.Eventually(t, func() bool {
+		conn, err = net.Dial("tcp", stratumAddr)
+		return err == nil
+	}, 10*time.Second, 100*time.Millisecond)
+	defer conn.Close()
+	m := &stratumMiner{t: t, conn: conn, scanner: bufio.NewScanner(conn)}
+
+	// Submitting before subscribing fails.
+	resp := m.call("mining.submit", worker, "1", "00000000", "00000000",
+		"00000000")
+	require.JSONEq(t, `[25, "Not subscribed", null]`, string(resp.Error))
+
+	resp = m.call("mining.subscribe", "test/1.0")
+	var subscription []json.RawMessage
+	require.NoError(t, json.Unmarshal(resp.Result, &subscription))
+	require.Len(t, subscription, 3)
+	var extraNonce1 string
+	require.NoError(t, json.Unmarshal(subscription[1], &extraNonce1))
+	m.extraNonce1, err = hex.DecodeString(extraNonce1)
+	require.NoError(t, err)
+	require.Len(t, m.extraNonce1, 4)
+	require.Equal(t, "4", string(subscription[2]))
+
+	resp = m.call("mining.authorize", "notanaddress", "x")
+	require.NotEqual(t, "null", string(resp.Error))
+	resp = m.call("mining.authorize", worker, "x")
+	require.Equal(t, "true", string(resp.Result))
+	if m.notify == nil {
+		m.waitWork()
+	}
+
+	// A share above the target is rejected.
+	params, _ := m.solve(false)
+	params[0] = worker
+	resp = m.call("mining.submit", params...)
+	require.JSONEq(t, `[23, "Low difficulty share", null]`,
+		string(resp.Error))
+
+	// A share which solves the block is accepted and the block is mined.
+	params, header := m.solve(true)
+	params[0] = worker
+	m.notify = nil
+	resp = m.call("mining.submit", params...)
+	require.Equal(t, "true", string(resp.Result), string(resp.Error))
+	hash, height, err := r.Client.GetBestBlock()
+	require.NoError(t, err)
+	require.Equal(t, int32(1), height)
+	require.Equal(t, header.BlockHash(), *hash)
+	block, err := r.Client.GetBlock(hash)
+	require.NoError(t, err)
+	script := block.Transactions[0].TxIn[0].SignatureScript
+	require.True(t, bytes.Contains(script, append(m.extraNonce1, 0, 0, 0, 1)))
+
+	// The work moves on to the next block, so the same share again is
+	// stale.
+	m.waitWork()
+	var clean bool
+	require.NoError(t, json.Unmarshal(m.notify[8], &clean))
+	require.True(t, clean, "new block work doesn't clean the old work")
+	resp = m.call("mining.submit", params...)
+	require.JSONEq(t, `[21, "Job not found", null]`, string(resp.Error))
+
+	raw, err := r.Client.RawRequest("getstratuminfo", nil)
+	require.NoError(t, err)
+	var info btcjson.GetStratumInfoResult
+	require.NoError(t, json.Unmarshal(raw, &info))
+	require.Equal(t, []string{stratumAddr}, info.Listeners)
+	require.Equal(t, int32(2), info.Height)
+	require.Len(t, info.Workers, 1)
+	require.Equal(t, worker, info.Workers[0].Name)
+	require.Equal(t, uint64(1), info.Workers[0].Accepted)
+	require.Equal(t, uint64(1), info.Workers[0].Rejected)
+	require.Equal(t, uint64(1), info.Workers[0].Stale)
+	require.Equal(t, uint64(1), info.Workers[0].Blocks)
+	require.Len(t, info.Blocks, 1)
+	require.Equal(t, hash.String(), info.Blocks[0].Hash)
+	require.Equal(t, "immature", info.Blocks[0].Status)
+	reward := btcutil.Amount(block.Transactions[0].TxOut[0].Value)
+	require.Equal(t, map[string]float64{
+		addr.EncodeAddress(): (reward - reward/10).ToBTC(),
+	}, info.Blocks[0].Credits, fmt.Sprintf("reward %v", reward))
+	require.Empty(t, info.Balances)
+}
@@ -57,8 +57,9 @@ type Config struct {
 	// generate block templates that the miner will attempt to solve.
 	BlockTemplateGenerator *mining.BlkTmplGenerator
 
-	// MiningAddrs is a list of payment addresses to use for the generated
-	// blocks.  Each generated block will randomly choose one of them.
+	// MiningAddrs is the initial list of payment addresses to use for the
+	// generated blocks.  Each generated block will randomly choose one of
+	// them.  The list can be replaced at runtime with SetMiningAddrs.
 	MiningAddrs []btcutil.Address
 
 	// ProcessBlock defines the function to call with any solved blocks.
@@ -94,6 +95,8 @@ type CPUMiner struct {
 	g                 *mining.BlkTmplGenerator
 	cfg               Config
 	numWorkers        uint32
+	addrsLock         sync.RWMutex
+	miningAddrs       []btcutil.Address
 	started           bool
 	discreteMining    bool
 	submitBlockLock   sync.Mutex
@@ -335,8 +338,7 @@ out:
 		}
 
 		// Choose a payment address at random.
-		rand.Seed(time.Now().UnixNano())
-		payToAddr := m.cfg.MiningAddrs[rand.Intn(len(m.cfg.MiningAddrs))]
+		payToAddr := m.payToAddr()
 
 		// Create a new block template using the available transactions
 		// in the memory pool as a source of transactions to potentially
@@ -539,6 +541,37 @@ func (m *CPUMiner) NumWorkers() int32 {
 	return int32(m.numWorkers)
 }
 
+// SetMiningAddrs replaces the payment addresses used for the generated blocks.
+// Block templates created after this call pay to one of the new addresses, so
+// a running miner picks them up without being restarted.
+//
+// This function is safe for concurrent access.
+func (m *CPUMiner) SetMiningAddrs(addrs []btcutil.Address) {
+	m.addrsLock.Lock()
+	m.miningAddrs = append([]btcutil.Address(nil), addrs...)
+	m.addrsLock.Unlock()
+}
+
+// MiningAddrs returns the payment addresses used for the generated blocks.
+//
+// This function is safe for concurrent access.
+func (m *CPUMiner) MiningAddrs() []btcutil.Address {
+	m.addrsLock.RLock()
+	defer m.addrsLock.RUnlock()
+	return append([]btcutil.Address(nil), m.miningAddrs...)
+}
+
+// payToAddr chooses one of the payment addresses at random.  It returns nil
+// when no address is configured.
+func (m *CPUMiner) payToAddr() btcutil.Address {
+	m.addrsLock.RLock()
+	defer m.addrsLock.RUnlock()
+	if len(m.miningAddrs) == 0 {
+		return nil
+	}
+	return m.miningAddrs[rand.Intn(len(m.miningAddrs))]
+}
+
 // GenerateNBlocks generates the requested number of blocks. It is self
 // contained in that it creates block templates and attempts to solve them while
 // detecting when it is performing stale work and reacting accordingly by
@@ -589,8 +622,7 @@ func (m *CPUMiner) GenerateNBlocks(n uint32) ([]*chainhash.Hash, error) {
 		curHeight := m.g.BestSnapshot().Height
 
 		// Choose a payment address at random.
-		rand.Seed(time.Now().UnixNano())
-		payToAddr := m.cfg.MiningAddrs[rand.Intn(len(m.cfg.MiningAddrs))]
+		payToAddr := m.payToAddr()
 
 		// Create a new block template using the available transactions
 		// in the memory pool as a source of transactions to potentially
@@ -634,6 +666,7 @@ func New(cfg *Config) *CPUMiner {
 	return &CPUMiner{
 		g:                 cfg.BlockTemplateGenerator,
 		cfg:               *cfg,
+		miningAddrs:       cfg.MiningAddrs,
 		numWorkers:        defaultNumWorkers,
 		updateNumWorkers:  make(chan struct{}),
 		queryHashesPerSec: make(chan float64),
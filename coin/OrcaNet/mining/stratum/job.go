@@ -0,0 +1,282 @@
+package stratum
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/mining"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// extraNonce1Size is the size of the extra nonce the server assigns to
+	// each connection so no two miners search the same coinbase.
+	extraNonce1Size = 4
+
+	// extraNonce2Size is the size of the extra nonce each miner rolls
+	// through on its own.
+	extraNonce2Size = 4
+
+	// CoinbaseFlags is added to the coinbase script of the blocks found
+	// by the pool.
+	CoinbaseFlags = "/P2SH/btcd/stratum/"
+)
+
+// diff1Target is the target of a share of difficulty 1, the difficulty unit
+// used by stratum miners: 0x00000000ffff0000...0000.
+var diff1Target = new(big.Int).Lsh(big.NewInt(0xffff), 208)
+
+// DifficultyTarget returns the largest hash a share of the passed difficulty
+// may have.
+func DifficultyTarget(difficulty float64) (*big.Int, error) {
+	if !(difficulty > 0) {
+		return nil, fmt.Errorf("share difficulty %v is not positive",
+			difficulty)
+	}
+	d := new(big.Rat).SetFloat64(difficulty)
+	if d == nil {
+		return nil, fmt.Errorf("share difficulty %v is not finite",
+			difficulty)
+	}
+	target := new(big.Rat).SetInt(diff1Target)
+	target.Quo(target, d)
+	return new(big.Int).Quo(target.Num(), target.Denom()), nil
+}
+
+// TargetDifficulty returns the share difficulty of the passed target.
+func TargetDifficulty(target *big.Int) float64 {
+	if target.Sign() <= 0 {
+		return 0
+	}
+	difficulty, _ := new(big.Rat).SetFrac(diff1Target, target).Float64()
+	return difficulty
+}
+
+// job is a unit of work handed to the miners through mining.notify.  It holds
+// the block template it was made from and the coinbase split around the extra
+// nonces.
+type job struct {
+	id       string
+	created  time.Time
+	template *mining.BlockTemplate
+	clean    bool
+
+	// coinbase1 and coinbase2 are the serialized coinbase transaction,
+	// without its witness, before and after the extra nonces.
+	coinbase1    []byte
+	coinbase2    []byte
+	merkleBranch []chainhash.Hash
+
+	// target is the target of the block, shareTarget the one of the shares
+	// which are worth difficulty.  The share target is never harder than
+	// the block target since every block must be taken as a share.
+	target      *big.Int
+	shareTarget *big.Int
+	difficulty  float64
+
+	// submitted holds the solutions already submitted for the job so a
+	// share can't be counted twice.  It is protected by the server mutex.
+	submitted map[string]struct{}
+}
+
+// newJob splits the coinbase of the passed template around the extra nonces
+// and works out the merkle branch of the coinbase.  The share difficulty is
+// lowered to the difficulty of the block when the block is easier.
+func newJob(id string, template *mining.BlockTemplate, difficulty float64) (*job, error) {
+	msgBlock := template.Block
+	if len(msgBlock.Transactions) == 0 {
+		return nil, errors.New("block template has no coinbase")
+	}
+
+	heightScript, err := txscript.NewScriptBuilder().
+		AddInt64(int64(template.Height)).Script()
+	if err != nil {
+		return nil, err
+	}
+	placeholder := make([]byte, extraNonce1Size+extraNonce2Size)
+	script, err := txscript.NewScriptBuilder().
+		AddInt64(int64(template.Height)).AddData(placeholder).
+		AddData([]byte(CoinbaseFlags)).Script()
+	if err != nil {
+		return nil, err
+	}
+	if len(script) > blockchain.MaxCoinbaseScriptLen {
+		return nil, fmt.Errorf("coinbase script length of %d is out of "+
+			"range (max: %d)", len(script), blockchain.MaxCoinbaseScriptLen)
+	}
+	coinbase := msgBlock.Transactions[0].Copy()
+	coinbase.TxIn[0].SignatureScript = script
+	var buf bytes.Buffer
+	if err := coinbase.SerializeNoWitness(&buf); err != nil {
+		return nil, err
+	}
+	raw := buf.Bytes()
+
+	// The extra nonces follow the version, the input count, the outpoint
+	// spent by the coinbase, the script length, the height and the push
+	// opcode of the placeholder.
+	offset := 4 + wire.VarIntSerializeSize(1) + 36 +
+		wire.VarIntSerializeSize(uint64(len(script))) + len(heightScript) + 1
+	if !bytes.Equal(raw[offset:offset+len(placeholder)], placeholder) {
+		return nil, errors.New("extra nonce placeholder not found in the " +
+			"coinbase")
+	}
+
+	hashes := make([]chainhash.Hash, 0, len(msgBlock.Transactions)-1)
+	for _, tx := range msgBlock.Transactions[1:] {
+		hashes = append(hashes, tx.TxHash())
+	}
+
+	target := blockchain.CompactToBig(msgBlock.Header.Bits)
+	shareTarget, err := DifficultyTarget(difficulty)
+	if err != nil {
+		return nil, err
+	}
+	if shareTarget.Cmp(target) < 0 {
+		shareTarget = target
+		difficulty = TargetDifficulty(target)
+	}
+
+	return &job{
+		id:           id,
+		created:      time.Now(),
+		template:     template,
+		coinbase1:    append([]byte(nil), raw[:offset]...),
+		coinbase2:    append([]byte(nil), raw[offset+len(placeholder):]...),
+		merkleBranch: merkleBranch(hashes),
+		target:       target,
+		shareTarget:  shareTarget,
+		difficulty:   difficulty,
+		submitted:    make(map[string]struct{}),
+	}, nil
+}
+
+// merkleBranch returns the hashes a miner combines with the hash of the
+// coinbase, in order, to get the merkle root of a block with the passed
+// transactions after the coinbase.
+func merkleBranch(hashes []chainhash.Hash) []chainhash.Hash {
+	// The coinbase is left out of each level of the tree: only the hashes
+	// to its right are combined, and the one next to it goes to the
+	// branch.
+	level := make([]*chainhash.Hash, 0, len(hashes)+1)
+	level = append(level, nil)
+	for i := range hashes {
+		level = append(level, &hashes[i])
+	}
+	var branch []chainhash.Hash
+	for len(level) > 1 {
+		branch = append(branch, *level[1])
+		if len(level)%2 != 0 {
+			level = append(level, level[len(level)-1])
+		}
+		next := make([]*chainhash.Hash, 1, len(level)/2)
+		for i := 2; i < len(level); i += 2 {
+			hash := blockchain.HashMerkleBranches(level[i], level[i+1])
+			next = append(next, &hash)
+		}
+		level = next
+	}
+	return branch
+}
+
+// merkleRoot returns the merkle root of a block with the passed coinbase hash
+// and merkle branch.
+func merkleRoot(coinbaseHash chainhash.Hash, branch []chainhash.Hash) chainhash.Hash {
+	root := coinbaseHash
+	for i := range branch {
+		root = blockchain.HashMerkleBranches(&root, &branch[i])
+	}
+	return root
+}
+
+// swapWords reverses the bytes of each 4 byte word of the passed hash, which
+// is how stratum sends the previous block hash.
+func swapWords(hash *chainhash.Hash) []byte {
+	swapped := make([]byte, chainhash.HashSize)
+	for i := 0; i < chainhash.HashSize; i += 4 {
+		for j := 0; j < 4; j++ {
+			swapped[i+j] = hash[i+3-j]
+		}
+	}
+	return swapped
+}
+
+// notifyParams returns the parameters of the mining.notify message of the job.
+func (j *job) notifyParams() []interface{} {
+	header := &j.template.Block.Header
+	branch := make([]string, 0, len(j.merkleBranch))
+	for i := range j.merkleBranch {
+		branch = append(branch, hex.EncodeToString(j.merkleBranch[i][:]))
+	}
+	return []interface{}{
+		j.id,
+		hex.EncodeToString(swapWords(&header.PrevBlock)),
+		hex.EncodeToString(j.coinbase1),
+		hex.EncodeToString(j.coinbase2),
+		branch,
+		fmt.Sprintf("%08x", uint32(header.Version)),
+		fmt.Sprintf("%08x", header.Bits),
+		fmt.Sprintf("%08x", uint32(header.Timestamp.Unix())),
+		j.clean,
+	}
+}
+
+// coinbase returns the serialized coinbase, without its witness, with the
+// passed extra nonces.
+func (j *job) coinbase(extraNonce1, extraNonce2 []byte) []byte {
+	raw := make([]byte, 0, len(j.coinbase1)+len(extraNonce1)+
+		len(extraNonce2)+len(j.coinbase2))
+	raw = append(raw, j.coinbase1...)
+	raw = append(raw, extraNonce1...)
+	raw = append(raw, extraNonce2...)
+	return append(raw, j.coinbase2...)
+}
+
+// header returns the block header of a solution of the job.
+func (j *job) header(coinbase []byte, timestamp, nonce uint32) wire.BlockHeader {
+	template := &j.template.Block.Header
+	return wire.BlockHeader{
+		Version:    template.Version,
+		PrevBlock:  template.PrevBlock,
+		MerkleRoot: merkleRoot(chainhash.DoubleHashH(coinbase), j.merkleBranch),
+		Timestamp:  time.Unix(int64(timestamp), 0),
+		Bits:       template.Bits,
+		Nonce:      nonce,
+	}
+}
+
+// block returns the block of a solution of the job.  The coinbase gets back
+// the witness of the template coinbase, which commits to the witnesses of the
+// other transactions.
+func (j *job) block(coinbase []byte, header wire.BlockHeader) (*btcutil.Block, error) {
+	var tx wire.MsgTx
+	if err := tx.DeserializeNoWitness(bytes.NewReader(coinbase)); err != nil {
+		return nil, err
+	}
+	template := j.template.Block
+	tx.TxIn[0].Witness = template.Transactions[0].TxIn[0].Witness
+	msgBlock := wire.MsgBlock{
+		Header:       header,
+		Transactions: make([]*wire.MsgTx, len(template.Transactions)),
+	}
+	msgBlock.Transactions[0] = &tx
+	copy(msgBlock.Transactions[1:], template.Transactions[1:])
+	return btcutil.NewBlock(&msgBlock), nil
+}
+
+// reward returns the value of the coinbase outputs of the job.
+func (j *job) reward() btcutil.Amount {
+	var reward int64
+	for _, out := range j.template.Block.Transactions[0].TxOut {
+		reward += out.Value
+	}
+	return btcutil.Amount(reward)
+}
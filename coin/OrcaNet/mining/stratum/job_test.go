@@ -0,0 +1,203 @@
+package stratum
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/mining"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// testTemplate returns a block template with a coinbase with a witness and
+// the passed number of other transactions.
+func testTemplate(txCount int) *mining.BlockTemplate {
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{},
+			wire.MaxPrevOutIndex),
+		SignatureScript: []byte{0x51, 0x52},
+		Sequence:        wire.MaxTxInSequenceNum,
+		Witness:         wire.TxWitness{make([]byte, 32)},
+	})
+	coinbase.AddTxOut(wire.NewTxOut(5000000000, []byte{0x51}))
+	coinbase.AddTxOut(wire.NewTxOut(1000, []byte{0x52}))
+
+	msgBlock := &wire.MsgBlock{
+		Header: wire.BlockHeader{
+			Version:   0x20000000,
+			PrevBlock: chainhash.Hash{1, 2, 3, 4, 5, 6, 7, 8},
+			Timestamp: time.Unix(1700000000, 0),
+			Bits:      0x207fffff,
+		},
+		Transactions: []*wire.MsgTx{coinbase},
+	}
+	for i := 0; i < txCount; i++ {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{byte(i)},
+			uint32(i)), nil, nil))
+		tx.AddTxOut(wire.NewTxOut(int64(i), nil))
+		msgBlock.Transactions = append(msgBlock.Transactions, tx)
+	}
+	return &mining.BlockTemplate{Block: msgBlock, Height: 1234}
+}
+
+// TestMerkleBranch ensures the merkle root worked out from the coinbase hash
+// and the branch matches the merkle root of the whole block.
+func TestMerkleBranch(t *testing.T) {
+	t.Parallel()
+
+	for txCount := 0; txCount <= 9; txCount++ {
+		msgBlock := testTemplate(txCount).Block
+		txs := make([]*btcutil.Tx, 0, len(msgBlock.Transactions))
+		hashes := make([]chainhash.Hash, 0, txCount)
+		for i, tx := range msgBlock.Transactions {
+			txs = append(txs, btcutil.NewTx(tx))
+			if i > 0 {
+				hashes = append(hashes, tx.TxHash())
+			}
+		}
+		want := blockchain.CalcMerkleRoot(txs, false)
+		got := merkleRoot(msgBlock.Transactions[0].TxHash(),
+			merkleBranch(hashes))
+		if got != want {
+			t.Errorf("%d transactions: merkle root %v, want %v",
+				txCount+1, got, want)
+		}
+	}
+}
+
+// TestJob ensures a solution of a job rebuilds a block with the extra nonces
+// in the coinbase and the witness of the template coinbase.
+func TestJob(t *testing.T) {
+	t.Parallel()
+
+	template := testTemplate(3)
+	j, err := newJob("1", template, 1)
+	if err != nil {
+		t.Fatalf("newJob: %v", err)
+	}
+
+	// The block of this template is easier than a share of difficulty 1.
+	if j.shareTarget.Cmp(j.target) != 0 {
+		t.Errorf("share target %x is not the block target %x",
+			j.shareTarget, j.target)
+	}
+
+	extraNonce1 := []byte{1, 2, 3, 4}
+	extraNonce2 := []byte{5, 6, 7, 8}
+	coinbase := j.coinbase(extraNonce1, extraNonce2)
+	header := j.header(coinbase, 1700000100, 42)
+	block, err := j.block(coinbase, header)
+	if err != nil {
+		t.Fatalf("block: %v", err)
+	}
+
+	msgBlock := block.MsgBlock()
+	tx := msgBlock.Transactions[0]
+	script := tx.TxIn[0].SignatureScript
+	if !bytes.Contains(script, append(extraNonce1, extraNonce2...)) {
+		t.Errorf("extra nonces missing from coinbase script %x", script)
+	}
+	if !bytes.HasSuffix(script, []byte(CoinbaseFlags)) {
+		t.Errorf("coinbase flags missing from coinbase script %x", script)
+	}
+	height, err := blockchain.ExtractCoinbaseHeight(btcutil.NewTx(tx))
+	if err != nil || height != template.Height {
+		t.Errorf("coinbase height %d (%v), want %d", height, err,
+			template.Height)
+	}
+	if len(tx.TxIn[0].Witness) != 1 {
+		t.Error("coinbase witness was lost")
+	}
+	if len(msgBlock.Transactions) != 4 {
+		t.Errorf("block has %d transactions, want 4",
+			len(msgBlock.Transactions))
+	}
+	want := blockchain.CalcMerkleRoot(block.Transactions(), false)
+	if msgBlock.Header.MerkleRoot != want {
+		t.Errorf("merkle root %v, want %v", msgBlock.Header.MerkleRoot,
+			want)
+	}
+	if msgBlock.Header.Timestamp.Unix() != 1700000100 ||
+		msgBlock.Header.Nonce != 42 {
+		t.Errorf("header time %v nonce %d", msgBlock.Header.Timestamp,
+			msgBlock.Header.Nonce)
+	}
+	if j.reward() != 5000001000 {
+		t.Errorf("reward %v, want 5000001000", j.reward())
+	}
+}
+
+// TestNotifyParams ensures the previous block hash and header fields are sent
+// the way stratum miners expect them.
+func TestNotifyParams(t *testing.T) {
+	t.Parallel()
+
+	j, err := newJob("a", testTemplate(0), 1)
+	if err != nil {
+		t.Fatalf("newJob: %v", err)
+	}
+	params := j.notifyParams()
+	if len(params) != 9 {
+		t.Fatalf("got %d parameters, want 9", len(params))
+	}
+	wantPrev := "04030201080706050000000000000000" +
+		"00000000000000000000000000000000"
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"job id", params[0], "a"},
+		{"previous block", params[1], wantPrev},
+		{"coinbase 1", params[2], hex.EncodeToString(j.coinbase1)},
+		{"version", params[5], "20000000"},
+		{"bits", params[6], "207fffff"},
+		{"time", params[7], "6553f100"},
+		{"clean", params[8], false},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, test.got,
+				test.want)
+		}
+	}
+	if branch := params[4].([]string); len(branch) != 0 {
+		t.Errorf("coinbase alone has merkle branch %v", branch)
+	}
+}
+
+// TestDifficultyTarget ensures share difficulties and targets convert both
+// ways.
+func TestDifficultyTarget(t *testing.T) {
+	t.Parallel()
+
+	target, err := DifficultyTarget(1)
+	if err != nil {
+		t.Fatalf("DifficultyTarget: %v", err)
+	}
+	if target.Cmp(blockchain.CompactToBig(0x1d00ffff)) != 0 {
+		t.Errorf("difficulty 1 target %x", target)
+	}
+	half, err := DifficultyTarget(0.5)
+	if err != nil {
+		t.Fatalf("DifficultyTarget: %v", err)
+	}
+	if half.Cmp(new(big.Int).Lsh(target, 1)) != 0 {
+		t.Errorf("difficulty 0.5 target %x", half)
+	}
+	if d := TargetDifficulty(half); d != 0.5 {
+		t.Errorf("difficulty of target %x is %v, want 0.5", half, d)
+	}
+	for _, difficulty := range []float64{0, -1} {
+		if _, err := DifficultyTarget(difficulty); err == nil {
+			t.Errorf("difficulty %v was accepted", difficulty)
+		}
+	}
+}
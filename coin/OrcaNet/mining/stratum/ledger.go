@@ -0,0 +1,342 @@
+package stratum
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+const (
+	// maxLedgerShares is the most shares the ledger keeps.  The oldest
+	// shares are dropped first, so the last N shares of a block can't
+	// reach further back than this.
+	maxLedgerShares = 100000
+
+	// maxLedgerBlocks is the most blocks found by the pool the ledger
+	// keeps once they matured or were orphaned.
+	maxLedgerBlocks = 100
+
+	// maxLedgerPayouts is the most payouts the ledger keeps.
+	maxLedgerPayouts = 100
+)
+
+// The statuses of the blocks found by the pool.
+const (
+	BlockImmature = "immature"
+	BlockMature   = "mature"
+	BlockOrphaned = "orphaned"
+)
+
+// Share is a share accepted from a miner.
+type Share struct {
+	Address    string    `json:"address"`
+	Difficulty float64   `json:"difficulty"`
+	Time       time.Time `json:"time"`
+}
+
+// FoundBlock is a block found by the pool and what it credits to the
+// addresses of the miners.  The credits are added to the balances once the
+// coinbase matures.
+type FoundBlock struct {
+	Hash    string                    `json:"hash"`
+	Height  int32                     `json:"height"`
+	Time    time.Time                 `json:"time"`
+	Reward  btcutil.Amount            `json:"reward"`
+	Fee     btcutil.Amount            `json:"fee"`
+	Credits map[string]btcutil.Amount `json:"credits"`
+	Status  string                    `json:"status"`
+}
+
+// Payout is a wallet transaction paying the balances of the miners.
+type Payout struct {
+	TxID    string                    `json:"txid"`
+	Time    time.Time                 `json:"time"`
+	Amounts map[string]btcutil.Amount `json:"amounts"`
+}
+
+// ledgerState is what the ledger saves to its file.
+type ledgerState struct {
+	Shares   []Share                   `json:"shares"`
+	Blocks   []*FoundBlock             `json:"blocks"`
+	Balances map[string]btcutil.Amount `json:"balances"`
+	Payouts  []*Payout                 `json:"payouts"`
+}
+
+// Ledger keeps the shares of the miners and splits the reward of each block
+// found by the pool between the last N shares (PPLNS), where N is the window
+// factor times the difficulty of the block.  Since a share is worth its
+// difficulty, miners are paid for the work they did, whoever found the block.
+//
+// The ledger is saved as JSON so the balances outlive restarts.
+type Ledger struct {
+	mtx    sync.Mutex
+	path   string
+	window float64
+	fee    float64
+	state  ledgerState
+	dirty  bool
+}
+
+// LoadLedger opens the ledger saved at path, or starts an empty one when there
+// is no such file.  The window is the PPLNS window factor and fee the percent
+// of each reward kept by the pool.
+func LoadLedger(path string, window, fee float64) (*Ledger, error) {
+	if !(window > 0) {
+		return nil, fmt.Errorf("PPLNS window %v is not positive", window)
+	}
+	if !(fee >= 0 && fee < 100) {
+		return nil, fmt.Errorf("pool fee %v is not a percentage below 100",
+			fee)
+	}
+	l := &Ledger{path: path, window: window, fee: fee}
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(data, &l.state); err != nil {
+			return nil, fmt.Errorf("unable to read the stratum ledger "+
+				"%s: %v", path, err)
+		}
+	}
+	if l.state.Balances == nil {
+		l.state.Balances = make(map[string]btcutil.Amount)
+	}
+	return l, nil
+}
+
+// AddShare records a share of the passed difficulty for an address.
+func (l *Ledger) AddShare(address string, difficulty float64, t time.Time) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	l.state.Shares = append(l.state.Shares, Share{
+		Address:    address,
+		Difficulty: difficulty,
+		Time:       t,
+	})
+	if extra := len(l.state.Shares) - maxLedgerShares; extra > 0 {
+		l.state.Shares = append(l.state.Shares[:0], l.state.Shares[extra:]...)
+	}
+	l.dirty = true
+}
+
+// BlockFound credits the reward of a block found by the pool to the addresses
+// of the last shares, in proportion to their difficulty.  The block difficulty
+// is in share difficulty units.  What's left after rounding down the credits
+// stays with the pool along with the fee.
+func (l *Ledger) BlockFound(hash *chainhash.Hash, height int32, reward btcutil.Amount,
+	blockDifficulty float64, t time.Time) (*FoundBlock, error) {
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	fee := btcutil.Amount(float64(reward) * l.fee / 100)
+	block := &FoundBlock{
+		Hash:    hash.String(),
+		Height:  height,
+		Time:    t,
+		Reward:  reward,
+		Fee:     fee,
+		Credits: make(map[string]btcutil.Amount),
+		Status:  BlockImmature,
+	}
+
+	// Gather the last N shares.
+	window := l.window * blockDifficulty
+	weights := make(map[string]float64)
+	var total float64
+	for i := len(l.state.Shares) - 1; i >= 0 && total < window; i-- {
+		share := &l.state.Shares[i]
+		weights[share.Address] += share.Difficulty
+		total += share.Difficulty
+	}
+	if total > 0 {
+		for address, weight := range weights {
+			credit := btcutil.Amount(float64(reward-fee) * weight / total)
+			if credit > 0 {
+				block.Credits[address] = credit
+			}
+		}
+	}
+
+	l.state.Blocks = append(l.state.Blocks, block)
+	l.pruneBlocks()
+	return block, l.save()
+}
+
+// pruneBlocks drops the oldest blocks which are no longer immature once there
+// are more than maxLedgerBlocks of them.  It must be called with the mutex
+// held.
+func (l *Ledger) pruneBlocks() {
+	extra := len(l.state.Blocks) - maxLedgerBlocks
+	if extra <= 0 {
+		return
+	}
+	blocks := l.state.Blocks[:0]
+	for _, block := range l.state.Blocks {
+		if extra > 0 && block.Status != BlockImmature {
+			extra--
+			continue
+		}
+		blocks = append(blocks, block)
+	}
+	l.state.Blocks = blocks
+}
+
+// Mature adds the credits of the blocks whose coinbase matured to the balances
+// and marks the blocks no longer in the main chain as orphaned.  It returns
+// whether any balance changed.
+func (l *Ledger) Mature(bestHeight int32, maturity int32,
+	mainChainHasBlock func(*chainhash.Hash) bool) (bool, error) {
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	var changed, credited bool
+	for _, block := range l.state.Blocks {
+		if block.Status != BlockImmature {
+			continue
+		}
+		hash, err := chainhash.NewHashFromStr(block.Hash)
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case !mainChainHasBlock(hash):
+			block.Status = BlockOrphaned
+			changed = true
+		case bestHeight-block.Height >= maturity:
+			for address, credit := range block.Credits {
+				l.state.Balances[address] += credit
+			}
+			block.Status = BlockMature
+			changed, credited = true, true
+		}
+	}
+	if !changed {
+		return false, nil
+	}
+	l.pruneBlocks()
+	return credited, l.save()
+}
+
+// Due returns the balances of at least the passed amount.
+func (l *Ledger) Due(min btcutil.Amount) map[string]btcutil.Amount {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	due := make(map[string]btcutil.Amount)
+	for address, balance := range l.state.Balances {
+		if balance > 0 && balance >= min {
+			due[address] = balance
+		}
+	}
+	return due
+}
+
+// Paid takes the amounts paid by a wallet transaction off the balances.
+func (l *Ledger) Paid(txid *chainhash.Hash, amounts map[string]btcutil.Amount,
+	t time.Time) error {
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	for address, amount := range amounts {
+		l.state.Balances[address] -= amount
+		if l.state.Balances[address] == 0 {
+			delete(l.state.Balances, address)
+		}
+	}
+	l.state.Payouts = append(l.state.Payouts, &Payout{
+		TxID:    txid.String(),
+		Time:    t,
+		Amounts: amounts,
+	})
+	if extra := len(l.state.Payouts) - maxLedgerPayouts; extra > 0 {
+		l.state.Payouts = append(l.state.Payouts[:0],
+			l.state.Payouts[extra:]...)
+	}
+	return l.save()
+}
+
+// LedgerInfo is a copy of the blocks, balances and payouts of the ledger.
+type LedgerInfo struct {
+	Blocks   []FoundBlock
+	Balances map[string]btcutil.Amount
+	Payouts  []Payout
+}
+
+// Info returns a copy of the blocks, balances and payouts of the ledger, the
+// newest blocks and payouts first.
+func (l *Ledger) Info() *LedgerInfo {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	info := &LedgerInfo{
+		Blocks:   make([]FoundBlock, 0, len(l.state.Blocks)),
+		Balances: make(map[string]btcutil.Amount, len(l.state.Balances)),
+		Payouts:  make([]Payout, 0, len(l.state.Payouts)),
+	}
+	for i := len(l.state.Blocks) - 1; i >= 0; i-- {
+		block := *l.state.Blocks[i]
+		block.Credits = copyAmounts(block.Credits)
+		info.Blocks = append(info.Blocks, block)
+	}
+	for address, balance := range l.state.Balances {
+		info.Balances[address] = balance
+	}
+	for i := len(l.state.Payouts) - 1; i >= 0; i-- {
+		payout := *l.state.Payouts[i]
+		payout.Amounts = copyAmounts(payout.Amounts)
+		info.Payouts = append(info.Payouts, payout)
+	}
+	return info
+}
+
+// copyAmounts returns a copy of the passed amounts.
+func copyAmounts(amounts map[string]btcutil.Amount) map[string]btcutil.Amount {
+	c := make(map[string]btcutil.Amount, len(amounts))
+	for address, amount := range amounts {
+		c[address] = amount
+	}
+	return c
+}
+
+// Save writes the ledger to its file if anything changed since it was last
+// saved.
+func (l *Ledger) Save() error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if !l.dirty {
+		return nil
+	}
+	return l.save()
+}
+
+// save writes the ledger to a temporary file which then replaces the ledger
+// file, so a crash can't leave half a ledger behind.  It must be called with
+// the mutex held.
+func (l *Ledger) save() error {
+	data, err := json.Marshal(&l.state)
+	if err != nil {
+		return err
+	}
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		return err
+	}
+	l.dirty = false
+	return nil
+}
@@ -0,0 +1,102 @@
+package stratum
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// TestLedger ensures the reward of a block is split between the last N shares
+// and credited once the block matures, and that the ledger survives a restart.
+func TestLedger(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "ledger.json")
+	l, err := LoadLedger(path, 2, 10)
+	if err != nil {
+		t.Fatalf("LoadLedger: %v", err)
+	}
+
+	// With a block difficulty of 2 the window covers the last 4
+	// difficulty of shares, so alice's first share is left out.
+	now := time.Now()
+	l.AddShare("alice", 1, now)
+	l.AddShare("bob", 1, now)
+	l.AddShare("alice", 1, now)
+	l.AddShare("bob", 2, now)
+	hash := chainhash.Hash{1}
+	block, err := l.BlockFound(&hash, 10, 1000, 2, now)
+	if err != nil {
+		t.Fatalf("BlockFound: %v", err)
+	}
+	want := map[string]btcutil.Amount{"alice": 225, "bob": 675}
+	if !reflect.DeepEqual(block.Credits, want) || block.Fee != 100 {
+		t.Errorf("credits %v fee %v, want %v fee 100", block.Credits,
+			block.Fee, want)
+	}
+
+	inMainChain := func(*chainhash.Hash) bool { return true }
+	credited, err := l.Mature(19, 10, inMainChain)
+	if err != nil || credited {
+		t.Fatalf("immature block credited: %v %v", credited, err)
+	}
+	if due := l.Due(1); len(due) != 0 {
+		t.Errorf("immature balances are due: %v", due)
+	}
+	credited, err = l.Mature(20, 10, inMainChain)
+	if err != nil || !credited {
+		t.Fatalf("mature block not credited: %v %v", credited, err)
+	}
+	if due := l.Due(300); !reflect.DeepEqual(due,
+		map[string]btcutil.Amount{"bob": 675}) {
+		t.Errorf("due balances %v", due)
+	}
+
+	txid := chainhash.Hash{2}
+	if err := l.Paid(&txid, map[string]btcutil.Amount{"bob": 675},
+		now); err != nil {
+		t.Fatalf("Paid: %v", err)
+	}
+
+	// A block which left the main chain credits nothing.
+	hash2 := chainhash.Hash{3}
+	if _, err := l.BlockFound(&hash2, 11, 1000, 2, now); err != nil {
+		t.Fatalf("BlockFound: %v", err)
+	}
+	credited, err = l.Mature(30, 10, func(h *chainhash.Hash) bool {
+		return *h != hash2
+	})
+	if err != nil || credited {
+		t.Fatalf("orphaned block credited: %v %v", credited, err)
+	}
+
+	l, err = LoadLedger(path, 2, 10)
+	if err != nil {
+		t.Fatalf("LoadLedger: %v", err)
+	}
+	info := l.Info()
+	if !reflect.DeepEqual(info.Balances,
+		map[string]btcutil.Amount{"alice": 225}) {
+		t.Errorf("reloaded balances %v", info.Balances)
+	}
+	if len(info.Blocks) != 2 || info.Blocks[0].Status != BlockOrphaned ||
+		info.Blocks[1].Status != BlockMature {
+		t.Errorf("reloaded blocks %+v", info.Blocks)
+	}
+	if len(info.Payouts) != 1 || info.Payouts[0].TxID != txid.String() {
+		t.Errorf("reloaded payouts %+v", info.Payouts)
+	}
+
+	for _, window := range []float64{0, -1} {
+		if _, err := LoadLedger(path, window, 0); err == nil {
+			t.Errorf("window %v was accepted", window)
+		}
+	}
+	if _, err := LoadLedger(path, 1, 100); err == nil {
+		t.Error("fee of 100 percent was accepted")
+	}
+}
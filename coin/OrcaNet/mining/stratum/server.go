@@ -0,0 +1,939 @@
+package stratum
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/mining"
+)
+
+const (
+	// maxMessageSize is the largest stratum message a miner may send.
+	maxMessageSize = 16 * 1024
+
+	// idleTimeout is how long a miner may stay silent before it is
+	// disconnected.
+	idleTimeout = 10 * time.Minute
+
+	// writeTimeout is how long writing a message to a miner may take.
+	writeTimeout = 10 * time.Second
+
+	// templateCheckInterval is how often the server checks whether it
+	// should hand out new work.
+	templateCheckInterval = 5 * time.Second
+
+	// templateRefreshInterval is how often the work is refreshed to pick
+	// up new transactions when the chain tip doesn't change.
+	templateRefreshInterval = time.Minute
+
+	// maxJobs is how many jobs for the current chain tip are kept, so
+	// the shares of miners a little behind are still accepted.
+	maxJobs = 8
+
+	// hashrateWindow is the period the hash rate of a worker is worked
+	// out over.  Workers without clients are forgotten once they have no
+	// shares in it.
+	hashrateWindow = 10 * time.Minute
+
+	// maxClientWorkers is how many workers a miner may authorize on one
+	// connection.
+	maxClientWorkers = 16
+
+	// payoutInterval is how often the server pays the due balances when
+	// no block matured in between.
+	payoutInterval = 10 * time.Minute
+
+	// ledgerSaveInterval is how often the shares are saved to the ledger.
+	ledgerSaveInterval = time.Minute
+)
+
+// Config is a descriptor containing the stratum server configuration.
+type Config struct {
+	// ChainParams identifies which chain parameters the server is
+	// associated with.
+	ChainParams *chaincfg.Params
+
+	// Chain is the chain the server follows to hand out new work when
+	// the tip changes and to mature the blocks found by the pool.
+	Chain *blockchain.BlockChain
+
+	// BlockTemplateGenerator identifies the instance to use in order to
+	// generate the block templates the miners work on.
+	BlockTemplateGenerator *mining.BlkTmplGenerator
+
+	// PayToAddr is the pool address the coinbase of the blocks found by
+	// the pool pays.  The wallet making the payouts must own it.
+	PayToAddr btcutil.Address
+
+	// Listeners defines a slice of listeners for which the server will
+	// take ownership of and accept connections.
+	Listeners []net.Listener
+
+	// Difficulty is the difficulty of the shares the miners submit.
+	Difficulty float64
+
+	// Ledger records the shares and splits the rewards between them.
+	Ledger *Ledger
+
+	// ProcessBlock defines the function to call with any solved blocks.
+	// It typically must run the provided block through the same set of
+	// rules and handling as any other block coming from the network.
+	ProcessBlock func(*btcutil.Block, blockchain.BehaviorFlags) (bool, error)
+
+	// IsCurrent defines the function to use to obtain whether or not the
+	// block chain is current.  No work is handed out while it isn't.
+	IsCurrent func() bool
+
+	// Payout defines the function to call to pay the due balances through
+	// the wallet.  It returns the hash of the payout transaction.  The
+	// balances are only credited when it is nil.
+	Payout func(map[string]btcutil.Amount) (*chainhash.Hash, error)
+
+	// MinPayout is the smallest balance paid out.
+	MinPayout btcutil.Amount
+}
+
+// WorkerInfo describes a worker of the pool.  A worker is named after the
+// address it mines to, followed by an optional name for the machine.
+type WorkerInfo struct {
+	Name         string
+	Address      string
+	Connected    bool
+	Accepted     uint64
+	Rejected     uint64
+	Stale        uint64
+	Blocks       uint64
+	LastShare    time.Time
+	HashesPerSec float64
+}
+
+// worker keeps the statistics of a worker.
+type worker struct {
+	info    WorkerInfo
+	shares  []Share
+	clients int
+}
+
+// hashrate works out the hash rate of the worker from its shares in the last
+// hashrate window and drops the older shares.  A share of difficulty 1 takes
+// 2^32 hashes on average.
+func (w *worker) hashrate(now time.Time) float64 {
+	w.dropOldShares(now)
+	var work float64
+	for _, share := range w.shares {
+		work += share.Difficulty
+	}
+	return work * (1 << 32) / hashrateWindow.Seconds()
+}
+
+// dropOldShares drops the shares older than the hashrate window.
+func (w *worker) dropOldShares(now time.Time) {
+	start := now.Add(-hashrateWindow)
+	i := 0
+	for i < len(w.shares) && w.shares[i].Time.Before(start) {
+		i++
+	}
+	w.shares = w.shares[i:]
+}
+
+// idle returns whether the worker has no connected clients and no shares in
+// the hashrate window.
+func (w *worker) idle(now time.Time) bool {
+	w.dropOldShares(now)
+	return w.clients == 0 && len(w.shares) == 0
+}
+
+// Info describes the state of the server.
+type Info struct {
+	Listeners         []string
+	Clients           int
+	Height            int32
+	Difficulty        float64
+	NetworkDifficulty float64
+	Workers           []WorkerInfo
+	Ledger            *LedgerInfo
+}
+
+// Server is a stratum v1 mining pool server.  It hands out work built from
+// the block templates of the node, checks the shares the miners submit,
+// submits the blocks among them and records the shares in a PPLNS ledger.
+type Server struct {
+	cfg Config
+
+	mtx         sync.Mutex
+	jobs        map[string]*job
+	current     *job
+	jobCounter  uint64
+	clients     map[*client]struct{}
+	workers     map[string]*worker
+	nextNonce   uint32
+	started     bool
+	submitMtx   sync.Mutex
+	tipChanged  chan struct{}
+	payoutReady chan struct{}
+	quit        chan struct{}
+	wg          sync.WaitGroup
+}
+
+// New returns a new stratum server for the provided configuration.  Use Start
+// to begin serving the miners.
+func New(cfg *Config) *Server {
+	var nonce [4]byte
+	rand.Read(nonce[:])
+	s := &Server{
+		cfg:         *cfg,
+		jobs:        make(map[string]*job),
+		clients:     make(map[*client]struct{}),
+		workers:     make(map[string]*worker),
+		nextNonce:   binary.BigEndian.Uint32(nonce[:]),
+		tipChanged:  make(chan struct{}, 1),
+		payoutReady: make(chan struct{}, 1),
+		quit:        make(chan struct{}),
+	}
+	cfg.Chain.Subscribe(s.handleBlockchainNotification)
+	return s
+}
+
+// handleBlockchainNotification signals the job handler when the chain tip
+// changes.  It is called by the chain with its lock held, so it must not do
+// any work itself.
+func (s *Server) handleBlockchainNotification(notification *blockchain.Notification) {
+	switch notification.Type {
+	case blockchain.NTBlockConnected, blockchain.NTBlockDisconnected:
+		select {
+		case s.tipChanged <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Start begins accepting miners and handing out work.
+func (s *Server) Start() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.started {
+		return
+	}
+	s.started = true
+
+	log.Infof("Stratum server paying to %v with share difficulty %v",
+		s.cfg.PayToAddr, s.cfg.Difficulty)
+	for _, listener := range s.cfg.Listeners {
+		s.wg.Add(1)
+		go s.listenHandler(listener)
+	}
+	s.wg.Add(2)
+	go s.jobHandler()
+	go s.payoutHandler()
+}
+
+// Stop disconnects the miners, stops the server and saves the ledger.
+func (s *Server) Stop() {
+	s.mtx.Lock()
+	if !s.started {
+		s.mtx.Unlock()
+		return
+	}
+	s.started = false
+	close(s.quit)
+	for _, listener := range s.cfg.Listeners {
+		listener.Close()
+	}
+	for c := range s.clients {
+		c.conn.Close()
+	}
+	s.mtx.Unlock()
+
+	s.wg.Wait()
+	if err := s.cfg.Ledger.Save(); err != nil {
+		log.Errorf("Unable to save the stratum ledger: %v", err)
+	}
+	log.Infof("Stratum server stopped")
+}
+
+// listenHandler accepts the connections of the miners on a listener.
+func (s *Server) listenHandler(listener net.Listener) {
+	defer s.wg.Done()
+
+	log.Infof("Stratum server listening on %s", listener.Addr())
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-s.quit:
+				return
+			default:
+			}
+			log.Errorf("Can't accept stratum connection: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		c := &client{
+			server:  s,
+			conn:    conn,
+			workers: make(map[string]string),
+		}
+		s.mtx.Lock()
+		if !s.started {
+			s.mtx.Unlock()
+			conn.Close()
+			return
+		}
+		c.extraNonce1 = make([]byte, extraNonce1Size)
+		binary.BigEndian.PutUint32(c.extraNonce1, s.nextNonce)
+		s.nextNonce++
+		s.clients[c] = struct{}{}
+		s.wg.Add(1)
+		s.mtx.Unlock()
+
+		go c.serve()
+	}
+}
+
+// jobHandler hands out new work when the chain tip changes or new
+// transactions showed up, matures the blocks found by the pool and saves the
+// shares now and then.
+func (s *Server) jobHandler() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(templateCheckInterval)
+	defer ticker.Stop()
+	saveTicker := time.NewTicker(ledgerSaveInterval)
+	defer saveTicker.Stop()
+
+	s.matureBlocks()
+	s.refreshJob()
+	for {
+		select {
+		case <-s.tipChanged:
+			s.refreshJob()
+			s.matureBlocks()
+
+		case <-ticker.C:
+			s.refreshJob()
+
+		case <-saveTicker.C:
+			if err := s.cfg.Ledger.Save(); err != nil {
+				log.Errorf("Unable to save the stratum ledger: %v",
+					err)
+			}
+			s.pruneWorkers(time.Now())
+
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// refreshJob hands out new work when there is none yet, the chain tip
+// changed, or new transactions showed up since the current work was made and
+// the work is old enough.
+func (s *Server) refreshJob() {
+	g := s.cfg.BlockTemplateGenerator
+	best := g.BestSnapshot()
+
+	s.mtx.Lock()
+	current := s.current
+	s.mtx.Unlock()
+	clean := current == nil ||
+		!current.template.Block.Header.PrevBlock.IsEqual(&best.Hash)
+	if !clean && (time.Since(current.created) < templateRefreshInterval ||
+		!g.TxSource().LastUpdated().After(current.created)) {
+		return
+	}
+
+	// There's no use in mining on a chain which is still catching up,
+	// except for the first block after the genesis block.
+	if best.Height != 0 && !s.cfg.IsCurrent() {
+		log.Debugf("Not handing out stratum work while the chain is " +
+			"syncing")
+		return
+	}
+
+	template, err := g.NewBlockTemplate(s.cfg.PayToAddr)
+	if err != nil {
+		log.Errorf("Failed to create stratum block template: %v", err)
+		return
+	}
+
+	s.mtx.Lock()
+	s.jobCounter++
+	j, err := newJob(strconv.FormatUint(s.jobCounter, 16), template,
+		s.cfg.Difficulty)
+	if err != nil {
+		s.mtx.Unlock()
+		log.Errorf("Failed to create stratum job: %v", err)
+		return
+	}
+	j.clean = clean
+	if clean {
+		s.jobs = make(map[string]*job)
+	} else if len(s.jobs) >= maxJobs {
+		var oldest *job
+		for _, old := range s.jobs {
+			if oldest == nil || old.created.Before(oldest.created) {
+				oldest = old
+			}
+		}
+		delete(s.jobs, oldest.id)
+	}
+	s.jobs[j.id] = j
+	s.current = j
+	clients := make([]*client, 0, len(s.clients))
+	for c := range s.clients {
+		clients = append(clients, c)
+	}
+	s.mtx.Unlock()
+
+	log.Debugf("New stratum job %s at height %d (clean %v)", j.id,
+		template.Height, clean)
+	for _, c := range clients {
+		c.sendJob(j)
+	}
+}
+
+// matureBlocks credits the blocks found by the pool whose coinbase matured and
+// signals the payout handler when a balance changed.
+func (s *Server) matureBlocks() {
+	best := s.cfg.Chain.BestSnapshot()
+	credited, err := s.cfg.Ledger.Mature(best.Height,
+		int32(s.cfg.ChainParams.CoinbaseMaturity),
+		s.cfg.Chain.MainChainHasBlock)
+	if err != nil {
+		log.Errorf("Unable to update the stratum ledger: %v", err)
+	}
+	if credited {
+		select {
+		case s.payoutReady <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// payoutHandler pays the due balances through the wallet when blocks matured
+// and now and then, in case an earlier payout failed.
+func (s *Server) payoutHandler() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(payoutInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.payoutReady:
+		case <-ticker.C:
+		case <-s.quit:
+			return
+		}
+		if s.cfg.Payout == nil {
+			continue
+		}
+		due := s.cfg.Ledger.Due(s.cfg.MinPayout)
+		if len(due) == 0 {
+			continue
+		}
+		txid, err := s.cfg.Payout(due)
+		if err != nil {
+			log.Errorf("Stratum payout failed: %v", err)
+			continue
+		}
+		if err := s.cfg.Ledger.Paid(txid, due, time.Now()); err != nil {
+			log.Errorf("Unable to record stratum payout %v: %v", txid,
+				err)
+			continue
+		}
+		log.Infof("Paid %d stratum balances in transaction %v", len(due),
+			txid)
+	}
+}
+
+// currentJob returns the job handed out last, if any.
+func (s *Server) currentJob() *job {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.current
+}
+
+// authorize adds a client to the connected clients of a worker.
+func (s *Server) authorize(name, address string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	w := s.workers[name]
+	if w == nil {
+		w = &worker{info: WorkerInfo{Name: name, Address: address}}
+		s.workers[name] = w
+	}
+	w.clients++
+}
+
+// disconnect removes a client from the server and from its workers, and
+// forgets the workers left idle.
+func (s *Server) disconnect(c *client) {
+	now := time.Now()
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	delete(s.clients, c)
+	for name := range c.workers {
+		if w := s.workers[name]; w != nil {
+			w.clients--
+			if w.idle(now) {
+				delete(s.workers, name)
+			}
+		}
+	}
+}
+
+// pruneWorkers forgets the workers without clients whose last share left the
+// hashrate window, so the workers named by miners that went away don't pile
+// up.  Their shares stay in the ledger.
+func (s *Server) pruneWorkers(now time.Time) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for name, w := range s.workers {
+		if w.idle(now) {
+			delete(s.workers, name)
+		}
+	}
+}
+
+// Submission errors, sent back to the miners as [code, message, null].
+var (
+	errUnknownJob    = &stratumError{21, "Job not found"}
+	errDuplicate     = &stratumError{22, "Duplicate share"}
+	errLowDifficulty = &stratumError{23, "Low difficulty share"}
+	errUnauthorized  = &stratumError{24, "Unauthorized worker"}
+	errNotSubscribed = &stratumError{25, "Not subscribed"}
+)
+
+// submit checks a share submitted by a worker, records it and submits the
+// block when the share solves it.
+func (s *Server) submit(c *client, name, jobID string, extraNonce2 []byte,
+	timestamp, nonce uint32) error {
+
+	now := time.Now()
+	s.mtx.Lock()
+	w := s.workers[name]
+	j := s.jobs[jobID]
+	if j == nil {
+		w.info.Stale++
+		s.mtx.Unlock()
+		return errUnknownJob
+	}
+	minTime := j.template.Block.Header.Timestamp.Unix()
+	maxTime := now.Add(blockchain.MaxTimeOffset(s.cfg.ChainParams)).Unix()
+	if int64(timestamp) < minTime || int64(timestamp) > maxTime {
+		w.info.Rejected++
+		s.mtx.Unlock()
+		return &stratumError{20, "Time out of range"}
+	}
+	solution := fmt.Sprintf("%x:%x:%08x:%08x", c.extraNonce1, extraNonce2,
+		timestamp, nonce)
+	if _, ok := j.submitted[solution]; ok {
+		w.info.Rejected++
+		s.mtx.Unlock()
+		return errDuplicate
+	}
+	j.submitted[solution] = struct{}{}
+	s.mtx.Unlock()
+
+	coinbase := j.coinbase(c.extraNonce1, extraNonce2)
+	header := j.header(coinbase, timestamp, nonce)
+	hash := header.BlockHash()
+	hashNum := blockchain.HashToBig(&hash)
+	if hashNum.Cmp(j.shareTarget) > 0 {
+		s.mtx.Lock()
+		w.info.Rejected++
+		s.mtx.Unlock()
+		return errLowDifficulty
+	}
+
+	s.mtx.Lock()
+	w.info.Accepted++
+	w.info.LastShare = now
+	w.shares = append(w.shares, Share{Difficulty: j.difficulty, Time: now})
+	address := w.info.Address
+	s.mtx.Unlock()
+	s.cfg.Ledger.AddShare(address, j.difficulty, now)
+
+	if hashNum.Cmp(j.target) <= 0 {
+		block, err := j.block(coinbase, header)
+		if err != nil {
+			log.Errorf("Unable to build the block of stratum job "+
+				"%s: %v", j.id, err)
+			return nil
+		}
+		if s.submitBlock(block, j) {
+			s.mtx.Lock()
+			w.info.Blocks++
+			s.mtx.Unlock()
+		}
+	}
+	return nil
+}
+
+// submitBlock processes a block solved by a worker and credits its reward to
+// the last shares once the block is accepted.
+func (s *Server) submitBlock(block *btcutil.Block, j *job) bool {
+	s.submitMtx.Lock()
+	defer s.submitMtx.Unlock()
+
+	// Ensure the block is not stale since a new block could have shown up
+	// since the job was handed out.
+	msgBlock := block.MsgBlock()
+	best := s.cfg.BlockTemplateGenerator.BestSnapshot()
+	if !msgBlock.Header.PrevBlock.IsEqual(&best.Hash) {
+		log.Debugf("Block submitted via stratum with previous block %s "+
+			"is stale", msgBlock.Header.PrevBlock)
+		return false
+	}
+
+	// Process this block using the same rules as blocks coming from other
+	// nodes.  This will in turn relay it to the network like normal.
+	isOrphan, err := s.cfg.ProcessBlock(block, blockchain.BFNone)
+	if err != nil {
+		// Anything other than a rule violation is an unexpected error,
+		// so log that error as an internal error.
+		if _, ok := err.(blockchain.RuleError); !ok {
+			log.Errorf("Unexpected error while processing block "+
+				"submitted via stratum: %v", err)
+			return false
+		}
+		log.Debugf("Block submitted via stratum rejected: %v", err)
+		return false
+	}
+	if isOrphan {
+		log.Debugf("Block submitted via stratum is an orphan")
+		return false
+	}
+
+	reward := j.reward()
+	log.Infof("Block submitted via stratum accepted (hash %s, amount %v)",
+		block.Hash(), reward)
+	_, err = s.cfg.Ledger.BlockFound(block.Hash(), j.template.Height,
+		reward, TargetDifficulty(j.target), time.Now())
+	if err != nil {
+		log.Errorf("Unable to record block %s in the stratum ledger: %v",
+			block.Hash(), err)
+	}
+	return true
+}
+
+// Info returns the state of the server, its workers and its ledger.
+func (s *Server) Info() *Info {
+	best := s.cfg.BlockTemplateGenerator.BestSnapshot()
+	info := &Info{
+		Height:            best.Height + 1,
+		Difficulty:        s.cfg.Difficulty,
+		NetworkDifficulty: TargetDifficulty(blockchain.CompactToBig(best.Bits)),
+		Ledger:            s.cfg.Ledger.Info(),
+	}
+	for _, listener := range s.cfg.Listeners {
+		info.Listeners = append(info.Listeners, listener.Addr().String())
+	}
+
+	now := time.Now()
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.current != nil {
+		info.Height = s.current.template.Height
+		info.Difficulty = s.current.difficulty
+		info.NetworkDifficulty = TargetDifficulty(s.current.target)
+	}
+	info.Clients = len(s.clients)
+	for _, w := range s.workers {
+		workerInfo := w.info
+		workerInfo.Connected = w.clients > 0
+		workerInfo.HashesPerSec = w.hashrate(now)
+		info.Workers = append(info.Workers, workerInfo)
+	}
+	sort.Slice(info.Workers, func(i, j int) bool {
+		return info.Workers[i].Name < info.Workers[j].Name
+	})
+	return info
+}
+
+// stratumError is an error sent back to a miner.
+type stratumError struct {
+	code    int
+	message string
+}
+
+// Error satisfies the error interface.
+func (e *stratumError) Error() string {
+	return e.message
+}
+
+// MarshalJSON encodes the error the way stratum miners expect it.
+func (e *stratumError) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{e.code, e.message, nil})
+}
+
+// request is a message from a miner.
+type request struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// response is the answer to a request.
+type response struct {
+	ID     json.RawMessage `json:"id"`
+	Result interface{}     `json:"result"`
+	Error  interface{}     `json:"error"`
+}
+
+// notification is a message sent to a miner unprompted.
+type notification struct {
+	ID     interface{}   `json:"id"`
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+}
+
+// client is the connection of a miner.
+type client struct {
+	server      *Server
+	conn        net.Conn
+	extraNonce1 []byte
+
+	// The fields below are only used by the goroutine serving the
+	// client.
+	subscribed bool
+	workers    map[string]string
+
+	// ready is set once the miner subscribed and authorized a worker,
+	// and difficulty is the last share difficulty sent to it.  They are
+	// protected by the write mutex.
+	writeMtx   sync.Mutex
+	ready      bool
+	difficulty float64
+}
+
+// serve reads the requests of the miner until it disconnects.
+func (c *client) serve() {
+	defer c.server.wg.Done()
+	defer c.server.disconnect(c)
+	defer c.conn.Close()
+
+	log.Debugf("Stratum client %s connected", c.conn.RemoteAddr())
+	scanner := bufio.NewScanner(c.conn)
+	scanner.Buffer(make([]byte, 0, 1024), maxMessageSize)
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		if !scanner.Scan() {
+			break
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var req request
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			log.Debugf("Malformed stratum request from %s: %v",
+				c.conn.RemoteAddr(), err)
+			break
+		}
+		if err := c.handle(&req); err != nil {
+			log.Debugf("Stratum client %s: %v", c.conn.RemoteAddr(),
+				err)
+			break
+		}
+	}
+	log.Debugf("Stratum client %s disconnected", c.conn.RemoteAddr())
+}
+
+// handle answers a request of the miner.  An error is only returned when the
+// connection should be closed.
+func (c *client) handle(req *request) error {
+	var result interface{}
+	var err error
+	switch req.Method {
+	case "mining.subscribe":
+		subscription := hex.EncodeToString(c.extraNonce1)
+		result = []interface{}{
+			[][]string{
+				{"mining.set_difficulty", subscription},
+				{"mining.notify", subscription},
+			},
+			hex.EncodeToString(c.extraNonce1),
+			extraNonce2Size,
+		}
+		c.subscribed = true
+
+	case "mining.authorize":
+		result, err = c.authorize(req.Params)
+
+	case "mining.submit":
+		result, err = c.submit(req.Params)
+
+	case "mining.extranonce.subscribe":
+		// The extra nonce of a connection never changes.
+		result = true
+
+	default:
+		err = &stratumError{20, "Unsupported method " + req.Method}
+	}
+
+	resp := response{ID: req.ID, Result: result}
+	if err != nil {
+		resp.Result = nil
+		resp.Error = err
+	}
+	if err := c.send(&resp); err != nil {
+		return err
+	}
+
+	// Start the miner off once it is subscribed and authorized.
+	c.writeMtx.Lock()
+	start := !c.ready && c.subscribed && len(c.workers) != 0
+	c.ready = c.ready || start
+	c.writeMtx.Unlock()
+	if start {
+		if j := c.server.currentJob(); j != nil {
+			c.sendJob(j)
+		}
+	}
+	return nil
+}
+
+// authorize checks the worker name is a pool address, optionally followed by a
+// dot and the name of the machine.  The password is ignored.
+func (c *client) authorize(params []json.RawMessage) (interface{}, error) {
+	if len(params) < 1 {
+		return nil, &stratumError{20, "Missing worker name"}
+	}
+	var name string
+	if err := json.Unmarshal(params[0], &name); err != nil {
+		return nil, &stratumError{20, "Worker name must be a string"}
+	}
+	addrStr := name
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		addrStr = name[:i]
+	}
+	chainParams := c.server.cfg.ChainParams
+	addr, err := btcutil.DecodeAddress(addrStr, chainParams)
+	if err != nil || !addr.IsForNet(chainParams) {
+		return nil, &stratumError{24, fmt.Sprintf("Worker name must "+
+			"start with an address on %s", chainParams.Name)}
+	}
+	if _, ok := c.workers[name]; !ok {
+		if len(c.workers) >= maxClientWorkers {
+			return nil, &stratumError{24, fmt.Sprintf("At most %d "+
+				"workers per connection", maxClientWorkers)}
+		}
+		c.workers[name] = addr.EncodeAddress()
+		c.server.authorize(name, addr.EncodeAddress())
+	}
+	return true, nil
+}
+
+// submit parses a share submitted by the miner and hands it to the server.
+func (c *client) submit(params []json.RawMessage) (interface{}, error) {
+	if !c.subscribed {
+		return nil, errNotSubscribed
+	}
+	if len(params) < 5 {
+		return nil, &stratumError{20, "Missing share parameters"}
+	}
+	var strs [5]string
+	for i := range strs {
+		if err := json.Unmarshal(params[i], &strs[i]); err != nil {
+			return nil, &stratumError{20, "Share parameters must be " +
+				"strings"}
+		}
+	}
+	name, jobID := strs[0], strs[1]
+	if _, ok := c.workers[name]; !ok {
+		return nil, errUnauthorized
+	}
+	extraNonce2, err := hex.DecodeString(strs[2])
+	if err != nil || len(extraNonce2) != extraNonce2Size {
+		return nil, &stratumError{20, fmt.Sprintf("Extra nonce 2 must "+
+			"be %d hex encoded bytes", extraNonce2Size)}
+	}
+	timestamp, err := parseUint32(strs[3])
+	if err != nil {
+		return nil, &stratumError{20, "Malformed time"}
+	}
+	nonce, err := parseUint32(strs[4])
+	if err != nil {
+		return nil, &stratumError{20, "Malformed nonce"}
+	}
+	if err := c.server.submit(c, name, jobID, extraNonce2, timestamp,
+		nonce); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+// parseUint32 parses the 8 hex digits of a big endian 32-bit integer.
+func parseUint32(s string) (uint32, error) {
+	if len(s) != 8 {
+		return 0, errors.New("not 8 hex digits")
+	}
+	n, err := strconv.ParseUint(s, 16, 32)
+	return uint32(n), err
+}
+
+// sendJob sends a job to the miner, preceded by its share difficulty when it
+// differs from the last one sent.  Miners which haven't subscribed and
+// authorized a worker yet get nothing.
+func (c *client) sendJob(j *job) {
+	c.writeMtx.Lock()
+	if !c.ready {
+		c.writeMtx.Unlock()
+		return
+	}
+	difficulty := c.difficulty
+	c.difficulty = j.difficulty
+	c.writeMtx.Unlock()
+	if difficulty != j.difficulty {
+		err := c.send(&notification{
+			Method: "mining.set_difficulty",
+			Params: []interface{}{j.difficulty},
+		})
+		if err != nil {
+			c.conn.Close()
+			return
+		}
+	}
+	err := c.send(&notification{
+		Method: "mining.notify",
+		Params: j.notifyParams(),
+	})
+	if err != nil {
+		c.conn.Close()
+	}
+}
+
+// send writes a message to the miner.
+func (c *client) send(message interface{}) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	c.writeMtx.Lock()
+	defer c.writeMtx.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err = c.conn.Write(data)
+	return err
+}
@@ -0,0 +1,86 @@
+package stratum
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// TestWorkers ensures a connection can only authorize a limited number of
+// workers and that workers without clients are forgotten once their shares
+// leave the hashrate window.
+func TestWorkers(t *testing.T) {
+	params := &chaincfg.SimNetParams
+	addr, err := btcutil.NewAddressPubKeyHash(
+		btcutil.Hash160([]byte("miner")), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		cfg:     Config{ChainParams: params},
+		clients: make(map[*client]struct{}),
+		workers: make(map[string]*worker),
+	}
+	authorize := func(c *client, name string) error {
+		param, _ := json.Marshal(name)
+		_, err := c.authorize([]json.RawMessage{param})
+		return err
+	}
+
+	// A connection authorizes up to maxClientWorkers workers.
+	c := &client{server: s, workers: make(map[string]string)}
+	s.clients[c] = struct{}{}
+	for i := 0; i < maxClientWorkers; i++ {
+		name := fmt.Sprintf("%s.rig%d", addr.EncodeAddress(), i)
+		if err := authorize(c, name); err != nil {
+			t.Fatalf("worker %d: %v", i, err)
+		}
+	}
+	if err := authorize(c, addr.EncodeAddress()+".rig0"); err != nil {
+		t.Fatalf("authorizing a worker again: %v", err)
+	}
+	if err := authorize(c, addr.EncodeAddress()+".extra"); err == nil {
+		t.Fatal("worker past the limit was authorized")
+	}
+	if len(s.workers) != maxClientWorkers {
+		t.Fatalf("got %d workers, want %d", len(s.workers),
+			maxClientWorkers)
+	}
+
+	// A second connection shares a worker with the first one, and rig1
+	// submitted a share.
+	other := &client{server: s, workers: make(map[string]string)}
+	s.clients[other] = struct{}{}
+	if err := authorize(other, addr.EncodeAddress()+".rig0"); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	rig1 := s.workers[addr.EncodeAddress()+".rig1"]
+	rig1.shares = append(rig1.shares, Share{Difficulty: 1, Time: now})
+
+	// Workers left without clients and shares are forgotten on
+	// disconnect.
+	s.disconnect(c)
+	if len(s.workers) != 2 {
+		t.Fatalf("got %d workers after disconnecting, want rig0 and rig1",
+			len(s.workers))
+	}
+	if s.workers[addr.EncodeAddress()+".rig0"].clients != 1 {
+		t.Fatal("rig0 lost the client of the other connection")
+	}
+
+	// rig1 is forgotten once its share leaves the hashrate window.
+	s.pruneWorkers(now.Add(hashrateWindow / 2))
+	if len(s.workers) != 2 {
+		t.Fatalf("got %d workers within the window, want 2",
+			len(s.workers))
+	}
+	s.pruneWorkers(now.Add(hashrateWindow + time.Second))
+	if len(s.workers) != 1 || s.workers[addr.EncodeAddress()+".rig0"] == nil {
+		t.Fatalf("got %d workers, want only rig0", len(s.workers))
+	}
+}
@@ -5,6 +5,12 @@
 package main
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/wire"
 )
@@ -48,12 +54,108 @@ var testNet3Params = params{
 	rpcPort: "18334",
 }
 
-
+// FreshNetParams contains parameters specific to the fresh network
+// (wire.FreshNet) the OrcaNet peers run on.
 var FreshNetParams = params{
 	Params:  &chaincfg.FreshNetParams,
 	rpcPort: "8334",
 }
 
+// freshNetOverrides returns a copy of the passed fresh network parameters with
+// the changes given as comma separated name=value pairs, which lets test
+// deployments run the network with e.g. faster blocks.  Every node of a
+// deployment has to be started with the same overrides, or they won't agree on
+// which blocks are valid.
+//
+// The supported names are blocktime (a duration), lwmawindow, powlimitbits
+// (compact bits in hex), coinbasematurity, subsidyinterval,
+// confirmationwindow and activationthreshold.  A confirmation window given
+// without a threshold needs 75% of its blocks to lock in a deployment.
+func freshNetOverrides(base *chaincfg.Params, overrides string) (*chaincfg.Params, error) {
+	chainParams := *base
+	var thresholdSet bool
+	for _, override := range strings.Split(overrides, ",") {
+		name, value, found := strings.Cut(strings.TrimSpace(override), "=")
+		if !found {
+			return nil, fmt.Errorf("freshnet override %q is not name=value", override)
+		}
+		var err error
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "blocktime":
+			var blockTime time.Duration
+			blockTime, err = time.ParseDuration(value)
+			if err == nil && blockTime < time.Second {
+				err = fmt.Errorf("must be at least a second")
+			}
+			chainParams.TargetTimePerBlock = blockTime
+		case "lwmawindow":
+			chainParams.LWMAWindow, err = strconv.ParseInt(value, 10, 64)
+			if err == nil && chainParams.LWMAWindow < 1 {
+				err = fmt.Errorf("must be at least 1")
+			}
+		case "powlimitbits":
+			var bits uint64
+			bits, err = strconv.ParseUint(strings.TrimPrefix(value, "0x"), 16, 32)
+			powLimit := blockchain.CompactToBig(uint32(bits))
+			if err == nil && powLimit.Sign() <= 0 {
+				err = fmt.Errorf("must be a positive target")
+			}
+			chainParams.PowLimitBits = uint32(bits)
+			chainParams.PowLimit = powLimit
+		case "coinbasematurity":
+			var maturity uint64
+			maturity, err = strconv.ParseUint(value, 10, 16)
+			chainParams.CoinbaseMaturity = uint16(maturity)
+		case "subsidyinterval":
+			var interval int64
+			interval, err = strconv.ParseInt(value, 10, 32)
+			if err == nil && interval < 1 {
+				err = fmt.Errorf("must be at least 1")
+			}
+			chainParams.SubsidyReductionInterval = int32(interval)
+		case "confirmationwindow":
+			var window uint64
+			window, err = strconv.ParseUint(value, 10, 32)
+			if err == nil && window < 1 {
+				err = fmt.Errorf("must be at least 1")
+			}
+			chainParams.MinerConfirmationWindow = uint32(window)
+		case "activationthreshold":
+			var threshold uint64
+			threshold, err = strconv.ParseUint(value, 10, 32)
+			chainParams.RuleChangeActivationThreshold = uint32(threshold)
+			thresholdSet = true
+		default:
+			return nil, fmt.Errorf("unknown freshnet override %q", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid freshnet override %s: %v", name, err)
+		}
+	}
+
+	if !thresholdSet && chainParams.MinerConfirmationWindow != base.MinerConfirmationWindow {
+		chainParams.RuleChangeActivationThreshold = chainParams.MinerConfirmationWindow * 3 / 4
+	}
+	if chainParams.RuleChangeActivationThreshold > chainParams.MinerConfirmationWindow {
+		return nil, fmt.Errorf("the freshnet activation threshold %d is larger "+
+			"than the confirmation window %d",
+			chainParams.RuleChangeActivationThreshold,
+			chainParams.MinerConfirmationWindow)
+	}
+
+	// Keep the retarget window of the Bitcoin rules in step, the block
+	// chain derives the number of blocks between retargets from it.
+	chainParams.TargetTimespan = chainParams.TargetTimePerBlock *
+		time.Duration(chainParams.LWMAWindow)
+
+	// Block times stay limited to the same number of block times ahead.
+	if base.MaxTimeOffset != 0 {
+		blockTimes := base.MaxTimeOffset / base.TargetTimePerBlock
+		chainParams.MaxTimeOffset = blockTimes * chainParams.TargetTimePerBlock
+	}
+	return &chainParams, nil
+}
+
 // simNetParams contains parameters specific to the simulation test network
 // (wire.SimNet).
 var simNetParams = params{
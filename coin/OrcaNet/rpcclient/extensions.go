@@ -472,3 +472,50 @@ func (c *Client) VersionAsync() FutureVersionResult {
 func (c *Client) Version() (map[string]btcjson.VersionResult, error) {
 	return c.VersionAsync().Receive()
 }
+
+// FutureSearchFileAnchorsResult is a future promise to deliver the result of a
+// searchfileanchors RPC invocation (or an applicable error).
+//
+// NOTE: This is an OrcaNet extension.
+type FutureSearchFileAnchorsResult chan *Response
+
+// Receive waits for the Response promised by the future and returns the
+// anchors found.
+//
+// NOTE: This is an OrcaNet extension.
+func (r FutureSearchFileAnchorsResult) Receive() ([]btcjson.SearchFileAnchorsResult, error) {
+	res, err := ReceiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal result as a slice of anchors.
+	var anchors []btcjson.SearchFileAnchorsResult
+	err = json.Unmarshal(res, &anchors)
+	if err != nil {
+		return nil, err
+	}
+
+	return anchors, nil
+}
+
+// SearchFileAnchorsAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See SearchFileAnchors for the blocking version and more details.
+//
+// NOTE: This is an OrcaNet extension.
+func (c *Client) SearchFileAnchorsAsync(key string, kind string, skip, count int) FutureSearchFileAnchorsResult {
+	cmd := btcjson.NewSearchFileAnchorsCmd(key, &kind, &skip, &count)
+	return c.SendCmd(cmd)
+}
+
+// SearchFileAnchors returns the transactions that anchored the hex-encoded key
+// of the passed kind, "file" or "contract", the oldest first.  The first skip
+// anchors are left out and at most count are returned.
+//
+// NOTE: This is an OrcaNet extension.
+func (c *Client) SearchFileAnchors(key string, kind string, skip, count int) ([]btcjson.SearchFileAnchorsResult, error) {
+	return c.SearchFileAnchorsAsync(key, kind, skip, count).Receive()
+}
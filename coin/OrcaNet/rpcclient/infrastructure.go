@@ -1477,6 +1477,8 @@ func New(config *ConnConfig, ntfnHandlers *NotificationHandlers) (*Client, error
 		client.chainParams = &chaincfg.RegressionNetParams
 	case chaincfg.SimNetParams.Name:
 		client.chainParams = &chaincfg.SimNetParams
+	case chaincfg.FreshNetParams.Name:
+		client.chainParams = &chaincfg.FreshNetParams
 	default:
 		return nil, fmt.Errorf("rpcclient.New: Unknown chain %s", config.Params)
 	}
@@ -162,7 +162,7 @@ func (r FutureSetGenerateResult) Receive() error {
 //
 // See SetGenerate for the blocking version and more details.
 func (c *Client) SetGenerateAsync(enable bool, numCPUs int) FutureSetGenerateResult {
-	cmd := btcjson.NewSetGenerateCmd(enable, &numCPUs)
+	cmd := btcjson.NewSetGenerateCmd(enable, &numCPUs, nil)
 	return c.SendCmd(cmd)
 }
 
@@ -171,6 +171,23 @@ func (c *Client) SetGenerate(enable bool, numCPUs int) error {
 	return c.SetGenerateAsync(enable, numCPUs).Receive()
 }
 
+// SetGenerateToAddressAsync returns an instance of a type that can be used to
+// get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See SetGenerateToAddress for the blocking version and more details.
+func (c *Client) SetGenerateToAddressAsync(enable bool, numCPUs int, address btcutil.Address) FutureSetGenerateResult {
+	addr := address.EncodeAddress()
+	cmd := btcjson.NewSetGenerateCmd(enable, &numCPUs, &addr)
+	return c.SendCmd(cmd)
+}
+
+// SetGenerateToAddress sets the server to generate coins (mine) or not and
+// replaces the addresses the generated blocks pay to with address.
+func (c *Client) SetGenerateToAddress(enable bool, numCPUs int, address btcutil.Address) error {
+	return c.SetGenerateToAddressAsync(enable, numCPUs, address).Receive()
+}
+
 // FutureGetHashesPerSecResult is a future promise to deliver the result of a
 // GetHashesPerSecAsync RPC invocation (or an applicable error).
 type FutureGetHashesPerSecResult chan *Response
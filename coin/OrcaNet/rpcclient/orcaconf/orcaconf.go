@@ -0,0 +1,279 @@
+// Package orcaconf connects programs running next to an OrcaNet node, such as
+// the coin API server and the peer, to the node and its OrcaWallet.
+//
+// The credentials and the network are read from the btcd.conf file OrcaNet
+// generates in its application data folder, and the ports are the defaults of
+// OrcaNet and OrcaWallet for that network.  Clients are cached and connected
+// again after a call fails to reach the server, so the callers keep working
+// across restarts of the node and the wallet.
+package orcaconf
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/rpcclient"
+)
+
+var (
+	btcdHomeDir   = btcutil.AppDataDir("btcd", false)
+	walletHomeDir = btcutil.AppDataDir("btcwallet", false)
+)
+
+// Error is a failed call to OrcaNet or OrcaWallet.  Status is the HTTP status
+// to answer callers with and Code the JSON-RPC error code of the server, 0 when
+// the server could not be reached.
+type Error struct {
+	Status  int    `json:"-"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error returns the message of the error.
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Settings describe how to reach OrcaNet and OrcaWallet.  The wallet is set up
+// with the credentials of the node.
+type Settings struct {
+	User       string
+	Pass       string
+	Params     *chaincfg.Params
+	NodePort   string
+	WalletPort string
+	DisableTLS bool
+}
+
+var (
+	clientMutex  sync.Mutex
+	nodeClient   *rpcclient.Client
+	walletClient *rpcclient.Client
+)
+
+// ReadBtcdConf returns the options set in the btcd.conf file at path.  Comments
+// and sections are skipped and values are kept whole, the generated rpcuser and
+// rpcpass end with '='.
+func ReadBtcdConf(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the btcd.conf file: %w", err)
+	}
+	defer file.Close()
+
+	options := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == ';' || line[0] == '#' || line[0] == '[' {
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		options[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return options, scanner.Err()
+}
+
+// ReadSettings reads the settings from the btcd.conf file of OrcaNet.
+func ReadSettings() (*Settings, error) {
+	options, err := ReadBtcdConf(filepath.Join(btcdHomeDir, "btcd.conf"))
+	if err != nil {
+		return nil, err
+	}
+	return settingsFromOptions(options)
+}
+
+func settingsFromOptions(options map[string]string) (*Settings, error) {
+	settings := &Settings{
+		User:       options["rpcuser"],
+		Pass:       options["rpcpass"],
+		Params:     &chaincfg.MainNetParams,
+		NodePort:   "8334",
+		WalletPort: "8332",
+		DisableTLS: options["notls"] == "1",
+	}
+	if settings.User == "" || settings.Pass == "" {
+		return nil, errors.New("error finding rpcuser and rpcpass in btcd.conf")
+	}
+	// The ports are the defaults of OrcaNet and OrcaWallet for each network.
+	switch {
+	case options["freshnet"] == "1":
+		settings.Params = &chaincfg.FreshNetParams
+	case options["testnet"] == "1":
+		settings.Params = &chaincfg.TestNet3Params
+		settings.NodePort, settings.WalletPort = "18334", "18332"
+	case options["regtest"] == "1":
+		settings.Params = &chaincfg.RegressionNetParams
+		settings.NodePort, settings.WalletPort = "18334", "18332"
+	case options["simnet"] == "1":
+		settings.Params = &chaincfg.SimNetParams
+		settings.NodePort, settings.WalletPort = "18556", "18554"
+	}
+	return settings, nil
+}
+
+// NodeConfig returns the connection config of OrcaNet.  The certificate is
+// only read when TLS is used.
+func (s *Settings) NodeConfig() (*rpcclient.ConnConfig, error) {
+	return s.connConfig(s.NodePort, filepath.Join(btcdHomeDir, "rpc.cert"),
+		s.DisableTLS)
+}
+
+// WalletConfig returns the connection config of OrcaWallet, which always uses
+// TLS.
+func (s *Settings) WalletConfig() (*rpcclient.ConnConfig, error) {
+	return s.connConfig(s.WalletPort, filepath.Join(walletHomeDir, "rpc.cert"),
+		false)
+}
+
+func (s *Settings) connConfig(port string, certFile string,
+	disableTLS bool) (*rpcclient.ConnConfig, error) {
+
+	config := &rpcclient.ConnConfig{
+		Host:       "localhost:" + port,
+		User:       s.User,
+		Pass:       s.Pass,
+		Params:     s.Params.Name,
+		DisableTLS: disableTLS,
+	}
+	if !disableTLS {
+		cert, err := os.ReadFile(certFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the RPC certificate: %w", err)
+		}
+		config.Certificates = cert
+	}
+	return config, nil
+}
+
+// Params returns the parameters of the network OrcaNet runs on.  Errors are
+// returned as *Error.
+func Params() (*chaincfg.Params, error) {
+	settings, err := ReadSettings()
+	if err != nil {
+		return nil, ToError(err, "OrcaNet")
+	}
+	return settings.Params, nil
+}
+
+// The client posts every request over HTTP, so it keeps working when the
+// server restarts.
+func getClient(cached **rpcclient.Client, wallet bool) (*rpcclient.Client, error) {
+	clientMutex.Lock()
+	defer clientMutex.Unlock()
+	if *cached != nil {
+		return *cached, nil
+	}
+	settings, err := ReadSettings()
+	if err != nil {
+		return nil, err
+	}
+	var config *rpcclient.ConnConfig
+	if wallet {
+		config, err = settings.WalletConfig()
+	} else {
+		config, err = settings.NodeConfig()
+	}
+	if err != nil {
+		return nil, err
+	}
+	config.HTTPPostMode = true
+	client, err := rpcclient.New(config, nil)
+	if err != nil {
+		return nil, err
+	}
+	*cached = client
+	return client, nil
+}
+
+// Forget client so the next call connects again with btcd.conf and the
+// certificate read anew, both are generated again when missing.
+func dropClient(cached **rpcclient.Client, client *rpcclient.Client) {
+	clientMutex.Lock()
+	defer clientMutex.Unlock()
+	if *cached == client {
+		*cached = nil
+		client.Shutdown()
+	}
+}
+
+// If the server cannot be reached the client is dropped, so the next call
+// reconnects.
+func call(cached **rpcclient.Client, wallet bool, name string,
+	fn func(*rpcclient.Client) error) error {
+
+	client, err := getClient(cached, wallet)
+	if err != nil {
+		return ToError(err, name)
+	}
+	err = fn(client)
+	var rpcErr *btcjson.RPCError
+	if err != nil && !errors.As(err, &rpcErr) {
+		dropClient(cached, client)
+	}
+	return ToError(err, name)
+}
+
+// Node calls fn with a client of the running OrcaNet node.  Errors are returned
+// as *Error.
+func Node(fn func(*rpcclient.Client) error) error {
+	return call(&nodeClient, false, "OrcaNet", fn)
+}
+
+// Wallet calls fn with a client of the running OrcaWallet.  Errors are
+// returned as *Error.
+func Wallet(fn func(*rpcclient.Client) error) error {
+	return call(&walletClient, true, "OrcaWallet", fn)
+}
+
+// ToError turns err into an *Error with the HTTP status matching its JSON-RPC
+// error code, or 503 Service Unavailable when the server named name could not
+// be reached.
+func ToError(err error, name string) error {
+	if err == nil {
+		return nil
+	}
+	var rpcErr *btcjson.RPCError
+	if errors.As(err, &rpcErr) {
+		return &Error{
+			Status:  rpcStatus(rpcErr.Code),
+			Code:    int(rpcErr.Code),
+			Message: rpcErr.Message,
+		}
+	}
+	return &Error{
+		Status:  http.StatusServiceUnavailable,
+		Message: name + " is not reachable: " + err.Error(),
+	}
+}
+
+func rpcStatus(code btcjson.RPCErrorCode) int {
+	switch code {
+	case btcjson.ErrRPCInvalidAddressOrKey, btcjson.ErrRPCInvalidParameter,
+		btcjson.ErrRPCType, btcjson.ErrRPCDeserialization,
+		btcjson.ErrRPCWalletInsufficientFunds,
+		btcjson.ErrRPCInvalidParams.Code:
+
+		return http.StatusBadRequest
+	case btcjson.ErrRPCWalletUnlockNeeded, btcjson.ErrRPCWalletPassphraseIncorrect:
+		return http.StatusForbidden
+	case btcjson.ErrRPCMethodNotFound.Code:
+		return http.StatusNotImplemented
+	case btcjson.ErrRPCInWarmup, btcjson.ErrRPCClientInInitialDownload:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadGateway
+	}
+}
@@ -0,0 +1,101 @@
+package orcaconf
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// TestReadBtcdConf ensures comments and sections are skipped and the generated
+// credentials are read whole.
+func TestReadBtcdConf(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "btcd.conf")
+	conf := "[Application Options]\n; rpcuser=commented\nrpcuser=dXNlcg==\nrpcpass = cGFzcw=\nfreshnet=1\n"
+	if err := os.WriteFile(path, []byte(conf), 0600); err != nil {
+		t.Fatal(err)
+	}
+	options, err := ReadBtcdConf(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Base64 padding is part of the generated credentials.
+	if options["rpcuser"] != "dXNlcg==" || options["rpcpass"] != "cGFzcw=" {
+		t.Errorf("credentials are %q and %q", options["rpcuser"],
+			options["rpcpass"])
+	}
+	if options["freshnet"] != "1" {
+		t.Errorf("freshnet is %q", options["freshnet"])
+	}
+}
+
+// TestSettings ensures each network gets the default ports of OrcaNet and
+// OrcaWallet and that credentials are required.
+func TestSettings(t *testing.T) {
+	tests := []struct {
+		network    string
+		params     *chaincfg.Params
+		nodePort   string
+		walletPort string
+	}{
+		{"", &chaincfg.MainNetParams, "8334", "8332"},
+		{"freshnet", &chaincfg.FreshNetParams, "8334", "8332"},
+		{"testnet", &chaincfg.TestNet3Params, "18334", "18332"},
+		{"regtest", &chaincfg.RegressionNetParams, "18334", "18332"},
+		{"simnet", &chaincfg.SimNetParams, "18556", "18554"},
+	}
+	for _, test := range tests {
+		options := map[string]string{"rpcuser": "u", "rpcpass": "p"}
+		if test.network != "" {
+			options[test.network] = "1"
+		}
+		settings, err := settingsFromOptions(options)
+		if err != nil {
+			t.Fatalf("%s: %v", test.network, err)
+		}
+		if settings.Params != test.params ||
+			settings.NodePort != test.nodePort ||
+			settings.WalletPort != test.walletPort {
+
+			t.Errorf("%s: got %s on ports %s and %s", test.network,
+				settings.Params.Name, settings.NodePort,
+				settings.WalletPort)
+		}
+	}
+
+	if _, err := settingsFromOptions(map[string]string{"rpcuser": "u"}); err == nil {
+		t.Error("settings without rpcpass were accepted")
+	}
+}
+
+// TestToError ensures JSON-RPC errors keep their code and get a matching HTTP
+// status, and unreachable servers answer 503.
+func TestToError(t *testing.T) {
+	for _, test := range []struct {
+		err    error
+		status int
+		code   int
+	}{
+		{btcjson.NewRPCError(btcjson.ErrRPCWalletPassphraseIncorrect, "wrong passphrase"), http.StatusForbidden, -14},
+		{btcjson.NewRPCError(btcjson.ErrRPCWalletInsufficientFunds, "insufficient funds"), http.StatusBadRequest, -6},
+		{btcjson.NewRPCError(btcjson.ErrRPCMisc, "failed"), http.StatusBadGateway, -1},
+		{errors.New("connection refused"), http.StatusServiceUnavailable, 0},
+	} {
+		var rpcErr *Error
+		if !errors.As(ToError(test.err, "OrcaWallet"), &rpcErr) {
+			t.Fatalf("%v is not an Error", test.err)
+		}
+		if rpcErr.Status != test.status || rpcErr.Code != test.code {
+			t.Errorf("%v: status %d and code %d, want %d and %d",
+				test.err, rpcErr.Status, rpcErr.Code, test.status,
+				test.code)
+		}
+	}
+	if ToError(nil, "OrcaNet") != nil {
+		t.Error("no error became an error")
+	}
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// restPrefix is the path the REST interface is served under.
+	restPrefix = "/rest/"
+
+	// defaultRESTHeaders is the number of headers returned by
+	// /rest/headers when no count is given.
+	defaultRESTHeaders = 5
+
+	// maxRESTHeaders is the most headers returned by one /rest/headers
+	// request.
+	maxRESTHeaders = 2000
+
+	// defaultRESTAddressTxns is the number of transactions returned by
+	// /rest/address when no count is given.
+	defaultRESTAddressTxns = 100
+
+	// maxRESTAddressTxns is the most transactions returned by one
+	// /rest/address request.
+	maxRESTAddressTxns = 1000
+)
+
+// restFormat is the format a REST response is written in, chosen by the
+// extension of the requested path.
+type restFormat int
+
+const (
+	restJSON restFormat = iota
+	restBinary
+	restHex
+)
+
+// restFormats maps the path extensions to the formats.
+var restFormats = map[string]restFormat{
+	"json": restJSON,
+	"bin":  restBinary,
+	"hex":  restHex,
+}
+
+// restError is a failed REST request along with the HTTP status to answer it
+// with.
+type restError struct {
+	status  int
+	message string
+}
+
+// Error satisfies the error interface.
+func (e *restError) Error() string {
+	return e.message
+}
+
+// restErrorf returns a restError with the passed status and a formatted
+// message.
+func restErrorf(status int, format string, args ...interface{}) *restError {
+	return &restError{status: status, message: fmt.Sprintf(format, args...)}
+}
+
+// restHandler is a handler of a REST path.  The path is what follows the
+// prefix of the handler, with the extension removed.
+type restHandler func(s *rpcServer, r *http.Request, path string,
+	format restFormat) (interface{}, error)
+
+// restHandlers maps the prefixes of the REST paths to their handlers.  The
+// first matching prefix wins.
+var restHandlers = []struct {
+	prefix  string
+	handler restHandler
+}{
+	{"block/notxdetails/", restBlockNoTxDetails},
+	{"block/", restBlock},
+	{"tx/", restTx},
+	{"address/", restAddressTxns},
+	{"headers/", restHeaders},
+	{"mempool/", restMempool},
+	{"chaininfo", restChainInfo},
+}
+
+// parseRESTPath splits a REST path below restPrefix into the handler serving
+// it, the rest of the path and the requested format.
+func parseRESTPath(path string) (restHandler, string, restFormat, error) {
+	dot := strings.LastIndex(path, ".")
+	if dot < 0 || dot < strings.LastIndex(path, "/") {
+		return nil, "", 0, restErrorf(http.StatusBadRequest,
+			"output format not found (available: json, bin, hex)")
+	}
+	format, ok := restFormats[path[dot+1:]]
+	if !ok {
+		return nil, "", 0, restErrorf(http.StatusBadRequest,
+			"output format %q not found (available: json, bin, hex)",
+			path[dot+1:])
+	}
+	path = path[:dot]
+	for _, h := range restHandlers {
+		if strings.HasPrefix(path, h.prefix) {
+			return h.handler, strings.TrimPrefix(path, h.prefix),
+				format, nil
+		}
+	}
+	return nil, "", 0, restErrorf(http.StatusNotFound, "not found")
+}
+
+// restStatus returns the HTTP status matching the code of a JSON-RPC error.
+func restStatus(code btcjson.RPCErrorCode) int {
+	switch code {
+	// The same code as ErrRPCInvalidAddressOrKey, the REST handlers check
+	// hashes and addresses first.
+	case btcjson.ErrRPCBlockNotFound:
+		return http.StatusNotFound
+	case btcjson.ErrRPCDecodeHexString, btcjson.ErrRPCInvalidParameter:
+		return http.StatusBadRequest
+	case btcjson.ErrRPCMisc:
+		// A missing index.
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// handleREST serves the block explorer REST interface.  Like the REST
+// interface of Bitcoin Core, it only serves public chain data, so it needs no
+// authentication, and the extension of the path selects JSON, binary or hex
+// encoded binary output.
+func (s *rpcServer) handleREST(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Limit the number of connections to max allowed.
+	if s.limitConnections(w, r.RemoteAddr) {
+		return
+	}
+	s.incrementClients()
+	defer s.decrementClients()
+
+	handler, path, format, err := parseRESTPath(
+		strings.TrimPrefix(r.URL.Path, restPrefix))
+	var result interface{}
+	if err == nil {
+		result, err = handler(s, r, path, format)
+	}
+	if err != nil {
+		status, message := http.StatusInternalServerError, err.Error()
+		switch e := err.(type) {
+		case *restError:
+			status = e.status
+		case *btcjson.RPCError:
+			status, message = restStatus(e.Code), e.Message
+		}
+		http.Error(w, message, status)
+		return
+	}
+
+	switch format {
+	case restBinary:
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(result.([]byte))
+	case restHex:
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintln(w, hex.EncodeToString(result.([]byte)))
+	default:
+		data, err := json.Marshal(result)
+		if err != nil {
+			rpcsLog.Errorf("Failed to marshal REST reply: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(append(data, '\n'))
+	}
+}
+
+// restHexResult decodes the hex string returned by a JSON-RPC handler.
+func restHexResult(result interface{}) ([]byte, error) {
+	return hex.DecodeString(result.(string))
+}
+
+// restBlock serves /rest/block/<hash>: the block and, in JSON, its
+// transactions in full.
+func restBlock(s *rpcServer, r *http.Request, path string,
+	format restFormat) (interface{}, error) {
+
+	return restGetBlock(s, r, path, format, 2)
+}
+
+// restBlockNoTxDetails serves /rest/block/notxdetails/<hash>: the block with
+// only the hashes of its transactions in JSON.
+func restBlockNoTxDetails(s *rpcServer, r *http.Request, path string,
+	format restFormat) (interface{}, error) {
+
+	return restGetBlock(s, r, path, format, 1)
+}
+
+// restGetBlock returns the serialized block of the passed hash, or the
+// getblock result of the passed verbosity in JSON.
+func restGetBlock(s *rpcServer, r *http.Request, hash string,
+	format restFormat, verbosity int) (interface{}, error) {
+
+	if _, err := chainhash.NewHashFromStr(hash); err != nil {
+		return nil, rpcDecodeHexError(hash)
+	}
+	if format != restJSON {
+		verbosity = 0
+	}
+	cmd := btcjson.NewGetBlockCmd(hash, &verbosity)
+	result, err := handleGetBlock(s, cmd, r.Context().Done())
+	if err != nil || format == restJSON {
+		return result, err
+	}
+	return restHexResult(result)
+}
+
+// restTx serves /rest/tx/<txid>: a transaction from the mempool or, with
+// --txindex, from the chain.
+func restTx(s *rpcServer, r *http.Request, txid string,
+	format restFormat) (interface{}, error) {
+
+	if _, err := chainhash.NewHashFromStr(txid); err != nil {
+		return nil, rpcDecodeHexError(txid)
+	}
+	verbose := 0
+	if format == restJSON {
+		verbose = 1
+	}
+	cmd := btcjson.NewGetRawTransactionCmd(txid, &verbose)
+	result, err := handleGetRawTransaction(s, cmd, r.Context().Done())
+	if err != nil || format == restJSON {
+		return result, err
+	}
+	return restHexResult(result)
+}
+
+// restAddressTxns serves /rest/address/<address>/txs: the transactions paying
+// or spending from an address, oldest first, found with --addrindex.  The
+// skip, count and reverse query parameters page through them.  In binary, the
+// transactions follow their number as a variable length integer, like the
+// transactions of a block.
+func restAddressTxns(s *rpcServer, r *http.Request, path string,
+	format restFormat) (interface{}, error) {
+
+	address := strings.TrimSuffix(path, "/txs")
+	if address == path || address == "" || strings.Contains(address, "/") {
+		return nil, restErrorf(http.StatusNotFound, "not found")
+	}
+	if _, err := btcutil.DecodeAddress(address, s.cfg.ChainParams); err != nil {
+		return nil, restErrorf(http.StatusBadRequest,
+			"invalid address %q: %v", address, err)
+	}
+	query := r.URL.Query()
+	skip, err := restIntParam(query.Get("skip"), 0, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	count, err := restIntParam(query.Get("count"), defaultRESTAddressTxns,
+		1, maxRESTAddressTxns)
+	if err != nil {
+		return nil, err
+	}
+	var reverse bool
+	if value := query.Get("reverse"); value != "" {
+		reverse, err = strconv.ParseBool(value)
+		if err != nil {
+			return nil, restErrorf(http.StatusBadRequest,
+				"reverse must be true or false")
+		}
+	}
+
+	verbose, vinExtra := 0, 0
+	if format == restJSON {
+		verbose, vinExtra = 1, 1
+	}
+	cmd := btcjson.NewSearchRawTransactionsCmd(address, &verbose, &skip,
+		&count, &vinExtra, &reverse, nil)
+	result, err := handleSearchRawTransactions(s, cmd, r.Context().Done())
+	if rpcErr, ok := err.(*btcjson.RPCError); ok &&
+		rpcErr.Code == btcjson.ErrRPCNoTxInfo {
+
+		// An address which was never used has no transactions.
+		if format == restJSON {
+			return []btcjson.SearchRawTransactionsResult{}, nil
+		}
+		result, err = []string{}, nil
+	}
+	if err != nil || format == restJSON {
+		return result, err
+	}
+
+	hexTxns := result.([]string)
+	var buf bytes.Buffer
+	if err := wire.WriteVarInt(&buf, 0, uint64(len(hexTxns))); err != nil {
+		return nil, err
+	}
+	for _, hexTx := range hexTxns {
+		tx, err := hex.DecodeString(hexTx)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(tx)
+	}
+	return buf.Bytes(), nil
+}
+
+// restHeaders serves /rest/headers/<hash>: the main chain headers starting
+// with the block of the passed hash.  The count query parameter sets how many,
+// defaultRESTHeaders by default.  In binary, the 80 byte headers follow each
+// other.
+func restHeaders(s *rpcServer, r *http.Request, path string,
+	format restFormat) (interface{}, error) {
+
+	// Bitcoin Core used to take the count in the path as
+	// /rest/headers/<count>/<hash>.
+	countParam := r.URL.Query().Get("count")
+	if i := strings.Index(path, "/"); i >= 0 {
+		countParam, path = path[:i], path[i+1:]
+	}
+	count, err := restIntParam(countParam, defaultRESTHeaders, 1,
+		maxRESTHeaders)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := chainhash.NewHashFromStr(path)
+	if err != nil {
+		return nil, rpcDecodeHexError(path)
+	}
+
+	chain := s.cfg.Chain
+	height, err := chain.BlockHeightByHash(hash)
+	if err != nil {
+		return nil, restErrorf(http.StatusNotFound,
+			"block %v is not in the main chain", hash)
+	}
+	best := chain.BestSnapshot().Height
+	if last := height + int32(count) - 1; last < best {
+		best = last
+	}
+
+	var buf bytes.Buffer
+	headers := make([]interface{}, 0, best-height+1)
+	verbose := true
+	for ; height <= best; height++ {
+		hash, err := chain.BlockHashByHeight(height)
+		if err != nil {
+			// The chain was reorganized meanwhile.
+			break
+		}
+		if format == restJSON {
+			cmd := btcjson.NewGetBlockHeaderCmd(hash.String(),
+				&verbose)
+			header, err := handleGetBlockHeader(s, cmd,
+				r.Context().Done())
+			if err != nil {
+				return nil, err
+			}
+			headers = append(headers, header)
+			continue
+		}
+		header, err := chain.HeaderByHash(hash)
+		if err != nil {
+			return nil, err
+		}
+		if err := header.Serialize(&buf); err != nil {
+			return nil, err
+		}
+	}
+	if format == restJSON {
+		return headers, nil
+	}
+	return buf.Bytes(), nil
+}
+
+// restMempool serves /rest/mempool/info and /rest/mempool/contents, the
+// getmempoolinfo and verbose getrawmempool results, in JSON only.
+func restMempool(s *rpcServer, r *http.Request, path string,
+	format restFormat) (interface{}, error) {
+
+	if path != "info" && path != "contents" {
+		return nil, restErrorf(http.StatusNotFound, "not found")
+	}
+	if format != restJSON {
+		return nil, restErrorf(http.StatusBadRequest,
+			"output format not found (available: json)")
+	}
+	if path == "info" {
+		return handleGetMempoolInfo(s, nil, r.Context().Done())
+	}
+	verbose := true
+	cmd := btcjson.NewGetRawMempoolCmd(&verbose)
+	return handleGetRawMempool(s, cmd, r.Context().Done())
+}
+
+// restChainInfo serves /rest/chaininfo, the getblockchaininfo result, in JSON
+// only.
+func restChainInfo(s *rpcServer, r *http.Request, path string,
+	format restFormat) (interface{}, error) {
+
+	if path != "" {
+		return nil, restErrorf(http.StatusNotFound, "not found")
+	}
+	if format != restJSON {
+		return nil, restErrorf(http.StatusBadRequest,
+			"output format not found (available: json)")
+	}
+	return handleGetBlockChainInfo(s, nil, r.Context().Done())
+}
+
+// restIntParam parses an integer query parameter, which is def when empty.
+// A negative max leaves the value unbounded.
+func restIntParam(value string, def, min, max int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min || (max >= 0 && n > max) {
+		if max < 0 {
+			return 0, restErrorf(http.StatusBadRequest,
+				"%q is not an integer of at least %d", value,
+				min)
+		}
+		return 0, restErrorf(http.StatusBadRequest,
+			"%q is not an integer from %d to %d", value, min, max)
+	}
+	return n, nil
+}
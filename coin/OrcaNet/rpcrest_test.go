@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// TestParseRESTPath ensures REST paths are routed to their handlers with the
+// format of their extension.
+func TestParseRESTPath(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		path    string
+		handler restHandler
+		rest    string
+		format  restFormat
+		status  int
+	}{
+		{"block/00ff.json", restBlock, "00ff", restJSON, 0},
+		{"block/notxdetails/00ff.hex", restBlockNoTxDetails, "00ff", restHex, 0},
+		{"tx/abcd.bin", restTx, "abcd", restBinary, 0},
+		{"address/SZ1x/txs.json", restAddressTxns, "SZ1x/txs", restJSON, 0},
+		{"headers/5/00ff.bin", restHeaders, "5/00ff", restBinary, 0},
+		{"mempool/contents.json", restMempool, "contents", restJSON, 0},
+		{"chaininfo.json", restChainInfo, "", restJSON, 0},
+		{"block/00ff", nil, "", 0, http.StatusBadRequest},
+		{"block.json/00ff", nil, "", 0, http.StatusBadRequest},
+		{"block/00ff.xml", nil, "", 0, http.StatusBadRequest},
+		{"unknown/00ff.json", nil, "", 0, http.StatusNotFound},
+	}
+	for _, test := range tests {
+		handler, rest, format, err := parseRESTPath(test.path)
+		if test.status != 0 {
+			restErr, ok := err.(*restError)
+			if !ok || restErr.status != test.status {
+				t.Errorf("%s: got error %v, want status %d",
+					test.path, err, test.status)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.path, err)
+			continue
+		}
+		if reflect.ValueOf(handler).Pointer() !=
+			reflect.ValueOf(test.handler).Pointer() ||
+			rest != test.rest || format != test.format {
+
+			t.Errorf("%s: got path %q format %d, want %q format %d",
+				test.path, rest, format, test.rest, test.format)
+		}
+	}
+}
+
+// TestRESTIntParam ensures integer query parameters are checked against their
+// bounds.
+func TestRESTIntParam(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		value   string
+		min     int
+		max     int
+		want    int
+		wantErr bool
+	}{
+		{"", 1, 10, 5, false},
+		{"3", 1, 10, 3, false},
+		{"0", 1, 10, 0, true},
+		{"11", 1, 10, 0, true},
+		{"x", 1, 10, 0, true},
+		{"1000000", 0, -1, 1000000, false},
+		{"-1", 0, -1, 0, true},
+	}
+	for _, test := range tests {
+		got, err := restIntParam(test.value, 5, test.min, test.max)
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Errorf("%q in [%d, %d]: got %d, %v", test.value,
+				test.min, test.max, got, err)
+		}
+	}
+}
@@ -38,6 +38,7 @@ import (
 	"github.com/btcsuite/btcd/mempool"
 	"github.com/btcsuite/btcd/mining"
 	"github.com/btcsuite/btcd/mining/cpuminer"
+	"github.com/btcsuite/btcd/mining/stratum"
 	"github.com/btcsuite/btcd/peer"
 	"github.com/btcsuite/btcd/rpcclient"
 	"github.com/btcsuite/btcd/txscript"
@@ -169,10 +170,12 @@ var rpcHandlersBeforeInit = map[string]commandHandler{
 	"getpeerinfo":            handleGetPeerInfo,
 	"getrawmempool":          handleGetRawMempool,
 	"getrawtransaction":      handleGetRawTransaction,
+	"getstratuminfo":         handleGetStratumInfo,
 	"gettxout":               handleGetTxOut,
 	"help":                   handleHelp,
 	"node":                   handleNode,
 	"ping":                   handlePing,
+	"searchfileanchors":      handleSearchFileAnchors,
 	"searchrawtransactions":  handleSearchRawTransactions,
 	"sendrawtransaction":     handleSendRawTransaction,
 	"setgenerate":            handleSetGenerate,
@@ -285,6 +288,7 @@ var rpcLimited = map[string]struct{}{
 	"getrawmempool":         {},
 	"getrawtransaction":     {},
 	"gettxout":              {},
+	"searchfileanchors":     {},
 	"searchrawtransactions": {},
 	"sendrawtransaction":    {},
 	"submitblock":           {},
@@ -348,14 +352,18 @@ type gbtWorkState struct {
 	template      *mining.BlockTemplate
 	notifyMap     map[chainhash.Hash]map[int64]chan struct{}
 	timeSource    blockchain.MedianTimeSource
+	chainParams   *chaincfg.Params
 }
 
 // newGbtWorkState returns a new instance of a gbtWorkState with all internal
 // fields initialized and ready to use.
-func newGbtWorkState(timeSource blockchain.MedianTimeSource) *gbtWorkState {
+func newGbtWorkState(timeSource blockchain.MedianTimeSource,
+	chainParams *chaincfg.Params) *gbtWorkState {
+
 	return &gbtWorkState{
-		notifyMap:  make(map[chainhash.Hash]map[int64]chan struct{}),
-		timeSource: timeSource,
+		notifyMap:   make(map[chainhash.Hash]map[int64]chan struct{}),
+		timeSource:  timeSource,
+		chainParams: chainParams,
 	}
 }
 
@@ -908,11 +916,11 @@ func handleEstimateFee(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 func handleGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// Respond with an error if there are no addresses to pay the
 	// created blocks to.
-	if len(cfg.miningAddrs) == 0 {
+	if len(s.cfg.CPUMiner.MiningAddrs()) == 0 {
 		return nil, &btcjson.RPCError{
 			Code: btcjson.ErrRPCInternal.Code,
 			Message: "No payment addresses specified " +
-				"via --miningaddr",
+				"via --miningaddr or setgenerate",
 		}
 	}
 
@@ -1604,7 +1612,8 @@ func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue bo
 		// to create their own coinbase.
 		var payAddr btcutil.Address
 		if !useCoinbaseValue {
-			payAddr = cfg.miningAddrs[rand.Intn(len(cfg.miningAddrs))]
+			miningAddrs := s.cfg.CPUMiner.MiningAddrs()
+			payAddr = miningAddrs[rand.Intn(len(miningAddrs))]
 		}
 
 		// Create a new block template that has a coinbase which anyone
@@ -1655,11 +1664,12 @@ func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue bo
 		// the pertinent details needed to create their own coinbase,
 		// add a payment address to the output of the coinbase of the
 		// template if it doesn't already have one.  Since this requires
-		// mining addresses to be specified via the config, an error is
-		// returned if none have been specified.
+		// mining addresses to be specified via the config or setgenerate,
+		// an error is returned if none have been specified.
 		if !useCoinbaseValue && !template.ValidPayAddress {
 			// Choose a payment address at random.
-			payToAddr := cfg.miningAddrs[rand.Intn(len(cfg.miningAddrs))]
+			miningAddrs := s.cfg.CPUMiner.MiningAddrs()
+			payToAddr := miningAddrs[rand.Intn(len(miningAddrs))]
 
 			// Update the block coinbase output of the template to
 			// pay to the randomly selected payment address.
@@ -1710,7 +1720,7 @@ func (state *gbtWorkState) blockTemplateResult(useCoinbaseValue bool, submitOld
 	msgBlock := template.Block
 	header := &msgBlock.Header
 	adjustedTime := state.timeSource.AdjustedTime()
-	maxTime := adjustedTime.Add(time.Second * blockchain.MaxTimeOffsetSeconds)
+	maxTime := adjustedTime.Add(blockchain.MaxTimeOffset(state.chainParams))
 	if header.Timestamp.After(maxTime) {
 		return nil, &btcjson.RPCError{
 			Code: btcjson.ErrRPCOutOfRange,
@@ -1968,12 +1978,13 @@ func handleGetBlockTemplateRequest(s *rpcServer, request *btcjson.TemplateReques
 
 	// When a coinbase transaction has been requested, respond with an error
 	// if there are no addresses to pay the created block template to.
-	if !useCoinbaseValue && len(cfg.miningAddrs) == 0 {
+	if !useCoinbaseValue && len(s.cfg.CPUMiner.MiningAddrs()) == 0 {
 		return nil, &btcjson.RPCError{
 			Code: btcjson.ErrRPCInternal.Code,
 			Message: "A coinbase transaction has been requested, " +
 				"but the server has not been configured with " +
-				"any payment addresses via --miningaddr",
+				"any payment addresses via --miningaddr or " +
+				"setgenerate",
 		}
 	}
 
@@ -2418,6 +2429,11 @@ func handleGetMiningInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{
 		}
 	}
 
+	var miningAddrs []string
+	for _, addr := range s.cfg.CPUMiner.MiningAddrs() {
+		miningAddrs = append(miningAddrs, addr.EncodeAddress())
+	}
+
 	best := s.cfg.Chain.BestSnapshot()
 	result := btcjson.GetMiningInfoResult{
 		Blocks:             int64(best.Height),
@@ -2428,6 +2444,7 @@ func handleGetMiningInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{
 		Generate:           s.cfg.CPUMiner.IsMining(),
 		GenProcLimit:       s.cfg.CPUMiner.NumWorkers(),
 		HashesPerSec:       s.cfg.CPUMiner.HashesPerSecond(),
+		MiningAddrs:        miningAddrs,
 		NetworkHashPS:      networkHashesPerSec,
 		PooledTx:           uint64(s.cfg.TxMemPool.Count()),
 		TestNet:            cfg.TestNet3,
@@ -2752,6 +2769,73 @@ func handleGetRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan str
 	return *rawTxn, nil
 }
 
+// handleGetStratumInfo implements the getstratuminfo command.
+func handleGetStratumInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	// Respond with an error if the stratum server is not running.
+	if s.cfg.StratumServer == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "Stratum server must be enabled (--stratum)",
+		}
+	}
+
+	info := s.cfg.StratumServer.Info()
+	toBTC := func(amounts map[string]btcutil.Amount) map[string]float64 {
+		result := make(map[string]float64, len(amounts))
+		for address, amount := range amounts {
+			result[address] = amount.ToBTC()
+		}
+		return result
+	}
+	result := &btcjson.GetStratumInfoResult{
+		Listeners:         info.Listeners,
+		Clients:           info.Clients,
+		Height:            info.Height,
+		Difficulty:        info.Difficulty,
+		NetworkDifficulty: info.NetworkDifficulty,
+		Workers:           make([]btcjson.StratumWorkerResult, 0, len(info.Workers)),
+		Blocks:            make([]btcjson.StratumBlockResult, 0, len(info.Ledger.Blocks)),
+		Balances:          toBTC(info.Ledger.Balances),
+		Payouts:           make([]btcjson.StratumPayoutResult, 0, len(info.Ledger.Payouts)),
+	}
+	for _, worker := range info.Workers {
+		var lastShare int64
+		if !worker.LastShare.IsZero() {
+			lastShare = worker.LastShare.Unix()
+		}
+		result.Workers = append(result.Workers, btcjson.StratumWorkerResult{
+			Name:         worker.Name,
+			Address:      worker.Address,
+			Connected:    worker.Connected,
+			Accepted:     worker.Accepted,
+			Rejected:     worker.Rejected,
+			Stale:        worker.Stale,
+			Blocks:       worker.Blocks,
+			LastShare:    lastShare,
+			HashesPerSec: worker.HashesPerSec,
+		})
+	}
+	for _, block := range info.Ledger.Blocks {
+		result.Blocks = append(result.Blocks, btcjson.StratumBlockResult{
+			Hash:    block.Hash,
+			Height:  block.Height,
+			Time:    block.Time.Unix(),
+			Reward:  block.Reward.ToBTC(),
+			Fee:     block.Fee.ToBTC(),
+			Status:  block.Status,
+			Credits: toBTC(block.Credits),
+		})
+	}
+	for _, payout := range info.Ledger.Payouts {
+		result.Payouts = append(result.Payouts, btcjson.StratumPayoutResult{
+			TxID:    payout.TxID,
+			Time:    payout.Time.Unix(),
+			Amounts: toBTC(payout.Amounts),
+		})
+	}
+	return result, nil
+}
+
 // handleGetTxOut handles gettxout commands.
 func handleGetTxOut(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.GetTxOutCmd)
@@ -3141,6 +3225,87 @@ func fetchMempoolTxnsForAddress(s *rpcServer, addr btcutil.Address, numToSkip, n
 	return mpTxns[numToSkip:rangeEnd], numToSkip
 }
 
+// handleSearchFileAnchors implements the searchfileanchors command.
+func handleSearchFileAnchors(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	// Respond with an error if the file anchor index is not enabled.
+	fileAnchorIndex := s.cfg.FileAnchorIndex
+	if fileAnchorIndex == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "File anchor index must be enabled (--fileanchorindex)",
+		}
+	}
+
+	c := cmd.(*btcjson.SearchFileAnchorsCmd)
+	kind := indexers.FileAnchorFile
+	if c.Kind != nil {
+		var err error
+		kind, err = indexers.ParseFileAnchorKind(*c.Kind)
+		if err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: err.Error(),
+			}
+		}
+	}
+
+	// File keys are the hex-encoded SHA-256 hash of the file, as they are
+	// shared on the DHT, so unlike hashes of the chain they aren't
+	// byte-reversed.
+	keyBytes, err := hex.DecodeString(c.Key)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.Key)
+	}
+	if len(keyBytes) != indexers.FileAnchorKeySize {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Key must be %d bytes (not %d)",
+				indexers.FileAnchorKeySize, len(keyBytes)),
+		}
+	}
+	var key [indexers.FileAnchorKeySize]byte
+	copy(key[:], keyBytes)
+
+	skip := 0
+	if c.Skip != nil && *c.Skip > 0 {
+		skip = *c.Skip
+	}
+	count := 100
+	if c.Count != nil {
+		count = *c.Count
+		if count < 0 {
+			count = 1
+		}
+	}
+
+	anchors, err := fileAnchorIndex.AnchorsForKey(kind, key, skip, count)
+	if err != nil {
+		context := "Failed to search file anchors"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	best := s.cfg.Chain.BestSnapshot()
+	results := make([]btcjson.SearchFileAnchorsResult, 0, len(anchors))
+	for _, anchor := range anchors {
+		header, err := s.cfg.Chain.HeaderByHash(&anchor.BlockHash)
+		if err != nil {
+			context := "Failed to fetch block header"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		results = append(results, btcjson.SearchFileAnchorsResult{
+			Kind:          anchor.Kind.String(),
+			Key:           hex.EncodeToString(anchor.Key[:]),
+			TxID:          anchor.TxHash.String(),
+			BlockHash:     anchor.BlockHash.String(),
+			Height:        anchor.Height,
+			BlockTime:     header.Timestamp.Unix(),
+			Confirmations: int64(1 + best.Height - anchor.Height),
+		})
+	}
+
+	return results, nil
+}
+
 // handleSearchRawTransactions implements the searchrawtransactions command.
 func handleSearchRawTransactions(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// Respond with an error if the address index is not enabled.
@@ -3523,16 +3688,45 @@ func handleSetGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 		generate = false
 	}
 
+	// Replace the addresses the created blocks pay to when one is given.
+	// A running miner picks the new address up with its next block
+	// template, so there is no need to restart it.
+	if c.MiningAddr != nil {
+		params := s.cfg.ChainParams
+		addr, err := btcutil.DecodeAddress(*c.MiningAddr, params)
+		if err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidAddressOrKey,
+				Message: "Invalid address or key: " + err.Error(),
+			}
+		}
+		if !addr.IsForNet(params) {
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCInvalidAddressOrKey,
+				Message: "Invalid address or key: address is " +
+					"on the wrong network",
+			}
+		}
+		s.cfg.CPUMiner.SetMiningAddrs([]btcutil.Address{addr})
+
+		// Have getblocktemplate generate a new template as well, rather
+		// than keep handing out one paying to the old address.
+		state := s.gbtWorkState
+		state.Lock()
+		state.prevHash = nil
+		state.Unlock()
+	}
+
 	if !generate {
 		s.cfg.CPUMiner.Stop()
 	} else {
 		// Respond with an error if there are no addresses to pay the
 		// created blocks to.
-		if len(cfg.miningAddrs) == 0 {
+		if len(s.cfg.CPUMiner.MiningAddrs()) == 0 {
 			return nil, &btcjson.RPCError{
 				Code: btcjson.ErrRPCInternal.Code,
 				Message: "No payment addresses specified " +
-					"via --miningaddr",
+					"via --miningaddr or setgenerate",
 			}
 		}
 
@@ -4625,6 +4819,11 @@ func (s *rpcServer) Start() {
 		s.WebsocketHandler(ws, r.RemoteAddr, authenticated, isAdmin)
 	})
 
+	// Block explorer REST endpoints.
+	if cfg.REST {
+		rpcServeMux.HandleFunc(restPrefix, s.handleREST)
+	}
+
 	for _, listener := range s.cfg.Listeners {
 		s.wg.Add(1)
 		go func(listener net.Listener) {
@@ -4814,12 +5013,19 @@ type rpcserverConfig struct {
 	Generator *mining.BlkTmplGenerator
 	CPUMiner  *cpuminer.CPUMiner
 
+	// StratumServer is the stratum mining pool, nil when it isn't enabled.
+	StratumServer *stratum.Server
+
 	// These fields define any optional indexes the RPC server can make use
 	// of to provide additional data when queried.
 	TxIndex   *indexers.TxIndex
 	AddrIndex *indexers.AddrIndex
 	CfIndex   *indexers.CfIndex
 
+	// FileAnchorIndex is the index of the file keys and storage contracts
+	// anchored on the chain, nil when it isn't enabled.
+	FileAnchorIndex *indexers.FileAnchorIndex
+
 	// The fee estimator keeps track of how long transactions are left in
 	// the mempool before they are mined into blocks.
 	FeeEstimator *mempool.FeeEstimator
@@ -4830,7 +5036,7 @@ func newRPCServer(config *rpcserverConfig) (*rpcServer, error) {
 	rpc := rpcServer{
 		cfg:                    *config,
 		statusLines:            make(map[int]string),
-		gbtWorkState:           newGbtWorkState(config.TimeSource),
+		gbtWorkState:           newGbtWorkState(config.TimeSource, config.ChainParams),
 		helpCacher:             newHelpCacher(),
 		requestProcessShutdown: make(chan struct{}),
 		quit:                   make(chan int),
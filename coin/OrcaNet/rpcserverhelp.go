@@ -426,6 +426,55 @@ var helpDescsEnUS = map[string]string{
 	"getheaders-hashstop":      "Block hash to stop including block headers for; if not found, all headers to the latest known block are returned.",
 	"getheaders--result0":      "Serialized block headers of all located blocks, limited to some arbitrary maximum number of hashes (currently 2000, which matches the wire protocol headers message, but this is not guaranteed)",
 
+	// GetStratumInfoCmd help.
+	"getstratuminfo--synopsis": "Returns the state of the stratum mining pool: its workers, the blocks it found with what they credit to each address, the balances due and the payouts made.\n" +
+		"Usage of this RPC requires the optional --stratum flag to be set.",
+
+	// GetStratumInfoResult help.
+	"getstratuminforesult-listeners":         "The addresses the stratum server listens on",
+	"getstratuminforesult-clients":           "The number of connected miners",
+	"getstratuminforesult-height":            "The height of the block the miners work on",
+	"getstratuminforesult-difficulty":        "The difficulty of the shares",
+	"getstratuminforesult-networkdifficulty": "The difficulty of the block the miners work on, in share difficulty units",
+	"getstratuminforesult-workers":           "The workers which submitted shares since the server started",
+	"getstratuminforesult-blocks":            "The blocks found by the pool, the newest first",
+	"getstratuminforesult-balances":          "The matured credits in BTC not paid yet, keyed by address",
+	"getstratuminforesult-balances--key":     "address",
+	"getstratuminforesult-balances--value":   "n.nnn",
+	"getstratuminforesult-balances--desc":    "The address as the key and the balance in BTC as the value",
+	"getstratuminforesult-payouts":           "The payouts made by the pool, the newest first",
+
+	// StratumWorkerResult help.
+	"stratumworkerresult-name":         "The worker name: the address it mines to, optionally followed by a dot and the name of the machine",
+	"stratumworkerresult-address":      "The address the shares of the worker are credited to",
+	"stratumworkerresult-connected":    "Whether the worker is connected",
+	"stratumworkerresult-accepted":     "The number of accepted shares",
+	"stratumworkerresult-rejected":     "The number of rejected shares",
+	"stratumworkerresult-stale":        "The number of shares for work which was no longer current",
+	"stratumworkerresult-blocks":       "The number of blocks found by the worker",
+	"stratumworkerresult-lastshare":    "The time of the last accepted share in seconds since 1 Jan 1970 GMT",
+	"stratumworkerresult-hashespersec": "The hash rate of the worker worked out from its recent shares",
+
+	// StratumBlockResult help.
+	"stratumblockresult-hash":           "The hash of the block",
+	"stratumblockresult-height":         "The height of the block",
+	"stratumblockresult-time":           "The time the block was found in seconds since 1 Jan 1970 GMT",
+	"stratumblockresult-reward":         "The value of the coinbase in BTC",
+	"stratumblockresult-fee":            "The part of the reward in BTC kept by the pool",
+	"stratumblockresult-status":         "Whether the coinbase is immature, mature or orphaned",
+	"stratumblockresult-credits":        "What the block credits to each address in BTC once the coinbase matures",
+	"stratumblockresult-credits--key":   "address",
+	"stratumblockresult-credits--value": "n.nnn",
+	"stratumblockresult-credits--desc":  "The address as the key and the credit in BTC as the value",
+
+	// StratumPayoutResult help.
+	"stratumpayoutresult-txid":           "The hash of the payout transaction",
+	"stratumpayoutresult-time":           "The time of the payout in seconds since 1 Jan 1970 GMT",
+	"stratumpayoutresult-amounts":        "The amounts in BTC paid to each address",
+	"stratumpayoutresult-amounts--key":   "address",
+	"stratumpayoutresult-amounts--value": "n.nnn",
+	"stratumpayoutresult-amounts--desc":  "The address as the key and the amount in BTC as the value",
+
 	// GetInfoCmd help.
 	"getinfo--synopsis": "Returns a JSON object containing various state info.",
 
@@ -446,6 +495,7 @@ var helpDescsEnUS = map[string]string{
 	"getmininginforesult-generate":           "Whether or not server is set to generate coins",
 	"getmininginforesult-genproclimit":       "Number of processors to use for coin generation (-1 when disabled)",
 	"getmininginforesult-hashespersec":       "Recent hashes per second performance measurement while generating coins",
+	"getmininginforesult-miningaddrs":        "Addresses the generated blocks pay to",
 	"getmininginforesult-networkhashps":      "Estimated network hashes per second for the most recent blocks",
 	"getmininginforesult-pooledtx":           "Number of transactions in the memory pool",
 	"getmininginforesult-testnet":            "Whether or not server is using testnet",
@@ -556,6 +606,25 @@ var helpDescsEnUS = map[string]string{
 	"ping--synopsis": "Queues a ping to be sent to each connected peer.\n" +
 		"Ping times are provided by getpeerinfo via the pingtime and pingwait fields.",
 
+	// SearchFileAnchorsCmd help.
+	"searchfileanchors--synopsis": "Returns the transactions that anchored a file key or storage contract on the chain, the oldest first.\n" +
+		"An anchor is a transaction output with the script OP_RETURN <\"ORCA\"><kind><key>, where kind is 1 for a file key and 2 for a storage contract.\n" +
+		"The block of the first anchor records when the key was first published.\n" +
+		"Usage of this RPC requires the optional --fileanchorindex flag to be activated.",
+	"searchfileanchors-key":   "The hex-encoded 32 byte file key or storage contract hash to search for",
+	"searchfileanchors-kind":  "Whether key is a file key or the hash of a storage contract",
+	"searchfileanchors-skip":  "The number of leading anchors to leave out of the final response",
+	"searchfileanchors-count": "The maximum number of anchors to return",
+
+	// SearchFileAnchorsResult help.
+	"searchfileanchorsresult-kind":          "Whether the anchored key is a file key or the hash of a storage contract",
+	"searchfileanchorsresult-key":           "The hex-encoded anchored key",
+	"searchfileanchorsresult-txid":          "The hash of the transaction that anchored the key",
+	"searchfileanchorsresult-blockhash":     "Hash of the block the transaction is part of",
+	"searchfileanchorsresult-height":        "Height of the block the transaction is part of",
+	"searchfileanchorsresult-blocktime":     "Block time in seconds since 1 Jan 1970 GMT",
+	"searchfileanchorsresult-confirmations": "Number of confirmations of the block",
+
 	// SearchRawTransactionsCmd help.
 	"searchrawtransactions--synopsis": "Returns raw data for transactions involving the passed address.\n" +
 		"Returned transactions are pulled from both the database, and transactions currently in the mempool.\n" +
@@ -584,6 +653,7 @@ var helpDescsEnUS = map[string]string{
 	"setgenerate--synopsis":    "Set the server to generate coins (mine) or not.",
 	"setgenerate-generate":     "Use true to enable generation, false to disable it",
 	"setgenerate-genproclimit": "The number of processors (cores) to limit generation to or -1 for default",
+	"setgenerate-miningaddr":   "Address the generated blocks pay to, replacing the addresses set with --miningaddr",
 
 	// SignMessageWithPrivKeyCmd help.
 	"signmessagewithprivkey--synopsis": "Sign a message with the private key of an address",
@@ -777,6 +847,7 @@ var rpcResultTypes = map[string][]interface{}{
 	"gethashespersec":        {(*float64)(nil)},
 	"getheaders":             {(*[]string)(nil)},
 	"getinfo":                {(*btcjson.InfoChainResult)(nil)},
+	"getstratuminfo":         {(*btcjson.GetStratumInfoResult)(nil)},
 	"getmempoolinfo":         {(*btcjson.GetMempoolInfoResult)(nil)},
 	"getmininginfo":          {(*btcjson.GetMiningInfoResult)(nil)},
 	"getnettotals":           {(*btcjson.GetNetTotalsResult)(nil)},
@@ -789,6 +860,7 @@ var rpcResultTypes = map[string][]interface{}{
 	"node":                   nil,
 	"help":                   {(*string)(nil), (*string)(nil)},
 	"ping":                   nil,
+	"searchfileanchors":      {(*[]btcjson.SearchFileAnchorsResult)(nil)},
 	"searchrawtransactions":  {(*string)(nil), (*[]btcjson.SearchRawTransactionsResult)(nil)},
 	"sendrawtransaction":     {(*string)(nil)},
 	"setgenerate":            nil,
@@ -14,6 +14,8 @@ import (
 	"fmt"
 	"math"
 	"net"
+	"os"
+	"path/filepath"
 	"runtime"
 	"sort"
 	"strconv"
@@ -34,8 +36,10 @@ import (
 	"github.com/btcsuite/btcd/mempool"
 	"github.com/btcsuite/btcd/mining"
 	"github.com/btcsuite/btcd/mining/cpuminer"
+	"github.com/btcsuite/btcd/mining/stratum"
 	"github.com/btcsuite/btcd/netsync"
 	"github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btcd/rpcclient"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/decred/dcrd/lru"
@@ -216,6 +220,7 @@ type server struct {
 	chain                *blockchain.BlockChain
 	txMemPool            *mempool.TxPool
 	cpuMiner             *cpuminer.CPUMiner
+	stratumServer        *stratum.Server
 	modifyRebroadcastInv chan interface{}
 	newPeers             chan *serverPeer
 	donePeers            chan *serverPeer
@@ -239,6 +244,9 @@ type server struct {
 	addrIndex *indexers.AddrIndex
 	cfIndex   *indexers.CfIndex
 
+	// fileAnchorIndex is nil unless --fileanchorindex is given.
+	fileAnchorIndex *indexers.FileAnchorIndex
+
 	// The fee estimator keeps track of how long transactions are left in
 	// the mempool before they are mined into blocks.
 	feeEstimator *mempool.FeeEstimator
@@ -2490,6 +2498,11 @@ func (s *server) Start() {
 	if cfg.Generate {
 		s.cpuMiner.Start()
 	}
+
+	// Start the stratum server if it's enabled.
+	if s.stratumServer != nil {
+		s.stratumServer.Start()
+	}
 }
 
 // Stop gracefully shuts down the server by stopping and disconnecting all
@@ -2506,6 +2519,11 @@ func (s *server) Stop() error {
 	// Stop the CPU miner if needed
 	s.cpuMiner.Stop()
 
+	// Stop the stratum server if needed.
+	if s.stratumServer != nil {
+		s.stratumServer.Stop()
+	}
+
 	// Shutdown the RPC server if it's not disabled.
 	if !cfg.DisableRPC {
 		s.rpcServer.Stop()
@@ -2716,6 +2734,65 @@ func setupRPCListeners() ([]net.Listener, error) {
 	return listeners, nil
 }
 
+// setupStratumListeners returns a slice of listeners that are configured for
+// use with the stratum server depending on the configuration settings for
+// listen addresses.  Miners speak plain TCP, so unlike the RPC listeners they
+// don't use TLS.
+func setupStratumListeners() ([]net.Listener, error) {
+	netAddrs, err := parseListeners(cfg.StratumListeners)
+	if err != nil {
+		return nil, err
+	}
+
+	listeners := make([]net.Listener, 0, len(netAddrs))
+	for _, addr := range netAddrs {
+		listener, err := net.Listen(addr.Network(), addr.String())
+		if err != nil {
+			minrLog.Warnf("Can't listen on %s: %v", addr, err)
+			continue
+		}
+		listeners = append(listeners, listener)
+	}
+
+	return listeners, nil
+}
+
+// stratumPayout pays the due balances of the stratum miners from the default
+// account of the wallet given by --stratumwallet.
+func stratumPayout(amounts map[string]btcutil.Amount) (*chainhash.Hash, error) {
+	certs, err := os.ReadFile(cfg.StratumWalletCert)
+	if err != nil {
+		return nil, err
+	}
+	client, err := rpcclient.New(&rpcclient.ConnConfig{
+		Host:         cfg.StratumWallet,
+		User:         cfg.RPCUser,
+		Pass:         cfg.RPCPass,
+		Certificates: certs,
+		HTTPPostMode: true,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Shutdown()
+
+	payments := make(map[btcutil.Address]btcutil.Amount, len(amounts))
+	for address, amount := range amounts {
+		addr, err := btcutil.DecodeAddress(address, activeNetParams.Params)
+		if err != nil {
+			return nil, err
+		}
+		payments[addr] = amount
+	}
+	if cfg.StratumWalletPass != "" {
+		err := client.WalletPassphrase(cfg.StratumWalletPass, 60)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return client.SendMany("default", payments)
+}
+
 // newServer returns a new btcd server configured to listen on addr for the
 // bitcoin network type specified by chainParams.  Use start to begin accepting
 // connections from peers.
@@ -2810,6 +2887,11 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		s.cfIndex = indexers.NewCfIndex(db, chainParams)
 		indexes = append(indexes, s.cfIndex)
 	}
+	if cfg.FileAnchorIndex {
+		indxLog.Info("File anchor index is enabled")
+		s.fileAnchorIndex = indexers.NewFileAnchorIndex(db)
+		indexes = append(indexes, s.fileAnchorIndex)
+	}
 
 	// Create an index manager if any of the optional indexes are enabled.
 	var indexManager blockchain.IndexManager
@@ -2936,6 +3018,39 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		IsCurrent:              s.syncManager.IsCurrent,
 	})
 
+	// Set up the stratum mining pool if it's enabled.
+	if len(cfg.StratumListeners) > 0 {
+		stratumListeners, err := setupStratumListeners()
+		if err != nil {
+			return nil, err
+		}
+		if len(stratumListeners) == 0 {
+			return nil, errors.New("STRATUM: No valid listen address")
+		}
+		ledger, err := stratum.LoadLedger(filepath.Join(cfg.DataDir,
+			"stratum-ledger.json"), cfg.StratumPPLNS, cfg.StratumFee)
+		if err != nil {
+			return nil, err
+		}
+		var payout func(map[string]btcutil.Amount) (*chainhash.Hash, error)
+		if cfg.StratumWallet != "" {
+			payout = stratumPayout
+		}
+		s.stratumServer = stratum.New(&stratum.Config{
+			ChainParams:            chainParams,
+			Chain:                  s.chain,
+			BlockTemplateGenerator: blockTemplateGenerator,
+			PayToAddr:              cfg.stratumAddr,
+			Listeners:              stratumListeners,
+			Difficulty:             cfg.StratumDifficulty,
+			Ledger:                 ledger,
+			ProcessBlock:           s.syncManager.ProcessBlock,
+			IsCurrent:              s.syncManager.IsCurrent,
+			Payout:                 payout,
+			MinPayout:              cfg.stratumMinPayout,
+		})
+	}
+
 	// Only setup a function to return new addresses to connect to when
 	// not running in connect-only mode.  The simulation network is always
 	// in connect-only mode since it is only intended to connect to
@@ -3048,6 +3163,9 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 			AddrIndex:    s.addrIndex,
 			CfIndex:      s.cfIndex,
 			FeeEstimator: s.feeEstimator,
+
+			FileAnchorIndex: s.fileAnchorIndex,
+			StratumServer:   s.stratumServer,
 		})
 		if err != nil {
 			return nil, err
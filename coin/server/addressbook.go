@@ -0,0 +1,163 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync"
+
+    "github.com/btcsuite/btcd/btcutil"
+)
+
+// where the server keeps its own files, e.g. the address book
+var serverDataDir = btcutil.AppDataDir("orcanetapiserver", false)
+
+type AddressBookEntry struct {
+    Address string `json:"address"`
+    Label   string `json:"label"`
+}
+
+// AddressBook: labels for addresses, ours and those of others, kept in a JSON file
+type AddressBook struct {
+    path    string
+    mutex   sync.RWMutex
+    entries map[string]string
+}
+
+var addressBook = &AddressBook{entries: make(map[string]string)}
+
+// loadAddressBook: reads the address book saved at path, a missing file is an empty address book
+func loadAddressBook(path string) (*AddressBook, error) {
+    book := &AddressBook{path: path, entries: make(map[string]string)}
+    data, err := os.ReadFile(path)
+    if errors.Is(err, os.ErrNotExist) {
+        return book, nil
+    } else if err != nil {
+        return nil, err
+    }
+    var entries []AddressBookEntry
+    if err := json.Unmarshal(data, &entries); err != nil {
+        return nil, fmt.Errorf("failed to read the address book: %w", err)
+    }
+    for _, entry := range entries {
+        book.entries[entry.Address] = entry.Label
+    }
+    return book, nil
+}
+
+// Label: returns the label of address, "" if it has none
+func (b *AddressBook) Label(address string) string {
+    b.mutex.RLock()
+    defer b.mutex.RUnlock()
+    return b.entries[address]
+}
+
+// Entries: returns the address book sorted by label, then address
+func (b *AddressBook) Entries() []AddressBookEntry {
+    b.mutex.RLock()
+    defer b.mutex.RUnlock()
+    entries := make([]AddressBookEntry, 0, len(b.entries))
+    for address, label := range b.entries {
+        entries = append(entries, AddressBookEntry{Address: address, Label: label})
+    }
+    sort.Slice(entries, func(i, j int) bool {
+        if entries[i].Label != entries[j].Label {
+            return entries[i].Label < entries[j].Label
+        }
+        return entries[i].Address < entries[j].Address
+    })
+    return entries
+}
+
+// Set: labels address, replacing its previous label
+func (b *AddressBook) Set(address string, label string) error {
+    b.mutex.Lock()
+    defer b.mutex.Unlock()
+    b.entries[address] = label
+    return b.save()
+}
+
+// Remove: removes address, returns false if it wasn't in the address book
+func (b *AddressBook) Remove(address string) (bool, error) {
+    b.mutex.Lock()
+    defer b.mutex.Unlock()
+    if _, ok := b.entries[address]; !ok {
+        return false, nil
+    }
+    delete(b.entries, address)
+    return true, b.save()
+}
+
+// save: writes to a temporary file first so a crash never leaves a truncated address book, the mutex must be held
+func (b *AddressBook) save() error {
+    if b.path == "" {
+        return nil
+    }
+    entries := make([]AddressBookEntry, 0, len(b.entries))
+    for address, label := range b.entries {
+        entries = append(entries, AddressBookEntry{Address: address, Label: label})
+    }
+    data, err := json.MarshalIndent(entries, "", "  ")
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(filepath.Dir(b.path), 0700); err != nil {
+        return err
+    }
+    tmpPath := b.path + ".tmp"
+    if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+        return err
+    }
+    return os.Rename(tmpPath, b.path)
+}
+
+// addressBookHandler: endpoint for the address book
+// GET lists the entries, POST adds or relabels one with a JSON body {"address": ..., "label": ...}
+// and DELETE removes the address given in the "address" query parameter
+func addressBookHandler(w http.ResponseWriter, r *http.Request) {
+    fmt.Println("addressBook endpoint")
+    switch r.Method {
+    case http.MethodGet:
+        writeJSON(w, addressBook.Entries())
+    case http.MethodPost:
+        var entry AddressBookEntry
+        if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+            http.Error(w, "Error reading request body", http.StatusBadRequest)
+            return
+        }
+        entry.Label = strings.TrimSpace(entry.Label)
+        if entry.Label == "" {
+            http.Error(w, "Missing label", http.StatusBadRequest)
+            return
+        }
+        address, err := decodeAddress(entry.Address)
+        if err != nil {
+            writeError(w, err)
+            return
+        }
+        entry.Address = address.EncodeAddress()
+        if err := addressBook.Set(entry.Address, entry.Label); err != nil {
+            writeError(w, err)
+            return
+        }
+        writeJSON(w, entry)
+    case http.MethodDelete:
+        removed, err := addressBook.Remove(r.URL.Query().Get("address"))
+        if err != nil {
+            writeError(w, err)
+            return
+        }
+        if !removed {
+            http.Error(w, "Address is not in the address book", http.StatusNotFound)
+            return
+        }
+        w.WriteHeader(http.StatusNoContent)
+    default:
+        http.Error(w, "Only GET, POST and DELETE requests are handled", http.StatusMethodNotAllowed)
+    }
+}
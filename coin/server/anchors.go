@@ -0,0 +1,211 @@
+package main
+
+import (
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "sort"
+    "strings"
+    "sync"
+
+    "github.com/btcsuite/btcd/blockchain/indexers"
+    "github.com/btcsuite/btcd/btcutil"
+    "github.com/btcsuite/btcd/chaincfg/chainhash"
+    "github.com/btcsuite/btcd/rpcclient"
+    "github.com/btcsuite/btcd/txscript"
+    "github.com/btcsuite/btcd/wire"
+    "github.com/coloshword/OrcaNetAPIServer/manageOrcaNet"
+)
+
+const (
+    // fee paid by anchor transactions in satoshis per byte, well above what OrcaNet relays
+    anchorFeeRate = 5
+    // upper bounds of the serialized sizes used to work out the fee: the transaction without its inputs and
+    // outputs, a P2PKH input, the change output and the anchor output
+    anchorTxOverhead = 10
+    anchorInputSize = 148
+    anchorChangeSize = 34
+    anchorOutputSize = 8 + 1 + 2 + indexers.FileAnchorKeySize + 5
+    // change below this many satoshis is left to the fee, OrcaNet doesn't relay smaller P2PKH outputs
+    anchorDustLimit = 546
+    // the most anchors searchFileAnchors returns at once
+    maxAnchorsPage = 100
+)
+
+// anchor transactions are built one at a time so two of them don't pick the same coins
+var anchorMutex sync.Mutex
+
+type AnchorRequest struct {
+    Key              string `json:"key"`
+    Kind             string `json:"kind"`
+    SenderWalletPass string `json:"senderwalletpass"`
+}
+
+// parseAnchorKey: decodes a hex-encoded file key or storage contract hash and the kind of anchor, "file" by default
+func parseAnchorKey(key string, kind string) ([indexers.FileAnchorKeySize]byte, indexers.FileAnchorKind, error) {
+    var parsed [indexers.FileAnchorKeySize]byte
+    anchorKind := indexers.FileAnchorFile
+    if kind != "" {
+        var err error
+        anchorKind, err = indexers.ParseFileAnchorKind(kind)
+        if err != nil {
+            return parsed, 0, &manageOrcaNet.Error{Status: http.StatusBadRequest, Message: "kind must be file or contract"}
+        }
+    }
+    decoded, err := hex.DecodeString(strings.TrimSpace(key))
+    if err != nil || len(decoded) != len(parsed) {
+        return parsed, 0, &manageOrcaNet.Error{Status: http.StatusBadRequest, Message: fmt.Sprintf("key must be a %d byte hex string", len(parsed))}
+    }
+    copy(parsed[:], decoded)
+    return parsed, anchorKind, nil
+}
+
+// anchorFile: endpoint that timestamps a file key or the hash of a storage contract on the chain
+// it sends a transaction with an OP_RETURN output carrying the key, which costs only the transaction fee
+// Usage: POST a JSON object {"key": <hex SHA-256 hash>, "kind": "file" or "contract", "senderwalletpass": ...},
+// kind is "file" by default, returns {"txid": ...}
+func anchorFile(w http.ResponseWriter, r *http.Request) {
+    fmt.Println("anchorFile endpoint")
+    if r.Method != http.MethodPost {
+        http.Error(w, "Only POST requests are handled", http.StatusMethodNotAllowed)
+        return
+    }
+    var request AnchorRequest
+    if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+        http.Error(w, "Error reading request body", http.StatusBadRequest)
+        return
+    }
+    key, kind, err := parseAnchorKey(request.Key, request.Kind)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    script, err := indexers.FileAnchorScript(kind, key)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    anchorMutex.Lock()
+    defer anchorMutex.Unlock()
+    var tx *wire.MsgTx
+    err = manageOrcaNet.Wallet(func(c *rpcclient.Client) error {
+        var err error
+        tx, err = buildAnchorTx(c, script)
+        if err != nil {
+            return err
+        }
+        if err := c.WalletPassphrase(request.SenderWalletPass, walletUnlockSecs); err != nil {
+            return err
+        }
+        signed, complete, err := c.SignRawTransaction(tx)
+        if err != nil {
+            return err
+        }
+        if !complete {
+            return fmt.Errorf("the wallet could not sign the anchor transaction")
+        }
+        tx = signed
+        return nil
+    })
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    var txid *chainhash.Hash
+    err = manageOrcaNet.Node(func(c *rpcclient.Client) error {
+        var err error
+        txid, err = c.SendRawTransaction(tx, false)
+        return err
+    })
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, map[string]string{"txid": txid.String()})
+}
+
+// buildAnchorTx: an unsigned transaction with the anchor output, paid for with confirmed coins of the wallet
+// the change goes back to a new wallet address unless it's too small to be worth an output
+func buildAnchorTx(c *rpcclient.Client, script []byte) (*wire.MsgTx, error) {
+    unspent, err := c.ListUnspentMinMax(1, 9999999)
+    if err != nil {
+        return nil, err
+    }
+    // the largest coins first, so as few inputs as possible are needed
+    sort.Slice(unspent, func(i, j int) bool {
+        return unspent[i].Amount > unspent[j].Amount
+    })
+    tx := wire.NewMsgTx(wire.TxVersion)
+    tx.AddTxOut(wire.NewTxOut(0, script))
+    var total, fee btcutil.Amount
+    for _, output := range unspent {
+        if !output.Spendable {
+            continue
+        }
+        hash, err := chainhash.NewHashFromStr(output.TxID)
+        if err != nil {
+            return nil, err
+        }
+        amount, err := btcutil.NewAmount(output.Amount)
+        if err != nil {
+            return nil, err
+        }
+        tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(hash, output.Vout), nil, nil))
+        total += amount
+        size := anchorTxOverhead + len(tx.TxIn)*anchorInputSize + anchorOutputSize + anchorChangeSize
+        fee = btcutil.Amount(size * anchorFeeRate)
+        if total >= fee {
+            break
+        }
+    }
+    if total < fee || len(tx.TxIn) == 0 {
+        return nil, &manageOrcaNet.Error{Status: http.StatusBadRequest, Message: "Not enough confirmed coins to pay the anchor transaction fee"}
+    }
+    change, err := c.GetRawChangeAddress("default")
+    if err != nil {
+        return nil, err
+    }
+    changeScript, err := txscript.PayToAddrScript(change)
+    if err != nil {
+        return nil, err
+    }
+    if total-fee >= anchorDustLimit {
+        tx.AddTxOut(wire.NewTxOut(int64(total-fee), changeScript))
+    }
+    return tx, nil
+}
+
+// searchFileAnchors: endpoint listing the transactions that anchored a file key or storage contract, the oldest first,
+// the block time of the first one is when the key was first published
+// Usage: query parameter "key" (hex SHA-256 hash) and optional "kind" ("file" by default or "contract"),
+// "offset" (anchors to skip, 0 by default) and "limit" (at most 100, 20 by default)
+// OrcaNet is started with --fileanchorindex for this
+func searchFileAnchors(w http.ResponseWriter, r *http.Request) {
+    fmt.Println("searchFileAnchors endpoint")
+    key, kind, err := parseAnchorKey(r.URL.Query().Get("key"), r.URL.Query().Get("kind"))
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    offset, err := intParam(r, "offset", 0, 0, 1<<30)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    limit, err := intParam(r, "limit", 20, 1, maxAnchorsPage)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    err = manageOrcaNet.Node(func(c *rpcclient.Client) error {
+        anchors, err := c.SearchFileAnchors(hex.EncodeToString(key[:]), kind.String(), offset, limit)
+        if err == nil {
+            writeJSON(w, anchors)
+        }
+        return err
+    })
+    if err != nil {
+        writeError(w, err)
+    }
+}
@@ -8,6 +8,9 @@ import (
     "strings"
 	"strconv"
 	"encoding/json"
+	"errors"
+    "github.com/btcsuite/btcd/btcutil"
+    "github.com/btcsuite/btcd/rpcclient"
 )
 
 type Block struct {
@@ -15,6 +18,45 @@ type Block struct {
     Height int    `json:"height"`
 }
 
+// how long sendToAddress unlocks the wallet for, in seconds
+const walletUnlockSecs = 100
+
+// writeJSON: writes v as the JSON body of the response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+    jsonData, err := json.Marshal(v)
+    if err != nil {
+        http.Error(w, "Error encoding JSON", http.StatusInternalServerError)
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    w.Write(jsonData)
+}
+
+// writeError: writes err as {"error": {"code": <JSON-RPC error code>, "message": <message>}}
+// errors of OrcaNet and OrcaWallet carry the status to use, other errors are internal errors
+func writeError(w http.ResponseWriter, err error) {
+    fmt.Println(err)
+    rpcErr := &manageOrcaNet.Error{Status: http.StatusInternalServerError, Message: err.Error()}
+    errors.As(err, &rpcErr)
+    jsonData, _ := json.Marshal(map[string]*manageOrcaNet.Error{"error": rpcErr})
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(rpcErr.Status)
+    w.Write(jsonData)
+}
+
+// decodeAddress: decodes an address of the network OrcaNet runs on
+func decodeAddress(address string) (btcutil.Address, error) {
+    params, err := manageOrcaNet.Params()
+    if err != nil {
+        return nil, err
+    }
+    addr, err := btcutil.DecodeAddress(address, params)
+    if err != nil || !addr.IsForNet(params) {
+        return nil, &manageOrcaNet.Error{Status: http.StatusBadRequest, Message: "Invalid address"}
+    }
+    return addr, nil
+}
+
 // some basic endpoints
 
 // getRoot: the root endpoint ('/')
@@ -31,104 +73,161 @@ func getHello(w http.ResponseWriter, r *http.Request) {
 
 // getBlockchainInfo: endpoint to get the blockchain info
 func getBlockchainInfo(w http.ResponseWriter, r *http.Request) {
-    fmt.Println("getBlockchainInfo request") 
-    const command string = "getblockchaininfo"
-    stdout, err :=  manageOrcaNet.CallBtcctlCmd(command)
-    fmt.Println(err)
-    // return the output of CallBtcctlCommand back to the querier 
-    io.WriteString(w, stdout)
+    fmt.Println("getBlockchainInfo request")
+    err := manageOrcaNet.Node(func(c *rpcclient.Client) error {
+        info, err := c.GetBlockChainInfo()
+        if err == nil {
+            writeJSON(w, info)
+        }
+        return err
+    })
+    if err != nil {
+        writeError(w, err)
+    }
 }
 // getNewAddress: endpoint to get a new wallet address
 // this wallet address can be used for mining rewards / sending / receiving transactions
-// For security purposes, it is recommended to create a new address everytime 
+// For security purposes, it is recommended to create a new address everytime
 func getNewAddress(w http.ResponseWriter, r *http.Request) {
     fmt.Println("getNewAddress request")
-    const command string = "getnewaddress --wallet"
-    stdout, err := manageOrcaNet.CallBtcctlCmd(command)
-    fmt.Println(err)
-    io.WriteString(w, stdout)
+    address, err := newAddress()
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    io.WriteString(w, address.EncodeAddress())
+}
+
+// newAddress: gets a new address of the default account of the wallet
+func newAddress() (btcutil.Address, error) {
+    var address btcutil.Address
+    err := manageOrcaNet.Wallet(func(c *rpcclient.Client) error {
+        var err error
+        address, err = c.GetNewAddress("default")
+        return err
+    })
+    return address, err
 }
 
-// getBalance: gets the balance of the wallet 
+// getBalance: gets the balance of the wallet
 func getBalance(w http.ResponseWriter, r *http.Request) {
     fmt.Println("getBalance endpoint")
-    const command string = "getbalance --wallet"
-    stdout, err := manageOrcaNet.CallBtcctlCmd(command)
-    fmt.Println(err)
-    io.WriteString(w, stdout)
+    err := manageOrcaNet.Wallet(func(c *rpcclient.Client) error {
+        balance, err := c.GetBalance("*")
+        if err == nil {
+            io.WriteString(w, strconv.FormatFloat(balance.ToBTC(), 'f', -1, 64))
+        }
+        return err
+    })
+    if err != nil {
+        writeError(w, err)
+    }
 }
-// getPeerInfo: gets the peer info 
+// getPeerInfo: gets the peer info
 func getPeerInfo(w http.ResponseWriter, r *http.Request) {
     fmt.Println("Get peer endpoint")
-    const command string = "getpeerinfo"
-    stdout, err := manageOrcaNet.CallBtcctlCmd(command)
-    fmt.Println(err)
-    io.WriteString(w, stdout)
+    err := manageOrcaNet.Node(func(c *rpcclient.Client) error {
+        peers, err := c.GetPeerInfo()
+        if err == nil {
+            writeJSON(w, peers)
+        }
+        return err
+    })
+    if err != nil {
+        writeError(w, err)
+    }
 }
 
 // getBestBlock: gets the best block
 func getBestBlock(w http.ResponseWriter, r *http.Request) {
     fmt.Println("Get best block endpoint")
-    const command string = "getbestblock"
-    stdout, err := manageOrcaNet.CallBtcctlCmd(command)
-    fmt.Println(err)
-    io.WriteString(w, stdout)
+    err := manageOrcaNet.Node(func(c *rpcclient.Client) error {
+        hash, height, err := c.GetBestBlock()
+        if err == nil {
+            writeJSON(w, Block{Hash: hash.String(), Height: int(height)})
+        }
+        return err
+    })
+    if err != nil {
+        writeError(w, err)
+    }
 }
 
 // getBestBlockInfo: gets the best block info
 func getBestBlockInfo(w http.ResponseWriter, r *http.Request) {
     // get bestblock hash then run getblock on it
     fmt.Println("Get best block info endpoint")
-    const command string = "getbestblock"
-    stdout, err := manageOrcaNet.CallBtcctlCmd(command)
-    fmt.Println(err)
-    // get the hash of the best block
-    var block Block
-
-    // Unmarshal the JSON data into the block variable
-    err = json.Unmarshal([]byte(stdout), &block)
+    err := manageOrcaNet.Node(func(c *rpcclient.Client) error {
+        hash, _, err := c.GetBestBlock()
+        if err != nil {
+            return err
+        }
+        block, err := c.GetBlockVerbose(hash)
+        if err == nil {
+            writeJSON(w, block)
+        }
+        return err
+    })
     if err != nil {
-        fmt.Println(err)
-        http.Error(w, "Error accessing JSON data", http.StatusInternalServerError)
+        writeError(w, err)
     }
-
-    getBlockCommand := "getblock " + block.Hash
-    stdout, err = manageOrcaNet.CallBtcctlCmd(getBlockCommand)
-    fmt.Println(err)
-    io.WriteString(w, stdout)
 }
-// mine: endpoint to start mining, mining rewards go to the associated wallet on this node 
+// mine: endpoint to start mining, mining rewards go to the associated wallet on this node
+// the running node is told to mine with setgenerate, so it keeps its peers and mempool
+// Usage: optional query parameters "workers" (number of mining goroutines, -1 for one per core) and
+// "address" (address the rewards are paid to, a new wallet address by default)
+// calling mine while mining changes the workers / address without stopping
 func mine(w http.ResponseWriter, r *http.Request) {
     fmt.Println("Mine endpoint")
-    // to mine, we need to restart the OrcaNet node with --generate and --mingaddr=<newAddress>
-    const getAddressCmd string = "getnewaddress --wallet"
-    stdout, err := manageOrcaNet.CallBtcctlCmd(getAddressCmd)
+    workers := -1
+    if workersParam := r.URL.Query().Get("workers"); workersParam != "" {
+        n, err := strconv.Atoi(workersParam)
+        if err != nil || n < -1 || n == 0 {
+            http.Error(w, "workers must be a positive number or -1", http.StatusBadRequest)
+            return
+        }
+        workers = n
+    }
+    var address btcutil.Address
+    var err error
+    if addressParam := strings.TrimSpace(r.URL.Query().Get("address")); addressParam != "" {
+        address, err = decodeAddress(addressParam)
+    } else {
+        address, err = newAddress()
+    }
     if err != nil {
-        fmt.Println("error getting a new address for mining")
-        io.WriteString(w, "error getting a new address for mining")
-    }
-    //std out is the address
-    address := strings.TrimSpace(stdout)
-    orcaNetParams := []string{"--generate", "--miningaddr=" + address}
-    fmt.Println("orcaParams[0] " + orcaNetParams[0])
-    fmt.Println("orcaParams[1] " + orcaNetParams[1])
-    // we need to kill the OrcaNet process first
-    if err := manageOrcaNet.Stop(); err != nil {
-        fmt.Println("failed to end OrcaNet:", err)
-        http.Error(w, "failed to kill original OrcaNet instance to start mining", http.StatusInternalServerError)
-        return 
-    }
-    if err := manageOrcaNet.Start(orcaNetParams...); err != nil {
-        fmt.Println("failed to start mining:", err)
-        http.Error(w, "failed to start mining", http.StatusInternalServerError)
+        writeError(w, err)
+        return
+    }
+    err = manageOrcaNet.Node(func(c *rpcclient.Client) error {
+        return c.SetGenerateToAddress(true, workers, address)
+    })
+    if err != nil {
+        writeError(w, err)
         return
     }
     io.WriteString(w, "Mining successfully started")
 }
 
+// getMiningInfo: gets whether the node is mining, its workers, hash rate and the addresses rewards are paid to
+func getMiningInfo(w http.ResponseWriter, r *http.Request) {
+    fmt.Println("getMiningInfo endpoint")
+    err := manageOrcaNet.Node(func(c *rpcclient.Client) error {
+        info, err := c.GetMiningInfo()
+        if err == nil {
+            writeJSON(w, info)
+        }
+        return err
+    })
+    if err != nil {
+        writeError(w, err)
+    }
+}
+
 // sendToAddress: endpoint to send n coins to an address
-// if you want to send coins to a specific wallet, ask the recepient to getNewAddress and pass that address to the query string 
+// if you want to send coins to a specific wallet, ask the recepient to getNewAddress and pass that address to the query string
 // Usage: make a JSON request with 2 fields "coins" and "address"
+// the passphrase only travels over RPC to the wallet, it never ends up on a command line
 func sendToAddress(w http.ResponseWriter, r *http.Request) {
     var request struct {
         Coins           string `json:"coins"`
@@ -145,64 +244,46 @@ func sendToAddress(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    if _, err := strconv.ParseFloat(request.Coins, 64); err != nil {
+    coins, err := strconv.ParseFloat(request.Coins, 64)
+    if err != nil {
         http.Error(w, "Invalid number format for coins", http.StatusBadRequest)
         return
     }
-
-    if err := unlockWallet(request.SenderWalletPass); err != nil {
-        fmt.Printf("Failed to unlock wallet: %v\n", err)
-        http.Error(w, "Error unlocking wallet", http.StatusInternalServerError)
+    amount, err := btcutil.NewAmount(coins)
+    if err != nil || amount <= 0 {
+        http.Error(w, "Invalid number format for coins", http.StatusBadRequest)
         return
     }
-
-    if err := sendCoins(request.Coins, request.Address); err != nil {
-        fmt.Printf("Error sending coins: %v\n", err)
-        http.Error(w, "Error sending coins", http.StatusInternalServerError)
+    address, err := decodeAddress(request.Address)
+    if err != nil {
+        writeError(w, err)
         return
     }
 
-    fmt.Fprintf(w, "Successfully sent %s coins to %s\n", request.Coins, request.Address)
-}
-
-func unlockWallet(walletPass string) error {
-    command := fmt.Sprintf("--wallet walletpassphrase %s 100", walletPass)
-    stdout, err := manageOrcaNet.CallBtcctlCmd(command)
+    err = manageOrcaNet.Wallet(func(c *rpcclient.Client) error {
+        if err := c.WalletPassphrase(request.SenderWalletPass, walletUnlockSecs); err != nil {
+            return err
+        }
+        _, err := c.SendToAddress(address, amount)
+        return err
+    })
     if err != nil {
-        return fmt.Errorf("Failed to unlock wallet: %s, error: %v", stdout, err)
+        writeError(w, err)
+        return
     }
-    return nil
-}
 
-func sendCoins(numCoins, address string) error {
-    command := fmt.Sprintf("--wallet sendtoaddress %s %s", address, numCoins)
-    stdout, err := manageOrcaNet.CallBtcctlCmd(command)
-    if err != nil {
-        return fmt.Errorf("Failed to send coins: %s, error: %v", stdout, err)
-    }
-    return nil
+    fmt.Fprintf(w, "Successfully sent %s coins to %s\n", request.Coins, request.Address)
 }
 
-
-
-// stopMine: endpoint to stop mining
+// stopMine: endpoint to stop mining, the node keeps running
 func stopMine(w http.ResponseWriter, r *http.Request) {
     fmt.Println("stop mine endpoint")
-    // kill the instance first 
-    if err := manageOrcaNet.Stop(); err != nil {
-        fmt.Println("failed to end Orcanet:", err)
-        http.Error(w, "failed to kill original OrcaNet isntance to start mining", http.StatusInternalServerError)
-        return 
-    }
-    if err := manageOrcaNet.Start(); err != nil {
-        fmt.Println("failed to start mining:", err)
-        http.Error(w, "failed to start mining", http.StatusInternalServerError)
-        return 
+    err := manageOrcaNet.Node(func(c *rpcclient.Client) error {
+        return c.SetGenerate(false, 0)
+    })
+    if err != nil {
+        writeError(w, err)
+        return
     }
-    io.WriteString(w, "Mining successfully started")
+    io.WriteString(w, "Mining successfully stopped")
 }
-
-
-
-
-
@@ -0,0 +1,264 @@
+package main
+
+import (
+    "bufio"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/btcsuite/btcd/btcjson"
+    "github.com/btcsuite/btcd/btcutil"
+    "github.com/btcsuite/btcd/rpcclient"
+    "github.com/coloshword/OrcaNetAPIServer/manageOrcaNet"
+)
+
+// environment variable holding the passphrase that unlocks the faucet's wallet
+const faucetPassEnv = "ORCANET_FAUCET_PASS"
+
+// largest body of a faucet request, it only holds an address
+const faucetMaxBody = 1 << 10
+
+// FaucetPayout: a line of the faucet ledger
+type FaucetPayout struct {
+    Time    time.Time `json:"time"`
+    Address string    `json:"address"`
+    IP      string    `json:"ip,omitempty"`
+    Amount  float64   `json:"amount"`
+    TxID    string    `json:"txid"`
+}
+
+// FaucetInfo: what GET /faucet returns, Balance is the confirmed balance left in the faucet's account
+type FaucetInfo struct {
+    Amount   float64 `json:"amount"`
+    Interval int64   `json:"interval"`
+    Balance  float64 `json:"balance"`
+    Payouts  int     `json:"payouts"`
+}
+
+// Faucet: pays a fixed amount from a wallet account to each address that asks for it, at most once per
+// interval for an address and for an IP address, every payout is appended to a ledger file
+type Faucet struct {
+    amount     btcutil.Amount
+    account    string
+    interval   time.Duration
+    passphrase string
+    path       string
+    // guards the limits, an address and an IP address are taken while their coins are sent, so two
+    // requests from the same address can't both pass the limits and slow payouts don't hold up the others
+    mutex     sync.Mutex
+    byAddress map[string]time.Time
+    byIP      map[string]time.Time
+    payouts   int
+}
+
+// set by main when the faucet is enabled
+var faucet *Faucet
+
+// loadFaucet: reads the ledger saved at path to know who was paid recently, a missing file is an empty ledger
+// a line cut short by a crash is skipped, the payout it recorded went through but its limit is forgotten
+func loadFaucet(path string, amount btcutil.Amount, account string, interval time.Duration, passphrase string) (*Faucet, error) {
+    f := &Faucet{
+        amount:     amount,
+        account:    account,
+        interval:   interval,
+        passphrase: passphrase,
+        path:       path,
+        byAddress:  make(map[string]time.Time),
+        byIP:       make(map[string]time.Time),
+    }
+    file, err := os.Open(path)
+    if errors.Is(err, os.ErrNotExist) {
+        return f, nil
+    } else if err != nil {
+        return nil, err
+    }
+    defer file.Close()
+    scanner := bufio.NewScanner(file)
+    for line := 1; scanner.Scan(); line++ {
+        var payout FaucetPayout
+        if err := json.Unmarshal(scanner.Bytes(), &payout); err != nil {
+            fmt.Printf("skipping line %d of the faucet ledger: %s\n", line, err)
+            continue
+        }
+        f.record(payout)
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, fmt.Errorf("failed to read the faucet ledger: %w", err)
+    }
+    return f, nil
+}
+
+// record: remembers when address and IP were last paid, the mutex must be held
+func (f *Faucet) record(payout FaucetPayout) {
+    if payout.Time.After(f.byAddress[payout.Address]) {
+        f.byAddress[payout.Address] = payout.Time
+    }
+    if payout.Time.After(f.byIP[payout.IP]) {
+        f.byIP[payout.IP] = payout.Time
+    }
+    f.payouts++
+}
+
+// wait: how long address and ip have to wait before they can be paid again, 0 if they can be paid now
+// the mutex must be held
+func (f *Faucet) wait(address string, ip string, now time.Time) time.Duration {
+    last := f.byAddress[address]
+    if f.byIP[ip].After(last) {
+        last = f.byIP[ip]
+    }
+    if wait := last.Add(f.interval).Sub(now); wait > 0 {
+        return wait
+    }
+    return 0
+}
+
+// Pay: sends the faucet amount to address and records it in the ledger, a *faucetLimitError
+// says how long to wait if address or ip were paid less than an interval ago
+func (f *Faucet) Pay(address btcutil.Address, ip string) (FaucetPayout, error) {
+    f.mutex.Lock()
+    encoded := address.EncodeAddress()
+    now := time.Now()
+    if wait := f.wait(encoded, ip, now); wait > 0 {
+        f.mutex.Unlock()
+        return FaucetPayout{}, &faucetLimitError{wait: wait}
+    }
+    lastAddress, lastIP := f.byAddress[encoded], f.byIP[ip]
+    f.byAddress[encoded] = now
+    f.byIP[ip] = now
+    f.mutex.Unlock()
+
+    var txid string
+    err := manageOrcaNet.Wallet(func(c *rpcclient.Client) error {
+        if err := c.WalletPassphrase(f.passphrase, walletUnlockSecs); err != nil {
+            return err
+        }
+        hash, err := c.SendFrom(f.account, address, f.amount)
+        if err == nil {
+            txid = hash.String()
+        }
+        return err
+    })
+    f.mutex.Lock()
+    defer f.mutex.Unlock()
+    if err != nil {
+        // nothing was sent, so the address and the IP address keep the limits they had
+        f.byAddress[encoded] = lastAddress
+        f.byIP[ip] = lastIP
+    }
+    var rpcErr *manageOrcaNet.Error
+    if errors.As(err, &rpcErr) && rpcErr.Code == int(btcjson.ErrRPCWalletInsufficientFunds) {
+        return FaucetPayout{}, &manageOrcaNet.Error{Status: http.StatusServiceUnavailable, Code: rpcErr.Code, Message: "The faucet is empty"}
+    } else if err != nil {
+        return FaucetPayout{}, err
+    }
+    payout := FaucetPayout{Time: now, Address: encoded, IP: ip, Amount: f.amount.ToBTC(), TxID: txid}
+    f.record(payout)
+    if err := f.append(payout); err != nil {
+        // the coins are sent, so don't fail the request, the limit still holds until the server restarts
+        fmt.Println("error writing the faucet ledger:", err)
+    }
+    return payout, nil
+}
+
+// append: adds payout to the end of the ledger file, the mutex must be held
+func (f *Faucet) append(payout FaucetPayout) error {
+    data, err := json.Marshal(payout)
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(filepath.Dir(f.path), 0700); err != nil {
+        return err
+    }
+    file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+    if err != nil {
+        return err
+    }
+    if _, err := file.Write(append(data, '\n')); err != nil {
+        file.Close()
+        return err
+    }
+    return file.Close()
+}
+
+// Info: the faucet settings and the balance it has left
+func (f *Faucet) Info() (FaucetInfo, error) {
+    f.mutex.Lock()
+    info := FaucetInfo{Amount: f.amount.ToBTC(), Interval: int64(f.interval.Seconds()), Payouts: f.payouts}
+    f.mutex.Unlock()
+    err := manageOrcaNet.Wallet(func(c *rpcclient.Client) error {
+        balance, err := c.GetBalance(f.account)
+        info.Balance = balance.ToBTC()
+        return err
+    })
+    return info, err
+}
+
+type faucetLimitError struct {
+    wait time.Duration
+}
+
+func (e *faucetLimitError) Error() string {
+    return fmt.Sprintf("Coins were already sent to this address or IP address, try again in %s", e.wait.Round(time.Minute))
+}
+
+// requestIP: the IP address a request comes from, without the port
+func requestIP(r *http.Request) string {
+    host, _, err := net.SplitHostPort(r.RemoteAddr)
+    if err != nil {
+        return r.RemoteAddr
+    }
+    return host
+}
+
+// faucetHandler: endpoint of the faucet, only served when the server runs with -faucet
+// GET returns the amount paid, the interval between payouts in seconds and the balance left,
+// POST with a JSON body {"address": ...} sends the amount to the address and returns the payout
+func faucetHandler(w http.ResponseWriter, r *http.Request) {
+    fmt.Println("faucet endpoint")
+    switch r.Method {
+    case http.MethodGet:
+        info, err := faucet.Info()
+        if err != nil {
+            writeError(w, err)
+            return
+        }
+        writeJSON(w, info)
+    case http.MethodPost:
+        var request struct {
+            Address string `json:"address"`
+        }
+        r.Body = http.MaxBytesReader(w, r.Body, faucetMaxBody)
+        if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+            http.Error(w, "Error reading request body", http.StatusBadRequest)
+            return
+        }
+        address, err := decodeAddress(strings.TrimSpace(request.Address))
+        if err != nil {
+            writeError(w, err)
+            return
+        }
+        payout, err := faucet.Pay(address, requestIP(r))
+        var limitErr *faucetLimitError
+        if errors.As(err, &limitErr) {
+            w.Header().Set("Retry-After", strconv.Itoa(int(limitErr.wait.Seconds())+1))
+            writeError(w, &manageOrcaNet.Error{Status: http.StatusTooManyRequests, Message: limitErr.Error()})
+            return
+        } else if err != nil {
+            writeError(w, err)
+            return
+        }
+        // the IP address stays in the ledger
+        payout.IP = ""
+        writeJSON(w, payout)
+    default:
+        http.Error(w, "Only GET and POST requests are handled", http.StatusMethodNotAllowed)
+    }
+}
@@ -1,15 +1,24 @@
 package main
 
 import (
+    "context"
+    "flag"
     "fmt"
     "errors"
     "net/http"
+    "os"
+    "os/signal"
+    "path/filepath"
+    "syscall"
+    "time"
+    "github.com/btcsuite/btcd/btcutil"
     "github.com/coloshword/OrcaNetAPIServer/manageOrcaNet"
 ) 
 
 // startOrcaNet: starts an OrcaNet full node instance for the server to communicate with
+// the file anchor index is kept for the searchFileAnchors endpoint
 func startOrcaNet() (error) {
-   return manageOrcaNet.Start()
+   return manageOrcaNet.Start("--fileanchorindex")
 }
 
 // startOrcaWallet: starts OrcoWallet instance for the server to communicate with
@@ -18,6 +27,12 @@ func startOrcaWallet() (error) {
 }
 
 func main() {
+    faucetListen := flag.String("faucet", "", "serve a faucet at /faucet on this address, e.g. :3334, it's disabled when empty. The passphrase of the wallet is read from "+faucetPassEnv)
+    faucetAmount := flag.Float64("faucet-amount", 10, "coins the faucet sends to each address")
+    faucetAccount := flag.String("faucet-account", "default", "wallet account the faucet pays from")
+    faucetInterval := flag.Duration("faucet-interval", 24 * time.Hour, "how long an address or IP address waits before the faucet pays it again")
+    flag.Parse()
+
     http.HandleFunc("/", getRoot)
     http.HandleFunc("/hello", getHello)
     http.HandleFunc("/getBlockchainInfo", getBlockchainInfo)
@@ -29,14 +44,109 @@ func main() {
     http.HandleFunc("/getBestBlock", getBestBlock)
     http.HandleFunc("/getBestBlockInfo", getBestBlockInfo)
     http.HandleFunc("/stopMine", stopMine)
+    http.HandleFunc("/getMiningInfo", getMiningInfo)
+    http.HandleFunc("/getTransactions", getTransactions)
+    http.HandleFunc("/getBalances", getBalances)
+    http.HandleFunc("/listUnspent", listUnspent)
+    http.HandleFunc("/addressBook", addressBookHandler)
+    http.HandleFunc("/events", streamEvents)
+    http.HandleFunc("/anchorFile", anchorFile)
+    http.HandleFunc("/searchFileAnchors", searchFileAnchors)
+    book, err := loadAddressBook(filepath.Join(serverDataDir, "addressbook.json"))
+    if err != nil {
+        fmt.Println(err)
+        return
+    }
+    addressBook = book
+    var faucetServer *http.Server
+    if *faucetListen != "" {
+        amount, err := btcutil.NewAmount(*faucetAmount)
+        if err != nil || amount <= 0 {
+            fmt.Println("the faucet amount must be a positive number of coins")
+            return
+        }
+        passphrase := os.Getenv(faucetPassEnv)
+        if passphrase == "" {
+            fmt.Printf("the faucet needs the passphrase of the wallet in %s\n", faucetPassEnv)
+            return
+        }
+        faucet, err = loadFaucet(filepath.Join(serverDataDir, "faucet-ledger.jsonl"), amount, *faucetAccount, *faucetInterval, passphrase)
+        if err != nil {
+            fmt.Println(err)
+            return
+        }
+        // the faucet is meant for other machines, so it gets its own server that serves nothing else
+        mux := http.NewServeMux()
+        mux.HandleFunc("/faucet", faucetHandler)
+        // it faces the internet, so slow clients can't hold connections open for long
+        faucetServer = &http.Server{
+            Addr:              *faucetListen,
+            Handler:           mux,
+            ReadHeaderTimeout: 5 * time.Second,
+            ReadTimeout:       10 * time.Second,
+            WriteTimeout:      30 * time.Second,
+            IdleTimeout:       time.Minute,
+        }
+    }
     fmt.Println("starting orcanet")
     startOrcaNet()    
     startOrcaWallet()
-    err := http.ListenAndServe(":3333", nil)
+    go watchNotifications(shuttingDown)
+    // the wallet endpoints can spend coins, so only serve them to this machine
+    server := &http.Server{Addr: "127.0.0.1:3333"}
+    // Shutdown waits for open event streams, so end them first
+    server.RegisterOnShutdown(func() {
+        close(shuttingDown)
+    })
+    stopped := make(chan struct{})
+    go shutdownOnSignal(server, faucetServer, stopped)
+    if faucetServer != nil {
+        go func() {
+            fmt.Printf("serving the faucet on %s\n", faucetServer.Addr)
+            if err := faucetServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+                fmt.Printf("error starting the faucet %s\n", err)
+            }
+        }()
+    }
+    err = server.ListenAndServe()
     if errors.Is(err, http.ErrServerClosed) {
         fmt.Println("server is closed")
+        // wait for the wallet and the full node to exit before we do
+        <-stopped
     } else if err != nil {
         fmt.Printf("error starting the server %s\n ", err)
+        stopChildren()
+    }
+}
+
+// shutdownOnSignal: waits for SIGINT or SIGTERM, then stops the http servers followed by the wallet and the full node
+// faucetServer is nil when the faucet is disabled
+func shutdownOnSignal(server *http.Server, faucetServer *http.Server, stopped chan struct{}) {
+    signals := make(chan os.Signal, 1)
+    signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+    sig := <-signals
+    fmt.Printf("received %s, shutting down\n", sig)
+    ctx, cancel := context.WithTimeout(context.Background(), 10 * time.Second)
+    defer cancel()
+    if faucetServer != nil {
+        if err := faucetServer.Shutdown(ctx); err != nil {
+            fmt.Printf("error shutting down the faucet %s\n", err)
+        }
+    }
+    if err := server.Shutdown(ctx); err != nil {
+        fmt.Printf("error shutting down the server %s\n", err)
+    }
+    stopChildren()
+    close(stopped)
+}
+
+// stopChildren: stops the wallet before the full node it is connected to
+func stopChildren() {
+    if err := manageOrcaNet.StopOrcaWallet(); err != nil {
+        fmt.Println(err)
+    }
+    if err := manageOrcaNet.Stop(); err != nil {
+        fmt.Println(err)
     }
 }
 
@@ -1,13 +1,13 @@
  package manageOrcaNet
 
  import (
+     "errors"
      "fmt"
      "os"
      "os/exec"
-     "strings"
      "bufio"
-     "runtime"
      "path/filepath"
+     "sync"
      "time"
      "io"
  )
@@ -25,11 +25,20 @@ func getExePath() (string, error) {
 
 const (
      orcaNetPath string = "./OrcaNet/OrcaNet"
-     btcctlPath string = "./OrcaNet/cmd/btcctl/btcctl"
      orcaWalletPath string = "./OrcaWallet/btcwallet"
  )
 
-var cmdProcess *exec.Cmd
+// how long a child gets to exit after being interrupted before it is killed
+const stopTimeout = 30 * time.Second
+
+var (
+    cmdProcess *exec.Cmd
+    // closed once the OrcaNet instance in cmdProcess has exited
+    cmdDone chan struct{}
+    walletProcess *exec.Cmd
+    // closed once the wallet in walletProcess has exited
+    walletDone chan struct{}
+)
 
 func Start(params ...string) error {
     exePath, err := getExePath();
@@ -60,13 +69,68 @@ func Start(params ...string) error {
         return err
     }
     fmt.Println("OrcaNet started successfully")
-    go printOutput(stdout)
-    go printOutput(stderr)
-
+    cmdDone = waitForExit(cmdProcess, stdout, stderr)
 
     return nil
 }
 
+// waitForExit: prints the output of cmd and reaps it once it exits, the returned channel is closed when that happens
+func waitForExit(cmd *exec.Cmd, outputs ...io.Reader) chan struct{} {
+    done := make(chan struct{})
+    go func() {
+        // all output has to be read before calling Wait
+        var wg sync.WaitGroup
+        for _, output := range outputs {
+            wg.Add(1)
+            go func(r io.Reader) {
+                defer wg.Done()
+                printOutput(r)
+            }(output)
+        }
+        wg.Wait()
+        cmd.Wait()
+        close(done)
+    }()
+    return done
+}
+
+// stopProcess: interrupts cmd and waits for it to exit, killing it if it takes longer than timeout
+func stopProcess(name string, cmd *exec.Cmd, done chan struct{}, timeout time.Duration) error {
+    if cmd == nil || cmd.Process == nil || exited(done) {
+        return fmt.Errorf("%s process is not running", name)
+    }
+
+    fmt.Printf("Stopping %s...\n", name)
+    // interrupt is not supported on windows, kill the process instead
+    if err := cmd.Process.Signal(os.Interrupt); err != nil {
+        fmt.Println("Failed to send interrupt:", err)
+        if err := cmd.Process.Kill(); err != nil {
+            return err
+        }
+    }
+    select {
+    case <-done:
+        fmt.Printf("%s stopped successfully.\n", name)
+        return nil
+    case <-time.After(timeout):
+        cmd.Process.Kill()
+        <-done
+        return errors.New(name + " did not stop in time and was killed")
+    }
+}
+
+func exited(done chan struct{}) bool {
+    if done == nil {
+        return true
+    }
+    select {
+    case <-done:
+        return true
+    default:
+        return false
+    }
+}
+
 
 func printOutput(r io.Reader) {
     scanner := bufio.NewScanner(r)
@@ -79,23 +143,13 @@ func printOutput(r io.Reader) {
 }
 
 
-// Stop: ends the running OrcaNet instance if its running
-//TO DO: right now it sleeps for 5 seconds instead of just waiting for the interrupt (fix this)
+// Stop: ends the running OrcaNet instance if its running and waits for it to exit
 func Stop() error {
-    if cmdProcess == nil || cmdProcess.Process == nil {
+    if cmdProcess == nil || cmdProcess.Process == nil || exited(cmdDone) {
         fmt.Println("OrcaNet process is not currently running.")
         return fmt.Errorf("OrcaNet process is not running")
     }
-
-    fmt.Println("Stopping OrcaNet...")
-    // send interrupt sig
-    if err := cmdProcess.Process.Signal(os.Interrupt); err != nil {
-        fmt.Println("Failed to send interrupt:", err)
-        return err
-    }
-    time.Sleep(5 * time.Second)
-    fmt.Println("OrcaNet stopped successfully.")
-    return nil
+    return stopProcess("OrcaNet", cmdProcess, cmdDone, stopTimeout)
 }
 
 //startOrcaWallet: starts the OrcaWallet
@@ -119,106 +173,13 @@ func StartOrcaWallet() error {
         fmt.Println("failed to start wallet executable")
         return nil
     }
+    walletProcess = cmd
+    walletDone = waitForExit(cmd)
     fmt.Println("Wallet started successfully")
     return nil
 }
-// getBtcdConfFilePath returns the file path for btcd.conf based on the user's OS
-func getBtcdConfFilePath() string {
-    const defaultConfigFilename = "btcd.conf"
-    homeDir := getUserHomeDir()
-    if homeDir == "" {
-        return "" // Return empty string if the home directory can't be determined
-    }
-    
-    // Determine the application data directory based on the operating system
-    var appDataDir string
-    switch runtime.GOOS {
-    case "windows":
-        appDataDir = filepath.Join(homeDir, "AppData", "Roaming", "Btcd")
-    case "darwin": // macOS
-        appDataDir = filepath.Join(homeDir, "Library", "Application Support", "Btcd")
-    case "linux":
-        appDataDir = filepath.Join(homeDir, ".btcd")
-    default:
-        appDataDir = filepath.Join(homeDir, ".btcd") // Default to a Unix-style hidden directory
-    }
-
-    return filepath.Join(appDataDir, defaultConfigFilename)
-}
-
-// getUserHomeDir returns the home directory of the current user
-func getUserHomeDir() string {
-    homeDir, err := os.UserHomeDir()
-    if err != nil {
-        fmt.Println("Error getting user home directory:", err)
-        return ""
-    }
-    return homeDir
-}
-
-// returns an array [rpcuser, rpcpass]
-func readRPCInfo(path string) ([]string, error) {
-	body, err := os.ReadFile(path)
-
-	if err != nil {
-		return nil, fmt.Errorf("error reading the btcd.conf file")
-	}
-
-	content := string(body)
-	var rpcInfo []string 
-	// find the line with "rpcuser" and "rpcpass"
-	lines := strings.Split(content, "\n");
-	for _, line := range lines {
-		if strings.HasPrefix(line, "rpcuser") || strings.HasPrefix(line, "rpcpass") {
-			parts := strings.Split(line, "=")
-			// if len(parts) == 2 {
-			// 	fmt.Println(parts)
-			// 	rpcInfo = append(rpcInfo, strings.TrimSpace(parts[1]))
-			// }
-			rpcInfo = append(rpcInfo, strings.TrimSpace(parts[1]))
-		}
-	}
-
-	if len(rpcInfo) < 2 {
-		return nil, fmt.Errorf("error finding rpcuser and rpc pass")
-	}
-	return rpcInfo, nil 
-}
-
-
-// callBtcctlCmd: calls a Btcctl command Exactly as specified in string param, and returns the stdout of btcctl as a string 
-// its a singular string, but you can pass as many arguments, we will split the arguments in this fn
-func CallBtcctlCmd(cmdStr string) (string, error) {
-    // get the rpc values 
-    rpcInfo, err := readRPCInfo(getBtcdConfFilePath())
-    if err != nil {
-        return "", fmt.Errorf("failed to get rpc info")
-    }
-    // get the bttcl full path
-    exePath, err := getExePath()
-    if err != nil {
-        fmt.Println("error finding APIServer exec")
-        return "", err
-    }
-    
-    var btcctlFullPath = filepath.Join(exePath, "..", "..", btcctlPath)
-    _, err = os.Stat(btcctlFullPath)
-    if os.IsNotExist(err) {
-        fmt.Println("Error finding btcctl full path")
-        return "", err 
-    }
-    params :=  strings.Split(cmdStr, " ") 
-    params = append(params, "--rpcuser=" + strings.TrimSpace(rpcInfo[0]) + "=", "--rpcpass=" + strings.TrimSpace(rpcInfo[1]) + "=")
 
-    fmt.Println(params)
-    cmd := exec.Command(btcctlFullPath, params...)
-    // get the stdout of cmd, CAN HANG but shouldn't be a problem in a btcctl command
-    stdout, err := cmd.CombinedOutput() 
-    if err != nil {
-        return "", fmt.Errorf("failed to execute btcctl commands '%s': %s, error: %v", cmdStr, stdout, err)
-    }
-    fmt.Println(err);
-    return string(stdout), nil
+// StopOrcaWallet: ends the running OrcaWallet if its running and waits for it to exit
+func StopOrcaWallet() error {
+    return stopProcess("OrcaWallet", walletProcess, walletDone, stopTimeout)
 }
-
-
@@ -0,0 +1,34 @@
+package manageOrcaNet
+
+import (
+    "github.com/btcsuite/btcd/rpcclient"
+    "github.com/btcsuite/btcd/rpcclient/orcaconf"
+)
+
+// Notifications: connects a websocket client to OrcaNet that calls handlers for blocks added to and removed from
+// the best chain and for transactions accepted to the mempool, errors are returned as *Error
+// the client reconnects by itself when the node restarts and registers for the notifications again, call Shutdown to stop it
+func Notifications(handlers *rpcclient.NotificationHandlers) (*rpcclient.Client, error) {
+    settings, err := orcaconf.ReadSettings()
+    if err != nil {
+        return nil, orcaconf.ToError(err, "OrcaNet")
+    }
+    config, err := settings.NodeConfig()
+    if err != nil {
+        return nil, orcaconf.ToError(err, "OrcaNet")
+    }
+    config.Endpoint = "ws"
+    c, err := rpcclient.New(config, handlers)
+    if err != nil {
+        return nil, orcaconf.ToError(err, "OrcaNet")
+    }
+    if err := c.NotifyBlocks(); err != nil {
+        c.Shutdown()
+        return nil, orcaconf.ToError(err, "OrcaNet")
+    }
+    if err := c.NotifyNewTransactions(false); err != nil {
+        c.Shutdown()
+        return nil, orcaconf.ToError(err, "OrcaNet")
+    }
+    return c, nil
+}
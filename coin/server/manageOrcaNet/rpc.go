@@ -0,0 +1,26 @@
+package manageOrcaNet
+
+import (
+    "github.com/btcsuite/btcd/chaincfg"
+    "github.com/btcsuite/btcd/rpcclient"
+    "github.com/btcsuite/btcd/rpcclient/orcaconf"
+)
+
+// Error: a failed call to OrcaNet or OrcaWallet, ready to be returned to HTTP callers
+// Code is the JSON-RPC error code of the server, 0 when the server could not be reached
+type Error = orcaconf.Error
+
+// Params: returns the parameters of the network OrcaNet runs on, used to decode addresses
+func Params() (*chaincfg.Params, error) {
+    return orcaconf.Params()
+}
+
+// Node: calls fn with a client of the running OrcaNet node, errors are returned as *Error
+func Node(fn func(*rpcclient.Client) error) error {
+    return orcaconf.Node(fn)
+}
+
+// Wallet: calls fn with a client of the running OrcaWallet, errors are returned as *Error
+func Wallet(fn func(*rpcclient.Client) error) error {
+    return orcaconf.Wallet(fn)
+}
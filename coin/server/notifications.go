@@ -0,0 +1,327 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/btcsuite/btcd/btcjson"
+    "github.com/btcsuite/btcd/btcutil"
+    "github.com/btcsuite/btcd/chaincfg/chainhash"
+    "github.com/btcsuite/btcd/rpcclient"
+    "github.com/btcsuite/btcd/wire"
+    "github.com/coloshword/OrcaNetAPIServer/manageOrcaNet"
+)
+
+// event types, clients can filter on a type or on the part before the dot, e.g. "transaction" for all wallet events
+const (
+    eventBlockConnected    = "block.connected"
+    eventBlockDisconnected = "block.disconnected"
+    eventTxReceived        = "transaction.received"
+    eventTxSent            = "transaction.sent"
+    eventTxConfirmations   = "transaction.confirmations"
+)
+
+const (
+    // past events kept for clients that reconnect
+    eventHistorySize = 256
+    // events buffered for each client before it misses some
+    eventBuffer = 64
+    // wallet transactions are followed until they have this many confirmations
+    confirmationWindow = 6
+    // how often the wallet is checked without a notification from OrcaNet, it also learns about payments on its own
+    walletCheckInterval = 30 * time.Second
+    // how long to wait before connecting to OrcaNet again
+    notificationRetry = 5 * time.Second
+    // how often a comment is sent on an idle stream so it isn't closed
+    keepAliveInterval = 15 * time.Second
+)
+
+// BlockEvent: a block added to the best chain, or removed from it by a reorg
+type BlockEvent struct {
+    Hash         string `json:"hash"`
+    Height       int32  `json:"height"`
+    PreviousHash string `json:"previousblockhash"`
+    Time         int64  `json:"time"`
+}
+
+// Event: a notification sent on the /events stream, Block or Transaction is set depending on the type
+// Transaction.Confirmations is the new number of confirmations for transaction.confirmations events,
+// 0 again when a reorg took the transaction out of the best chain
+type Event struct {
+    ID          uint64             `json:"id"`
+    Type        string             `json:"type"`
+    Time        time.Time          `json:"time"`
+    Block       *BlockEvent        `json:"block,omitempty"`
+    Transaction *WalletTransaction `json:"transaction,omitempty"`
+}
+
+type eventSubscriber struct {
+    c     chan Event
+    types []string
+}
+
+var (
+    eventsMutex  sync.Mutex
+    nextEventID  uint64 = 1
+    eventHistory        = make([]Event, 0, eventHistorySize)
+    subscribers         = make(map[*eventSubscriber]struct{})
+    // closed when the server shuts down, which ends the streams and the notifications
+    shuttingDown = make(chan struct{})
+)
+
+// publishEvent: sends an event to every client interested in its type, never blocks on slow clients
+func publishEvent(eventType string, block *BlockEvent, tx *WalletTransaction) {
+    eventsMutex.Lock()
+    defer eventsMutex.Unlock()
+    e := Event{ID: nextEventID, Type: eventType, Time: time.Now(), Block: block, Transaction: tx}
+    nextEventID++
+    if len(eventHistory) == eventHistorySize {
+        copy(eventHistory, eventHistory[1:])
+        eventHistory = eventHistory[:eventHistorySize-1]
+    }
+    eventHistory = append(eventHistory, e)
+    for sub := range subscribers {
+        if !sub.matches(eventType) {
+            continue
+        }
+        select {
+        case sub.c <- e:
+        default:
+            // the client isn't keeping up
+        }
+    }
+}
+
+// subscribe: returns a subscriber to types, all events if there are none
+// the kept events published after since are delivered first, so reconnecting clients don't miss any
+func subscribe(since uint64, types []string) *eventSubscriber {
+    sub := &eventSubscriber{c: make(chan Event, eventBuffer+eventHistorySize), types: types}
+    eventsMutex.Lock()
+    defer eventsMutex.Unlock()
+    if since > 0 {
+        for _, e := range eventHistory {
+            if e.ID > since && sub.matches(e.Type) {
+                sub.c <- e
+            }
+        }
+    }
+    subscribers[sub] = struct{}{}
+    return sub
+}
+
+func unsubscribe(sub *eventSubscriber) {
+    eventsMutex.Lock()
+    defer eventsMutex.Unlock()
+    delete(subscribers, sub)
+}
+
+func (sub *eventSubscriber) matches(eventType string) bool {
+    if len(sub.types) == 0 {
+        return true
+    }
+    for _, t := range sub.types {
+        if t == eventType || strings.HasPrefix(eventType, t+".") {
+            return true
+        }
+    }
+    return false
+}
+
+// streamEvents: endpoint streaming events as server-sent events (text/event-stream) until the client disconnects
+// Usage: optional query parameters "types" (comma separated types or prefixes) and "since" (replay the events after this id),
+// EventSource clients send Last-Event-ID when they reconnect, which works like since
+func streamEvents(w http.ResponseWriter, r *http.Request) {
+    fmt.Println("events endpoint")
+    flusher, ok := w.(http.Flusher)
+    if !ok {
+        http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+        return
+    }
+    var types []string
+    if param := r.URL.Query().Get("types"); param != "" {
+        types = strings.Split(param, ",")
+    }
+    since, _ := strconv.ParseUint(r.URL.Query().Get("since"), 10, 64)
+    if id, err := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64); err == nil {
+        since = id
+    }
+    sub := subscribe(since, types)
+    defer unsubscribe(sub)
+
+    w.Header().Set("Content-Type", "text/event-stream")
+    w.Header().Set("Cache-Control", "no-cache")
+    w.WriteHeader(http.StatusOK)
+    fmt.Fprint(w, "retry: 3000\n\n")
+    flusher.Flush()
+
+    keepAlive := time.NewTicker(keepAliveInterval)
+    defer keepAlive.Stop()
+    for {
+        select {
+        case <-r.Context().Done():
+            return
+        case <-shuttingDown:
+            return
+        case <-keepAlive.C:
+            fmt.Fprint(w, ": keep-alive\n\n")
+        case e := <-sub.c:
+            data, err := json.Marshal(e)
+            if err != nil {
+                fmt.Println("error encoding event:", err)
+                continue
+            }
+            fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+        }
+        flusher.Flush()
+    }
+}
+
+// watchNotifications: publishes the block notifications of OrcaNet and the wallet transactions they lead to until stop is closed
+// OrcaWallet only streams transactions over its experimental gRPC server, which isn't started,
+// so the wallet is checked whenever OrcaNet sees a block or a transaction and every walletCheckInterval
+func watchNotifications(stop <-chan struct{}) {
+    walletChanged := make(chan struct{}, 1)
+    checkWallet := func() {
+        select {
+        case walletChanged <- struct{}{}:
+        default:
+            // a check is already pending
+        }
+    }
+    handlers := &rpcclient.NotificationHandlers{
+        OnClientConnected: checkWallet,
+        OnFilteredBlockConnected: func(height int32, header *wire.BlockHeader, txs []*btcutil.Tx) {
+            publishEvent(eventBlockConnected, blockEvent(height, header), nil)
+            checkWallet()
+        },
+        OnFilteredBlockDisconnected: func(height int32, header *wire.BlockHeader) {
+            publishEvent(eventBlockDisconnected, blockEvent(height, header), nil)
+            checkWallet()
+        },
+        OnTxAccepted: func(hash *chainhash.Hash, amount btcutil.Amount) {
+            checkWallet()
+        },
+    }
+    go func() {
+        c := connectNotifications(handlers, stop)
+        if c != nil {
+            <-stop
+            c.Shutdown()
+        }
+    }()
+
+    tracker := &walletTracker{confirmations: make(map[string]int64)}
+    ticker := time.NewTicker(walletCheckInterval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-stop:
+            return
+        case <-ticker.C:
+        case <-walletChanged:
+        }
+        if err := tracker.check(); err != nil && tracker.seeded {
+            fmt.Println("error checking wallet transactions:", err)
+        }
+    }
+}
+
+// connectNotifications: keeps trying to connect until OrcaNet is up, returns nil if stop is closed first
+func connectNotifications(handlers *rpcclient.NotificationHandlers, stop <-chan struct{}) *rpcclient.Client {
+    for {
+        c, err := manageOrcaNet.Notifications(handlers)
+        if err == nil {
+            fmt.Println("subscribed to OrcaNet notifications")
+            return c
+        }
+        select {
+        case <-stop:
+            return nil
+        case <-time.After(notificationRetry):
+        }
+    }
+}
+
+func blockEvent(height int32, header *wire.BlockHeader) *BlockEvent {
+    return &BlockEvent{
+        Hash:         header.BlockHash().String(),
+        Height:       height,
+        PreviousHash: header.PrevBlock.String(),
+        Time:         header.Timestamp.Unix(),
+    }
+}
+
+// walletTracker: remembers the confirmations of recent wallet transactions to publish what changed since the last check
+type walletTracker struct {
+    // by txKey, only transactions with fewer than confirmationWindow confirmations are kept
+    confirmations map[string]int64
+    // false until the first check, which only learns the transactions the wallet already had
+    seeded bool
+}
+
+// the wallet lists a transaction once for every output it pays us or sends away
+func txKey(result btcjson.ListTransactionsResult) string {
+    return fmt.Sprintf("%s:%d:%s", result.TxID, result.Vout, result.Category)
+}
+
+// check: lists the wallet transactions in the last confirmationWindow blocks and in the mempool and publishes
+// the new ones and those whose confirmations changed
+func (t *walletTracker) check() error {
+    params, err := manageOrcaNet.Params()
+    if err != nil {
+        return err
+    }
+    var since *chainhash.Hash
+    err = manageOrcaNet.Node(func(c *rpcclient.Client) error {
+        _, height, err := c.GetBestBlock()
+        if err != nil || height < confirmationWindow {
+            return err
+        }
+        since, err = c.GetBlockHash(int64(height - confirmationWindow))
+        return err
+    })
+    if err != nil {
+        return err
+    }
+    var events []Event
+    seen := make(map[string]int64)
+    err = manageOrcaNet.Wallet(func(c *rpcclient.Client) error {
+        result, err := c.ListSinceBlock(since)
+        if err != nil {
+            return err
+        }
+        payers := make(map[string][]string)
+        for _, tx := range result.Transactions {
+            key := txKey(tx)
+            seen[key] = tx.Confirmations
+            previous, known := t.confirmations[key]
+            if !t.seeded || (known && previous == tx.Confirmations) {
+                continue
+            }
+            eventType := eventTxConfirmations
+            if !known && tx.Category == "send" {
+                eventType = eventTxSent
+            } else if !known {
+                eventType = eventTxReceived
+            }
+            walletTx := walletTransaction(c, tx, params, payers)
+            events = append(events, Event{Type: eventType, Transaction: &walletTx})
+        }
+        return nil
+    })
+    if err != nil {
+        return err
+    }
+    // transactions that are no longer listed have enough confirmations, or were dropped from the mempool
+    t.confirmations = seen
+    t.seeded = true
+    for _, e := range events {
+        publishEvent(e.Type, nil, e.Transaction)
+    }
+    return nil
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+    "bytes"
+    "encoding/hex"
+    "fmt"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+
+    "github.com/btcsuite/btcd/btcjson"
+    "github.com/btcsuite/btcd/btcutil"
+    "github.com/btcsuite/btcd/chaincfg"
+    "github.com/btcsuite/btcd/chaincfg/chainhash"
+    "github.com/btcsuite/btcd/rpcclient"
+    "github.com/btcsuite/btcd/txscript"
+    "github.com/btcsuite/btcd/wire"
+    "github.com/coloshword/OrcaNetAPIServer/manageOrcaNet"
+)
+
+// the most transactions getTransactions returns at once
+const maxTransactionsPage = 100
+
+// WalletTransaction: an entry of the wallet's transaction history
+// Address is our receiving address for received coins and the recipient for sent coins
+// Counterparties are the recipient of sent coins or the addresses that paid received coins, as far as they can be found
+type WalletTransaction struct {
+    TxID           string   `json:"txid"`
+    Category       string   `json:"category"`
+    Account        string   `json:"account"`
+    Amount         float64  `json:"amount"`
+    Fee            *float64 `json:"fee,omitempty"`
+    Confirmations  int64    `json:"confirmations"`
+    BlockHash      string   `json:"blockhash,omitempty"`
+    BlockHeight    *int32   `json:"blockheight,omitempty"`
+    Time           int64    `json:"time"`
+    Address        string   `json:"address,omitempty"`
+    Counterparties []string `json:"counterparties,omitempty"`
+    Label          string   `json:"label,omitempty"`
+}
+
+type TransactionsPage struct {
+    Offset       int                 `json:"offset"`
+    Limit        int                 `json:"limit"`
+    Transactions []WalletTransaction `json:"transactions"`
+}
+
+// AccountBalance: balances of a wallet account in coins
+// Immature are mining rewards that can't be spent until enough blocks were mined on top of them
+type AccountBalance struct {
+    Account     string  `json:"account"`
+    Confirmed   float64 `json:"confirmed"`
+    Unconfirmed float64 `json:"unconfirmed"`
+    Immature    float64 `json:"immature"`
+}
+
+// UnspentOutput: an output the wallet can spend, with the label of its address
+type UnspentOutput struct {
+    TxID          string  `json:"txid"`
+    Vout          uint32  `json:"vout"`
+    Address       string  `json:"address"`
+    Label         string  `json:"label,omitempty"`
+    Account       string  `json:"account"`
+    Amount        float64 `json:"amount"`
+    Confirmations int64   `json:"confirmations"`
+    Spendable     bool    `json:"spendable"`
+}
+
+// intParam: reads the integer query parameter name, def if it is missing
+func intParam(r *http.Request, name string, def int, min int, max int) (int, error) {
+    value := r.URL.Query().Get(name)
+    if value == "" {
+        return def, nil
+    }
+    n, err := strconv.Atoi(value)
+    if err != nil || n < min || n > max {
+        return 0, &manageOrcaNet.Error{Status: http.StatusBadRequest, Message: fmt.Sprintf("%s must be a number from %d to %d", name, min, max)}
+    }
+    return n, nil
+}
+
+// getTransactions: endpoint for the transaction history of the wallet, newest first
+// Usage: optional query parameters "offset" (transactions to skip, 0 by default) and "limit" (at most 100, 20 by default)
+func getTransactions(w http.ResponseWriter, r *http.Request) {
+    fmt.Println("getTransactions endpoint")
+    offset, err := intParam(r, "offset", 0, 0, 1<<30)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    limit, err := intParam(r, "limit", 20, 1, maxTransactionsPage)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    params, err := manageOrcaNet.Params()
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    page := TransactionsPage{Offset: offset, Limit: limit, Transactions: []WalletTransaction{}}
+    err = manageOrcaNet.Wallet(func(c *rpcclient.Client) error {
+        // the wallet doesn't group transactions by account yet, so the history covers all of them
+        results, err := c.ListTransactionsCountFrom("*", limit, offset)
+        if err != nil {
+            return err
+        }
+        payers := make(map[string][]string)
+        for _, result := range results {
+            page.Transactions = append(page.Transactions, walletTransaction(c, result, params, payers))
+        }
+        return nil
+    })
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, page)
+}
+
+// walletTransaction: converts a transaction listed by OrcaWallet, looking up its counterparties and label
+// payers caches the input addresses of received transactions, which are listed once for every output they pay us
+func walletTransaction(wallet *rpcclient.Client, result btcjson.ListTransactionsResult, params *chaincfg.Params, payers map[string][]string) WalletTransaction {
+    tx := WalletTransaction{
+        TxID:          result.TxID,
+        Category:      result.Category,
+        Account:       result.Account,
+        Amount:        result.Amount,
+        Fee:           result.Fee,
+        Confirmations: result.Confirmations,
+        BlockHash:     result.BlockHash,
+        BlockHeight:   result.BlockHeight,
+        Time:          result.Time,
+        Address:       result.Address,
+    }
+    switch result.Category {
+    case "send":
+        if result.Address != "" {
+            tx.Counterparties = []string{result.Address}
+        }
+    case "receive":
+        if _, ok := payers[result.TxID]; !ok {
+            payers[result.TxID] = inputAddresses(wallet, result.TxID, params)
+        }
+        tx.Counterparties = payers[result.TxID]
+    }
+    tx.Label = labelOf(append(tx.Counterparties, tx.Address))
+    return tx
+}
+
+// labelOf: returns the label of the first address that has one
+func labelOf(addresses []string) string {
+    for _, address := range addresses {
+        if label := addressBook.Label(address); label != "" {
+            return label
+        }
+    }
+    return ""
+}
+
+// inputAddresses: returns the addresses that paid for the inputs of the wallet transaction txid
+// the previous transactions are looked up in OrcaNet, which only finds them with --txindex or in the mempool,
+// addresses that can't be found are left out
+func inputAddresses(wallet *rpcclient.Client, txid string, params *chaincfg.Params) []string {
+    hash, err := chainhash.NewHashFromStr(txid)
+    if err != nil {
+        return nil
+    }
+    result, err := wallet.GetTransaction(hash)
+    if err != nil {
+        return nil
+    }
+    serialized, err := hex.DecodeString(result.Hex)
+    if err != nil {
+        return nil
+    }
+    var msgTx wire.MsgTx
+    if err := msgTx.Deserialize(bytes.NewReader(serialized)); err != nil {
+        return nil
+    }
+    var addresses []string
+    seen := make(map[string]bool)
+    prevTxs := make(map[chainhash.Hash]*btcutil.Tx)
+    for _, txIn := range msgTx.TxIn {
+        prevOut := txIn.PreviousOutPoint
+        prevTx, ok := prevTxs[prevOut.Hash]
+        if !ok {
+            manageOrcaNet.Node(func(c *rpcclient.Client) error {
+                prevTx, err = c.GetRawTransaction(&prevOut.Hash)
+                return err
+            })
+            prevTxs[prevOut.Hash] = prevTx
+        }
+        if prevTx == nil || int(prevOut.Index) >= len(prevTx.MsgTx().TxOut) {
+            continue
+        }
+        pkScript := prevTx.MsgTx().TxOut[prevOut.Index].PkScript
+        _, addrs, _, err := txscript.ExtractPkScriptAddrs(pkScript, params)
+        if err != nil {
+            continue
+        }
+        for _, addr := range addrs {
+            address := addr.EncodeAddress()
+            if !seen[address] {
+                seen[address] = true
+                addresses = append(addresses, address)
+            }
+        }
+    }
+    return addresses
+}
+
+// getBalances: endpoint for the confirmed, unconfirmed and immature balance of each wallet account
+func getBalances(w http.ResponseWriter, r *http.Request) {
+    fmt.Println("getBalances endpoint")
+    var balances []AccountBalance
+    err := manageOrcaNet.Wallet(func(c *rpcclient.Client) error {
+        confirmed, err := c.ListAccountsMinConf(1)
+        if err != nil {
+            return err
+        }
+        withUnconfirmed, err := c.ListAccountsMinConf(0)
+        if err != nil {
+            return err
+        }
+        // immature mining rewards only show up in the transaction history
+        history, err := c.ListSinceBlock(nil)
+        if err != nil {
+            return err
+        }
+        immature := make(map[string]float64)
+        for _, tx := range history.Transactions {
+            if tx.Category == "immature" {
+                immature[tx.Account] += tx.Amount
+            }
+        }
+        for account, amount := range withUnconfirmed {
+            balances = append(balances, AccountBalance{
+                Account:     account,
+                Confirmed:   confirmed[account].ToBTC(),
+                Unconfirmed: (amount - confirmed[account]).ToBTC(),
+                Immature:    immature[account],
+            })
+        }
+        return nil
+    })
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    sort.Slice(balances, func(i, j int) bool {
+        return balances[i].Account < balances[j].Account
+    })
+    writeJSON(w, balances)
+}
+
+// listUnspent: endpoint for the outputs the wallet can spend
+// Usage: optional query parameters "minconf" (1 by default), "maxconf" and "addresses" (comma separated)
+func listUnspent(w http.ResponseWriter, r *http.Request) {
+    fmt.Println("listUnspent endpoint")
+    minConf, err := intParam(r, "minconf", 1, 0, 9999999)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    maxConf, err := intParam(r, "maxconf", 9999999, minConf, 9999999)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    // OrcaWallet no longer filters by address, so we do
+    var addresses map[string]bool
+    if param := r.URL.Query().Get("addresses"); param != "" {
+        addresses = make(map[string]bool)
+        for _, address := range strings.Split(param, ",") {
+            addr, err := decodeAddress(strings.TrimSpace(address))
+            if err != nil {
+                writeError(w, err)
+                return
+            }
+            addresses[addr.EncodeAddress()] = true
+        }
+    }
+    outputs := []UnspentOutput{}
+    err = manageOrcaNet.Wallet(func(c *rpcclient.Client) error {
+        results, err := c.ListUnspentMinMax(minConf, maxConf)
+        if err != nil {
+            return err
+        }
+        for _, result := range results {
+            if addresses != nil && !addresses[result.Address] {
+                continue
+            }
+            outputs = append(outputs, UnspentOutput{
+                TxID:          result.TxID,
+                Vout:          result.Vout,
+                Address:       result.Address,
+                Label:         addressBook.Label(result.Address),
+                Account:       result.Account,
+                Amount:        result.Amount,
+                Confirmations: result.Confirmations,
+                Spendable:     result.Spendable,
+            })
+        }
+        return nil
+    })
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, outputs)
+}
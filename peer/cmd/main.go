@@ -1,30 +1,96 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	orcaAPI "orca-peer/internal/api"
+	orcaBandwidth "orca-peer/internal/bandwidth"
+	orcaBlockchain "orca-peer/internal/blockchain"
 	orcaCLI "orca-peer/internal/cli"
+	orcaConfig "orca-peer/internal/config"
+	orcaDataDir "orca-peer/internal/datadir"
+	orcaGeo "orca-peer/internal/geo"
 	orcaHash "orca-peer/internal/hash"
+	orcaLifecycle "orca-peer/internal/lifecycle"
 	"os"
 	"os/exec"
 )
 
-var boostrapNodeAddress string
-
 func main() {
-	flag.StringVar(&boostrapNodeAddress, "bootstrap", "", "Give address to boostrap.")
-	flag.Parse()
+	cfg, err := orcaConfig.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	} else if err != nil {
+		fmt.Printf("Error loading configuration: %s\n", err)
+		os.Exit(2)
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Printf("Invalid configuration: %s\n", err)
+		os.Exit(2)
+	}
+	if err := orcaDataDir.Init(cfg.DataDir); err != nil {
+		fmt.Printf("Error opening data directory: %s\n", err)
+		os.Exit(1)
+	}
+	defer orcaDataDir.Close()
+	orcaLifecycle.HandleSignals(orcaLifecycle.DefaultTimeout, func() {
+		orcaDataDir.Close()
+		os.Exit(0)
+	})
+	fmt.Printf("Using data directory %s\n", orcaDataDir.Root())
+	if err := orcaGeo.Init(cfg.GeoIPPath); err != nil {
+		fmt.Printf("WARNING: %s, peer locations will be reported as unknown\n", err)
+	}
+	orcaBandwidth.SetLimits(orcaBandwidth.Limits{
+		UploadRate:       cfg.MaxUpload,
+		DownloadRate:     cfg.MaxDownload,
+		PeerUploadRate:   cfg.MaxPeerUpload,
+		PeerDownloadRate: cfg.MaxPeerDownload,
+	})
 	publicKey, privateKey := orcaHash.LoadInKeys()
-	os.MkdirAll("./files/stored/", 0755)
 
 	cmd := exec.Command("./OrcaNetAPIServer")
-	cmd.Dir = "../coin/"
-	err := cmd.Start()
+	cmd.Dir = cfg.CoinDir
+	err = cmd.Start()
 	if err != nil {
 		fmt.Printf("Error starting OrcaNetAPIServer: %s\n", err)
 		return
 	}
 	fmt.Println("Started block chain api server")
-	orcaCLI.StartCLI(&boostrapNodeAddress, publicKey, privateKey, cmd, orcaAPI.InitServer)
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	orcaLifecycle.OnShutdown(orcaLifecycle.StageProcesses, "OrcaNetAPIServer", func(ctx context.Context) error {
+		return stopProcess(ctx, cmd, exited)
+	})
+	go orcaBlockchain.WatchPayments(orcaLifecycle.Context(), cfg.CoinAPI)
+
+	orcaCLI.StartCLI(cfg, publicKey, privateKey, orcaAPI.InitServer)
+	fmt.Println("Shutting down...")
+	orcaLifecycle.Shutdown(orcaLifecycle.DefaultTimeout)
+}
+
+// Ask the process to stop and kill it if it has not exited by the time ctx is done.
+func stopProcess(ctx context.Context, cmd *exec.Cmd, exited <-chan struct{}) error {
+	select {
+	case <-exited:
+		return nil
+	default:
+	}
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		// Windows cannot deliver interrupts to other processes
+		return cmd.Process.Kill()
+	}
+	select {
+	case <-exited:
+		return nil
+	case <-ctx.Done():
+		cmd.Process.Kill()
+		<-exited
+		return errors.New("did not exit in time and was killed")
+	}
 }
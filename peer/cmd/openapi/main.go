@@ -0,0 +1,54 @@
+// Command openapi writes the OpenAPI document of the peer node HTTP API.
+//
+//	go run ./cmd/openapi -o api/openapi.json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	orcaAPI "orca-peer/internal/api"
+	orcaBlockchain "orca-peer/internal/blockchain"
+	orcaEvents "orca-peer/internal/events"
+	orcaJobs "orca-peer/internal/jobs"
+	orcaMining "orca-peer/internal/mining"
+	orcaRouter "orca-peer/internal/router"
+	orcaServer "orca-peer/internal/server"
+	"os"
+)
+
+func main() {
+	output := flag.String("o", "", "file to write the document to, defaults to stdout")
+	flag.Parse()
+
+	data, err := document()
+	if err != nil {
+		fmt.Println("Error encoding OpenAPI document:", err)
+		os.Exit(1)
+	}
+	if *output == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(*output, data, 0644); err != nil {
+		fmt.Println("Error writing OpenAPI document:", err)
+		os.Exit(1)
+	}
+}
+
+// Build the document from the same route tables the node serves.
+func document() ([]byte, error) {
+	router := orcaRouter.New()
+	router.Handle(orcaServer.Routes(nil, nil)...)
+	router.Handle(orcaAPI.Routes()...)
+	router.Handle(orcaJobs.Routes()...)
+	router.Handle(orcaMining.Routes()...)
+	router.Handle(orcaBlockchain.Routes()...)
+	router.Handle(orcaEvents.Routes()...)
+
+	data, err := json.MarshalIndent(router.OpenAPI(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
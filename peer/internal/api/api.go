@@ -1,16 +1,21 @@
 package api
 
 import (
+	"context"
 	"crypto/rsa"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	orcaCLI "orca-peer/internal/cli"
+	orcaDataDir "orca-peer/internal/datadir"
 	"orca-peer/internal/fileshare"
 	orcaHash "orca-peer/internal/hash"
+	orcaEvents "orca-peer/internal/events"
 	orcaJobs "orca-peer/internal/jobs"
+	orcaLifecycle "orca-peer/internal/lifecycle"
 	orcaMining "orca-peer/internal/mining"
+	orcaRouter "orca-peer/internal/router"
 	"orca-peer/internal/server"
 	"os"
 	"path/filepath"
@@ -48,7 +53,6 @@ func getFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	fmt.Println("hash:", hash)
-	fileaddress := ""
 
 	if chunkIndex == "" {
 		http.Error(w, "Missing 'chunk-index' parameter", http.StatusBadRequest)
@@ -60,39 +64,39 @@ func getFile(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Bad chunk index parameter", http.StatusBadRequest)
 		return
 	}
-	fileaddress = ""
 	orcaFileInfo, ok := storedFileInfoMap[hash]
 	if !ok {
 		http.Error(w, "Specified hash is not in orcastore fileshare server node list", http.StatusBadRequest)
+		return
 	}
 
 	hashes := orcaFileInfo.ChunkHashes
-	if chunkIndexInt >= len(hashes) {
+	if chunkIndexInt < 0 || chunkIndexInt >= len(hashes) {
 		http.Error(w, "Bad chunk index parameter", http.StatusBadRequest)
 		return
 	}
 
-	if _, err := os.Stat("files/stored/" + hashes[chunkIndexInt]); !os.IsNotExist(err) {
-		fileaddress = "files/stored/" + hashes[chunkIndexInt]
-	}
-
-	if fileaddress != "" {
-		fmt.Println("File address:", fileaddress)
-		w.Header().Set("X-Chunks-Length", fmt.Sprintf("%d", len(hashes)))
-		http.ServeFile(w, r, fileaddress)
-
-	} else if os.IsNotExist(err) {
+	fileaddress := filepath.Join(orcaDataDir.StoredDir(), hashes[chunkIndexInt])
+	chunkInfo, err := os.Stat(fileaddress)
+	if os.IsNotExist(err) {
 		w.WriteHeader(http.StatusBadRequest)
 		writeStatusUpdate(w, "File hash does not exist in directory.")
 		return
-	} else {
+	} else if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		writeStatusUpdate(w, "Error arose checking for file.")
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	writeStatusUpdate(w, "Successfully removed file.")
-	return
+	fmt.Println("File address:", fileaddress)
+	w.Header().Set("X-Chunks-Length", fmt.Sprintf("%d", len(hashes)))
+	http.ServeFile(w, r, fileaddress)
+	orcaEvents.Publish(orcaEvents.ChunkServed, orcaEvents.ChunkServedData{
+		PeerID:   r.RemoteAddr,
+		FileHash: hash,
+		Chunk:    chunkIndexInt,
+		Chunks:   len(hashes),
+		Bytes:    int(chunkInfo.Size()),
+	})
 }
 func getAllFiles(w http.ResponseWriter, r *http.Request) {
 
@@ -122,8 +126,13 @@ type HashResponse struct {
 	Hash string `json:"hash"`
 }
 
+type UploadFileResponse struct {
+	Status string `json:"status"`
+	Hash   string `json:"hash"`
+}
+
 type UploadFileReq struct {
-	FilePath string `json:"filePath"`
+	FilePath string `json:"filePath" validate:"required"`
 	Price    int64  `json:"price"`
 }
 
@@ -146,18 +155,24 @@ func uploadFile(w http.ResponseWriter, r *http.Request) {
 		sourceFile, err := os.Open(payload.FilePath)
 		if err != nil {
 			fmt.Println("Error opening source file:", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			writeStatusUpdate(w, "Unable to open the file to upload.")
 			return
 		}
 		defer sourceFile.Close()
-		destinationFile, err := os.Create("./files/" + fileName)
+		destinationFile, err := os.Create(filepath.Join(orcaDataDir.FilesDir(), fileName))
 		if err != nil {
 			fmt.Println("Error creating destination file:", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			writeStatusUpdate(w, "Unable to copy the file into the files directory.")
 			return
 		}
 		defer destinationFile.Close()
 		_, err = io.Copy(destinationFile, sourceFile)
 		if err != nil {
 			fmt.Println("Error copying file:", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			writeStatusUpdate(w, "Unable to copy the file into the files directory.")
 			return
 		}
 
@@ -166,18 +181,26 @@ func uploadFile(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Unable to store file on DHT", http.StatusInternalServerError)
 			return
 		}
-		response := HashResponse{Hash: hashKey}
+		response := UploadFileResponse{
+			Status: "Successfully uploaded file from local computer into files directory",
+			Hash:   hashKey,
+		}
 		jsonResponse, err := json.Marshal(response)
 		if err != nil {
 			http.Error(w, "Unable to marshal JSON", http.StatusInternalServerError)
 			return
 		}
-		writeStatusUpdate(w, "Successfully uploaded file from local computer into files directory")
+		w.Header().Set("Content-Type", "application/json")
 		w.Write(jsonResponse)
-		return
+	} else {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		writeStatusUpdate(w, "Only POST requests will be handled.")
 	}
 }
 
+// Largest /writeFile body, files are sent whole and base64 encoded.
+const maxWriteFileBody = 256 << 20
+
 type WriteFileJSONBody struct {
 	Base64File       string `json:"base64File"`
 	Filesize         string `json:"fileSize"`
@@ -210,16 +233,32 @@ func writeFile(w http.ResponseWriter, r *http.Request) {
 
 }
 
-func handleFileRoute(w http.ResponseWriter, r *http.Request) {
+// Hash of the file a route refers to. That is the {hash} path segment, or on
+// the legacy routes the segment after /file/ which has to be followed by suffix.
+func fileRouteHash(r *http.Request, suffix ...string) (string, bool) {
+	if hash := orcaRouter.PathValue(r, "hash"); hash != "" {
+		return hash, true
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/file/"), "/")
+	if len(parts) != len(suffix)+1 || parts[0] == "" {
+		return "", false
+	}
+	for i, part := range suffix {
+		if parts[i+1] != part {
+			return "", false
+		}
+	}
+	return parts[0], true
+}
+
+func deleteLocalFile(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodDelete {
-		path := r.URL.Path
-		parts := strings.Split(path, "/")
-		if len(parts) != 3 {
+		hash, ok := fileRouteHash(r)
+		if !ok {
 			http.NotFound(w, r)
 			return
 		}
-		hash := parts[2]
-		filePath := "./files/" + hash
+		filePath := filepath.Join(orcaDataDir.FilesDir(), hash)
 		if _, err := os.Stat(filePath); err == nil {
 			err := os.Remove(filePath)
 			if err != nil {
@@ -229,7 +268,7 @@ func handleFileRoute(w http.ResponseWriter, r *http.Request) {
 			}
 
 		} else if os.IsNotExist(err) {
-			w.WriteHeader(http.StatusBadRequest)
+			w.WriteHeader(http.StatusNotFound)
 			writeStatusUpdate(w, "File hash does not exist in directory.")
 			return
 		} else {
@@ -239,19 +278,24 @@ func handleFileRoute(w http.ResponseWriter, r *http.Request) {
 		}
 		w.WriteHeader(http.StatusOK)
 		writeStatusUpdate(w, "Successfully removed file.")
-		return
-	} else if r.Method == http.MethodGet {
-		path := r.URL.Path
-		parts := strings.Split(path, "/")
-		if len(parts) != 4 || parts[3] != "info" {
+	} else {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		writeStatusUpdate(w, "Only DELETE requests will be handled.")
+	}
+}
+
+func getFileInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		hash, ok := fileRouteHash(r, "info")
+		if !ok {
 			http.NotFound(w, r)
 			return
 		}
-		hash := parts[2]
 		holders, err := server.SetupCheckHolders(hash)
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			writeStatusUpdate(w, "Unable to find holders of this file.")
+			return
 		}
 		peers := make([]string, 0)
 		for _, holder := range holders.Holders {
@@ -274,8 +318,7 @@ func handleFileRoute(w http.ResponseWriter, r *http.Request) {
 		w.Write(jsonData)
 	} else {
 		w.WriteHeader(http.StatusMethodNotAllowed)
-		writeStatusUpdate(w, "Only DELETE requests will be handled.")
-		return
+		writeStatusUpdate(w, "Only GET requests will be handled.")
 	}
 }
 
@@ -300,12 +343,12 @@ func deleteFile(w http.ResponseWriter, r *http.Request) {
 			}
 			if payload.Filename == "" && payload.Hash == "" {
 
-				w.WriteHeader(http.StatusInternalServerError)
+				w.WriteHeader(http.StatusBadRequest)
 				writeStatusUpdate(w, "Missing Filename and CID values inside of the payload.")
 				return
 			}
-			fileDir := "./files/"
-			filePath := "./files/" + payload.Hash
+			fileDir := orcaDataDir.FilesDir()
+			filePath := filepath.Join(orcaDataDir.FilesDir(), payload.Hash)
 
 			// Check if the file exists in the "stored" directory
 			storedFilePath := filepath.Join(fileDir, "stored", payload.Hash)
@@ -327,6 +370,8 @@ func deleteFile(w http.ResponseWriter, r *http.Request) {
 			}
 
 			fmt.Println("File deleted successfully.")
+			w.WriteHeader(http.StatusOK)
+			writeStatusUpdate(w, "Successfully removed file.")
 			return
 
 		default:
@@ -337,10 +382,8 @@ func deleteFile(w http.ResponseWriter, r *http.Request) {
 	} else {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		writeStatusUpdate(w, "Only DELETE requests will be handled.")
-
 		return
 	}
-
 }
 
 func InitServer(fileInfoMap *map[string]fileshare.FileInfo) {
@@ -349,18 +392,14 @@ func InitServer(fileInfoMap *map[string]fileshare.FileInfo) {
 	peers = NewPeerStorage()
 	fmt.Println("Settig up API Routes")
 	publicKey, privateKey = orcaHash.LoadInKeys()
-	orcaJobs.InitJobRoutes()
 	orcaMining.InitDeviceTracker()
-	http.HandleFunc("/file/", handleFileRoute)
-	http.HandleFunc("/upload", uploadFile)
-	http.HandleFunc("/get-file", getFile)
-	http.HandleFunc("/upload-file", uploadFile)
-	http.HandleFunc("/delete-file", deleteFile)
-
-	http.HandleFunc("/writeFile", writeFile)
-	http.HandleFunc("/sendMoney", sendMoney)
-	http.HandleFunc("/getLocation", getLocation)
-	http.HandleFunc("/job-peer", JobPeerHandler)
-	http.HandleFunc("/device", orcaMining.PutDeviceHandler)
-	http.HandleFunc("/device_list", orcaMining.PutDeviceHandler)
+	go orcaMining.RunPeriodicSave(orcaLifecycle.Context())
+	go orcaMining.RunSampler(orcaLifecycle.Context())
+	orcaLifecycle.OnShutdown(orcaLifecycle.StageStorage, "mining history", func(ctx context.Context) error {
+		return orcaMining.Flush()
+	})
+	orcaRouter.Handle(Routes()...)
+	orcaRouter.Handle(orcaJobs.Routes()...)
+	orcaRouter.Handle(orcaMining.Routes()...)
+	orcaRouter.Handle(orcaEvents.Routes()...)
 }
@@ -3,10 +3,13 @@ package api
 import (
 	"crypto/sha256"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	orcaClient "orca-peer/internal/client"
+	orcaDataDir "orca-peer/internal/datadir"
 	orcaStatus "orca-peer/internal/status"
 	"os"
+	"path/filepath"
 )
 
 // API to use with out CLI
@@ -60,31 +63,24 @@ type LocationInfoResponse struct {
 	ASN       string `json:"asn"`
 	Timezone  string `json:"timezone"`
 	Continent string `json:"continent"`
-	Org       string `json:"org`
+	Org       string `json:"org"`
+	FlagUrl   string `json:"flagUrl"`
 }
 
 func getLocation(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
-		locationJsonString := orcaStatus.GetLocationData()
-		var locationJson map[string]interface{}
-		err := json.Unmarshal([]byte(locationJsonString), &locationJson)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			writeStatusUpdate(w, "Issue with reading the request body. Is the correct format used?")
-			return
+		locationData := orcaStatus.GetLocationData()
+		location := LocationInfoResponse{
+			Ip:        locationData.Ip,
+			City:      locationData.City,
+			Region:    locationData.Region,
+			Country:   locationData.Country,
+			Latitude:  fmt.Sprint(locationData.Latitude),
+			Longitude: fmt.Sprint(locationData.Longitude),
+			Timezone:  locationData.Timezone,
+			Continent: locationData.Continent,
+			FlagUrl:   locationData.FlagUrl,
 		}
-		location := LocationInfoResponse{}
-		location.Ip = locationJson["ip"].(string)
-		location.Network = locationJson["network"].(string)
-		location.City = locationJson["city"].(string)
-		location.Region = locationJson["region"].(string)
-		location.Country = locationJson["country_name"].(string)
-		location.Latitude = locationJson["latitude"].(string)
-		location.Longitude = locationJson["longitude"].(string)
-		location.ASN = locationJson["asn"].(string)
-		location.Timezone = locationJson["timezone"].(string)
-		location.Continent = locationJson["continent_code"].(string)
-		location.Org = locationJson["org"].(string)
 
 		jsonData, err := json.Marshal(location)
 		if err != nil {
@@ -116,7 +112,7 @@ func hashFile(w http.ResponseWriter, r *http.Request) {
 				writeStatusUpdate(w, "Cannot marshal payload in Go object. Does the payload have the correct body structure?")
 				return
 			}
-			fileData, err := os.ReadFile("files/" + payload.Filepath)
+			fileData, err := os.ReadFile(filepath.Join(orcaDataDir.FilesDir(), payload.Filepath))
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				writeStatusUpdate(w, "Failed to read in file from given path")
@@ -34,8 +34,8 @@ func JobPeerHandler(w http.ResponseWriter, r *http.Request) {
 				}
 			}
 			if !found {
-				w.WriteHeader(http.StatusBadRequest)
-				writeStatusUpdate(w, "Unable to find a job with specified job id")
+				w.WriteHeader(http.StatusNotFound)
+				writeStatusUpdate(w, "Unable to find a job for the specified file hash")
 				return
 			}
 			peerOnJob := JobPeerResPayload{
@@ -56,13 +56,11 @@ func JobPeerHandler(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusOK)
 			w.Write(jsonData)
 		} else {
-			w.WriteHeader(http.StatusBadRequest)
+			w.WriteHeader(http.StatusNotFound)
 			writeStatusUpdate(w, "Peer with specified ID does not exist")
 		}
-		w.WriteHeader(http.StatusOK)
-		writeStatusUpdate(w, "Successfully added job.")
 	} else {
 		w.WriteHeader(http.StatusMethodNotAllowed)
-		writeStatusUpdate(w, "Only PATCH requests will be handled.")
+		writeStatusUpdate(w, "Only GET requests will be handled.")
 	}
 }
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"net/http"
+	orcaRouter "orca-peer/internal/router"
+)
+
+// Routes returns the HTTP routes for files, the wallet and the node itself.
+func Routes() []orcaRouter.Route {
+	return []orcaRouter.Route{
+		{
+			Method:      http.MethodPost,
+			Path:        "/files/upload",
+			Legacy:      "/upload-file",
+			Scope:       orcaRouter.ScopeFiles,
+			Tag:         "files",
+			Summary:     "Import a local file and offer it on the network",
+			Description: "price is per MiB and becomes the price of the file in the pricing policy, the default price of the policy is used when it is 0.",
+			Body:        UploadFileReq{},
+			Response:    UploadFileResponse{},
+			Handler:     uploadFile,
+		},
+		{
+			Method:  http.MethodPost,
+			Legacy:  "/upload",
+			Scope:   orcaRouter.ScopeFiles,
+			Handler: uploadFile,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/files/write",
+			Legacy:  "/writeFile",
+			Scope:   orcaRouter.ScopeFiles,
+			Tag:     "files",
+			Summary: "Write a base64 encoded file into the files directory",
+			Body:    WriteFileJSONBody{},
+			MaxBody: maxWriteFileBody,
+			Handler: writeFile,
+		},
+		{
+			Method:  http.MethodDelete,
+			Path:    "/files",
+			Legacy:  "/delete-file",
+			Scope:   orcaRouter.ScopeFiles,
+			Tag:     "files",
+			Summary: "Delete a requested or uploaded file",
+			Body:    GetFileJSONBody{},
+			Handler: deleteFile,
+		},
+		{
+			Method:  http.MethodDelete,
+			Path:    "/files/{hash}",
+			Legacy:  "/file/",
+			Scope:   orcaRouter.ScopeFiles,
+			Tag:     "files",
+			Summary: "Delete a file from the files directory",
+			Handler: deleteLocalFile,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/files/{hash}/info",
+			Legacy:   "/file/",
+			Scope:    orcaRouter.ScopeRead,
+			Tag:      "files",
+			Summary:  "Find the peers holding a file",
+			Response: GetFileJSONResponseBody{},
+			Handler:  getFileInfo,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/jobs/peer",
+			Legacy:   "/job-peer",
+			Scope:    orcaRouter.ScopeRead,
+			Tag:      "jobs",
+			Summary:  "Get the state of the job downloading a file from a peer",
+			Query:    []orcaRouter.Param{{Name: "fileHash", Required: true}, {Name: "peer", Required: true}},
+			Response: JobPeerResPayload{},
+			Handler:  JobPeerHandler,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/wallet/send",
+			Legacy:  "/sendMoney",
+			Scope:   orcaRouter.ScopeWallet,
+			Tag:     "wallet",
+			Summary: "Send a signed transaction to a peer",
+			Body:    SendMoneyJSONRequest{},
+			Handler: sendMoney,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/location",
+			Legacy:   "/getLocation",
+			Scope:    orcaRouter.ScopeRead,
+			Tag:      "node",
+			Summary:  "Get the public IP address and location of this node",
+			Response: LocationInfoResponse{},
+			Handler:  getLocation,
+		},
+
+		// Between peers only
+		{
+			Method:  http.MethodGet,
+			Legacy:  "/get-file",
+			Scope:   orcaRouter.ScopePublic,
+			Handler: getFile,
+		},
+	}
+}
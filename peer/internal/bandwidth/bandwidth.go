@@ -0,0 +1,239 @@
+package bandwidth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/metrics"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+const (
+	// Protocol that file chunk transfers are accounted under.
+	FileShareProtocol = protocol.ID("orcanet-fileshare/1.0")
+	// How often a rate sample is appended to the history.
+	sampleInterval = 10 * time.Second
+	// Number of samples kept, one hour at the default interval.
+	historySize = 360
+	// Per-peer buckets and job counters without traffic for this long are
+	// dropped, so peers and jobs that are gone do not pile up.
+	idleTimeout = time.Hour
+)
+
+// Limits caps transfer rates in bytes per second. Zero means unlimited.
+type Limits struct {
+	UploadRate       int64 `json:"uploadRate"`
+	DownloadRate     int64 `json:"downloadRate"`
+	PeerUploadRate   int64 `json:"peerUploadRate"`
+	PeerDownloadRate int64 `json:"peerDownloadRate"`
+}
+
+// Sample is a snapshot of transfer rates in bytes per second.
+type Sample struct {
+	Time        time.Time `json:"time"`
+	RateIn      float64   `json:"rateIn"`
+	RateOut     float64   `json:"rateOut"`
+	TransferIn  float64   `json:"transferIn"`
+	TransferOut float64   `json:"transferOut"`
+}
+
+// JobStats counts the file chunk bytes moved on behalf of a single job.
+type JobStats struct {
+	BytesIn  int64 `json:"bytesIn"`
+	BytesOut int64 `json:"bytesOut"`
+}
+
+type jobEntry struct {
+	JobStats
+	last time.Time
+}
+
+var (
+	// Reporter is installed on the libp2p host and sees all of its traffic.
+	Reporter = metrics.NewBandwidthCounter()
+	// transfers only sees file chunks sent and received by the market.
+	transfers = metrics.NewBandwidthCounter()
+
+	mutex          sync.Mutex
+	limits         Limits
+	uploadBucket   = newBucket(0)
+	downloadBucket = newBucket(0)
+	peerUpload     = make(map[peer.ID]*bucket)
+	peerDownload   = make(map[peer.ID]*bucket)
+	jobStats       = make(map[string]*jobEntry)
+	history        = make([]Sample, 0, historySize)
+)
+
+func SetLimits(l Limits) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	limits = l
+	uploadBucket.setRate(l.UploadRate)
+	downloadBucket.setRate(l.DownloadRate)
+	for _, b := range peerUpload {
+		b.setRate(l.PeerUploadRate)
+	}
+	for _, b := range peerDownload {
+		b.setRate(l.PeerDownloadRate)
+	}
+}
+
+func GetLimits() Limits {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return limits
+}
+
+// ThrottleUpload accounts n bytes of file data sent to p for jobId and blocks
+// until the global and per-peer upload caps allow them to go out.
+func ThrottleUpload(ctx context.Context, p peer.ID, jobId string, n int) error {
+	mutex.Lock()
+	delay := maxDuration(uploadBucket.take(n), peerBucket(peerUpload, p, limits.PeerUploadRate).take(n))
+	addJobBytes(jobId, 0, int64(n))
+	mutex.Unlock()
+
+	transfers.LogSentMessage(int64(n))
+	transfers.LogSentMessageStream(int64(n), FileShareProtocol, p)
+	return wait(ctx, delay)
+}
+
+// ThrottleDownload accounts n bytes of file data received from p for jobId and
+// blocks until the global and per-peer download caps allow more to be requested.
+func ThrottleDownload(ctx context.Context, p peer.ID, jobId string, n int) error {
+	mutex.Lock()
+	delay := maxDuration(downloadBucket.take(n), peerBucket(peerDownload, p, limits.PeerDownloadRate).take(n))
+	addJobBytes(jobId, int64(n), 0)
+	mutex.Unlock()
+
+	transfers.LogRecvMessage(int64(n))
+	transfers.LogRecvMessageStream(int64(n), FileShareProtocol, p)
+	return wait(ctx, delay)
+}
+
+// Must be called with the mutex held.
+func peerBucket(buckets map[peer.ID]*bucket, p peer.ID, rate int64) *bucket {
+	b, ok := buckets[p]
+	if !ok {
+		b = newBucket(rate)
+		buckets[p] = b
+	}
+	return b
+}
+
+// Must be called with the mutex held.
+func addJobBytes(jobId string, in int64, out int64) {
+	if jobId == "" {
+		return
+	}
+	stats, ok := jobStats[jobId]
+	if !ok {
+		stats = &jobEntry{}
+		jobStats[jobId] = stats
+	}
+	stats.BytesIn += in
+	stats.BytesOut += out
+	stats.last = time.Now()
+}
+
+func GetJobStats(jobId string) JobStats {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if stats, ok := jobStats[jobId]; ok {
+		return stats.JobStats
+	}
+	return JobStats{}
+}
+
+// Must be called with the mutex held.
+func evictIdle(now time.Time) {
+	for _, buckets := range []map[peer.ID]*bucket{peerUpload, peerDownload} {
+		for p, b := range buckets {
+			if b.idle(now, idleTimeout) {
+				delete(buckets, p)
+			}
+		}
+	}
+	for jobId, stats := range jobStats {
+		if now.Sub(stats.last) >= idleTimeout {
+			delete(jobStats, jobId)
+		}
+	}
+}
+
+// Totals returns the libp2p host traffic and the file transfer traffic.
+func Totals() (metrics.Stats, metrics.Stats) {
+	return Reporter.GetBandwidthTotals(), transfers.GetBandwidthTotals()
+}
+
+// ByPeer returns the libp2p host traffic per peer.
+func ByPeer() map[peer.ID]metrics.Stats {
+	return Reporter.GetBandwidthByPeer()
+}
+
+// ByProtocol returns the libp2p host traffic per protocol.
+func ByProtocol() map[protocol.ID]metrics.Stats {
+	return Reporter.GetBandwidthByProtocol()
+}
+
+// TransfersByPeer returns the file transfer traffic per peer.
+func TransfersByPeer() map[peer.ID]metrics.Stats {
+	return transfers.GetBandwidthByPeer()
+}
+
+func History() []Sample {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return append([]Sample(nil), history...)
+}
+
+// RecordHistory samples the current rates at a fixed interval until ctx is
+// cancelled. Idle per-peer buckets and job counters are dropped along the way.
+func RecordHistory(ctx context.Context) {
+	ticker := time.NewTicker(sampleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		host, files := Totals()
+		sample := Sample{
+			Time:        time.Now(),
+			RateIn:      host.RateIn,
+			RateOut:     host.RateOut,
+			TransferIn:  files.RateIn,
+			TransferOut: files.RateOut,
+		}
+		mutex.Lock()
+		if len(history) == historySize {
+			history = append(history[:0], history[1:]...)
+		}
+		history = append(history, sample)
+		evictIdle(sample.Time)
+		mutex.Unlock()
+	}
+}
+
+func wait(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
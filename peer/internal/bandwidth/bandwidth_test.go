@@ -0,0 +1,54 @@
+package bandwidth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestEvictIdleForgetsPeersAndJobs(t *testing.T) {
+	SetLimits(Limits{PeerUploadRate: 1000})
+	t.Cleanup(func() { SetLimits(Limits{}) })
+
+	p := peer.ID("peer")
+	if err := ThrottleUpload(context.Background(), p, "job", 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := ThrottleDownload(context.Background(), p, "job", 100); err != nil {
+		t.Fatal(err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	evictIdle(time.Now())
+	if peerUpload[p] == nil || peerDownload[p] == nil || jobStats["job"] == nil {
+		t.Fatal("active peer or job was dropped")
+	}
+
+	// A bucket still in debt is kept however long it went unused.
+	peerUpload[p].tokens = -1000 * idleTimeout.Seconds() * 2
+	evictIdle(time.Now().Add(idleTimeout))
+	if peerUpload[p] == nil {
+		t.Fatal("bucket in debt was dropped")
+	}
+	if peerDownload[p] != nil || jobStats["job"] != nil {
+		t.Fatal("idle peer or job was kept")
+	}
+}
+
+func TestIdleBucket(t *testing.T) {
+	now := time.Now()
+	unlimited := &bucket{last: now}
+	if unlimited.idle(now, time.Minute) || !unlimited.idle(now.Add(time.Minute), time.Minute) {
+		t.Error("unlimited bucket idle state is wrong")
+	}
+	b := &bucket{rate: 1000, tokens: -1000, last: now}
+	if b.idle(now.Add(time.Second), time.Second) {
+		t.Error("bucket in debt reported idle")
+	}
+	if !b.idle(now.Add(2*time.Second), time.Second) {
+		t.Error("refilled bucket not reported idle")
+	}
+}
@@ -0,0 +1,53 @@
+package bandwidth
+
+import "time"
+
+// bucket is a token bucket holding up to one second worth of bytes. Takes larger
+// than the bucket are allowed and put it into debt, so callers simply wait for
+// the returned delay instead of having to split their writes.
+type bucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate int64) *bucket {
+	return &bucket{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+func (b *bucket) setRate(rate int64) {
+	b.refill(time.Now())
+	b.rate = float64(rate)
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+}
+
+func (b *bucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+}
+
+// idle reports whether the bucket went unused for timeout and is out of debt,
+// so dropping it and starting a full one later changes nothing.
+func (b *bucket) idle(now time.Time, timeout time.Duration) bool {
+	elapsed := now.Sub(b.last)
+	return elapsed >= timeout && b.tokens+elapsed.Seconds()*b.rate >= b.rate
+}
+
+// take removes n tokens and returns how long the caller has to wait until the
+// bucket is out of debt. An unlimited bucket never delays.
+func (b *bucket) take(n int) time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+	b.refill(time.Now())
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
@@ -0,0 +1,33 @@
+package bandwidth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUnlimitedBucketNeverDelays(t *testing.T) {
+	b := newBucket(0)
+	if delay := b.take(1 << 30); delay != 0 {
+		t.Errorf("unlimited bucket delayed by %s", delay)
+	}
+}
+
+func TestBucketDelaysOnceEmpty(t *testing.T) {
+	b := newBucket(1000)
+	if delay := b.take(1000); delay != 0 {
+		t.Errorf("full bucket delayed by %s", delay)
+	}
+	// A take larger than the bucket goes into debt instead of failing.
+	delay := b.take(2000)
+	if delay < 1900*time.Millisecond || delay > 2*time.Second {
+		t.Errorf("expected a delay of about 2s, got %s", delay)
+	}
+}
+
+func TestSetRateCapsTokens(t *testing.T) {
+	b := newBucket(1000)
+	b.setRate(10)
+	if delay := b.take(20); delay < 900*time.Millisecond {
+		t.Errorf("lowered rate did not drain the bucket, delay %s", delay)
+	}
+}
@@ -5,17 +5,17 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	orcaEvents "orca-peer/internal/events"
 	"os"
 	"os/exec"
-	"path/filepath"
-	"runtime"
 	"strconv"
-	"strings"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/rpcclient"
 )
 
 const (
 	orcaNetPath    string = "./OrcaNet/OrcaNet"
-	btcctlPath     string = "./OrcaNet/cmd/btcctl/btcctl"
 	orcaWalletPath string = "./OrcaWallet/btcwallet"
 )
 
@@ -50,108 +50,16 @@ func StartOrcaWallet() (*exec.Cmd, error) {
 	return cmd, err
 }
 
-// getBtcdConfFilePath returns the file path for btcd.conf based on the user's OS
-func getBtcdConfFilePath() string {
-	const defaultConfigFilename = "btcd.conf"
-	homeDir := getUserHomeDir()
-	if homeDir == "" {
-		return "" // Return empty string if the home directory can't be determined
-	}
-
-	// Determine the application data directory based on the operating system
-	var appDataDir string
-	switch runtime.GOOS {
-	case "windows":
-		appDataDir = filepath.Join(homeDir, "AppData", "Roaming", "Btcd")
-	case "darwin": // macOS
-		appDataDir = filepath.Join(homeDir, "Library", "Application Support", "Btcd")
-	case "linux":
-		appDataDir = filepath.Join(homeDir, ".btcd")
-	default:
-		appDataDir = filepath.Join(homeDir, ".btcd") // Default to a Unix-style hidden directory
-	}
-
-	return filepath.Join(appDataDir, defaultConfigFilename)
-}
-
-// getUserHomeDir returns the home directory of the current user
-func getUserHomeDir() string {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		fmt.Println("Error getting user home directory:", err)
-		return ""
-	}
-	return homeDir
-}
-
-// returns an array [rpcuser, rpcpass]
-func readRPCInfo(path string) ([]string, error) {
-	body, err := os.ReadFile(path)
-
-	if err != nil {
-		return nil, fmt.Errorf("error reading the btcd.conf file")
-	}
-
-	content := string(body)
-	var rpcInfo []string
-	// find the line with "rpcuser" and "rpcpass"
-	lines := strings.Split(content, "\n")
-	for _, line := range lines {
-		if strings.HasPrefix(line, "rpcuser") || strings.HasPrefix(line, "rpcpass") {
-			parts := strings.Split(line, "=")
-			// if len(parts) == 2 {
-			// 	fmt.Println(parts)
-			// 	rpcInfo = append(rpcInfo, strings.TrimSpace(parts[1]))
-			// }
-			rpcInfo = append(rpcInfo, strings.TrimSpace(parts[1]))
+// Unlocks the wallet for 100 seconds and sends the coins. The passphrase only
+// travels over RPC to the wallet, it never ends up on a command line.
+func sendCoins(amount btcutil.Amount, address btcutil.Address, walletPass string) error {
+	return Wallet(func(client *rpcclient.Client) error {
+		if err := client.WalletPassphrase(walletPass, 100); err != nil {
+			return err
 		}
-	}
-
-	if len(rpcInfo) < 2 {
-		return nil, fmt.Errorf("error finding rpcuser and rpc pass")
-	}
-	return rpcInfo, nil
-}
-
-// callBtcctlCmd: calls a Btcctl command Exactly as specified in string param, and returns the stdout of btcctl as a string
-// its a singular string, but you can pass as many arguments, we will split the arguments in this fn
-func CallBtcctlCmd(cmdStr string) (string, error) {
-	// get the rpc values
-	rpcInfo, err := readRPCInfo(getBtcdConfFilePath())
-	if err != nil {
-		return "", fmt.Errorf("failed to get rpc info")
-	}
-	fmt.Println(rpcInfo)
-	params := strings.Split(cmdStr, " ")
-	params = append(params, "--rpcuser="+strings.TrimSpace(rpcInfo[0])+"=", "--rpcpass="+strings.TrimSpace(rpcInfo[1])+"=")
-
-	fmt.Println(params)
-	cmd := exec.Command(btcctlPath, params...)
-	// get the stdout of cmd, CAN HANG but shouldn't be a problem in a btcctl command
-	stdout, err := cmd.CombinedOutput()
-	if err != nil {
-		return "", fmt.Errorf("failed to execute btcctl commands '%s': %s, error: %v", cmdStr, stdout, err)
-	}
-	fmt.Println(err)
-	return string(stdout), nil
-}
-
-func unlockWallet(walletPass string) error {
-	command := fmt.Sprintf("--wallet walletpassphrase %s 100", walletPass)
-	stdout, err := CallBtcctlCmd(command)
-	if err != nil {
-		return fmt.Errorf("failed to unlock wallet: %s, error: %v", stdout, err)
-	}
-	return nil
-}
-
-func sendCoins(numCoins string, address string) error {
-	command := fmt.Sprintf("--wallet sendtoaddress %s %s", address, numCoins)
-	stdout, err := CallBtcctlCmd(command)
-	if err != nil {
-		return fmt.Errorf("failed to send coins: %s, error: %v", stdout, err)
-	}
-	return nil
+		_, err := client.SendToAddress(address, amount)
+		return err
+	})
 }
 
 // sendToAddress: endpoint to send n coins to an address
@@ -162,17 +70,30 @@ func SendToAddress(coins string, address string, senderWalletPass string) error
 		return errors.New("missing parameter")
 	}
 
-	if _, err := strconv.ParseFloat(coins, 64); err != nil {
+	amount, err := strconv.ParseFloat(coins, 64)
+	if err != nil {
 		return errors.New("invalid coin amount")
 	}
-
-	if err := unlockWallet(senderWalletPass); err != nil {
-		return errors.New("unable to unlock wallet")
+	satoshis, err := btcutil.NewAmount(amount)
+	if err != nil || satoshis <= 0 {
+		return errors.New("invalid coin amount")
+	}
+	params, err := Params()
+	if err != nil {
+		return err
+	}
+	addr, err := btcutil.DecodeAddress(address, params)
+	if err != nil || !addr.IsForNet(params) {
+		return errors.New("invalid address")
 	}
 
-	if err := sendCoins(coins, address); err != nil {
-		return errors.New("unable to send coins")
+	if err := sendCoins(satoshis, addr, senderWalletPass); err != nil {
+		return fmt.Errorf("unable to send coins: %w", err)
 	}
 
+	orcaEvents.Publish(orcaEvents.PaymentSent, orcaEvents.PaymentData{
+		Amount:  amount,
+		Address: address,
+	})
 	return nil
 }
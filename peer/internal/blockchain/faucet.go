@@ -0,0 +1,79 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/rpcclient"
+)
+
+// How long to wait for a faucet, it answers once the coins are sent.
+const faucetTimeout = 30 * time.Second
+
+// A payout of an OrcaNetAPIServer faucet.
+type FaucetPayout struct {
+	Time    time.Time `json:"time"`
+	Address string    `json:"address"`
+	Amount  float64   `json:"amount"`
+	TxID    string    `json:"txid"`
+}
+
+// RequestFaucet asks the faucet at faucetURL, e.g. a bootstrap node serving
+// one at http://host:3334, for coins paid to a new address of our wallet.
+func RequestFaucet(faucetURL string) (*FaucetPayout, error) {
+	var address string
+	err := Wallet(func(client *rpcclient.Client) error {
+		addr, err := client.GetNewAddress("default")
+		if err == nil {
+			address = addr.EncodeAddress()
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return requestFaucet(faucetURL, address)
+}
+
+func requestFaucet(faucetURL string, address string) (*FaucetPayout, error) {
+	if !strings.Contains(faucetURL, "://") {
+		faucetURL = "http://" + faucetURL
+	}
+	u, err := url.Parse(faucetURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid faucet url: %w", err)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/faucet"
+	}
+	body, err := json.Marshal(map[string]string{"address": address})
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: faucetTimeout}
+	resp, err := client.Post(u.String(), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error *RPCError `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&failure) == nil && failure.Error != nil {
+			failure.Error.Status = resp.StatusCode
+			return nil, failure.Error
+		}
+		return nil, fmt.Errorf("%s answered %s", u, resp.Status)
+	}
+	var payout FaucetPayout
+	if err := json.NewDecoder(resp.Body).Decode(&payout); err != nil {
+		return nil, fmt.Errorf("error reading the faucet answer: %w", err)
+	}
+	return &payout, nil
+}
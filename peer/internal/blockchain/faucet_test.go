@@ -0,0 +1,53 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestFaucet(t *testing.T) {
+	paid := make(map[string]bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/faucet" || r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		var request struct {
+			Address string `json:"address"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		if paid[request.Address] {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"error":{"code":0,"message":"try again later"}}`)
+			return
+		}
+		paid[request.Address] = true
+		fmt.Fprintf(w, `{"time":"2024-04-30T16:15:26Z","address":%q,"amount":10,"txid":"a"}`, request.Address)
+	}))
+	defer server.Close()
+
+	// The path defaults to /faucet and the scheme to http
+	payout, err := requestFaucet(strings.TrimPrefix(server.URL, "http://"), "addr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payout.Address != "addr" || payout.Amount != 10 || payout.TxID != "a" {
+		t.Errorf("payout is %+v", payout)
+	}
+
+	_, err = requestFaucet(server.URL+"/faucet", "addr")
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Status != http.StatusTooManyRequests || rpcErr.Message != "try again later" {
+		t.Errorf("second request failed with %v", err)
+	}
+
+	if _, err := requestFaucet(server.URL+"/other", "addr2"); err == nil {
+		t.Error("request to a missing faucet succeeded")
+	}
+}
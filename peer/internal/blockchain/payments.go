@@ -0,0 +1,129 @@
+package blockchain
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	orcaEvents "orca-peer/internal/events"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// How long to wait before following the OrcaNetAPIServer events again after
+// the stream broke.
+const paymentStreamRetry = 5 * time.Second
+
+// Event the OrcaNetAPIServer streams at /events, only the fields payments need.
+type walletEvent struct {
+	ID          uint64 `json:"id"`
+	Type        string `json:"type"`
+	Transaction *struct {
+		TxID           string   `json:"txid"`
+		Category       string   `json:"category"`
+		Amount         float64  `json:"amount"`
+		Confirmations  int64    `json:"confirmations"`
+		Address        string   `json:"address"`
+		Counterparties []string `json:"counterparties"`
+		Label          string   `json:"label"`
+	} `json:"transaction"`
+}
+
+// WatchPayments follows the wallet events of the OrcaNetAPIServer at coinAPI
+// until ctx is done and publishes payment.incoming as soon as coins paid to the
+// wallet are seen, then payment.confirmations whenever their confirmations
+// change. Broken streams are resumed after the last event received, so no
+// payment is missed while the server keeps it.
+func WatchPayments(ctx context.Context, coinAPI string) {
+	var lastID uint64
+	for {
+		err := followPayments(ctx, coinAPI, &lastID)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			fmt.Printf("Following wallet payments: %s\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(paymentStreamRetry):
+		}
+	}
+}
+
+func followPayments(ctx context.Context, coinAPI string, lastID *uint64) error {
+	url := strings.TrimSuffix(coinAPI, "/") + "/events?types=transaction.received,transaction.confirmations"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if *lastID > 0 {
+		req.Header.Set("Last-Event-ID", strconv.FormatUint(*lastID, 10))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s", url, resp.Status)
+	}
+	return readEvents(resp.Body, func(data string) {
+		var e walletEvent
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			fmt.Printf("Error reading wallet event: %s\n", err)
+			return
+		}
+		*lastID = e.ID
+		publishPayment(e)
+	})
+}
+
+// Calls fn with the data of every server-sent event read from r until it ends.
+func readEvents(r io.Reader, fn func(data string)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if len(data) > 0 {
+				fn(strings.Join(data, "\n"))
+				data = data[:0]
+			}
+			continue
+		}
+		if value, ok := strings.CutPrefix(line, "data:"); ok {
+			data = append(data, strings.TrimPrefix(value, " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
+
+// Only coins others paid us count, mining rewards and our own sends are left
+// out.
+func publishPayment(e walletEvent) {
+	if e.Transaction == nil || e.Transaction.Category != "receive" {
+		return
+	}
+	eventType := orcaEvents.PaymentConfirmations
+	if e.Type == "transaction.received" {
+		eventType = orcaEvents.PaymentIncoming
+	}
+	orcaEvents.Publish(eventType, orcaEvents.WalletPaymentData{
+		TxID:          e.Transaction.TxID,
+		Amount:        e.Transaction.Amount,
+		Confirmations: e.Transaction.Confirmations,
+		Address:       e.Transaction.Address,
+		From:          e.Transaction.Counterparties,
+		Label:         e.Transaction.Label,
+	})
+}
@@ -0,0 +1,59 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	orcaEvents "orca-peer/internal/events"
+	"testing"
+)
+
+func TestFollowPayments(t *testing.T) {
+	var lastEventID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastEventID = r.Header.Get("Last-Event-ID")
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "retry: 3000\n\n")
+		fmt.Fprint(w, "id: 7\nevent: transaction.received\ndata: {\"id\":7,\"type\":\"transaction.received\",\"transaction\":{\"txid\":\"a\",\"category\":\"receive\",\"amount\":2.5,\"address\":\"addr\",\"counterparties\":[\"payer\"]}}\n\n")
+		fmt.Fprint(w, ": keep-alive\n\n")
+		// Mining rewards are not payments
+		fmt.Fprint(w, "id: 8\nevent: transaction.received\ndata: {\"id\":8,\"type\":\"transaction.received\",\"transaction\":{\"txid\":\"b\",\"category\":\"generate\",\"amount\":50}}\n\n")
+		fmt.Fprint(w, "id: 9\nevent: transaction.confirmations\ndata: {\"id\":9,\"type\":\"transaction.confirmations\",\"transaction\":{\"txid\":\"a\",\"category\":\"receive\",\"amount\":2.5,\"confirmations\":1}}\n\n")
+	}))
+	defer server.Close()
+
+	sub := orcaEvents.Subscribe(0, "payment")
+	defer sub.Close()
+	var lastID uint64
+	if err := followPayments(context.Background(), server.URL, &lastID); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("stream ended with %v", err)
+	}
+	if lastID != 9 {
+		t.Errorf("last event id is %d, want 9", lastID)
+	}
+
+	incoming := <-sub.C
+	data := incoming.Data.(orcaEvents.WalletPaymentData)
+	if incoming.Type != orcaEvents.PaymentIncoming || data.TxID != "a" || data.Amount != 2.5 || len(data.From) != 1 || data.From[0] != "payer" {
+		t.Errorf("first event is %s %+v", incoming.Type, data)
+	}
+	confirmed := <-sub.C
+	data = confirmed.Data.(orcaEvents.WalletPaymentData)
+	if confirmed.Type != orcaEvents.PaymentConfirmations || data.TxID != "a" || data.Confirmations != 1 {
+		t.Errorf("second event is %s %+v", confirmed.Type, data)
+	}
+	select {
+	case e := <-sub.C:
+		t.Errorf("unexpected event %s %+v", e.Type, e.Data)
+	default:
+	}
+
+	// Following again resumes after the last event
+	followPayments(context.Background(), server.URL, &lastID)
+	if lastEventID != "9" {
+		t.Errorf("Last-Event-ID is %q, want 9", lastEventID)
+	}
+}
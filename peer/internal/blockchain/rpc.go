@@ -0,0 +1,29 @@
+package blockchain
+
+import (
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/rpcclient"
+	"github.com/btcsuite/btcd/rpcclient/orcaconf"
+)
+
+// RPCError is a failed call to OrcaNet or OrcaWallet. Status is the HTTP status
+// to answer callers with and Code the JSON-RPC error code of the server, 0 when
+// the server could not be reached.
+type RPCError = orcaconf.Error
+
+// Params returns the parameters of the network OrcaNet runs on.
+func Params() (*chaincfg.Params, error) {
+	return orcaconf.Params()
+}
+
+// Node calls fn with a client of the running OrcaNet node. Errors are returned
+// as *RPCError.
+func Node(fn func(*rpcclient.Client) error) error {
+	return orcaconf.Node(fn)
+}
+
+// Wallet calls fn with a client of the running OrcaWallet. Errors are returned
+// as *RPCError.
+func Wallet(fn func(*rpcclient.Client) error) error {
+	return orcaconf.Wallet(fn)
+}
@@ -1,20 +1,24 @@
 package blockchain
 
 import (
-	"bytes"
 	"crypto/rsa"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	orcaBandwidth "orca-peer/internal/bandwidth"
+	orcaDataDir "orca-peer/internal/datadir"
 	orcaHash "orca-peer/internal/hash"
+	orcaRouter "orca-peer/internal/router"
 	orcaStatus "orca-peer/internal/status"
 	"os"
+	"path/filepath"
 	"sort"
-	"strings"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/libp2p/go-libp2p/core/metrics"
 )
 
 var publicKey *rsa.PublicKey
@@ -31,7 +35,8 @@ func getDailyRevenue(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
 		pubKeyString, err := orcaHash.ExportRsaPublicKeyAsPemStr(publicKey)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			http.Error(w, "Error exporting public key", http.StatusInternalServerError)
+			return
 		}
 		totalSent := 0
 		totalReceived := 0
@@ -51,7 +56,7 @@ func getDailyRevenue(w http.ResponseWriter, r *http.Request) {
 				}
 			}
 		}
-		w.WriteHeader(http.StatusOK)
+		writeJSON(w, Revenue{Date: time.Now().Format(time.DateOnly), Earning: totalReceived, Spending: totalSent})
 	} else {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
@@ -62,13 +67,38 @@ type Revenue struct {
 	Date     string `json:"date"`
 	Earning  int    `json:"earning"`
 	Spending int    `json:"spending"`
+	day      time.Time
+}
+
+// Oldest day first.
+func sortRevenue(days map[string]*Revenue) []Revenue {
+	revenue := make([]Revenue, 0, len(days))
+	for _, rev := range days {
+		revenue = append(revenue, *rev)
+	}
+	sort.Slice(revenue, func(i, j int) bool {
+		return revenue[i].day.Before(revenue[j].day)
+	})
+	return revenue
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	jsonData, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, "Error encoding JSON", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
 }
 
 func getMonthlyRevenue(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
 		pubKeyString, err := orcaHash.ExportRsaPublicKeyAsPemStr(publicKey)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			http.Error(w, "Error exporting public key", http.StatusInternalServerError)
+			return
 		}
 		orcaStatus.LoadInTransactions()
 		timeThreshold := time.Now().Add(-24 * 30 * time.Hour)
@@ -80,14 +110,14 @@ func getMonthlyRevenue(w http.ResponseWriter, r *http.Request) {
 				continue
 			}
 			if timestamp.After(timeThreshold) {
-				key := timestamp.Month().String() + "/" + string(timestamp.Day())
+				key := timestamp.Month().String() + "/" + strconv.Itoa(timestamp.Day())
 				value, ok := hashMap[key]
 				var rev *Revenue
 				rev = nil
 				if ok {
 					rev = value
 				} else {
-					rev = &Revenue{Date: key, Earning: 0, Spending: 0}
+					rev = &Revenue{Date: key, Earning: 0, Spending: 0, day: timestamp}
 					hashMap[key] = rev
 				}
 				if transaction.TransactionData.PublicKey == string(pubKeyString) {
@@ -97,7 +127,7 @@ func getMonthlyRevenue(w http.ResponseWriter, r *http.Request) {
 				}
 			}
 		}
-		w.WriteHeader(http.StatusOK)
+		writeJSON(w, sortRevenue(hashMap))
 	} else {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
@@ -107,7 +137,8 @@ func getYearlyRevenue(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
 		pubKeyString, err := orcaHash.ExportRsaPublicKeyAsPemStr(publicKey)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			http.Error(w, "Error exporting public key", http.StatusInternalServerError)
+			return
 		}
 		orcaStatus.LoadInTransactions()
 		timeThreshold := time.Now().Add(-24 * 365 * time.Hour)
@@ -119,14 +150,14 @@ func getYearlyRevenue(w http.ResponseWriter, r *http.Request) {
 				continue
 			}
 			if timestamp.After(timeThreshold) {
-				key := timestamp.Month().String() + "/" + string(timestamp.Day())
+				key := timestamp.Month().String() + "/" + strconv.Itoa(timestamp.Day())
 				value, ok := hashMap[key]
 				var rev *Revenue
 				rev = nil
 				if ok {
 					rev = value
 				} else {
-					rev = &Revenue{Date: key, Earning: 0, Spending: 0}
+					rev = &Revenue{Date: key, Earning: 0, Spending: 0, day: timestamp}
 					hashMap[key] = rev
 				}
 				if transaction.TransactionData.PublicKey == string(pubKeyString) {
@@ -136,7 +167,7 @@ func getYearlyRevenue(w http.ResponseWriter, r *http.Request) {
 				}
 			}
 		}
-		w.WriteHeader(http.StatusOK)
+		writeJSON(w, sortRevenue(hashMap))
 	} else {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
@@ -170,7 +201,7 @@ type LatestTransactionResponse struct {
 
 func getLatestTransactions(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
-		dir := "./files/transactions"
+		dir := orcaDataDir.TransactionsDir()
 		files, err := os.ReadDir(dir)
 		if err != nil {
 			http.Error(w, "error reading directory", http.StatusInternalServerError)
@@ -196,7 +227,7 @@ func getLatestTransactions(w http.ResponseWriter, r *http.Request) {
 			if idx > 5 {
 				break
 			}
-			file, err := os.Open("./files/transactions/" + file.Name)
+			file, err := os.Open(filepath.Join(orcaDataDir.TransactionsDir(), file.Name))
 			if err != nil {
 				http.Error(w, "transaction file does not exist", http.StatusInternalServerError)
 				return
@@ -238,12 +269,7 @@ func getLatestTransactions(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
-		_, err = w.Write(jsonData)
-		if err != nil {
-			http.Error(w, "Error  marshalling JSON", http.StatusInternalServerError)
-			return
-		}
-		w.WriteHeader(http.StatusOK)
+		w.Write(jsonData)
 	} else {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
@@ -251,7 +277,7 @@ func getLatestTransactions(w http.ResponseWriter, r *http.Request) {
 }
 func getCompleteTransactions(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
-		dir := "./files/transactions"
+		dir := orcaDataDir.TransactionsDir()
 		files, err := os.ReadDir(dir)
 		if err != nil {
 			http.Error(w, "error reading directory", http.StatusInternalServerError)
@@ -271,7 +297,7 @@ func getCompleteTransactions(w http.ResponseWriter, r *http.Request) {
 		}
 		allTransactions := make([]TransactionResponse, 0)
 		for _, file := range filesWithTime {
-			file, err := os.Open("./files/transactions/" + file.Name)
+			file, err := os.Open(filepath.Join(orcaDataDir.TransactionsDir(), file.Name))
 			if err != nil {
 				http.Error(w, "transaction file does not exist", http.StatusInternalServerError)
 				return
@@ -313,69 +339,72 @@ func getCompleteTransactions(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
-		_, err = w.Write(jsonData)
-		if err != nil {
-			http.Error(w, "Error  marshalling JSON", http.StatusInternalServerError)
-			return
-		}
-		w.WriteHeader(http.StatusOK)
+		w.Write(jsonData)
 	} else {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
 }
 
-type StatsRequest struct {
-	PublicKey string `json:"pub_key"`
+// Byte totals and rates in bytes per second.
+type RateStats struct {
+	TotalIn  int64   `json:"totalIn"`
+	TotalOut int64   `json:"totalOut"`
+	RateIn   float64 `json:"rateIn"`
+	RateOut  float64 `json:"rateOut"`
 }
+
 type StatsResponse struct {
 	Id            string `json:"_id"`
 	PublicKey     string `json:"pub_key"`
 	IncomingSpeed string `json:"incoming_speed"`
 	OutgoingSpeed string `json:"outgoing_speed"`
+
+	Network   RateStats              `json:"network"`
+	Transfers RateStats              `json:"transfers"`
+	Peers     map[string]RateStats   `json:"peers"`
+	Protocols map[string]RateStats   `json:"protocols"`
+	Limits    orcaBandwidth.Limits   `json:"limits"`
+	History   []orcaBandwidth.Sample `json:"history"`
+}
+
+func toRateStats(stats metrics.Stats) RateStats {
+	return RateStats{
+		TotalIn:  stats.TotalIn,
+		TotalOut: stats.TotalOut,
+		RateIn:   stats.RateIn,
+		RateOut:  stats.RateOut,
+	}
 }
 
+/*
+ * Reports the bandwidth used by the libp2p host, as measured by its bandwidth
+ * reporter, and by file transfers. incoming_speed and outgoing_speed are the
+ * current host rates in KB/s.
+ */
 func getStatsNetwork(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
-		// Decode the JSON payload from the request body into a MyRequest struct
-		var requestData StatsRequest
-		err := json.NewDecoder(r.Body).Decode(&requestData)
-		if err != nil {
-			http.Error(w, "Error decoding JSON", http.StatusBadRequest)
-			return
+		network, transfers := orcaBandwidth.Totals()
+		peers := make(map[string]RateStats)
+		for p, stats := range orcaBandwidth.ByPeer() {
+			peers[p.String()] = toRateStats(stats)
 		}
-		byteString := strings.Repeat("a", 8192)
-		data := strings.NewReader(byteString)
-		startTime := time.Now()
-		totalIncomingTime := float64(0)
-		testIterations := 10
-		for i := 0; i < testIterations; i++ {
-			response, err := http.Post("http://localhost:8082/speed/sender", "application/json", bytes.NewBuffer([]byte(byteString)))
-			if err != nil {
-				fmt.Println("Error sending POST request:", err)
-				return
-			}
-			defer response.Body.Close()
-			var responseData SpeedEndpointResponse
-			err = json.NewDecoder(response.Body).Decode(&responseData)
-			if err != nil {
-				fmt.Println("Error decoding JSON:", err)
-				return
-			}
-			totalIncomingTime += responseData.KbPerSecond
+		protocols := make(map[string]RateStats)
+		for proto, stats := range orcaBandwidth.ByProtocol() {
+			protocols[string(proto)] = toRateStats(stats)
 		}
-		endTime := time.Now()
-		elapsedTime := endTime.Sub(startTime)
-		outgoingKbPerSecond := float64(data.Len()) / (elapsedTime.Seconds() * 1024)
-		incomingKbPerSecond := float64(totalIncomingTime / float64(testIterations))
 
-		newUUID := uuid.New()
-		uuidString := newUUID.String()
 		statsResponse := StatsResponse{
-			Id:            uuidString,
+			Id:            uuid.New().String(),
 			PublicKey:     "",
-			IncomingSpeed: fmt.Sprintf("%f", incomingKbPerSecond),
-			OutgoingSpeed: fmt.Sprintf("%f", outgoingKbPerSecond),
+			IncomingSpeed: fmt.Sprintf("%f", network.RateIn/1024),
+			OutgoingSpeed: fmt.Sprintf("%f", network.RateOut/1024),
+			Network:       toRateStats(network),
+			Transfers:     toRateStats(transfers),
+			Peers:         peers,
+			Protocols:     protocols,
+			Limits:        orcaBandwidth.GetLimits(),
+			History:       orcaBandwidth.History(),
 		}
 		jsonData, err := json.Marshal(statsResponse)
 		if err != nil {
@@ -384,62 +413,132 @@ func getStatsNetwork(w http.ResponseWriter, r *http.Request) {
 		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		_, err = w.Write(jsonData)
-		if err != nil {
-			http.Error(w, "Error writing response", http.StatusInternalServerError)
-			return
-		}
+		w.Write(jsonData)
 	} else {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
 }
 
-type SpeedEndpointResponse struct {
-	KbPerSecond float64 `json:"KbPerSecond"`
-}
-
-func speedEndpointReceiver(w http.ResponseWriter, r *http.Request) {
-	startTime := time.Now()
-	buffer := make([]byte, 1024)
-	totalBytesRead := 0
-	for {
-		n, err := r.Body.Read(buffer)
-		totalBytesRead += n
+// GET returns the current bandwidth caps, POST replaces them. Rates are in bytes
+// per second and 0 means unlimited.
+func bandwidthLimits(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var limits orcaBandwidth.Limits
+		err := json.NewDecoder(r.Body).Decode(&limits)
 		if err != nil {
-			break
+			http.Error(w, "Error decoding JSON", http.StatusBadRequest)
+			return
 		}
+		if limits.UploadRate < 0 || limits.DownloadRate < 0 || limits.PeerUploadRate < 0 || limits.PeerDownloadRate < 0 {
+			http.Error(w, "Rates cannot be negative", http.StatusBadRequest)
+			return
+		}
+		orcaBandwidth.SetLimits(limits)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
 	}
-
-	endTime := time.Now()
-	elapsedTime := endTime.Sub(startTime)
-	bytesPerSecond := float64(totalBytesRead) / (elapsedTime.Seconds() * 1024)
-	data := SpeedEndpointResponse{
-		KbPerSecond: bytesPerSecond,
-	}
-	jsonData, err := json.Marshal(data)
+	jsonData, err := json.Marshal(orcaBandwidth.GetLimits())
 	if err != nil {
 		http.Error(w, "Error encoding JSON", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	_, err = w.Write(jsonData)
-	if err != nil {
-		http.Error(w, "Error writing response", http.StatusInternalServerError)
-		return
-	}
+	w.Write(jsonData)
 }
 
-func InitBlockchainStats(publicKey *rsa.PublicKey) {
-	http.HandleFunc("/wallet/revenue/daily", getDailyRevenue)
-	http.HandleFunc("/wallet/revenue/monthly", getMonthlyRevenue)
-	http.HandleFunc("/wallet/revenue/yearly", getYearlyRevenue)
-
-	http.HandleFunc("/wallet/transactions/latest", getLatestTransactions)
-	http.HandleFunc("/wallet/revenue/complete", getCompleteTransactions)
-
-	http.HandleFunc("/stats/network", getStatsNetwork)
+// Routes returns the HTTP routes of the wallet and network statistics.
+func Routes() []orcaRouter.Route {
+	return []orcaRouter.Route{
+		{
+			Method:   http.MethodGet,
+			Path:     "/wallet/revenue/daily",
+			Legacy:   "/wallet/revenue/daily",
+			Scope:    orcaRouter.ScopeRead,
+			Tag:      "wallet",
+			Summary:  "Earnings and spending of the last 24 hours",
+			Response: Revenue{},
+			Handler:  getDailyRevenue,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/wallet/revenue/monthly",
+			Legacy:   "/wallet/revenue/monthly",
+			Scope:    orcaRouter.ScopeRead,
+			Tag:      "wallet",
+			Summary:  "Earnings and spending per day of the last 30 days",
+			Response: []Revenue{},
+			Handler:  getMonthlyRevenue,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/wallet/revenue/yearly",
+			Legacy:   "/wallet/revenue/yearly",
+			Scope:    orcaRouter.ScopeRead,
+			Tag:      "wallet",
+			Summary:  "Earnings and spending per day of the last year",
+			Response: []Revenue{},
+			Handler:  getYearlyRevenue,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/wallet/transactions/latest",
+			Legacy:   "/wallet/transactions/latest",
+			Scope:    orcaRouter.ScopeRead,
+			Tag:      "wallet",
+			Summary:  "The most recent transactions",
+			Response: LatestTransactionResponse{},
+			Handler:  getLatestTransactions,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/wallet/transactions",
+			Legacy:   "/wallet/revenue/complete",
+			Scope:    orcaRouter.ScopeRead,
+			Tag:      "wallet",
+			Summary:  "All transactions",
+			Response: LatestTransactionResponse{},
+			Handler:  getCompleteTransactions,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/stats/network",
+			Legacy:   "/stats/network",
+			Scope:    orcaRouter.ScopeRead,
+			Tag:      "stats",
+			Summary:  "Bandwidth used by the node, its peers and protocols",
+			Response: StatsResponse{},
+			Handler:  getStatsNetwork,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/stats/bandwidth-limits",
+			Legacy:   "/stats/bandwidth-limits",
+			Scope:    orcaRouter.ScopeRead,
+			Tag:      "stats",
+			Summary:  "Current bandwidth caps in bytes per second, 0 is unlimited",
+			Response: orcaBandwidth.Limits{},
+			Handler:  bandwidthLimits,
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/stats/bandwidth-limits",
+			Legacy:   "/stats/bandwidth-limits",
+			Scope:    orcaRouter.ScopeAdmin,
+			Tag:      "stats",
+			Summary:  "Replace the bandwidth caps",
+			Body:     orcaBandwidth.Limits{},
+			Response: orcaBandwidth.Limits{},
+			Handler:  bandwidthLimits,
+		},
+	}
+}
 
-	http.HandleFunc("/speed/sender", speedEndpointReceiver)
+func InitBlockchainStats(pubKey *rsa.PublicKey) {
+	publicKey = pubKey
+	orcaRouter.Handle(Routes()...)
 }
@@ -2,6 +2,7 @@ package cli
 
 import (
 	"bufio"
+	"context"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/json"
@@ -10,10 +11,19 @@ import (
 	"log"
 	"net"
 	"net/http"
+	orcaBandwidth "orca-peer/internal/bandwidth"
 	orcaBlockchain "orca-peer/internal/blockchain"
 	orcaClient "orca-peer/internal/client"
+	orcaConfig "orca-peer/internal/config"
+	orcaDataDir "orca-peer/internal/datadir"
 	"orca-peer/internal/fileshare"
+	orcaGater "orca-peer/internal/gater"
 	orcaHash "orca-peer/internal/hash"
+	orcaJobs "orca-peer/internal/jobs"
+	orcaLifecycle "orca-peer/internal/lifecycle"
+	orcaPeerDB "orca-peer/internal/peerdb"
+	orcaPricing "orca-peer/internal/pricing"
+	orcaRouter "orca-peer/internal/router"
 	"orca-peer/internal/server"
 	orcaServer "orca-peer/internal/server"
 	"github.com/libp2p/go-libp2p"
@@ -22,44 +32,65 @@ import (
 	orcaStatus "orca-peer/internal/status"
 	orcaStore "orca-peer/internal/store"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var (
 	Ip     string
 	Port   int64
 	Client *orcaClient.Client
+	Config = orcaConfig.Default()
 )
 
-func StartCLI(bootstrapAddress *string, pubKey *rsa.PublicKey, privKey *rsa.PrivateKey, orcaNetAPIProc *exec.Cmd, startAPIRoutes func(*map[string]fileshare.FileInfo)) {
+func StartCLI(cfg *orcaConfig.Config, pubKey *rsa.PublicKey, privKey *rsa.PrivateKey, startAPIRoutes func(*map[string]fileshare.FileInfo)) {
 	fmt.Println("Loading...")
-	rpcPort := getPort("Market RPC Server")
-	dhtPort := getPort("Market DHT Host")
-	httpPort := getPort("HTTP Server")
-	passKey := getPassKey()
+	Config = cfg
+	// Only prompt for the settings that were not configured
+	rpcPort, dhtPort, httpPort, passKey := cfg.RPCPort, cfg.DHTPort, cfg.HTTPPort, cfg.WalletPassKey
 	for httpPort == "" || rpcPort == "" || dhtPort == "" || passKey == "" {
-		fmt.Println("All three ports must be given, please try again.")
-		rpcPort = getPort("Market RPC Server")
-		dhtPort = getPort("Market DHT Host")
-		httpPort = getPort("HTTP Server")
-		passKey = getPassKey()
+		if rpcPort == "" {
+			rpcPort = getPort("Market RPC Server")
+		}
+		if dhtPort == "" {
+			dhtPort = getPort("Market DHT Host")
+		}
+		if httpPort == "" {
+			httpPort = getPort("HTTP Server")
+		}
+		if passKey == "" {
+			passKey = getPassKey()
+		}
+		if httpPort == "" || rpcPort == "" || dhtPort == "" || passKey == "" {
+			fmt.Println("All three ports and the passkey must be given, please try again.")
+		}
 	}
-	serverReady := make(chan bool)
-	confirming := false
-	confirmation := ""
-	locationJsonString := orcaStatus.GetLocationData()
-	var locationJson map[string]interface{}
-	err := json.Unmarshal([]byte(locationJsonString), &locationJson)
+	bootstrapPeers, err := cfg.Bootstrap()
 	if err != nil {
-		fmt.Println("Unable to establish user IP, please try again")
+		fmt.Println("Error reading bootstrap peers:", err)
 		return
 	}
-	Ip = locationJson["ip"].(string)
-	Port, err = strconv.ParseInt(httpPort, 10, 64)
+	orcaServer.BootstrapPeers = bootstrapPeers
+	serverReady := make(chan bool)
+	// Storage requests of other peers are confirmed in the REPL, which does not
+	// run in daemon mode
+	var confirmation *orcaServer.Confirmation
+	if !cfg.Daemon {
+		confirmation = &orcaServer.Confirmation{}
+	}
+	Ip = orcaStatus.GetLocationData().Ip
+	// Other peers fetch files and send payments on their own port, so the API
+	// can stay on loopback
+	peerListener, err := net.Listen("tcp", ":"+cfg.PeerPort)
 	if err != nil {
-		fmt.Println("Error parsing in port: must be a integer.", err)
+		fmt.Println("Error listening for peers:", err)
+		return
+	}
+	Port = int64(peerListener.Addr().(*net.TCPAddr).Port)
+	if err := setupAPIAccess(cfg); err != nil {
+		fmt.Println("Error setting up API access:", err)
 		return
 	}
 
@@ -77,10 +108,55 @@ func StartCLI(bootstrapAddress *string, pubKey *rsa.PublicKey, privKey *rsa.Priv
 		libp2p.EnableRelay(),
 	}
 
+	if err := orcaPeerDB.Init(orcaLifecycle.Context(), cfg.PeerDatabasePath); err != nil {
+		fmt.Println("Error loading peer database:", err)
+		return
+	}
+	orcaLifecycle.OnShutdown(orcaLifecycle.StageStorage, "peer database", func(ctx context.Context) error {
+		return orcaPeerDB.Default().Save()
+	})
+
+	// Unfinished jobs of the last run are queued again once the scheduler starts
+	if err := orcaJobs.InitStore(orcaDataDir.JobsDBFile(), orcaDataDir.JobsFile()); err != nil {
+		fmt.Println("Error opening job database:", err)
+		return
+	}
+	go orcaJobs.InitPeriodicJobSave(orcaLifecycle.Context())
+	orcaLifecycle.OnShutdown(orcaLifecycle.StageStorage, "job database", func(ctx context.Context) error {
+		return orcaJobs.CloseStore()
+	})
+
+	// Files are announced with the price schedule of the policy, and again when it changes
+	if err := orcaPricing.Init(orcaDataDir.PricingFile(), cfg.DefaultPrice); err != nil {
+		fmt.Println("Error loading pricing policy:", err)
+		return
+	}
+	orcaPricing.Default().OnChange(func(orcaPricing.Policy) {
+		go orcaServer.ReannounceFiles(orcaLifecycle.Context())
+	})
+
+	// Refuse connections from banned peers and keep the connection count bounded
+	connectionGater, err := orcaGater.New(cfg.BanListPath)
+	if err != nil {
+		fmt.Println("Error loading ban list:", err)
+		return
+	}
+	gaterOpts, err := orcaGater.HostOptions(connectionGater, orcaGater.DefaultLimits)
+	if err != nil {
+		panic(err)
+	}
+	opts = append(opts, gaterOpts...)
+	opts = append(opts, libp2p.BandwidthReporter(orcaBandwidth.Reporter))
+	go orcaBandwidth.RecordHistory(orcaLifecycle.Context())
+	orcaServer.PeerGater = connectionGater
+
 	host, err := libp2p.New(opts...)
 	if err != nil {
 		panic(err)
 	}
+	orcaLifecycle.OnShutdown(orcaLifecycle.StageNetwork, "libp2p host", func(ctx context.Context) error {
+		return host.Close()
+	})
 
 	hostMultiAddr := ""
 	fmt.Printf("\nlibp2p DHT Host ID: %s\n", host.ID())
@@ -93,13 +169,25 @@ func StartCLI(bootstrapAddress *string, pubKey *rsa.PublicKey, privKey *rsa.Priv
 		fmt.Printf("%s/p2p/%s\n", addr, host.ID())
 	}
 
-	Client = orcaClient.NewClient("files/names/")
+	Client = orcaClient.NewClient(orcaDataDir.NamesDir())
 	Client.PrivateKey = privKey
 	Client.PublicKey = pubKey
 	Client.Host = host
-	go orcaServer.StartServer(httpPort, dhtPort, rpcPort, serverReady, &confirming, &confirmation, libp2pPrivKey, passKey, Client, startAPIRoutes, host, hostMultiAddr)
+	go orcaServer.StartServer(net.JoinHostPort(cfg.APIListen, httpPort), peerListener, dhtPort, rpcPort, serverReady, confirmation, libp2pPrivKey, passKey, Client, startAPIRoutes, host, hostMultiAddr)
 	<-serverReady
 	orcaBlockchain.InitBlockchainStats(pubKey)
+	// Jobs queued through the API only start downloading once holders can be looked up
+	schedulerConfig := orcaJobs.DefaultSchedulerConfig
+	schedulerConfig.MaxActive = int(cfg.MaxDownloads)
+	schedulerConfig.MaxAttempts = int(cfg.JobAttempts)
+	orcaJobs.Default.Configure(schedulerConfig)
+	orcaJobs.SetBudget(orcaJobs.Budget{Daily: int(cfg.DailyBudget), Monthly: int(cfg.MonthlyBudget)})
+	orcaJobs.Default.Start(orcaLifecycle.Context(), orcaServer.DownloadJob, orcaLifecycle.Go)
+	if cfg.Daemon {
+		fmt.Println("Orcanet is running in daemon mode, use the HTTP and gRPC APIs to control it.")
+		<-orcaLifecycle.Context().Done()
+		return
+	}
 	fmt.Println("Welcome to Orcanet!")
 	fmt.Println("Dive In and Explore! Type 'help' for available commands.")
 
@@ -122,13 +210,7 @@ func StartCLI(bootstrapAddress *string, pubKey *rsa.PublicKey, privKey *rsa.Priv
 		command := parts[0]
 		args := parts[1:]
 
-		if confirming {
-			switch command {
-			case "yes":
-				confirmation = "yes"
-			default:
-				confirmation = "no"
-			}
+		if confirmation.Answer(command == "yes") {
 			continue
 		}
 
@@ -142,10 +224,11 @@ func StartCLI(bootstrapAddress *string, pubKey *rsa.PublicKey, privKey *rsa.Priv
 				}
 				var bestHolder *fileshare.User
 				bestHolder = nil
+				now := time.Now()
 				for _, holder := range holders.Holders {
 					if bestHolder == nil {
 						bestHolder = holder
-					} else if holder.GetPrice() < bestHolder.GetPrice() {
+					} else if orcaPricing.HolderPrice(holder, 0, now) < orcaPricing.HolderPrice(bestHolder, 0, now) {
 						bestHolder = holder
 					}
 				}
@@ -153,7 +236,15 @@ func StartCLI(bootstrapAddress *string, pubKey *rsa.PublicKey, privKey *rsa.Priv
 					fmt.Println("Unable to find holder for this hash.")
 					continue
 				}
-				fmt.Printf("%s - %d OrcaCoin\n", bestHolder.GetIp(), bestHolder.GetPrice())
+				fileSize, price, err := Client.GetFileQuote(orcaLifecycle.Context(), bestHolder.GetIp(), args[0])
+				if err != nil {
+					fmt.Printf("Error getting the price of the file %s\n", err)
+					continue
+				}
+				if price < 0 {
+					price = orcaPricing.HolderPrice(bestHolder, fileSize, now)
+				}
+				fmt.Printf("%s - %d OrcaCoin per MiB\n", bestHolder.GetIp(), price)
 				pubKeyInterface, err := x509.ParsePKIXPublicKey(bestHolder.Id)
 				if err != nil {
 					log.Fatal("failed to parse DER encoded public key: ", err)
@@ -163,7 +254,7 @@ func StartCLI(bootstrapAddress *string, pubKey *rsa.PublicKey, privKey *rsa.Priv
 					log.Fatal("not an RSA public key")
 				}
 				key := orcaServer.ConvertKeyToString(rsaPubKey.N, rsaPubKey.E)
-				err = Client.GetFileOnce(bestHolder.GetIp(), bestHolder.GetPort(), args[0], key, fmt.Sprintf("%d", bestHolder.GetPrice()), passKey, "")
+				err = Client.GetFileOnce(orcaLifecycle.Context(), bestHolder.GetIp(), bestHolder.GetPort(), args[0], key, fmt.Sprint(price), passKey, "")
 				
 				if err != nil {
 					fmt.Printf("Error getting file %s", err)
@@ -172,9 +263,9 @@ func StartCLI(bootstrapAddress *string, pubKey *rsa.PublicKey, privKey *rsa.Priv
 				fmt.Println("Usage: get [fileHash]")
 			}
 		case "store":
-			if len(args) == 2 {
+			if len(args) == 1 || len(args) == 2 {
 				fileName := args[0]
-				filePath := "./files/" + fileName
+				filePath := filepath.Join(orcaDataDir.FilesDir(), fileName)
 				if _, err := os.Stat(filePath); err == nil {
 
 				} else if os.IsNotExist(err) {
@@ -184,10 +275,14 @@ func StartCLI(bootstrapAddress *string, pubKey *rsa.PublicKey, privKey *rsa.Priv
 					fmt.Println("error checking file's existence, please try again")
 					continue
 				}
-				costPerMB, err := strconv.ParseInt(args[1], 10, 64)
-				if err != nil {
-					fmt.Println("Error parsing in cost per MB: must be a int64", err)
-					continue
+				// Without an amount the default price of the pricing policy applies
+				costPerMB := int64(0)
+				if len(args) == 2 {
+					costPerMB, err = strconv.ParseInt(args[1], 10, 64)
+					if err != nil {
+						fmt.Println("Error parsing in cost per MB: must be a int64", err)
+						continue
+					}
 				}
 				err = server.SetupRegisterFile(filePath, fileName, costPerMB, Ip, int32(Port))
 				if err != nil {
@@ -196,7 +291,7 @@ func StartCLI(bootstrapAddress *string, pubKey *rsa.PublicKey, privKey *rsa.Priv
 					fmt.Println("Sucessfully registered file on DHT.")
 				}
 			} else {
-				fmt.Println("Usage: store [fileName] [amount]")
+				fmt.Println("Usage: store [fileName] [amount?]")
 			}
 		case "import":
 			if len(args) == 1 {
@@ -208,7 +303,8 @@ func StartCLI(bootstrapAddress *string, pubKey *rsa.PublicKey, privKey *rsa.Priv
 				fmt.Println("Usage: import [filepath]")
 			}
 		case "location":
-			fmt.Println(orcaStatus.GetLocationData())
+			location := orcaStatus.GetLocationData()
+			fmt.Printf("IP: %s\nCity: %s\nRegion: %s\nCountry: %s\n", location.Ip, location.City, location.Region, location.Country)
 		case "network":
 			fmt.Println("Testing Network Speeds...")
 			networkData := orcaStatus.GetNetworkInfo()
@@ -241,22 +337,28 @@ func StartCLI(bootstrapAddress *string, pubKey *rsa.PublicKey, privKey *rsa.Priv
 			} else {
 				fmt.Println("Usage: send [amount] [ip] [port]")
 			}
+		case "faucet":
+			if len(args) == 1 {
+				payout, err := orcaBlockchain.RequestFaucet(args[0])
+				if err != nil {
+					fmt.Printf("Error requesting coins: %s\n", err)
+					continue
+				}
+				fmt.Printf("Received %v coins at %s in transaction %s\n", payout.Amount, payout.Address, payout.TxID)
+			} else {
+				fmt.Println("Usage: faucet [url]")
+			}
 		case "exit":
 			fmt.Println("Exiting...")
 
 			for _, fileInfo := range orcaStore.GetAllLocalFiles() {
-				filePath := "./files/stored/" + fileInfo.Name
+				filePath := filepath.Join(orcaDataDir.StoredDir(), fileInfo.Name)
 				err := os.Remove(filePath)
 				if err != nil {
 					fmt.Printf("Error cleaning up stored files: %s\n", err)
 				}
 			}
 
-			err = orcaNetAPIProc.Process.Signal(os.Interrupt)
-			if err != nil {
-				fmt.Printf("Error killing OrcaNet: %s\n", err)
-			}
-
 			return
 		case "getdir":
 			if len(args) == 3 {
@@ -280,11 +382,12 @@ func StartCLI(bootstrapAddress *string, pubKey *rsa.PublicKey, privKey *rsa.Priv
 		case "help":
 			fmt.Println("COMMANDS:")
 			fmt.Println(" get [fileHash]                 Request a file from DHT")
-			fmt.Println(" store [fileName] [amount]      Store a file on DHT")
+			fmt.Println(" store [fileName] [amount?]     Store a file on DHT")
 			fmt.Println(" getdir [ip] [port] [path]      Request a directory")
 			fmt.Println(" storedir [ip] [port] [path]    Request storage of a directory")
 			fmt.Println(" import [filepath]              Import a file")
 			fmt.Println(" send [amount] [ip]             Send an amount of money to network")
+			fmt.Println(" faucet [url]                   Request coins from a faucet")
 			fmt.Println(" hash [fileName]                Get the hash of a file")
 			fmt.Println(" list                           List all files you are storing")
 			fmt.Println(" location                       Print your location")
@@ -297,6 +400,30 @@ func StartCLI(bootstrapAddress *string, pubKey *rsa.PublicKey, privKey *rsa.Priv
 }
 
 // Ask user to enter a port and returns it
+// Let local clients use the API with the cookie file and the configured tokens.
+func setupAPIAccess(cfg *orcaConfig.Config) error {
+	tokens, err := cfg.Tokens()
+	if err != nil {
+		return err
+	}
+	cookie, err := orcaRouter.WriteCookie(orcaDataDir.APICookieFile())
+	if err != nil {
+		return err
+	}
+	orcaLifecycle.OnShutdown(orcaLifecycle.StageStorage, "API cookie", func(ctx context.Context) error {
+		return os.Remove(orcaDataDir.APICookieFile())
+	})
+	orcaRouter.SetAccess(orcaRouter.Access{
+		Tokens:  append(tokens, cookie),
+		NoAuth:  !cfg.APIAuth,
+		Origins: cfg.CORSOrigins,
+	})
+	if !cfg.APILoopback() {
+		fmt.Printf("WARNING: the HTTP API is reachable on %s, anyone with a token can use it\n", cfg.APIListen)
+	}
+	return nil
+}
+
 func getPort(useCase string) string {
 	reader := bufio.NewReader(os.Stdin)
 
@@ -10,13 +10,18 @@ import (
 	"context"
 	"log"
 	"net/http"
+	orcaBandwidth "orca-peer/internal/bandwidth"
 	orcaBlockchain "orca-peer/internal/blockchain"
+	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/protocol"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/peerstore"
+	orcaDataDir "orca-peer/internal/datadir"
 	"orca-peer/internal/hash"
 	orcaHash "orca-peer/internal/hash"
 	orcaJobs "orca-peer/internal/jobs"
+	orcaLifecycle "orca-peer/internal/lifecycle"
+	orcaPeerDB "orca-peer/internal/peerdb"
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/multiformats/go-multiaddr"
 	"os"
@@ -59,7 +64,7 @@ func (client *Client) ImportFile(filePath string) error {
 		return errors.New("cant find given absolute file path")
 	}
 	defer src.Close()
-	destinationFile, err := os.Create("./files/" + fileName)
+	destinationFile, err := os.Create(filepath.Join(orcaDataDir.FilesDir(), fileName))
 	if err != nil {
 		return errors.New("error creating destination file")
 	}
@@ -120,133 +125,160 @@ func SendTransaction(price float64, ip string, port string, publicKey *rsa.Publi
 		fmt.Println("Send Request")
 	}
 	defer resp.Body.Close()
-	err = os.WriteFile("./files/transactions/"+dateTimeString, jsonData, 0644)
+	err = os.WriteFile(filepath.Join(orcaDataDir.TransactionsDir(), dateTimeString), jsonData, 0644)
 	if err != nil {
 		fmt.Println("Error writing transaction to file:", err)
 		return
 	}
 }
-func (client *Client) GetFileOnce(ip string, port int32, file_hash string, walletAddress string, price string, passKey string, jobId string) error {
-	//Dial peer and start stream to request file
-	peerMA, err := multiaddr.NewMultiaddr(ip)
+// GetFileOnce downloads a file from a holder, paying for every chunk.
+func (client *Client) GetFileOnce(ctx context.Context, ip string, port int32, file_hash string, walletAddress string, price string, passKey string, jobId string) error {
+	return client.ResumeFile(ctx, ip, port, file_hash, walletAddress, price, passKey, jobId, 0, 0)
+}
+
+// GetFileQuote asks the holder at ip for the size of a file in bytes and the
+// price per MiB it charges us. Holders that do not answer these requests send the
+// first chunk instead, the size is then estimated from the number of chunks and
+// never underestimated, and the price is -1.
+func (client *Client) GetFileQuote(ctx context.Context, ip string, file_hash string) (int64, int64, error) {
+	s, _, err := client.openFileStream(ctx, ip, file_hash)
 	if err != nil {
-		log.Println(err)
-		orcaJobs.UpdateJobStatus(jobId, "terminated")
-		return err
+		return 0, 0, err
 	}
+	defer s.Close()
+	stop := context.AfterFunc(ctx, func() { s.Reset() })
+	defer stop()
 
-	peer, err := peer.AddrInfoFromP2pAddr(peerMA)
+	err = writeFileChunkRequest(s, orcaJobs.FileChunkRequest{FileHash: file_hash, Info: true})
 	if err != nil {
-		log.Println(err)
-		orcaJobs.UpdateJobStatus(jobId, "terminated")
-		return err
+		return 0, 0, err
+	}
+	fileChunk, _, err := readFileChunk(bufio.NewReader(s))
+	if err != nil {
+		return 0, 0, err
 	}
+	price := int64(-1)
+	if fileChunk.Price != nil {
+		price = *fileChunk.Price
+	}
+	switch {
+	case fileChunk.FileSize > 0:
+		return fileChunk.FileSize, price, nil
+	case fileChunk.MaxChunk == 1:
+		return int64(len(fileChunk.Data)), price, nil
+	default:
+		// Chunks are at most 4 MiB
+		return int64(fileChunk.MaxChunk) * 4 * orcaJobs.MiB, price, nil
+	}
+}
 
-	client.Host.Peerstore().AddAddrs(peer.ID, peer.Addrs, peerstore.AddressTTL)
+// ResumeFile downloads a file starting at chunk startChunk, which begins at
+// offset in the requested file. Anything after offset is overwritten. It stops
+// with the error of ctx when ctx is cancelled.
+//
+// price is per MiB. Every payment is authorized against the limits of the job
+// and the budget of the node first, a payment exceeding them stops the download
+// with an *orcaJobs.ApprovalError before anything is paid.
+func (client *Client) ResumeFile(ctx context.Context, ip string, port int32, file_hash string, walletAddress string, price string, passKey string, jobId string, startChunk int, offset int64) error {
+	// A price that can't be read would make every chunk free to the limits of
+	// the job and the budget, so the download stops before anything is paid
+	priceInt, err := strconv.ParseInt(price, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid price %q: %w", price, err)
+	}
+	if priceInt < 0 {
+		return fmt.Errorf("invalid price %q: must not be negative", price)
+	}
+	// Holders pad the last chunk, nothing past the end of the file is paid for
+	fileSize := int64(0)
+	if job, err := orcaJobs.FindJob(jobId); err == nil {
+		fileSize = job.FileSize
+	}
 
-	err = client.Host.Connect(context.Background(), *peer)
+	//Dial peer and start stream to request file
+	s, peerId, err := client.openFileStream(ctx, ip, file_hash)
 	if err != nil {
-		log.Println(err)
-		orcaJobs.UpdateJobStatus(jobId, "terminated")
 		return err
 	}
+	defer s.Close()
+	// Unblock the stream when the job is paused or terminated
+	stop := context.AfterFunc(ctx, func() { s.Reset() })
+	defer stop()
 
-	s, err := client.Host.NewStream(context.Background(), peer.ID, protocol.ID("orcanet-fileshare/1.0/" + file_hash))
+	file, err := os.OpenFile(filepath.Join(orcaDataDir.RequestedDir(), file_hash), os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	// Drop what was written after the last complete chunk
+	err = file.Truncate(offset)
+	if err != nil {
+		return err
+	}
+	_, err = file.Seek(offset, io.SeekStart)
 	if err != nil {
-		log.Println(err)
-		orcaJobs.UpdateJobStatus(jobId, "terminated")
 		return err
 	}
-	defer s.Close()
 
 	//continously send request and process response from peer
-	chunkIndex := -1
+	chunkIndex := startChunk - 1
 	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		chunkStart := time.Now()
 		fileChunkReq := orcaJobs.FileChunkRequest{
-			FileHash: file_hash,
+			FileHash:   file_hash,
 			ChunkIndex: chunkIndex + 1,
-			JobId: jobId,
-		}
-	
-		nextChunkReqBytes, err := json.Marshal(fileChunkReq)
-		if err != nil {
-			fmt.Println("Error:", err)
-			orcaJobs.UpdateJobStatus(jobId, "terminated")
-			return err
+			JobId:      jobId,
 		}
-	
-		lengthBytes := make([]byte, 4)
-		binary.LittleEndian.PutUint32(lengthBytes, uint32(len(nextChunkReqBytes)))
-		_, err = s.Write(lengthBytes)
+		err = writeFileChunkRequest(s, fileChunkReq)
 		if err != nil {
 			fmt.Println(err)
-			orcaJobs.UpdateJobStatus(jobId, "terminated")
-			return nil
-		}
-		
-		_, err = s.Write(nextChunkReqBytes)
-		if err != nil {
-			fmt.Println(err)
-			orcaJobs.UpdateJobStatus(jobId, "terminated")
-			return nil
-		}
-
-		buf := bufio.NewReader(s)
-		lengthBytes = make([]byte, 0)
-		for i := 0; i < 4; i++ {
-			b, err := buf.ReadByte()
-			if err != nil {
-				fmt.Println(err)
-				orcaJobs.UpdateJobStatus(jobId, "terminated")
-				return err
-			}	
-			lengthBytes = append(lengthBytes, b)
+			return err
 		}
 
-		length := binary.LittleEndian.Uint32(lengthBytes)
-		payload := make([]byte, length)
-		_, err = io.ReadFull(buf, payload)
+		fileChunk, size, err := readFileChunk(bufio.NewReader(s))
 		if err != nil {
 			fmt.Println(err)
-			orcaJobs.UpdateJobStatus(jobId, "terminated")
 			return err
 		}
-		
-		fileChunk := orcaJobs.FileChunk{}
-		err = json.Unmarshal(payload, &fileChunk)
+		orcaPeerDB.Default().AddTransfer(peerId.String(), 0, int64(size))
+		err = orcaBandwidth.ThrottleDownload(ctx, peerId, jobId, size)
 		if err != nil {
-			fmt.Println("Error unmarshaling JSON:", err)
-			orcaJobs.UpdateJobStatus(jobId, "terminated")
 			return err
 		}
 		hash := fileChunk.FileHash
 
-		err = client.sendTransactionFee(price, walletAddress, passKey)
-		if err != nil {
-			orcaJobs.UpdateJobStatus(jobId, "terminated")
-			return err
+		paidBytes := int64(len(fileChunk.Data))
+		if fileSize > 0 {
+			paidBytes = min(paidBytes, fileSize-offset)
 		}
-		priceInt, err := strconv.ParseInt(price, 10, 64)
-		if err != nil {
-			fmt.Println(err)
-		} else {
+		cost := orcaJobs.ChunkCost(int(priceInt), paidBytes)
+		if cost > 0 {
+			err = orcaJobs.Authorize(jobId, cost)
+			if err != nil {
+				return err
+			}
+			err = client.sendTransactionFee(fmt.Sprint(cost), walletAddress, passKey)
+			if err != nil {
+				orcaJobs.Release(cost)
+				return err
+			}
 			if client.PublicKey != nil && client.PrivateKey != nil {
-				SendTransaction(float64(priceInt), ip, string(port), client.PublicKey, client.PrivateKey)
+				SendTransaction(float64(cost), ip, string(port), client.PublicKey, client.PrivateKey)
 			}
-			orcaJobs.UpdateJobCost(jobId, int(priceInt))
+			orcaJobs.UpdateJobCost(jobId, cost)
 		}
 
-		file, err := os.OpenFile("./files/requested/" + hash, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
-		defer file.Close()
-	
 		_, err = file.Write(fileChunk.Data)
 		if err != nil {
-			log.Fatal(err)
-			orcaJobs.UpdateJobStatus(jobId, "terminated")
 			return err
 		}
+		offset += int64(len(fileChunk.Data))
 
-		fmt.Printf("Chunk %d for %s received and written\n", hash, fileChunk.ChunkIndex)
+		orcaJobs.RecordChunk(jobId, peerId.String(), fileChunk.ChunkIndex, fileChunk.MaxChunk, len(fileChunk.Data), time.Since(chunkStart), int(priceInt))
+		fmt.Printf("Chunk %d for %s received and written\n", fileChunk.ChunkIndex, hash)
 
 		if fileChunk.ChunkIndex == fileChunk.MaxChunk - 1 {
 			fmt.Println("All chunks received and written")
@@ -254,29 +286,78 @@ func (client *Client) GetFileOnce(ip string, port int32, file_hash string, walle
 		}
 
 		chunkIndex += 1
-
-		if jobId != "" {
-			status := orcaJobs.GetJobStatus(jobId)
-			if status == "terminated" {
-				return nil
-			} else if status == "paused" {
-				for {
-					time.Sleep(10 * time.Second)
-					if orcaJobs.GetJobStatus(jobId) != "paused" {
-						break
-					}
-				}
-			}
-		}
 	}
 
-	orcaJobs.UpdateJobStatus(jobId, "finished")
 	return nil
 }
 
+// Connect to the holder at the multiaddress ip and open a stream for file_hash.
+func (client *Client) openFileStream(ctx context.Context, ip string, file_hash string) (network.Stream, peer.ID, error) {
+	peerMA, err := multiaddr.NewMultiaddr(ip)
+	if err != nil {
+		log.Println(err)
+		return nil, "", err
+	}
+
+	info, err := peer.AddrInfoFromP2pAddr(peerMA)
+	if err != nil {
+		log.Println(err)
+		return nil, "", err
+	}
+
+	client.Host.Peerstore().AddAddrs(info.ID, info.Addrs, peerstore.AddressTTL)
+
+	err = client.Host.Connect(ctx, *info)
+	if err != nil {
+		log.Println(err)
+		return nil, "", err
+	}
+
+	s, err := client.Host.NewStream(ctx, info.ID, protocol.ID("orcanet-fileshare/1.0/"+file_hash))
+	if err != nil {
+		log.Println(err)
+		return nil, "", err
+	}
+	return s, info.ID, nil
+}
+
+// Requests and chunks on a fileshare stream are JSON prefixed with their length
+// as a little endian uint32.
+func writeFileChunkRequest(s network.Stream, fileChunkReq orcaJobs.FileChunkRequest) error {
+	nextChunkReqBytes, err := json.Marshal(fileChunkReq)
+	if err != nil {
+		return err
+	}
+	lengthBytes := make([]byte, 4)
+	binary.LittleEndian.PutUint32(lengthBytes, uint32(len(nextChunkReqBytes)))
+	_, err = s.Write(append(lengthBytes, nextChunkReqBytes...))
+	return err
+}
+
+// Read the next chunk from buf. The size returned includes the length prefix.
+func readFileChunk(buf *bufio.Reader) (orcaJobs.FileChunk, int, error) {
+	fileChunk := orcaJobs.FileChunk{}
+	lengthBytes := make([]byte, 4)
+	_, err := io.ReadFull(buf, lengthBytes)
+	if err != nil {
+		return fileChunk, 0, err
+	}
+	length := binary.LittleEndian.Uint32(lengthBytes)
+	payload := make([]byte, length)
+	_, err = io.ReadFull(buf, payload)
+	if err != nil {
+		return fileChunk, 0, err
+	}
+	err = json.Unmarshal(payload, &fileChunk)
+	if err != nil {
+		return fileChunk, 0, fmt.Errorf("error unmarshaling JSON: %w", err)
+	}
+	return fileChunk, len(lengthBytes) + len(payload), nil
+}
+
 func (client *Client) RequestStorage(ip, port, filename string) (string, error) {
 	// Read file content
-	content, err := os.ReadFile("./files/requested/" + filename)
+	content, err := os.ReadFile(filepath.Join(orcaDataDir.RequestedDir(), filename))
 	if err != nil {
 		fmt.Println("Error reading file:", err)
 		return "", err
@@ -317,12 +398,12 @@ func (client *Client) getDirectory(ip string, port int32, dir_tree map[string]an
 	for path, v := range dir_tree {
 		switch val := v.(type) {
 		case string:
-			err := os.MkdirAll(filepath.Join("./files/requested/", filepath.Dir(path)), 0755)
+			err := os.MkdirAll(filepath.Join(orcaDataDir.RequestedDir(), filepath.Dir(path)), 0755)
 			if err != nil {
 				return err
 			}
 			// need to fix to match new blockchain requirements
-			err = client.GetFileOnce(ip, port, path, "", "", "", "")
+			err = client.GetFileOnce(orcaLifecycle.Context(), ip, port, path, "", "", "", "")
 			if err != nil {
 				return err
 			}
@@ -336,7 +417,7 @@ func (client *Client) getDirectory(ip string, port int32, dir_tree map[string]an
 }
 
 func (client *Client) StoreDirectory(ip, port, path string) {
-	dir_tree_hashes, err := client.storeDirectory(ip, port, filepath.Join("./files/documents/", path))
+	dir_tree_hashes, err := client.storeDirectory(ip, port, filepath.Join(orcaDataDir.DocumentsDir(), path))
 	if err != nil {
 		fmt.Println("Error storing directory", path)
 	}
@@ -0,0 +1,24 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestResumeFileRejectsInvalidPrice(t *testing.T) {
+	client := &Client{}
+	for _, price := range []string{"", "abc", "1.5", "-1"} {
+		// Fails before the holder is dialed or anything is paid
+		err := client.ResumeFile(context.Background(), "", 0, "hash", "", price, "", "job", 0, 0)
+		if err == nil || !strings.Contains(err.Error(), "invalid price") {
+			t.Errorf("price %q: got %v", price, err)
+		}
+	}
+	var numErr *strconv.NumError
+	if err := client.ResumeFile(context.Background(), "", 0, "hash", "", "abc", "", "job", 0, 0); !errors.As(err, &numErr) {
+		t.Errorf("the parse error is not wrapped: %v", err)
+	}
+}
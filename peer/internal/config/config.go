@@ -0,0 +1,391 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	orcaDataDir "orca-peer/internal/datadir"
+	orcaGeo "orca-peer/internal/geo"
+	orcaRouter "orca-peer/internal/router"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// Resources shipped with the source are looked up relative to the working
+// directory, everything the node writes lives in the data directory.
+const (
+	DefaultBootstrapPeersPath = "./internal/cli/bootstrap.peers"
+	DefaultGeoIPPath          = orcaGeo.DefaultDatabasePath
+	DefaultCoinDir            = "../coin"
+	ConfigFileName            = "orcanet.toml"
+	DefaultAPIListen          = "127.0.0.1"
+	DefaultCoinAPI            = "http://127.0.0.1:3333"
+)
+
+/*
+ * Config holds every setting needed to start a node without prompting on stdin.
+ * Values are resolved in increasing order of precedence from the built in
+ * defaults, the TOML config file, ORCA_* environment variables and command line
+ * flags. Rates are in bytes per second and 0 means unlimited.
+ */
+type Config struct {
+	// Defaults to orcanet.toml inside the data directory.
+	ConfigPath string `toml:"-"`
+	DataDir    string `toml:"data_dir"`
+	// Directory holding the OrcaNetAPIServer executable.
+	CoinDir string `toml:"coin_dir"`
+	// URL of the OrcaNetAPIServer, whose wallet events confirm payments to us.
+	CoinAPI string `toml:"coin_api"`
+
+	RPCPort  string `toml:"rpc_port"`
+	DHTPort  string `toml:"dht_port"`
+	HTTPPort string `toml:"http_port"`
+	// Port other peers download files and send payments on, served on every
+	// interface. A free port is picked when it is not set.
+	PeerPort string `toml:"peer_port"`
+
+	// Host the HTTP API listens on. Only change it together with api_tokens.
+	APIListen string `toml:"api_listen"`
+	// Tokens written as <scope>[+<scope>]:<secret>, in addition to the api.cookie
+	// file written to the data directory on every start.
+	APITokens []string `toml:"api_tokens"`
+	// Turned off, every local process can use the API without a token.
+	APIAuth bool `toml:"api_auth"`
+	// Origins of web pages allowed to call the API, "*" for any.
+	CORSOrigins []string `toml:"cors_origins"`
+
+	// Bootstrap peers given inline take precedence over the peers file.
+	BootstrapPeers     []string `toml:"bootstrap_peers"`
+	BootstrapPeersPath string   `toml:"bootstrap_peers_file"`
+
+	GeoIPPath string `toml:"geoip_database"`
+	// Both default to a file in the config directory of the data directory.
+	PeerDatabasePath string `toml:"peer_database"`
+	BanListPath      string `toml:"ban_list"`
+
+	// Price per MiB of files stored without an explicit price, until the pricing
+	// policy is changed through the API.
+	DefaultPrice int64 `toml:"default_price"`
+
+	WalletPassKey string `toml:"wallet_passkey"`
+
+	MaxUpload       int64 `toml:"max_upload"`
+	MaxDownload     int64 `toml:"max_download"`
+	MaxPeerUpload   int64 `toml:"max_peer_upload"`
+	MaxPeerDownload int64 `toml:"max_peer_download"`
+
+	// Download jobs running at the same time, the rest wait in the queue.
+	MaxDownloads int64 `toml:"max_downloads"`
+	// Attempts of a download job, each from another holder if there is one,
+	// before it fails.
+	JobAttempts int64 `toml:"job_attempts"`
+	// Coins download jobs may spend per day and per calendar month before they
+	// wait for approval, 0 for unlimited.
+	DailyBudget   int64 `toml:"daily_budget"`
+	MonthlyBudget int64 `toml:"monthly_budget"`
+
+	// Run without the interactive prompt, all control goes through the HTTP and gRPC APIs.
+	// Storage requests of other peers, which need confirming in the prompt, are refused.
+	Daemon bool `toml:"daemon"`
+}
+
+func Default() *Config {
+	return &Config{
+		DataDir:            orcaDataDir.DefaultRoot(),
+		CoinDir:            DefaultCoinDir,
+		CoinAPI:            DefaultCoinAPI,
+		BootstrapPeersPath: DefaultBootstrapPeersPath,
+		GeoIPPath:          DefaultGeoIPPath,
+		DefaultPrice:       1,
+		APIListen:          DefaultAPIListen,
+		APIAuth:            true,
+		MaxDownloads:       3,
+		JobAttempts:        5,
+	}
+}
+
+// Load resolves the configuration from the config file, the environment and args.
+// A missing config file is only an error if its path was given explicitly.
+func Load(args []string) (*Config, error) {
+	// The config file location depends on the data directory and both can be set
+	// by a flag or the environment, so find them with a first pass over the flags
+	// before reading the file.
+	probe := Default()
+	if dir, ok := os.LookupEnv("ORCA_DATA_DIR"); ok {
+		probe.DataDir = dir
+	}
+	if path, ok := os.LookupEnv("ORCA_CONFIG"); ok {
+		probe.ConfigPath = path
+	}
+	probeFlags := newFlagSet(probe)
+	probeFlags.SetOutput(io.Discard)
+	// Errors are reported by the real flag set below.
+	probeFlags.Parse(args)
+	explicit := probe.ConfigPath != ""
+	if !explicit {
+		probe.ConfigPath = filepath.Join(probe.DataDir, ConfigFileName)
+		// Until the data directory is migrated the config file may still be in
+		// the old location.
+		if _, err := os.Stat(probe.ConfigPath); errors.Is(err, os.ErrNotExist) {
+			legacyPath := filepath.Join("config", ConfigFileName)
+			if _, err := os.Stat(legacyPath); err == nil {
+				probe.ConfigPath = legacyPath
+			}
+		}
+	}
+
+	cfg := Default()
+	cfg.DataDir = probe.DataDir
+	cfg.ConfigPath = probe.ConfigPath
+	if _, err := toml.DecodeFile(cfg.ConfigPath, cfg); err != nil {
+		if !errors.Is(err, os.ErrNotExist) || explicit {
+			return nil, fmt.Errorf("unable to read config file %s: %w", cfg.ConfigPath, err)
+		}
+	}
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	if err := newFlagSet(cfg).Parse(args); err != nil {
+		return nil, err
+	}
+	if cfg.PeerDatabasePath == "" {
+		cfg.PeerDatabasePath = filepath.Join(cfg.DataDir, "config", "peers.json")
+	}
+	if cfg.BanListPath == "" {
+		cfg.BanListPath = filepath.Join(cfg.DataDir, "config", "bans.json")
+	}
+	return cfg, nil
+}
+
+func newFlagSet(cfg *Config) *flag.FlagSet {
+	fs := flag.NewFlagSet("orcanet", flag.ContinueOnError)
+	fs.StringVar(&cfg.ConfigPath, "config", cfg.ConfigPath, "Path to the TOML config file, defaults to orcanet.toml in the data directory.")
+	fs.StringVar(&cfg.DataDir, "datadir", cfg.DataDir, "Directory the node keeps its keys, files and state in.")
+	fs.StringVar(&cfg.CoinDir, "coin-dir", cfg.CoinDir, "Directory holding the OrcaNetAPIServer executable.")
+	fs.StringVar(&cfg.CoinAPI, "coin-api", cfg.CoinAPI, "URL of the OrcaNetAPIServer.")
+	fs.StringVar(&cfg.RPCPort, "rpc-port", cfg.RPCPort, "Port of the market gRPC server.")
+	fs.StringVar(&cfg.DHTPort, "dht-port", cfg.DHTPort, "Port of the libp2p DHT host.")
+	fs.StringVar(&cfg.HTTPPort, "http-port", cfg.HTTPPort, "Port of the HTTP API server.")
+	fs.StringVar(&cfg.PeerPort, "peer-port", cfg.PeerPort, "Port other peers download files from, a free port when not set.")
+	fs.StringVar(&cfg.APIListen, "api-listen", cfg.APIListen, "Host the HTTP API listens on.")
+	fs.Var(&stringList{values: &cfg.APITokens}, "api-token", "API token as <scope>[+<scope>]:<secret>, may be repeated.")
+	fs.BoolVar(&cfg.APIAuth, "api-auth", cfg.APIAuth, "Require an API token, set to false to let every local process use the API.")
+	fs.Var(&stringList{values: &cfg.CORSOrigins}, "cors-origin", "Origin of a web page allowed to call the API, may be repeated.")
+	fs.Var(&stringList{values: &cfg.BootstrapPeers}, "bootstrap", "Multiaddr of a bootstrap peer, may be repeated.")
+	fs.StringVar(&cfg.BootstrapPeersPath, "bootstrap-file", cfg.BootstrapPeersPath, "File with one bootstrap multiaddr per line.")
+	fs.StringVar(&cfg.GeoIPPath, "geoip", cfg.GeoIPPath, "Path to a GeoLite2 Country or City database.")
+	fs.StringVar(&cfg.PeerDatabasePath, "peer-db", cfg.PeerDatabasePath, "Path of the peer database, defaults to config/peers.json in the data directory.")
+	fs.StringVar(&cfg.BanListPath, "ban-list", cfg.BanListPath, "Path of the peer ban list, defaults to config/bans.json in the data directory.")
+	fs.Int64Var(&cfg.DefaultPrice, "default-price", cfg.DefaultPrice, "Price per MiB for files stored without an explicit price, until the pricing policy is changed through the API.")
+	fs.StringVar(&cfg.WalletPassKey, "wallet-passkey", cfg.WalletPassKey, "Passkey of the blockchain wallet.")
+	fs.Int64Var(&cfg.MaxUpload, "max-upload", cfg.MaxUpload, "Cap on file data served to all peers in bytes per second, 0 for unlimited.")
+	fs.Int64Var(&cfg.MaxDownload, "max-download", cfg.MaxDownload, "Cap on file data downloaded from all peers in bytes per second, 0 for unlimited.")
+	fs.Int64Var(&cfg.MaxPeerUpload, "max-peer-upload", cfg.MaxPeerUpload, "Cap on file data served to a single peer in bytes per second, 0 for unlimited.")
+	fs.Int64Var(&cfg.MaxPeerDownload, "max-peer-download", cfg.MaxPeerDownload, "Cap on file data downloaded from a single peer in bytes per second, 0 for unlimited.")
+	fs.Int64Var(&cfg.MaxDownloads, "max-downloads", cfg.MaxDownloads, "Download jobs running at the same time.")
+	fs.Int64Var(&cfg.JobAttempts, "job-attempts", cfg.JobAttempts, "Attempts of a download job before it fails.")
+	fs.Int64Var(&cfg.DailyBudget, "daily-budget", cfg.DailyBudget, "Coins downloads may spend per day without approval, 0 for unlimited.")
+	fs.Int64Var(&cfg.MonthlyBudget, "monthly-budget", cfg.MonthlyBudget, "Coins downloads may spend per month without approval, 0 for unlimited.")
+	fs.BoolVar(&cfg.Daemon, "daemon", cfg.Daemon, "Run without the interactive prompt.")
+	return fs
+}
+
+func (cfg *Config) applyEnv() error {
+	stringVars := map[string]*string{
+		"ORCA_DATA_DIR":       &cfg.DataDir,
+		"ORCA_RPC_PORT":       &cfg.RPCPort,
+		"ORCA_DHT_PORT":       &cfg.DHTPort,
+		"ORCA_HTTP_PORT":      &cfg.HTTPPort,
+		"ORCA_PEER_PORT":      &cfg.PeerPort,
+		"ORCA_API_LISTEN":     &cfg.APIListen,
+		"ORCA_COIN_DIR":       &cfg.CoinDir,
+		"ORCA_COIN_API":       &cfg.CoinAPI,
+		"ORCA_BOOTSTRAP_FILE": &cfg.BootstrapPeersPath,
+		"ORCA_GEOIP":          &cfg.GeoIPPath,
+		"ORCA_PEER_DB":        &cfg.PeerDatabasePath,
+		"ORCA_BAN_LIST":       &cfg.BanListPath,
+		"ORCA_WALLET_PASSKEY": &cfg.WalletPassKey,
+	}
+	for name, field := range stringVars {
+		if value, ok := os.LookupEnv(name); ok {
+			*field = value
+		}
+	}
+	ints := map[string]*int64{
+		"ORCA_DEFAULT_PRICE":     &cfg.DefaultPrice,
+		"ORCA_MAX_UPLOAD":        &cfg.MaxUpload,
+		"ORCA_MAX_DOWNLOAD":      &cfg.MaxDownload,
+		"ORCA_MAX_PEER_UPLOAD":   &cfg.MaxPeerUpload,
+		"ORCA_MAX_PEER_DOWNLOAD": &cfg.MaxPeerDownload,
+		"ORCA_MAX_DOWNLOADS":     &cfg.MaxDownloads,
+		"ORCA_JOB_ATTEMPTS":      &cfg.JobAttempts,
+		"ORCA_DAILY_BUDGET":      &cfg.DailyBudget,
+		"ORCA_MONTHLY_BUDGET":    &cfg.MonthlyBudget,
+	}
+	for name, field := range ints {
+		if value, ok := os.LookupEnv(name); ok {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("%s must be an integer: %w", name, err)
+			}
+			*field = parsed
+		}
+	}
+	if value, ok := os.LookupEnv("ORCA_BOOTSTRAP_PEERS"); ok {
+		cfg.BootstrapPeers = splitList(value)
+	}
+	if value, ok := os.LookupEnv("ORCA_API_TOKENS"); ok {
+		cfg.APITokens = splitList(value)
+	}
+	if value, ok := os.LookupEnv("ORCA_CORS_ORIGINS"); ok {
+		cfg.CORSOrigins = splitList(value)
+	}
+	if value, ok := os.LookupEnv("ORCA_API_AUTH"); ok {
+		auth, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("ORCA_API_AUTH must be a boolean: %w", err)
+		}
+		cfg.APIAuth = auth
+	}
+	if value, ok := os.LookupEnv("ORCA_DAEMON"); ok {
+		daemon, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("ORCA_DAEMON must be a boolean: %w", err)
+		}
+		cfg.Daemon = daemon
+	}
+	return nil
+}
+
+// Bootstrap returns the configured bootstrap peers, reading the peers file when
+// none are given inline.
+func (cfg *Config) Bootstrap() ([]ma.Multiaddr, error) {
+	lines := cfg.BootstrapPeers
+	if len(lines) == 0 && cfg.BootstrapPeersPath != "" {
+		file, err := os.Open(cfg.BootstrapPeersPath)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	peers := []ma.Multiaddr{}
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		addr, err := ma.NewMultiaddr(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bootstrap peer %s: %w", line, err)
+		}
+		peers = append(peers, addr)
+	}
+	return peers, nil
+}
+
+// Validate checks the settings a daemon cannot ask the user for.
+func (cfg *Config) Validate() error {
+	for name, port := range map[string]string{"rpc_port": cfg.RPCPort, "dht_port": cfg.DHTPort, "http_port": cfg.HTTPPort, "peer_port": cfg.PeerPort} {
+		if port == "" {
+			if cfg.Daemon && name != "peer_port" {
+				return fmt.Errorf("%s must be set in daemon mode", name)
+			}
+			continue
+		}
+		if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+			return fmt.Errorf("%s is not a valid port: %s", name, port)
+		}
+	}
+	if cfg.Daemon && cfg.WalletPassKey == "" {
+		return errors.New("wallet_passkey must be set in daemon mode")
+	}
+	if cfg.DefaultPrice < 0 {
+		return errors.New("default_price cannot be negative")
+	}
+	if cfg.MaxDownloads < 1 {
+		return errors.New("max_downloads must be at least 1")
+	}
+	if cfg.JobAttempts < 1 {
+		return errors.New("job_attempts must be at least 1")
+	}
+	if cfg.DailyBudget < 0 || cfg.MonthlyBudget < 0 {
+		return errors.New("daily_budget and monthly_budget cannot be negative")
+	}
+	if _, err := cfg.Tokens(); err != nil {
+		return err
+	}
+	if !cfg.APIAuth && !cfg.APILoopback() {
+		return fmt.Errorf("api_auth can only be turned off while api_listen is a loopback address, not %s", cfg.APIListen)
+	}
+	return nil
+}
+
+// Tokens parses the configured API tokens.
+func (cfg *Config) Tokens() ([]orcaRouter.Token, error) {
+	tokens := []orcaRouter.Token{}
+	for _, value := range cfg.APITokens {
+		token, err := orcaRouter.ParseToken(value)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+// APILoopback reports whether the HTTP API is only reachable from this machine.
+func (cfg *Config) APILoopback() bool {
+	if cfg.APIListen == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(cfg.APIListen)
+	return ip != nil && ip.IsLoopback()
+}
+
+func splitList(value string) []string {
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// stringList is a repeatable flag. The first use on the command line replaces
+// the list from the config file or environment instead of extending it.
+type stringList struct {
+	values *[]string
+	set    bool
+}
+
+func (l *stringList) String() string {
+	if l.values == nil {
+		return ""
+	}
+	return strings.Join(*l.values, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	if !l.set {
+		*l.values = nil
+		l.set = true
+	}
+	*l.values = append(*l.values, value)
+	return nil
+}
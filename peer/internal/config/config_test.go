@@ -0,0 +1,84 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orcanet.toml")
+	err := os.WriteFile(path, []byte(`
+rpc_port = "1000"
+dht_port = "2000"
+http_port = "3000"
+default_price = 5
+bootstrap_peers = ["/ip4/127.0.0.1/tcp/4001/p2p/QmZyLQd66AYP9sPxGbdjqZ5Ys76ZBaFFJy5PwzXxosXz74"]
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ORCA_DHT_PORT", "2001")
+	t.Setenv("ORCA_HTTP_PORT", "3001")
+
+	cfg, err := Load([]string{"-config", path, "-http-port", "3002", "-daemon"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RPCPort != "1000" {
+		t.Errorf("expected rpc port from the config file, got %s", cfg.RPCPort)
+	}
+	if cfg.DHTPort != "2001" {
+		t.Errorf("expected dht port from the environment, got %s", cfg.DHTPort)
+	}
+	if cfg.HTTPPort != "3002" {
+		t.Errorf("expected http port from the flags, got %s", cfg.HTTPPort)
+	}
+	if cfg.DefaultPrice != 5 || !cfg.Daemon {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+	peers, err := cfg.Bootstrap()
+	if err != nil || len(peers) != 1 {
+		t.Errorf("expected one bootstrap peer, got %v (%v)", peers, err)
+	}
+}
+
+func TestLoadMissingExplicitConfig(t *testing.T) {
+	if _, err := Load([]string{"-config", filepath.Join(t.TempDir(), "missing.toml")}); err == nil {
+		t.Error("missing config file given with -config should be an error")
+	}
+}
+
+func TestValidateDaemonNeedsSettings(t *testing.T) {
+	cfg := Default()
+	cfg.Daemon = true
+	if err := cfg.Validate(); err == nil {
+		t.Error("daemon without ports should not validate")
+	}
+	cfg.RPCPort, cfg.DHTPort, cfg.HTTPPort, cfg.WalletPassKey = "1000", "2000", "3000", "secret"
+	if err := cfg.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidateAPIAccess(t *testing.T) {
+	cfg := Default()
+	cfg.APITokens = []string{"read+files:secret"}
+	tokens, err := cfg.Tokens()
+	if err != nil || len(tokens) != 1 || len(tokens[0].Scopes) != 2 || tokens[0].Secret != "secret" {
+		t.Fatalf("unexpected tokens %+v (%v)", tokens, err)
+	}
+	cfg.APITokens = []string{"spend:secret"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("token with an unknown scope should not validate")
+	}
+	cfg.APITokens = nil
+	cfg.APIAuth = false
+	if err := cfg.Validate(); err != nil {
+		t.Error(err)
+	}
+	cfg.APIListen = "0.0.0.0"
+	if err := cfg.Validate(); err == nil {
+		t.Error("api without auth on every interface should not validate")
+	}
+}
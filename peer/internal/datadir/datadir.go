@@ -0,0 +1,273 @@
+package datadir
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+ * Every file a node reads or writes at runtime lives below a single data
+ * directory, so several nodes can run side by side on one machine by giving each
+ * its own directory:
+ *
+ *	<root>/
+ *		orcanet.toml        optional config file
+ *		config/             keys, peer database and ban list
+ *		files/              files imported into the node
+ *		files/stored/       chunks we are serving
+ *		files/requested/    files downloaded from other peers
+ *		files/transactions/ transaction receipts
+ *		files/names/        file name index of the client
+ *		files/documents/    directories shared with storedir
+ *		jobs.db             job database
+ *		devices.json        mining devices
+ *		api.cookie          API token of the running node
+ */
+
+const (
+	// Bumped whenever the layout changes so older installs can be migrated.
+	layoutVersion  = 1
+	layoutFileName = "layout"
+	lockFileName   = "LOCK"
+)
+
+var (
+	mutex sync.RWMutex
+	// Until Init is called paths resolve against the working directory, which is
+	// where the layout used to live.
+	root = "."
+	lock io.Closer
+)
+
+// DefaultRoot returns ~/.orcanet, or ./data if the home directory is unknown.
+func DefaultRoot() string {
+	home, err := os.UserHomeDir()
+	if err != nil || home == "" {
+		return "./data"
+	}
+	return filepath.Join(home, ".orcanet")
+}
+
+// Init makes dir the data directory of this process. It creates the layout,
+// takes an exclusive lock so no other node can use the same directory, and on
+// first use moves the data of an older install out of the working directory
+// when that is a peer checkout the node used to run from.
+func Init(dir string) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	l, err := lockDir(filepath.Join(dir, lockFileName))
+	if err != nil {
+		return fmt.Errorf("data directory %s is in use by another node: %w", dir, err)
+	}
+	if err := migrate(dir); err != nil {
+		l.Close()
+		return err
+	}
+	for _, sub := range [][]string{
+		{"config"},
+		{"files", "stored"},
+		{"files", "requested"},
+		{"files", "transactions"},
+		{"files", "names"},
+		{"files", "documents"},
+	} {
+		if err := os.MkdirAll(filepath.Join(append([]string{dir}, sub...)...), 0755); err != nil {
+			l.Close()
+			return err
+		}
+	}
+
+	mutex.Lock()
+	if lock != nil {
+		lock.Close()
+	}
+	root = dir
+	lock = l
+	mutex.Unlock()
+	return nil
+}
+
+// Close releases the lock on the data directory.
+func Close() error {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if lock == nil {
+		return nil
+	}
+	err := lock.Close()
+	lock = nil
+	return err
+}
+
+func Root() string {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return root
+}
+
+// Path joins elem onto the data directory.
+func Path(elem ...string) string {
+	return filepath.Join(append([]string{Root()}, elem...)...)
+}
+
+func ConfigDir() string       { return Path("config") }
+func FilesDir() string        { return Path("files") }
+func StoredDir() string       { return Path("files", "stored") }
+func RequestedDir() string    { return Path("files", "requested") }
+func TransactionsDir() string { return Path("files", "transactions") }
+func NamesDir() string        { return Path("files", "names") }
+func DocumentsDir() string    { return Path("files", "documents") }
+func JobsFile() string        { return Path("jobs.json") }
+func JobsDBFile() string      { return Path("jobs.db") }
+func DevicesFile() string     { return Path("devices.json") }
+func PricingFile() string     { return Path("config", "pricing.json") }
+func APICookieFile() string   { return Path("api.cookie") }
+
+// Files that older versions kept relative to the working directory, and where
+// they belong in the data directory.
+var legacyLayout = []struct {
+	from string
+	to   []string
+}{
+	{"files", []string{"files"}},
+	{filepath.Join("config", "key.pub"), []string{"config", "key.pub"}},
+	{filepath.Join("config", "key.priv"), []string{"config", "key.priv"}},
+	{filepath.Join("config", "peers.json"), []string{"config", "peers.json"}},
+	{filepath.Join("config", "bans.json"), []string{"config", "bans.json"}},
+	{filepath.Join("config", "orcanet.toml"), []string{"orcanet.toml"}},
+	{filepath.Join("internal", "jobs", "jobs.json"), []string{"jobs.json"}},
+	{filepath.Join("internal", "mining", "devices.json"), []string{"devices.json"}},
+}
+
+// Move the legacy layout into dir unless dir has already been set up.
+func migrate(dir string) error {
+	layoutPath := filepath.Join(dir, layoutFileName)
+	if data, err := os.ReadFile(layoutPath); err == nil {
+		version, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil {
+			return fmt.Errorf("unreadable layout version in %s: %w", layoutPath, err)
+		}
+		if version > layoutVersion {
+			return fmt.Errorf("data directory %s was created by a newer version of the node", dir)
+		}
+		return nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	legacy, err := filepath.Abs(".")
+	if err != nil {
+		return err
+	}
+	if !isLegacyCheckout(legacy) {
+		return writeLayout(layoutPath)
+	}
+	for _, entry := range legacyLayout {
+		src := filepath.Join(legacy, entry.from)
+		dst := filepath.Join(append([]string{dir}, entry.to...)...)
+		if src == dst {
+			continue
+		}
+		if _, err := os.Stat(src); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err := move(src, dst); err != nil {
+			return fmt.Errorf("unable to migrate %s to %s: %w", src, dst, err)
+		}
+		fmt.Printf("Migrated %s to %s\n", src, dst)
+	}
+	return writeLayout(layoutPath)
+}
+
+func writeLayout(path string) error {
+	return os.WriteFile(path, []byte(strconv.Itoa(layoutVersion)+"\n"), 0644)
+}
+
+// Whether dir is a checkout of the peer that a node ran from, which has the
+// key of the node next to the source. Any other working directory, such as a
+// home or project directory with its own files or config folder, is left alone.
+func isLegacyCheckout(dir string) bool {
+	key, err := os.Stat(filepath.Join(dir, "config", "key.priv"))
+	if err != nil || key.IsDir() {
+		return false
+	}
+	jobs, err := os.Stat(filepath.Join(dir, "internal", "jobs"))
+	return err == nil && jobs.IsDir()
+}
+
+// Move src to dst. Directories are merged into an existing dst, files that
+// already exist at the destination are left alone. Dotfiles in directories,
+// such as the .gitkeep of the files folder in the source tree, stay where they
+// are.
+func move(src string, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		if _, err := os.Stat(dst); err == nil {
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(src, dst); err == nil {
+			return nil
+		}
+		// Rename fails across file systems, fall back to copying.
+		if err := copyFile(src, dst, info.Mode()); err != nil {
+			return err
+		}
+		return os.Remove(src)
+	}
+
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if err := move(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+			return err
+		}
+	}
+	// Leave the directory behind if anything was skipped or could not be
+	// moved.
+	os.Remove(src)
+	return nil
+}
+
+func copyFile(src string, dst string, mode fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,121 @@
+package datadir
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Run fn with the working directory set to dir.
+func inDir(t *testing.T, dir string, fn func()) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	fn()
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInitMigratesLegacyLayout(t *testing.T) {
+	legacy := t.TempDir()
+	writeFile(t, filepath.Join(legacy, "files", "stored", "chunk"), "chunk")
+	writeFile(t, filepath.Join(legacy, "config", "key.pub"), "pub")
+	writeFile(t, filepath.Join(legacy, "config", "key.priv"), "priv")
+	writeFile(t, filepath.Join(legacy, "internal", "jobs", "jobs.json"), "[]")
+	// Tracked by git in the source tree
+	writeFile(t, filepath.Join(legacy, "files", ".gitkeep"), "")
+	writeFile(t, filepath.Join(legacy, "files", ".gitignore"), "*\n")
+	root := filepath.Join(t.TempDir(), "node")
+
+	inDir(t, legacy, func() {
+		if err := Init(root); err != nil {
+			t.Fatal(err)
+		}
+	})
+	defer Close()
+
+	for path, content := range map[string]string{
+		filepath.Join(StoredDir(), "chunk"):    "chunk",
+		filepath.Join(ConfigDir(), "key.pub"):  "pub",
+		filepath.Join(ConfigDir(), "key.priv"): "priv",
+		JobsFile():                             "[]",
+	} {
+		data, err := os.ReadFile(path)
+		if err != nil || string(data) != content {
+			t.Errorf("%s was not migrated: %v", path, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(legacy, "internal", "jobs", "jobs.json")); !os.IsNotExist(err) {
+		t.Error("legacy job history was left in place")
+	}
+	if _, err := os.Stat(RequestedDir()); err != nil {
+		t.Errorf("layout was not created: %v", err)
+	}
+	for _, name := range []string{".gitkeep", ".gitignore"} {
+		if _, err := os.Stat(filepath.Join(legacy, "files", name)); err != nil {
+			t.Errorf("%s was moved out of the source tree: %v", name, err)
+		}
+		if _, err := os.Stat(filepath.Join(FilesDir(), name)); !os.IsNotExist(err) {
+			t.Errorf("%s was copied into the data directory", name)
+		}
+	}
+}
+
+func TestInitLeavesOtherWorkingDirectoriesAlone(t *testing.T) {
+	// A home or project directory with folders named like the legacy layout,
+	// but no key of a node next to the peer source
+	wd := t.TempDir()
+	writeFile(t, filepath.Join(wd, "files", "report.pdf"), "report")
+	writeFile(t, filepath.Join(wd, "config", "peers.json"), "{}")
+	writeFile(t, filepath.Join(wd, "config", "key.priv"), "other key")
+	root := filepath.Join(t.TempDir(), "node")
+
+	inDir(t, wd, func() {
+		if err := Init(root); err != nil {
+			t.Fatal(err)
+		}
+	})
+	defer Close()
+
+	for _, path := range []string{
+		filepath.Join(wd, "files", "report.pdf"),
+		filepath.Join(wd, "config", "peers.json"),
+		filepath.Join(wd, "config", "key.priv"),
+	} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s was moved: %v", path, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(ConfigDir(), "key.priv")); !os.IsNotExist(err) {
+		t.Error("a key out of the working directory was taken over")
+	}
+	if _, err := os.Stat(filepath.Join(root, layoutFileName)); err != nil {
+		t.Errorf("layout version was not written: %v", err)
+	}
+}
+
+func TestDataDirectoryIsExclusive(t *testing.T) {
+	root := t.TempDir()
+	if err := Init(root); err != nil {
+		t.Fatal(err)
+	}
+	defer Close()
+
+	l, err := lockDir(filepath.Join(root, lockFileName))
+	if err == nil {
+		l.Close()
+		t.Error("a second node was able to lock the data directory")
+	}
+}
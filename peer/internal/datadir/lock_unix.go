@@ -0,0 +1,23 @@
+//go:build !windows
+
+package datadir
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// Hold an exclusive advisory lock on path for the lifetime of the process. The
+// lock is released by the kernel if the node crashes.
+func lockDir(path string) (io.Closer, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
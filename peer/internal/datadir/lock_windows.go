@@ -0,0 +1,15 @@
+//go:build windows
+
+package datadir
+
+import (
+	"io"
+	"os"
+)
+
+// Windows does not allow a file that another process has open for writing to be
+// removed, so holding it open is enough to keep a second node out.
+func lockDir(path string) (io.Closer, error) {
+	os.Remove(path)
+	return os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+}
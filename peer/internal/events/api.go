@@ -0,0 +1,87 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	orcaLifecycle "orca-peer/internal/lifecycle"
+	orcaRouter "orca-peer/internal/router"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// How often a comment is sent on an idle stream so proxies keep it open.
+const keepAliveInterval = 15 * time.Second
+
+// Stream events to the client as server-sent events until it disconnects or the
+// node shuts down.
+func streamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		orcaRouter.WriteError(w, orcaRouter.Errorf(http.StatusInternalServerError, "streaming is not supported"))
+		return
+	}
+	var types []string
+	if value := r.URL.Query().Get("types"); value != "" {
+		types = strings.Split(value, ",")
+	}
+	// EventSource sends the id of the last event it saw when it reconnects
+	since, _ := strconv.ParseUint(r.URL.Query().Get("since"), 10, 64)
+	if id, err := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64); err == nil {
+		since = id
+	}
+	sub := Subscribe(since, types...)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-orcaLifecycle.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				fmt.Println("Error marshalling event:", err)
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+		}
+		flusher.Flush()
+	}
+}
+
+// Routes returns the HTTP routes of the event stream.
+func Routes() []orcaRouter.Route {
+	return []orcaRouter.Route{
+		{
+			Method:  http.MethodGet,
+			Path:    "/events",
+			Scope:   orcaRouter.ScopeRead,
+			Tag:     "events",
+			Summary: "Stream job, transfer, payment, peer and mining events",
+			Description: "Server-sent events (text/event-stream). Each message has the event id, its type as the event name and the Event as JSON data. " +
+				"Clients that reconnect with Last-Event-ID, or pass since, first receive the recent events they missed.",
+			Query: []orcaRouter.Param{
+				{Name: "types", Description: "Comma separated event types or prefixes to receive, e.g. job,payment.sent. All events by default."},
+				{Name: "since", Type: "integer", Description: "Replay the kept events after this id"},
+			},
+			Response: Event{},
+			Handler:  streamEvents,
+		},
+	}
+}
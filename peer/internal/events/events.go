@@ -0,0 +1,202 @@
+package events
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+ * The event bus carries everything a UI would otherwise have to poll for. The
+ * packages doing the work publish events as they happen and every subscriber
+ * gets its own buffered channel. Publishing never blocks: a subscriber that
+ * falls behind misses events rather than stalling a transfer, and can catch up
+ * with the recent events the bus keeps for replay.
+ */
+
+// Event types. Subscribers can filter on a type or on the prefix before the dot,
+// e.g. "job" for both job events.
+const (
+	JobStatus        = "job.status"
+	JobProgress      = "job.progress"
+	ChunkServed      = "transfer.served"
+	PaymentSent      = "payment.sent"
+	PaymentReceived  = "payment.received"
+	PeerConnected    = "peer.connected"
+	PeerDisconnected = "peer.disconnected"
+
+	// Coins paid to the wallet were seen on the network, and later their
+	// confirmations changed.
+	PaymentIncoming      = "payment.incoming"
+	PaymentConfirmations = "payment.confirmations"
+
+	// The miner of the node found a block.
+	MiningBlockFound = "mining.block"
+)
+
+const (
+	// Number of past events kept for subscribers that reconnect.
+	historySize = 256
+	// New events buffered per subscriber before they are dropped.
+	subscriberBuffer = 64
+)
+
+type Event struct {
+	// Increases by one with every event published since the node started.
+	ID   uint64      `json:"id"`
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// JobStatusData is sent whenever a job changes status.
+type JobStatusData struct {
+	JobID    string `json:"jobID"`
+	FileHash string `json:"fileHash"`
+	Status   string `json:"status"`
+}
+
+// JobProgressData is sent for every chunk a job downloads. Throughput is in
+// bytes per second and ETA in seconds, -1 while it is unknown.
+type JobProgressData struct {
+	JobID           string  `json:"jobID"`
+	FileHash        string  `json:"fileHash"`
+	PeerID          string  `json:"peer"`
+	Chunk           int     `json:"chunk"`
+	Chunks          int     `json:"chunks"`
+	Bytes           int64   `json:"bytes"`
+	Throughput      float64 `json:"throughput"`
+	ETA             int     `json:"eta"`
+	AccumulatedCost int     `json:"accumulatedCost"`
+	ProjectedCost   int     `json:"projectedCost"`
+}
+
+// ChunkServedData is sent for every chunk served to another peer.
+type ChunkServedData struct {
+	PeerID   string `json:"peer"`
+	FileHash string `json:"fileHash"`
+	Chunk    int    `json:"chunk"`
+	Chunks   int    `json:"chunks"`
+	Bytes    int    `json:"bytes"`
+	// Set when the peer is downloading as part of a job
+	JobID string `json:"jobID,omitempty"`
+}
+
+// PaymentData is sent for coins sent from the wallet and for payments peers
+// announce to us.
+type PaymentData struct {
+	Amount float64 `json:"amount"`
+	// Wallet address the coins were sent to
+	Address string `json:"address,omitempty"`
+	// Address of the peer that announced the payment
+	Peer string `json:"peer,omitempty"`
+}
+
+// WalletPaymentData is sent for coins that reached the wallet, first while
+// they are unconfirmed and then every time their confirmations change. A reorg
+// can take them back to 0.
+type WalletPaymentData struct {
+	TxID          string  `json:"txid"`
+	Amount        float64 `json:"amount"`
+	Confirmations int64   `json:"confirmations"`
+	// Our address the coins were paid to
+	Address string `json:"address"`
+	// Addresses that paid, as far as the wallet could find them
+	From  []string `json:"from,omitempty"`
+	Label string   `json:"label,omitempty"`
+}
+
+// MiningBlockData is sent for every block that pays the mining addresses of
+// the node. Reward is what the block pays them in coins, subsidy and fees.
+type MiningBlockData struct {
+	Hash   string  `json:"hash"`
+	Height int64   `json:"height"`
+	Reward float64 `json:"reward"`
+}
+
+// PeerData is sent when a libp2p peer connects or its last connection closes.
+type PeerData struct {
+	PeerID  string `json:"peer"`
+	Address string `json:"address,omitempty"`
+}
+
+type Subscription struct {
+	C      <-chan Event
+	c      chan Event
+	types  []string
+	closed bool
+}
+
+var (
+	mutex       sync.Mutex
+	nextID      uint64 = 1
+	history            = make([]Event, 0, historySize)
+	subscribers        = make(map[*Subscription]struct{})
+)
+
+// Publish sends an event to every subscriber interested in its type.
+func Publish(eventType string, data interface{}) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	e := Event{ID: nextID, Type: eventType, Time: time.Now(), Data: data}
+	nextID++
+	if len(history) == historySize {
+		copy(history, history[1:])
+		history = history[:historySize-1]
+	}
+	history = append(history, e)
+	for sub := range subscribers {
+		if !sub.matches(eventType) {
+			continue
+		}
+		select {
+		case sub.c <- e:
+		default:
+			// The subscriber is not keeping up
+		}
+	}
+}
+
+// Subscribe returns a subscription to the given event types, or to every event
+// when none are given. Events published after since are delivered first, so a
+// client that reconnects does not miss any as long as they are still kept.
+// Pass 0 to only receive new events.
+func Subscribe(since uint64, types ...string) *Subscription {
+	c := make(chan Event, subscriberBuffer+historySize)
+	sub := &Subscription{C: c, c: c, types: types}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if since > 0 {
+		for _, e := range history {
+			if e.ID > since && sub.matches(e.Type) {
+				c <- e
+			}
+		}
+	}
+	subscribers[sub] = struct{}{}
+	return sub
+}
+
+// Close stops delivery and closes the channel of the subscription.
+func (sub *Subscription) Close() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	delete(subscribers, sub)
+	close(sub.c)
+}
+
+func (sub *Subscription) matches(eventType string) bool {
+	if len(sub.types) == 0 {
+		return true
+	}
+	for _, t := range sub.types {
+		if t == eventType || strings.HasPrefix(eventType, t+".") {
+			return true
+		}
+	}
+	return false
+}
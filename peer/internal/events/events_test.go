@@ -0,0 +1,123 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	orcaRouter "orca-peer/internal/router"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func receive(t *testing.T, sub *Subscription) Event {
+	select {
+	case e := <-sub.C:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+	}
+	return Event{}
+}
+
+func TestSubscribe(t *testing.T) {
+	jobs := Subscribe(0, "job")
+	defer jobs.Close()
+	all := Subscribe(0)
+	defer all.Close()
+
+	Publish(PeerConnected, PeerData{PeerID: "QmPeer"})
+	Publish(JobStatus, JobStatusData{JobID: "1", Status: "active"})
+
+	if e := receive(t, jobs); e.Type != JobStatus || e.Data.(JobStatusData).Status != "active" {
+		t.Fatalf("job subscriber got %+v", e)
+	}
+	first := receive(t, all)
+	second := receive(t, all)
+	if first.Type != PeerConnected || second.Type != JobStatus || second.ID != first.ID+1 {
+		t.Fatalf("subscriber to all events got %+v then %+v", first, second)
+	}
+
+	// A subscriber that reconnects gets what it missed
+	replay := Subscribe(first.ID, "job.status")
+	defer replay.Close()
+	if e := receive(t, replay); e.ID != second.ID {
+		t.Fatalf("replay started at %d, want %d", e.ID, second.ID)
+	}
+
+	jobs.Close()
+	jobs.Close()
+	if _, ok := <-jobs.C; ok {
+		t.Fatal("closed subscription still delivers")
+	}
+}
+
+func TestSlowSubscriberDoesNotBlock(t *testing.T) {
+	sub := Subscribe(0, ChunkServed)
+	defer sub.Close()
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10*(subscriberBuffer+historySize); i++ {
+			Publish(ChunkServed, ChunkServedData{Chunk: i})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Publish blocked on a subscriber that does not read")
+	}
+}
+
+func TestStream(t *testing.T) {
+	rt := orcaRouter.New()
+	rt.Handle(Routes()...)
+	rt.SetAccess(orcaRouter.Access{NoAuth: true})
+	server := httptest.NewServer(rt)
+	defer server.Close()
+
+	Publish(PaymentSent, PaymentData{Amount: 1})
+	sub := Subscribe(0)
+	Publish(PaymentReceived, PaymentData{Amount: 2})
+	missed := receive(t, sub)
+	sub.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/v1/events?types=payment", nil)
+	req.Header.Set("Last-Event-ID", strconv.FormatUint(missed.ID-1, 10))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	Publish(PeerDisconnected, PeerData{PeerID: "QmPeer"})
+	Publish(PaymentSent, PaymentData{Amount: 3})
+
+	scanner := bufio.NewScanner(resp.Body)
+	var amounts []float64
+	for len(amounts) < 2 && scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var e struct {
+			Type string      `json:"type"`
+			Data PaymentData `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(e.Type, "payment.") {
+			t.Fatalf("stream filtered on payment sent %s", e.Type)
+		}
+		amounts = append(amounts, e.Data.Amount)
+	}
+	if len(amounts) != 2 || amounts[0] != 2 || amounts[1] != 3 {
+		t.Fatalf("streamed payments %v, want the missed one and the new one", amounts)
+	}
+}
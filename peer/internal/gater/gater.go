@@ -0,0 +1,203 @@
+package gater
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/control"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+	"github.com/libp2p/go-libp2p/p2p/net/connmgr"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// Ban is a single entry of the ban list. A zero Expires means the ban never ends.
+type Ban struct {
+	PeerID  string    `json:"peerID"`
+	Reason  string    `json:"reason"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+}
+
+func (b Ban) expired(now time.Time) bool {
+	return !b.Expires.IsZero() && now.After(b.Expires)
+}
+
+// Limits bounds how many connections and streams the libp2p host keeps open.
+// Once HighWater connections are open the connection manager trims back down to
+// LowWater, sparing connections younger than GracePeriod.
+type Limits struct {
+	LowWater    int
+	HighWater   int
+	GracePeriod time.Duration
+	PeerStreams int
+}
+
+var DefaultLimits = Limits{
+	LowWater:    100,
+	HighWater:   400,
+	GracePeriod: time.Minute,
+	PeerStreams: 64,
+}
+
+// ConnectionGater refuses connections to and from banned peers. The ban list is
+// persisted to disk on every change so bans survive restarts.
+type ConnectionGater struct {
+	path  string
+	mutex sync.RWMutex
+	bans  map[peer.ID]Ban
+}
+
+// New loads the ban list stored at path, starting with an empty list if the file
+// does not exist yet.
+func New(path string) (*ConnectionGater, error) {
+	g := &ConnectionGater{
+		path: path,
+		bans: make(map[peer.ID]Ban),
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return g, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var bans []Ban
+	if err := json.Unmarshal(data, &bans); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, ban := range bans {
+		id, err := peer.Decode(ban.PeerID)
+		if err != nil || ban.expired(now) {
+			continue
+		}
+		g.bans[id] = ban
+	}
+	return g, nil
+}
+
+// Ban adds the peer to the ban list. A duration of zero bans the peer permanently.
+func (g *ConnectionGater) Ban(id peer.ID, duration time.Duration, reason string) error {
+	now := time.Now()
+	ban := Ban{
+		PeerID:  id.String(),
+		Reason:  reason,
+		Created: now,
+	}
+	if duration > 0 {
+		ban.Expires = now.Add(duration)
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.bans[id] = ban
+	return g.save()
+}
+
+func (g *ConnectionGater) Unban(id peer.ID) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if _, ok := g.bans[id]; !ok {
+		return errors.New("peer is not banned")
+	}
+	delete(g.bans, id)
+	return g.save()
+}
+
+func (g *ConnectionGater) IsBanned(id peer.ID) bool {
+	g.mutex.RLock()
+	ban, ok := g.bans[id]
+	g.mutex.RUnlock()
+	return ok && !ban.expired(time.Now())
+}
+
+// Bans returns the active bans, oldest first.
+func (g *ConnectionGater) Bans() []Ban {
+	now := time.Now()
+	g.mutex.RLock()
+	bans := make([]Ban, 0, len(g.bans))
+	for _, ban := range g.bans {
+		if !ban.expired(now) {
+			bans = append(bans, ban)
+		}
+	}
+	g.mutex.RUnlock()
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Created.Before(bans[j].Created)
+	})
+	return bans
+}
+
+// Write the ban list to a temporary file first so a crash never leaves a
+// truncated list behind. Must be called with the mutex held.
+func (g *ConnectionGater) save() error {
+	bans := make([]Ban, 0, len(g.bans))
+	for _, ban := range g.bans {
+		bans = append(bans, ban)
+	}
+	data, err := json.Marshal(bans)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(g.path), 0755); err != nil {
+		return err
+	}
+	tmpPath := g.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, g.path)
+}
+
+func (g *ConnectionGater) InterceptPeerDial(p peer.ID) bool {
+	return !g.IsBanned(p)
+}
+
+func (g *ConnectionGater) InterceptAddrDial(p peer.ID, _ ma.Multiaddr) bool {
+	return !g.IsBanned(p)
+}
+
+func (g *ConnectionGater) InterceptAccept(network.ConnMultiaddrs) bool {
+	// The remote peer ID is not known until the connection is secured.
+	return true
+}
+
+func (g *ConnectionGater) InterceptSecured(_ network.Direction, p peer.ID, _ network.ConnMultiaddrs) bool {
+	return !g.IsBanned(p)
+}
+
+func (g *ConnectionGater) InterceptUpgraded(network.Conn) (bool, control.DisconnectReason) {
+	return true, 0
+}
+
+// HostOptions returns the libp2p options that install the gater together with a
+// connection manager and a resource manager enforcing limits.
+func HostOptions(g *ConnectionGater, limits Limits) ([]libp2p.Option, error) {
+	connManager, err := connmgr.NewConnManager(limits.LowWater, limits.HighWater, connmgr.WithGracePeriod(limits.GracePeriod))
+	if err != nil {
+		return nil, err
+	}
+
+	partialLimits := rcmgr.PartialLimitConfig{
+		PeerDefault: rcmgr.ResourceLimits{
+			Streams: rcmgr.LimitVal(limits.PeerStreams),
+		},
+	}
+	limiter := rcmgr.NewFixedLimiter(partialLimits.Build(rcmgr.DefaultLimits.AutoScale()))
+	resourceManager, err := rcmgr.NewResourceManager(limiter)
+	if err != nil {
+		return nil, err
+	}
+
+	return []libp2p.Option{
+		libp2p.ConnectionGater(g),
+		libp2p.ConnectionManager(connManager),
+		libp2p.ResourceManager(resourceManager),
+	}, nil
+}
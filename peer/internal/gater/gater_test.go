@@ -0,0 +1,65 @@
+package gater
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const testPeer = "12D3KooWGRUVh7ZTr4uqYLeRH1p2aVK3eqXnGSGqbjkiJBqUBjzG"
+
+func TestBanPersistsAcrossRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bans.json")
+	id, err := peer.Decode(testPeer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Ban(id, 0, "spam"); err != nil {
+		t.Fatal(err)
+	}
+	if g.InterceptPeerDial(id) {
+		t.Error("dial to banned peer was allowed")
+	}
+
+	reloaded, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reloaded.IsBanned(id) {
+		t.Error("ban was not loaded from disk")
+	}
+	if err := reloaded.Unban(id); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.IsBanned(id) {
+		t.Error("peer is still banned after unban")
+	}
+}
+
+func TestBanExpires(t *testing.T) {
+	id, err := peer.Decode(testPeer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := New(filepath.Join(t.TempDir(), "bans.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Ban(id, time.Millisecond, "timeout"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if g.IsBanned(id) {
+		t.Error("expired ban is still active")
+	}
+	if len(g.Bans()) != 0 {
+		t.Error("expired ban is still listed")
+	}
+}
@@ -0,0 +1,199 @@
+package geo
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/oschwald/geoip2-golang"
+)
+
+// Value used for every field we could not resolve.
+const Unknown = "unknown"
+
+const DefaultDatabasePath = "./rsrc/GeoLite2-Country.mmdb"
+
+// Location is the result of resolving an IP address against the local database.
+type Location struct {
+	Ip          string  `json:"ip"`
+	City        string  `json:"city"`
+	Region      string  `json:"region"`
+	Country     string  `json:"country"`
+	CountryCode string  `json:"countryCode"`
+	Continent   string  `json:"continent"`
+	Timezone    string  `json:"timezone"`
+	Latitude    float64 `json:"latitude"`
+	Longitude   float64 `json:"longitude"`
+	FlagUrl     string  `json:"flagUrl"`
+}
+
+// Resolver turns IP addresses into locations. Implementations must never fail,
+// addresses that cannot be resolved come back as an unknown Location.
+type Resolver interface {
+	Lookup(ip net.IP) Location
+}
+
+// MMDBResolver resolves addresses with a MaxMind GeoIP2/GeoLite2 database. Both
+// Country and City databases are supported, city-level fields are left unknown
+// with a Country database. Results are cached per IP for the lifetime of the resolver.
+type MMDBResolver struct {
+	db    *geoip2.Reader
+	city  bool
+	mutex sync.RWMutex
+	cache map[string]Location
+}
+
+var (
+	defaultResolver Resolver = &MMDBResolver{cache: make(map[string]Location)}
+	defaultMutex    sync.RWMutex
+)
+
+// Open loads the database at path once. A missing or unreadable database is
+// not fatal, the returned resolver answers every lookup with Unknown.
+func Open(path string) (*MMDBResolver, error) {
+	resolver := &MMDBResolver{cache: make(map[string]Location)}
+	db, err := geoip2.Open(path)
+	if err != nil {
+		return resolver, fmt.Errorf("unable to open geoip database %s: %w", path, err)
+	}
+	resolver.db = db
+	resolver.city = strings.Contains(db.Metadata().DatabaseType, "City")
+	return resolver, nil
+}
+
+func (r *MMDBResolver) Close() error {
+	if r.db == nil {
+		return nil
+	}
+	return r.db.Close()
+}
+
+func (r *MMDBResolver) Lookup(ip net.IP) Location {
+	if ip == nil {
+		return unknownLocation("")
+	}
+	key := ip.String()
+	r.mutex.RLock()
+	location, ok := r.cache[key]
+	r.mutex.RUnlock()
+	if ok {
+		return location
+	}
+
+	location = r.resolve(ip)
+	r.mutex.Lock()
+	r.cache[key] = location
+	r.mutex.Unlock()
+	return location
+}
+
+func (r *MMDBResolver) resolve(ip net.IP) Location {
+	location := unknownLocation(ip.String())
+	if r.db == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() {
+		return location
+	}
+	if r.city {
+		record, err := r.db.City(ip)
+		if err != nil {
+			return location
+		}
+		setIfPresent(&location.City, record.City.Names["en"])
+		if len(record.Subdivisions) > 0 {
+			setIfPresent(&location.Region, record.Subdivisions[0].Names["en"])
+		}
+		setIfPresent(&location.Country, record.Country.Names["en"])
+		setIfPresent(&location.CountryCode, record.Country.IsoCode)
+		setIfPresent(&location.Continent, record.Continent.Code)
+		setIfPresent(&location.Timezone, record.Location.TimeZone)
+		location.Latitude = record.Location.Latitude
+		location.Longitude = record.Location.Longitude
+	} else {
+		record, err := r.db.Country(ip)
+		if err != nil {
+			return location
+		}
+		setIfPresent(&location.Country, record.Country.Names["en"])
+		setIfPresent(&location.CountryCode, record.Country.IsoCode)
+		setIfPresent(&location.Continent, record.Continent.Code)
+	}
+	location.FlagUrl = FlagUrl(location.CountryCode)
+	return location
+}
+
+func setIfPresent(field *string, value string) {
+	if value != "" {
+		*field = value
+	}
+}
+
+func unknownLocation(ip string) Location {
+	return Location{
+		Ip:          ip,
+		City:        Unknown,
+		Region:      Unknown,
+		Country:     Unknown,
+		CountryCode: Unknown,
+		Continent:   Unknown,
+		Timezone:    Unknown,
+	}
+}
+
+// FlagUrl returns a link to a small flag image for an ISO 3166-1 alpha-2 code,
+// or an empty string if the country is unknown.
+func FlagUrl(countryCode string) string {
+	if len(countryCode) != 2 {
+		return ""
+	}
+	return fmt.Sprintf("https://flagcdn.com/w40/%s.png", strings.ToLower(countryCode))
+}
+
+// Init replaces the resolver used by the package level lookups with one backed by
+// the database at path. On error the previous resolver is left in place.
+func Init(path string) error {
+	resolver, err := Open(path)
+	if err != nil {
+		return err
+	}
+	SetResolver(resolver)
+	return nil
+}
+
+func SetResolver(resolver Resolver) {
+	defaultMutex.Lock()
+	defaultResolver = resolver
+	defaultMutex.Unlock()
+}
+
+func Lookup(ip net.IP) Location {
+	defaultMutex.RLock()
+	resolver := defaultResolver
+	defaultMutex.RUnlock()
+	return resolver.Lookup(ip)
+}
+
+func LookupString(ip string) Location {
+	parsed := net.ParseIP(strings.TrimSpace(ip))
+	if parsed == nil {
+		return unknownLocation(ip)
+	}
+	return Lookup(parsed)
+}
+
+// LookupMultiaddr resolves the IPv4 or IPv6 component of a multiaddr.
+func LookupMultiaddr(addr string) (Location, error) {
+	mAddr, err := ma.NewMultiaddr(addr)
+	if err != nil {
+		return unknownLocation(""), errors.New("cannot convert multiaddress to IP")
+	}
+	ipStr, err := mAddr.ValueForProtocol(ma.P_IP4)
+	if err != nil {
+		ipStr, err = mAddr.ValueForProtocol(ma.P_IP6)
+		if err != nil {
+			return unknownLocation(""), nil
+		}
+	}
+	return LookupString(ipStr), nil
+}
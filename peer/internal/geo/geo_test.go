@@ -0,0 +1,40 @@
+package geo
+
+import (
+	"net"
+	"testing"
+)
+
+func TestMissingDatabaseFallsBackToUnknown(t *testing.T) {
+	resolver, err := Open("./does-not-exist.mmdb")
+	if err == nil {
+		t.Fatalf("Expected an error opening a missing database")
+	}
+	location := resolver.Lookup(net.ParseIP("8.8.8.8"))
+	if location.Country != Unknown || location.Ip != "8.8.8.8" {
+		t.Errorf("Expected unknown location for 8.8.8.8, got %+v", location)
+	}
+}
+
+func TestLookupMultiaddr(t *testing.T) {
+	SetResolver(&MMDBResolver{cache: make(map[string]Location)})
+	location, err := LookupMultiaddr("/ip4/127.0.0.1/tcp/4001")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if location.Ip != "127.0.0.1" || location.Country != Unknown {
+		t.Errorf("Expected unknown loopback location, got %+v", location)
+	}
+	if _, err := LookupMultiaddr("not a multiaddr"); err == nil {
+		t.Errorf("Expected an error for an invalid multiaddr")
+	}
+}
+
+func TestFlagUrl(t *testing.T) {
+	if url := FlagUrl("US"); url != "https://flagcdn.com/w40/us.png" {
+		t.Errorf("Unexpected flag url %s", url)
+	}
+	if url := FlagUrl(Unknown); url != "" {
+		t.Errorf("Expected no flag for unknown country, got %s", url)
+	}
+}
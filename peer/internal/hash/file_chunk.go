@@ -5,8 +5,10 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
+	orcaDataDir "orca-peer/internal/datadir"
 	"orca-peer/internal/fileshare"
 	"os"
+	"path/filepath"
 	"strings"
 	"io/ioutil"
 	"errors"
@@ -42,11 +44,11 @@ func SaveChunkedFile(filePath string, fileName string) (string, fileshare.FileIn
 		hasher.Write(chunk[:bytesRead])
 		hash := hasher.Sum(nil)
 		hashedFiles.Hashes = append(hashedFiles.Hashes, hex.EncodeToString(hash))
-		err = ioutil.WriteFile("./files/stored/" + hex.EncodeToString(hash), chunk, 0777)
+		err = ioutil.WriteFile(filepath.Join(orcaDataDir.StoredDir(), hex.EncodeToString(hash)), chunk, 0777)
 		if err != nil {
 			//clean up any written hashes
 			for _, chunkHash := range hashedFiles.Hashes {
-				err = os.Remove("./files/stored/" + chunkHash)
+				err = os.Remove(filepath.Join(orcaDataDir.StoredDir(), chunkHash))
 				if err != nil {
 					return "", fileshare.FileInfo{}, errors.New(fmt.Sprintf("Failed to clean up removing partial chunks for error: %s", err))
 				}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	orcaDataDir "orca-peer/internal/datadir"
 	"os"
 	"path/filepath"
 )
@@ -62,7 +63,7 @@ func NewDataStore(path string) *DataStore {
 }
 
 func HashFile(address string) (string, error) {
-	f, err := os.Open("./files/" + address)
+	f, err := os.Open(filepath.Join(orcaDataDir.FilesDir(), address))
 	if err != nil {
 		return "", err
 	}
@@ -10,7 +10,9 @@ import (
 	"encoding/pem"
 	"errors"
 	"fmt"
+	orcaDataDir "orca-peer/internal/datadir"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/google/uuid"
@@ -136,7 +138,7 @@ func LoadInKeys() (*rsa.PublicKey, *rsa.PrivateKey) {
 		fmt.Println("Error reading file:", err)
 		os.Exit(1)
 	}
-	folderName := "./config"
+	folderName := orcaDataDir.ConfigDir()
 	if _, err := os.Stat(folderName); os.IsNotExist(err) {
 		// Folder does not exist, create it
 		err := os.Mkdir(folderName, 0755) // 0755 is the permission mode for the folder
@@ -144,16 +146,16 @@ func LoadInKeys() (*rsa.PublicKey, *rsa.PrivateKey) {
 			fmt.Println("Error creating folder:", err)
 		}
 	}
-	_, err1 := os.Stat("./config/key.pub")
-	_, err2 := os.Stat("./config/key.priv")
+	_, err1 := os.Stat(filepath.Join(orcaDataDir.ConfigDir(), "key.pub"))
+	_, err2 := os.Stat(filepath.Join(orcaDataDir.ConfigDir(), "key.priv"))
 	if err1 == nil && err2 == nil {
 		fmt.Printf("Loading in public/private key locally...\n")
-		privateKeyContent, err := os.ReadFile("./config/key.priv")
+		privateKeyContent, err := os.ReadFile(filepath.Join(orcaDataDir.ConfigDir(), "key.priv"))
 		if err != nil {
 			fmt.Println("Error loading in key file:", err)
 			os.Exit(1)
 		}
-		publicKeyContent, err := os.ReadFile("./config/key.pub")
+		publicKeyContent, err := os.ReadFile(filepath.Join(orcaDataDir.ConfigDir(), "key.pub"))
 		if err != nil {
 			fmt.Println("Error loading in key file:", err)
 			os.Exit(1)
@@ -182,14 +184,14 @@ func LoadInKeys() (*rsa.PublicKey, *rsa.PrivateKey) {
 			fmt.Println("Error generating public key as PEM str:", err)
 			os.Exit(1)
 		}
-		os.WriteFile("./config/key.pub", pubBytes, 0644)
+		os.WriteFile(filepath.Join(orcaDataDir.ConfigDir(), "key.pub"), pubBytes, 0644)
 
 		privBytes := ExportRsaPrivateKeyAsPemStr(privateKey)
 		if err != nil {
 			fmt.Println("Error generating public key as PEM str:", err)
 			os.Exit(1)
 		}
-		os.WriteFile("./config/key.priv", privBytes, 0644)
+		os.WriteFile(filepath.Join(orcaDataDir.ConfigDir(), "key.priv"), privBytes, 0644)
 	}
 
 	// Sign file
@@ -1,9 +1,15 @@
 package jobs
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	orcaRouter "orca-peer/internal/router"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -17,6 +23,23 @@ type Job struct {
 	ProjectedCost   int    `json:"projectedCost"`
 	ETA             int    `json:"eta"`
 	PeerId          string `json:"peer"`
+	// Jobs with a higher priority are started first
+	Priority int `json:"priority"`
+	// Downloads started so far, including the running one
+	Attempts int `json:"attempts"`
+	// When a retrying job is queued again
+	RetryAt string `json:"retryAt,omitempty"`
+	// Why the last attempt failed
+	Error string `json:"error,omitempty"`
+	// Chunks and bytes written to the file, a resumed job continues from here
+	ChunksReceived int   `json:"chunksReceived"`
+	BytesReceived  int64 `json:"bytesReceived"`
+	// Size of the file, 0 until a holder told us
+	FileSize int64 `json:"fileSize"`
+	// Most the job may spend, 0 for no limit other than the budget of the node
+	MaxCost int `json:"maxCost"`
+	// Spending the user approved past every limit
+	ApprovedCost int `json:"approvedCost,omitempty"`
 }
 
 type JobManager struct {
@@ -26,56 +49,84 @@ type JobManager struct {
 }
 
 type FileChunkRequest struct {
-	FileHash        string `json:"fileHash"`
-	ChunkIndex           int `json:"chunkIndex"`
-	JobId 				string `json:"jobId"`
+	FileHash   string `json:"fileHash"`
+	ChunkIndex int    `json:"chunkIndex"`
+	JobId      string `json:"jobId"`
+	// Asks for the size and number of chunks of the file instead of a chunk
+	Info bool `json:"info,omitempty"`
 }
 
 type FileChunk struct {
-	FileHash        string `json:"fileHash"`
-	ChunkIndex           int `json:"chunkIndex"`
-	MaxChunk           int `json:"maxChunk"`
-	JobId              string `json:"jobId"`
-	Data               []byte `json:"data"`
+	FileHash   string `json:"fileHash"`
+	ChunkIndex int    `json:"chunkIndex"`
+	MaxChunk   int    `json:"maxChunk"`
+	JobId      string `json:"jobId"`
+	Data       []byte `json:"data"`
+	// Set in the answer to an info request
+	FileSize int64 `json:"fileSize,omitempty"`
+	// Price per MiB the holder asks from the requesting peer, set in the answer
+	// to an info request
+	Price *int64 `json:"price,omitempty"`
 }
 
 var Manager JobManager
 
-func InitPeriodicJobSave() {
-	Manager = JobManager{
-		Jobs:    make([]Job, 0), // Initialize an empty slice of jobs
-		Mutex:   sync.Mutex{},   // Initialize a mutex
-		Changed: false,
-	}
+// Asks the periodic save to write the jobs now, e.g. after a status change.
+var saveSoon = make(chan struct{}, 1)
+
+// InitPeriodicJobSave saves the jobs to the job database every 10 seconds if
+// they changed, and right away when a job changes status, until ctx is cancelled.
+func InitPeriodicJobSave(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
 	for {
-		time.Sleep(10 * time.Second)
-		Manager.Mutex.Lock()
-		if Manager.Changed {
-			SaveHistory(Manager.Jobs)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-saveSoon:
+		}
+		if err := Flush(); err != nil {
+			fmt.Println("Error saving jobs:", err)
 		}
-		Manager.Mutex.Unlock()
 	}
 }
+
+func requestSave() {
+	select {
+	case saveSoon <- struct{}{}:
+	default:
+	}
+}
+
+// Flush writes the jobs to the job database if they changed since the last save.
+func Flush() error {
+	s := currentStore()
+	if s == nil {
+		return nil
+	}
+	Manager.Mutex.Lock()
+	defer Manager.Mutex.Unlock()
+	if !Manager.Changed {
+		return nil
+	}
+	if err := s.Put(Manager.Jobs...); err != nil {
+		return err
+	}
+	Manager.Changed = false
+	return nil
+}
 func UpdateJobStatus(jobId string, status string) error {
 	Manager.Mutex.Lock()
 	for idx, job := range Manager.Jobs {
 		if job.JobId == jobId {
-			Manager.Jobs[idx].Status = status
-			Manager.Changed = true
+			setStatus(idx, status)
 			break
 		}
 	}
 	Manager.Mutex.Unlock()
 	return nil
 }
-func GetJobStatus(jobId string) string {
-	for _, job := range Manager.Jobs {
-		if job.JobId == jobId {
-			return job.Status
-		}
-	}
-	return ""
-}
 func UpdateJobCost(jobId string, additionalCost int) error {
 	Manager.Mutex.Lock()
 	for idx, job := range Manager.Jobs {
@@ -102,7 +153,7 @@ func writeStatusUpdate(w http.ResponseWriter, message string) {
 }
 
 type RmFromHistoryReqPayload struct {
-	JobId string `json:"jobID"`
+	JobId string `json:"jobID" validate:"required"`
 }
 
 func RemoveFromHistoryHandler(w http.ResponseWriter, r *http.Request) {
@@ -132,7 +183,11 @@ func RemoveFromHistoryHandler(w http.ResponseWriter, r *http.Request) {
 
 func ClearHistoryHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPatch {
-		ClearHistory()
+		if err := ClearHistory(); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			writeStatusUpdate(w, err.Error())
+			return
+		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 	} else {
@@ -143,16 +198,18 @@ func ClearHistoryHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 type JobInfoReqPayload struct {
-	JobId string `json:"jobID"`
+	JobId string `json:"jobID" validate:"required"`
 }
 
 func JobInfoHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
-		queryParams := r.URL.Query()
-		jobId := queryParams.Get("jobID")
+		jobId := orcaRouter.PathValue(r, "jobID")
+		if jobId == "" {
+			jobId = r.URL.Query().Get("jobID")
+		}
 		job, err := FindJob(jobId)
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
+			w.WriteHeader(http.StatusNotFound)
 			writeStatusUpdate(w, err.Error())
 			return
 		}
@@ -186,10 +243,11 @@ func StartJobsHandler(w http.ResponseWriter, r *http.Request) {
 			if err != nil {
 				w.WriteHeader(http.StatusBadRequest)
 				writeStatusUpdate(w, err.Error())
+				return
 			}
 		}
 		w.WriteHeader(http.StatusOK)
-		writeStatusUpdate(w, "Successfully added job.")
+		writeStatusUpdate(w, "Successfully started jobs.")
 	} else {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		writeStatusUpdate(w, "Only PATCH requests will be handled.")
@@ -210,10 +268,11 @@ func PauseJobsHandler(w http.ResponseWriter, r *http.Request) {
 			if err != nil {
 				w.WriteHeader(http.StatusBadRequest)
 				writeStatusUpdate(w, err.Error())
+				return
 			}
 		}
 		w.WriteHeader(http.StatusOK)
-		writeStatusUpdate(w, "Successfully added job.")
+		writeStatusUpdate(w, "Successfully paused jobs.")
 	} else {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		writeStatusUpdate(w, "Only PATCH requests will be handled.")
@@ -234,16 +293,110 @@ func TerminateJobsHandler(w http.ResponseWriter, r *http.Request) {
 			if err != nil {
 				w.WriteHeader(http.StatusBadRequest)
 				writeStatusUpdate(w, err.Error())
+				return
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+		writeStatusUpdate(w, "Successfully terminated jobs.")
+	} else {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		writeStatusUpdate(w, "Only PATCH requests will be handled.")
+		return
+	}
+}
+
+type JobPriorityReqPayload struct {
+	JobId    string `json:"jobID" validate:"required"`
+	Priority int    `json:"priority"`
+}
+
+func PrioritizeJobsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPatch {
+		var priorities []JobPriorityReqPayload
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&priorities); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			writeStatusUpdate(w, "Cannot marshal payload in Go object. Does the payload have the correct body structure?")
+			return
+		}
+		for _, priority := range priorities {
+			err := Default.SetPriority(priority.JobId, priority.Priority)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				writeStatusUpdate(w, err.Error())
+				return
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+		writeStatusUpdate(w, "Successfully changed job priorities.")
+	} else {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		writeStatusUpdate(w, "Only PATCH requests will be handled.")
+	}
+}
+
+type JobApprovalReqPayload struct {
+	JobId string `json:"jobID" validate:"required"`
+	// Total the job may spend, defaults to its projected cost
+	MaxCost int `json:"maxCost"`
+}
+
+func ApproveJobsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPatch {
+		var approvals []JobApprovalReqPayload
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&approvals); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			writeStatusUpdate(w, "Cannot marshal payload in Go object. Does the payload have the correct body structure?")
+			return
+		}
+		for _, approval := range approvals {
+			err := Default.Approve(approval.JobId, approval.MaxCost)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				writeStatusUpdate(w, err.Error())
+				return
 			}
 		}
 		w.WriteHeader(http.StatusOK)
-		writeStatusUpdate(w, "Successfully added job.")
+		writeStatusUpdate(w, "Successfully approved jobs.")
 	} else {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		writeStatusUpdate(w, "Only PATCH requests will be handled.")
+	}
+}
+
+func BudgetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut {
+		var payload Budget
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&payload); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			writeStatusUpdate(w, "Cannot marshal payload in Go object. Does the payload have the correct body structure?")
+			return
+		}
+		if payload.Daily < 0 || payload.Monthly < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			writeStatusUpdate(w, "Budgets cannot be negative.")
+			return
+		}
+		SetBudget(payload)
+	} else if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		writeStatusUpdate(w, "Only GET and PUT requests will be handled.")
 		return
 	}
+	jsonData, err := json.Marshal(GetBudget())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		writeStatusUpdate(w, "Failed to convert JSON Data into a string")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
 }
+
 func JobListHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
 		currentJobs := Manager.Jobs
@@ -263,12 +416,26 @@ func JobListHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+/*
+ * Lists saved jobs, newest first. All query parameters are optional:
+ *   status: comma separated statuses
+ *   fileHash: only jobs downloading this file
+ *   since, until: only jobs queued in this range, RFC 3339 times or dates, until is exclusive
+ *   offset, limit: pagination, the total number of matches is sent in X-Total-Count
+ */
 func GetHistoryHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
-		histories, err := LoadHistory()
+		filter, err := parseHistoryFilter(r.URL.Query())
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			writeStatusUpdate(w, err.Error())
+			return
+		}
+		histories, total, err := LoadHistory(filter)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			writeStatusUpdate(w, "Unable to read all histories")
+			return
 		}
 		jsonData, err := json.Marshal(histories)
 		if err != nil {
@@ -277,6 +444,7 @@ func GetHistoryHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
 		w.WriteHeader(http.StatusOK)
 		w.Write(jsonData)
 	} else {
@@ -286,13 +454,186 @@ func GetHistoryHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func InitJobRoutes() {
-	http.HandleFunc("/terminate-jobs", TerminateJobsHandler)
-	http.HandleFunc("/pause-jobs", PauseJobsHandler)
-	http.HandleFunc("/job-info", JobInfoHandler)
-	http.HandleFunc("/start-jobs", StartJobsHandler)
-	http.HandleFunc("/remove-from-history", RemoveFromHistoryHandler)
-	http.HandleFunc("/clear-history", ClearHistoryHandler)
-	http.HandleFunc("/get-history", GetHistoryHandler)
-	http.HandleFunc("/job-list", JobListHandler)
+func parseHistoryFilter(query url.Values) (HistoryFilter, error) {
+	filter := HistoryFilter{FileHash: query.Get("fileHash")}
+	if value := query.Get("status"); value != "" {
+		filter.Statuses = strings.Split(value, ",")
+	}
+	var err error
+	if value := query.Get("since"); value != "" {
+		if filter.Since, _, err = parseHistoryTime(value); err != nil {
+			return filter, errors.New("since must be an RFC 3339 time or a date.")
+		}
+	}
+	if value := query.Get("until"); value != "" {
+		var date bool
+		if filter.Until, date, err = parseHistoryTime(value); err != nil {
+			return filter, errors.New("until must be an RFC 3339 time or a date.")
+		}
+		if date {
+			// Include the whole day
+			filter.Until = filter.Until.AddDate(0, 0, 1)
+		}
+	}
+	if value := query.Get("offset"); value != "" {
+		if filter.Offset, err = strconv.Atoi(value); err != nil || filter.Offset < 0 {
+			return filter, errors.New("offset must be a positive integer.")
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		if filter.Limit, err = strconv.Atoi(value); err != nil || filter.Limit < 0 {
+			return filter, errors.New("limit must be a positive integer.")
+		}
+	}
+	return filter, nil
+}
+
+// Parse an RFC 3339 time or a date in local time, reporting which one it was.
+func parseHistoryTime(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	return t, true, err
+}
+
+// Routes returns the HTTP routes that manage download jobs.
+func Routes() []orcaRouter.Route {
+	return []orcaRouter.Route{
+		{
+			Method:   http.MethodGet,
+			Path:     "/jobs",
+			Legacy:   "/job-list",
+			Scope:    orcaRouter.ScopeRead,
+			Tag:      "jobs",
+			Summary:  "List the jobs of this session",
+			Response: []Job{},
+			Handler:  JobListHandler,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/jobs/{jobID}",
+			Scope:    orcaRouter.ScopeRead,
+			Tag:      "jobs",
+			Summary:  "Get a job",
+			Response: Job{},
+			Handler:  JobInfoHandler,
+		},
+		{
+			Method:  http.MethodGet,
+			Legacy:  "/job-info",
+			Scope:   orcaRouter.ScopeRead,
+			Handler: JobInfoHandler,
+		},
+		{
+			Method:  http.MethodPatch,
+			Path:    "/jobs/start",
+			Legacy:  "/start-jobs",
+			Scope:   orcaRouter.ScopeWallet,
+			Tag:     "jobs",
+			Summary: "Queue paused, failed or terminated jobs again",
+			Body:    []JobInfoReqPayload{},
+			Handler: StartJobsHandler,
+		},
+		{
+			Method:  http.MethodPatch,
+			Path:    "/jobs/pause",
+			Legacy:  "/pause-jobs",
+			Scope:   orcaRouter.ScopeFiles,
+			Tag:     "jobs",
+			Summary: "Pause jobs",
+			Body:    []JobInfoReqPayload{},
+			Handler: PauseJobsHandler,
+		},
+		{
+			Method:  http.MethodPatch,
+			Path:    "/jobs/terminate",
+			Legacy:  "/terminate-jobs",
+			Scope:   orcaRouter.ScopeFiles,
+			Tag:     "jobs",
+			Summary: "Terminate jobs",
+			Body:    []JobInfoReqPayload{},
+			Handler: TerminateJobsHandler,
+		},
+		{
+			Method:  http.MethodPatch,
+			Path:    "/jobs/priority",
+			Scope:   orcaRouter.ScopeFiles,
+			Tag:     "jobs",
+			Summary: "Change the priority of jobs",
+			Description: "Queued jobs with a higher priority are started first, " +
+				"jobs of equal priority in the order they were queued.",
+			Body:    []JobPriorityReqPayload{},
+			Handler: PrioritizeJobsHandler,
+		},
+		{
+			Method:  http.MethodPatch,
+			Path:    "/jobs/approve",
+			Scope:   orcaRouter.ScopeWallet,
+			Tag:     "jobs",
+			Summary: "Approve jobs waiting for approval",
+			Description: "Lets a job that stopped before exceeding its maxCost or the budget of the node spend up to maxCost in total, " +
+				"its projected cost when maxCost is not given.",
+			Body:    []JobApprovalReqPayload{},
+			Handler: ApproveJobsHandler,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/jobs/budget",
+			Scope:    orcaRouter.ScopeRead,
+			Tag:      "jobs",
+			Summary:  "Get the download budget and what was spent",
+			Response: BudgetStatus{},
+			Handler:  BudgetHandler,
+		},
+		{
+			Method:   http.MethodPut,
+			Path:     "/jobs/budget",
+			Scope:    orcaRouter.ScopeWallet,
+			Tag:      "jobs",
+			Summary:  "Change the daily and monthly download budget",
+			Body:     Budget{},
+			Response: BudgetStatus{},
+			Handler:  BudgetHandler,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/jobs/history",
+			Legacy:  "/get-history",
+			Scope:   orcaRouter.ScopeRead,
+			Tag:     "jobs",
+			Summary: "List the saved job history",
+			Description: "Jobs of earlier runs included, newest first. " +
+				"The total number of matches is sent in X-Total-Count.",
+			Query: []orcaRouter.Param{
+				{Name: "status", Description: "Comma separated job statuses"},
+				{Name: "fileHash", Description: "Only jobs downloading this file"},
+				{Name: "since", Description: "Only jobs queued at or after this RFC 3339 time or date"},
+				{Name: "until", Description: "Only jobs queued before this RFC 3339 time, or on or before this date"},
+				{Name: "offset", Type: "integer"},
+				{Name: "limit", Type: "integer"},
+			},
+			Response: []Job{},
+			Handler:  GetHistoryHandler,
+		},
+		{
+			Method:  http.MethodPatch,
+			Path:    "/jobs/history/remove",
+			Legacy:  "/remove-from-history",
+			Scope:   orcaRouter.ScopeFiles,
+			Tag:     "jobs",
+			Summary: "Remove a job from the history",
+			Body:    RmFromHistoryReqPayload{},
+			Handler: RemoveFromHistoryHandler,
+		},
+		{
+			Method:  http.MethodPatch,
+			Path:    "/jobs/history/clear",
+			Legacy:  "/clear-history",
+			Scope:   orcaRouter.ScopeFiles,
+			Tag:     "jobs",
+			Summary: "Remove completed jobs from the history",
+			Handler: ClearHistoryHandler,
+		},
+	}
 }
@@ -0,0 +1,232 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Prices are per MiB of file data.
+const MiB = 1024 * 1024
+
+// StatusApproval is the status of a job that stopped before a payment that
+// would exceed its maximum spend or the budget of the node.
+const StatusApproval = "awaiting-approval"
+
+var spendingBucket = []byte("spending")
+
+/*
+ * Every payment for a chunk is authorized before it is sent. Authorize reserves
+ * the amount against the limits of the job and the daily and monthly budget of
+ * the node under one lock, so jobs downloading in parallel cannot overspend
+ * together. Spending is recorded per day in the job database.
+ */
+type Budget struct {
+	// Coins the node may spend on downloads per day and per calendar month,
+	// 0 for unlimited.
+	Daily   int `json:"daily"`
+	Monthly int `json:"monthly"`
+}
+
+type BudgetStatus struct {
+	Budget
+	SpentToday     int `json:"spentToday"`
+	SpentThisMonth int `json:"spentThisMonth"`
+}
+
+// ApprovalError is returned when a payment needs the user's approval. The
+// scheduler parks the job as StatusApproval instead of retrying it.
+type ApprovalError struct {
+	JobId  string
+	Reason string
+}
+
+func (e *ApprovalError) Error() string {
+	return "approval needed: " + e.Reason
+}
+
+var (
+	budgetMutex sync.Mutex
+	budget      Budget
+	// Coins spent per day, keyed by date
+	spending = make(map[string]int)
+	now      = time.Now
+)
+
+// ChunkCost returns what bytes of file data cost at price per MiB, counting
+// every started MiB.
+func ChunkCost(price int, bytes int64) int {
+	if price <= 0 || bytes <= 0 {
+		return 0
+	}
+	return price * int((bytes+MiB-1)/MiB)
+}
+
+func SetBudget(b Budget) {
+	budgetMutex.Lock()
+	budget = b
+	budgetMutex.Unlock()
+}
+
+func GetBudget() BudgetStatus {
+	budgetMutex.Lock()
+	defer budgetMutex.Unlock()
+	today, month := spentToday(), spentThisMonth()
+	return BudgetStatus{Budget: budget, SpentToday: today, SpentThisMonth: month}
+}
+
+// budgetMutex must be held by the following functions.
+
+func spentToday() int {
+	return spending[now().Format(time.DateOnly)]
+}
+
+func spentThisMonth() int {
+	month := now().Format("2006-01")
+	total := 0
+	for day, spent := range spending {
+		if strings.HasPrefix(day, month) {
+			total += spent
+		}
+	}
+	return total
+}
+
+// Check whether job may spend cost more. Node budgets apply to downloads
+// without a job as well.
+func checkSpend(job *Job, cost int) error {
+	jobId := ""
+	total := cost
+	if job != nil {
+		jobId = job.JobId
+		total += job.AccumulatedCost
+		if job.ApprovedCost > 0 {
+			// Approved spending is allowed past every limit
+			if total <= job.ApprovedCost {
+				return nil
+			}
+			return &ApprovalError{jobId, fmt.Sprintf("the job would cost %d, %d were approved", total, job.ApprovedCost)}
+		}
+		if job.MaxCost > 0 && total > job.MaxCost {
+			return &ApprovalError{jobId, fmt.Sprintf("the job would cost %d, more than its maximum of %d", total, job.MaxCost)}
+		}
+	}
+	if budget.Daily > 0 && spentToday()+cost > budget.Daily {
+		return &ApprovalError{jobId, fmt.Sprintf("spending %d more would exceed the daily budget of %d", cost, budget.Daily)}
+	}
+	if budget.Monthly > 0 && spentThisMonth()+cost > budget.Monthly {
+		return &ApprovalError{jobId, fmt.Sprintf("spending %d more would exceed the monthly budget of %d", cost, budget.Monthly)}
+	}
+	return nil
+}
+
+// PlanCost records the size of the file of a job and its projected cost at price
+// per MiB, and checks that the rest of the download fits the limits before
+// anything is paid.
+func PlanCost(jobId string, fileSize int64, price int) error {
+	var job Job
+	err := updateJob(jobId, func(j *Job) error {
+		j.FileSize = fileSize
+		j.ProjectedCost = j.AccumulatedCost + ChunkCost(price, fileSize-j.BytesReceived)
+		job = *j
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	budgetMutex.Lock()
+	defer budgetMutex.Unlock()
+	return checkSpend(&job, job.ProjectedCost-job.AccumulatedCost)
+}
+
+// Authorize reserves cost for the next payment of a job, or of a download
+// without a job if jobId is empty. Call Release if the payment is not sent.
+func Authorize(jobId string, cost int) error {
+	budgetMutex.Lock()
+	defer budgetMutex.Unlock()
+	var job *Job
+	if jobId != "" {
+		if j, err := FindJob(jobId); err == nil {
+			job = &j
+		}
+	}
+	if err := checkSpend(job, cost); err != nil {
+		return err
+	}
+	return addSpending(cost)
+}
+
+// Release gives back a reservation whose payment failed.
+func Release(cost int) {
+	budgetMutex.Lock()
+	defer budgetMutex.Unlock()
+	if err := addSpending(-cost); err != nil {
+		fmt.Println("Error saving spending:", err)
+	}
+}
+
+func addSpending(cost int) error {
+	day := now().Format(time.DateOnly)
+	spending[day] += cost
+	s := currentStore()
+	if s == nil {
+		return nil
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(spendingBucket).Put([]byte(day), []byte(strconv.Itoa(spending[day])))
+	})
+}
+
+// Read the spending recorded in s. budgetMutex must not be held.
+func loadSpending(s *Store) error {
+	loaded := make(map[string]int)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(spendingBucket).ForEach(func(day []byte, value []byte) error {
+			spent, err := strconv.Atoi(string(value))
+			if err != nil {
+				return err
+			}
+			loaded[string(day)] = spent
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	budgetMutex.Lock()
+	spending = loaded
+	budgetMutex.Unlock()
+	return nil
+}
+
+// Approve lets a job that waits for approval continue and spend up to maxCost
+// in total, regardless of its own limit and the budget of the node. A maxCost of
+// 0 approves the projected cost of the job.
+func (s *Scheduler) Approve(jobId string, maxCost int) error {
+	s.mutex.Lock()
+	defer s.dispatch()
+	defer s.mutex.Unlock()
+	return updateJob(jobId, func(job *Job) error {
+		if maxCost <= 0 {
+			maxCost = job.ProjectedCost
+		}
+		if maxCost <= 0 {
+			return errors.New("the cost of job " + jobId + " is not known yet, approve a maxCost")
+		}
+		if maxCost < job.AccumulatedCost {
+			return fmt.Errorf("job %s has already spent %d", jobId, job.AccumulatedCost)
+		}
+		job.ApprovedCost = maxCost
+		if job.Status == StatusApproval {
+			job.Error = ""
+			s.queue(jobId)
+			setJobStatus(job, StatusQueued)
+		}
+		return nil
+	})
+}
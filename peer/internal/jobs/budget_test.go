@@ -0,0 +1,145 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func resetBudget(t *testing.T, b Budget) {
+	SetBudget(b)
+	budgetMutex.Lock()
+	spending = make(map[string]int)
+	budgetMutex.Unlock()
+	t.Cleanup(func() {
+		SetBudget(Budget{})
+		budgetMutex.Lock()
+		spending = make(map[string]int)
+		now = time.Now
+		budgetMutex.Unlock()
+	})
+}
+
+func TestChunkCost(t *testing.T) {
+	for _, test := range []struct {
+		price int
+		bytes int64
+		want  int
+	}{
+		{3, 0, 0},
+		{3, 1, 3},
+		{3, MiB, 3},
+		{3, MiB + 1, 6},
+		{3, 4 * MiB, 12},
+		{0, 4 * MiB, 0},
+	} {
+		if got := ChunkCost(test.price, test.bytes); got != test.want {
+			t.Errorf("%d bytes at %d per MiB cost %d, want %d", test.bytes, test.price, got, test.want)
+		}
+	}
+}
+
+func TestAuthorizeJobLimit(t *testing.T) {
+	Manager = JobManager{Jobs: make([]Job, 0)}
+	resetBudget(t, Budget{})
+	AddJob(Job{JobId: "job", MaxCost: 10})
+
+	if err := PlanCost("job", 5*MiB, 3); !errors.As(err, new(*ApprovalError)) {
+		t.Fatalf("planning 15 coins against a maximum of 10 returned %v", err)
+	}
+	if job, _ := FindJob("job"); job.FileSize != 5*MiB || job.ProjectedCost != 15 {
+		t.Fatalf("planned job has size %d and projected cost %d", job.FileSize, job.ProjectedCost)
+	}
+
+	if err := Authorize("job", 6); err != nil {
+		t.Fatal(err)
+	}
+	UpdateJobCost("job", 6)
+	if err := Authorize("job", 6); !errors.As(err, new(*ApprovalError)) {
+		t.Fatalf("spending 12 of 10 returned %v", err)
+	}
+	if spent := GetBudget().SpentToday; spent != 6 {
+		t.Fatalf("a refused payment was recorded, spent %d", spent)
+	}
+
+	// Approval lifts the limit up to the approved amount
+	if err := Default.Approve("job", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := Authorize("job", 9); err != nil {
+		t.Fatal(err)
+	}
+	Release(9)
+	if err := Authorize("job", 10); err == nil {
+		t.Fatal("payment past the approved cost was authorized")
+	}
+	if spent := GetBudget().SpentToday; spent != 6 {
+		t.Fatalf("released payment is still counted, spent %d", spent)
+	}
+}
+
+func TestAuthorizeBudget(t *testing.T) {
+	Manager = JobManager{Jobs: make([]Job, 0)}
+	resetBudget(t, Budget{Daily: 10, Monthly: 15})
+	day := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return day }
+
+	if err := Authorize("", 8); err != nil {
+		t.Fatal(err)
+	}
+	if err := Authorize("", 3); !errors.As(err, new(*ApprovalError)) {
+		t.Fatalf("spending past the daily budget returned %v", err)
+	}
+
+	day = day.AddDate(0, 0, 1)
+	if err := Authorize("", 8); !errors.As(err, new(*ApprovalError)) {
+		t.Fatalf("spending past the monthly budget returned %v", err)
+	}
+	if err := Authorize("", 7); err != nil {
+		t.Fatal(err)
+	}
+	if status := GetBudget(); status.SpentToday != 7 || status.SpentThisMonth != 15 {
+		t.Fatalf("budget status %+v", status)
+	}
+
+	// A new month starts over
+	day = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if err := Authorize("", 10); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSchedulerWaitsForApproval(t *testing.T) {
+	Manager = JobManager{Jobs: make([]Job, 0)}
+	resetBudget(t, Budget{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := NewScheduler(SchedulerConfig{MaxActive: 1, MaxAttempts: 3, RetryDelay: time.Millisecond, MaxRetryDelay: time.Millisecond})
+	runs := make(chan struct{}, 2)
+	s.Start(ctx, func(ctx context.Context, job Job, failed []string) (string, error) {
+		runs <- struct{}{}
+		if err := PlanCost(job.JobId, MiB, 20); err != nil {
+			return "", err
+		}
+		return "holder", nil
+	}, nil)
+
+	s.Enqueue(Job{JobId: "job", MaxCost: 10})
+	<-runs
+	job := waitForStatus(t, "job", StatusApproval)
+	if job.Attempts != 1 || job.Error == "" {
+		t.Fatalf("job waiting for approval made %d attempts, error %q", job.Attempts, job.Error)
+	}
+	select {
+	case <-runs:
+		t.Fatal("job waiting for approval was retried")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if err := s.Approve("job", 0); err != nil {
+		t.Fatal(err)
+	}
+	<-runs
+	waitForStatus(t, "job", StatusFinished)
+}
@@ -1,9 +1,8 @@
 package jobs
 
 import (
-	"encoding/json"
 	"errors"
-	"os"
+	orcaEvents "orca-peer/internal/events"
 )
 
 func AddJob(job Job) {
@@ -11,100 +10,124 @@ func AddJob(job Job) {
 	Manager.Jobs = append(Manager.Jobs, job)
 	Manager.Changed = true
 	Manager.Mutex.Unlock()
+	publishStatus(job)
 }
 
-func LoadHistory() ([]Job, error) {
-	fileData, err := os.ReadFile("./internal/jobs/jobs.json")
-	if err != nil {
-		return nil, err
+// Set the status of the job at idx and report the change. Manager.Mutex must be held.
+func setStatus(idx int, status string) {
+	setJobStatus(&Manager.Jobs[idx], status)
+}
+
+func setJobStatus(job *Job, status string) {
+	if job.Status == status {
+		return
 	}
-	var jobs []Job
-	err = json.Unmarshal(fileData, &jobs)
-	if err != nil {
-		return nil, err
+	job.Status = status
+	Manager.Changed = true
+	requestSave()
+	publishStatus(*job)
+}
+
+// Call update with the job under Manager.Mutex.
+func updateJob(jobId string, update func(job *Job) error) error {
+	Manager.Mutex.Lock()
+	defer Manager.Mutex.Unlock()
+	for idx := range Manager.Jobs {
+		if Manager.Jobs[idx].JobId == jobId {
+			Manager.Changed = true
+			return update(&Manager.Jobs[idx])
+		}
 	}
-	return jobs, nil
+	return errors.New("Unable to find jobId: " + jobId)
 }
-func SaveHistory(jobs []Job) error {
-	Manager.Changed = false
-	jsonData, err := json.Marshal(jobs)
-	if err != nil {
-		return err
+
+func publishStatus(job Job) {
+	orcaEvents.Publish(orcaEvents.JobStatus, orcaEvents.JobStatusData{
+		JobID:    job.JobId,
+		FileHash: job.FileHash,
+		Status:   job.Status,
+	})
+}
+
+// LoadHistory returns the page of saved jobs matching filter, newest first,
+// together with the total number of matches.
+func LoadHistory(filter HistoryFilter) ([]Job, int, error) {
+	s := currentStore()
+	if s == nil {
+		return nil, 0, errors.New("job database is not open")
 	}
-	err = os.WriteFile("./internal/jobs/jobs.json", jsonData, 0644)
-	if err != nil {
-		return err
+	if err := Flush(); err != nil {
+		return nil, 0, err
 	}
-	return nil
+	return s.Query(filter)
 }
 
 func RemoveFromHistory(jobId string) error {
+	found := false
 	Manager.Mutex.Lock()
 	for idx, job := range Manager.Jobs {
 		if job.JobId == jobId {
 			Manager.Jobs = append(Manager.Jobs[:idx], Manager.Jobs[idx+1:]...)
-			Manager.Changed = true
-			Manager.Mutex.Unlock()
-			return nil
+			found = true
+			break
 		}
 	}
 	Manager.Mutex.Unlock()
-	return errors.New("unable to find job that matches jobID")
+	if s := currentStore(); s != nil {
+		_, saved, err := s.Get(jobId)
+		if err != nil {
+			return err
+		}
+		if saved {
+			found = true
+			if err := s.Delete(jobId); err != nil {
+				return err
+			}
+		}
+	}
+	if !found {
+		return errors.New("unable to find job that matches jobID")
+	}
+	return nil
 }
 
-func ClearHistory() {
+// ClearHistory removes every finished job.
+func ClearHistory() error {
 	Manager.Mutex.Lock()
 	newJobs := make([]Job, 0)
 	for _, job := range Manager.Jobs {
-		if job.Status != "completed" {
-			Manager.Changed = true
+		if job.Status != StatusFinished {
 			newJobs = append(newJobs, job)
 		}
 	}
 	Manager.Jobs = newJobs
 	Manager.Mutex.Unlock()
+	s := currentStore()
+	if s == nil {
+		return nil
+	}
+	finished, _, err := s.Query(HistoryFilter{Statuses: []string{StatusFinished}})
+	if err != nil {
+		return err
+	}
+	jobIds := make([]string, 0, len(finished))
+	for _, job := range finished {
+		jobIds = append(jobIds, job.JobId)
+	}
+	return s.Delete(jobIds...)
 }
 
 func TerminateJob(jobId string) error {
-	Manager.Mutex.Lock()
-	for idx, job := range Manager.Jobs {
-		if job.JobId == jobId {
-			Manager.Jobs[idx].Status = "terminated"
-			Manager.Changed = true
-			Manager.Mutex.Unlock()
-			return nil
-		}
-	}
-	Manager.Mutex.Unlock()
-	return errors.New("Unable to find jobId: " + jobId)
+	return Default.Terminate(jobId)
 }
 
 func PauseJob(jobId string) error {
-	Manager.Mutex.Lock()
-	for idx, job := range Manager.Jobs {
-		if job.JobId == jobId {
-			Manager.Jobs[idx].Status = "paused"
-			Manager.Changed = true
-			Manager.Mutex.Unlock()
-			return nil
-		}
-	}
-	Manager.Mutex.Unlock()
-	return errors.New("Unable to find jobId: " + jobId)
+	return Default.Pause(jobId)
 }
 
+// StartJob queues a paused, failed or terminated job again.
 func StartJob(jobId string) error {
-	Manager.Mutex.Lock()
-	for idx, job := range Manager.Jobs {
-		if job.JobId == jobId {
-			Manager.Jobs[idx].Status = "active"
-			Manager.Changed = true
-			Manager.Mutex.Unlock()
-			return nil
-		}
-	}
-	Manager.Mutex.Unlock()
-	return errors.New("Unable to find jobId: " + jobId)
+	return Default.Resume(jobId)
 }
 
 func FindJob(jobId string) (Job, error) {
@@ -0,0 +1,104 @@
+package jobs
+
+import (
+	"math"
+	orcaEvents "orca-peer/internal/events"
+	"sync"
+	"time"
+)
+
+// Weight of the newest chunk in the moving average of a job's throughput.
+const throughputSmoothing = 0.3
+
+type progress struct {
+	chunks int
+	bytes  int64
+	// Bytes per second
+	rate float64
+}
+
+var (
+	progressMutex sync.Mutex
+	progressByJob = make(map[string]*progress)
+)
+
+// RecordChunk updates the ETA and projected cost of a job after it received
+// chunk index chunk of chunks, and publishes its progress. elapsed is how long
+// the chunk took to request, pay for and receive, price is what a MiB costs
+// from this peer.
+func RecordChunk(jobId string, peerId string, chunk int, chunks int, bytes int, elapsed time.Duration, price int) {
+	if jobId == "" {
+		return
+	}
+	progressMutex.Lock()
+	p, ok := progressByJob[jobId]
+	if !ok || chunk == 0 {
+		// The throughput of a resumed job is measured anew
+		p = &progress{}
+		progressByJob[jobId] = p
+	}
+	p.chunks++
+	p.bytes += int64(bytes)
+	if elapsed > 0 {
+		sample := float64(bytes) / elapsed.Seconds()
+		if p.rate == 0 {
+			p.rate = sample
+		} else {
+			p.rate = throughputSmoothing*sample + (1-throughputSmoothing)*p.rate
+		}
+	}
+	remaining := chunks - chunk - 1
+	if remaining < 0 {
+		remaining = 0
+	}
+	eta := -1
+	if remaining == 0 {
+		eta = 0
+	} else if p.rate > 0 {
+		averageChunk := float64(p.bytes) / float64(p.chunks)
+		eta = int(math.Ceil(float64(remaining) * averageChunk / p.rate))
+	}
+	rate := p.rate
+	if remaining == 0 {
+		delete(progressByJob, jobId)
+	}
+	progressMutex.Unlock()
+
+	Manager.Mutex.Lock()
+	var job Job
+	for idx := range Manager.Jobs {
+		if Manager.Jobs[idx].JobId == jobId {
+			if chunk == 0 {
+				Manager.Jobs[idx].BytesReceived = 0
+			}
+			Manager.Jobs[idx].ChunksReceived = chunk + 1
+			Manager.Jobs[idx].BytesReceived += int64(bytes)
+			Manager.Jobs[idx].ETA = eta
+			remainingCost := remaining * ChunkCost(price, int64(bytes))
+			if size := Manager.Jobs[idx].FileSize; size > 0 {
+				remainingCost = ChunkCost(price, size-Manager.Jobs[idx].BytesReceived)
+			}
+			Manager.Jobs[idx].ProjectedCost = Manager.Jobs[idx].AccumulatedCost + remainingCost
+			Manager.Changed = true
+			job = Manager.Jobs[idx]
+			break
+		}
+	}
+	Manager.Mutex.Unlock()
+	if job.JobId == "" {
+		return
+	}
+
+	orcaEvents.Publish(orcaEvents.JobProgress, orcaEvents.JobProgressData{
+		JobID:           jobId,
+		FileHash:        job.FileHash,
+		PeerID:          peerId,
+		Chunk:           chunk,
+		Chunks:          chunks,
+		Bytes:           job.BytesReceived,
+		Throughput:      rate,
+		ETA:             eta,
+		AccumulatedCost: job.AccumulatedCost,
+		ProjectedCost:   job.ProjectedCost,
+	})
+}
@@ -0,0 +1,46 @@
+package jobs
+
+import (
+	orcaEvents "orca-peer/internal/events"
+	"testing"
+	"time"
+)
+
+func TestRecordChunk(t *testing.T) {
+	Manager = JobManager{Jobs: make([]Job, 0)}
+	AddJob(Job{JobId: "job", FileHash: "hash", Status: "active", ETA: -1, ProjectedCost: -1})
+	sub := orcaEvents.Subscribe(0, orcaEvents.JobProgress)
+	defer sub.Close()
+
+	// 1000 bytes a second, 4 chunks
+	UpdateJobCost("job", 5)
+	RecordChunk("job", "QmPeer", 0, 4, 1000, time.Second, 5)
+	job, _ := FindJob("job")
+	if job.ETA != 3 || job.ProjectedCost != 20 {
+		t.Fatalf("after the first chunk ETA = %d, projected cost = %d", job.ETA, job.ProjectedCost)
+	}
+	e := (<-sub.C).Data.(orcaEvents.JobProgressData)
+	if e.Throughput != 1000 || e.Chunk != 0 || e.Chunks != 4 || e.PeerID != "QmPeer" || e.FileHash != "hash" {
+		t.Fatalf("unexpected progress event %+v", e)
+	}
+
+	// Slower chunks push the ETA out
+	UpdateJobCost("job", 5)
+	RecordChunk("job", "QmPeer", 1, 4, 1000, 4*time.Second, 5)
+	job, _ = FindJob("job")
+	if job.ETA <= 2 || job.ProjectedCost != 20 {
+		t.Fatalf("after a slow chunk ETA = %d, projected cost = %d", job.ETA, job.ProjectedCost)
+	}
+
+	UpdateJobCost("job", 5)
+	RecordChunk("job", "QmPeer", 2, 4, 1000, time.Second, 5)
+	UpdateJobCost("job", 5)
+	RecordChunk("job", "QmPeer", 3, 4, 1000, time.Second, 5)
+	job, _ = FindJob("job")
+	if job.ETA != 0 || job.ProjectedCost != 20 {
+		t.Fatalf("finished job ETA = %d, projected cost = %d", job.ETA, job.ProjectedCost)
+	}
+	if _, ok := progressByJob["job"]; ok {
+		t.Error("progress of a finished job is still tracked")
+	}
+}
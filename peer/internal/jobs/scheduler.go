@@ -0,0 +1,311 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	StatusQueued   = "queued"
+	StatusActive   = "active"
+	StatusRetrying = "retrying"
+	StatusPaused   = "paused"
+	// Stopped by the user
+	StatusTerminated = "terminated"
+	// Gave up after the last attempt failed
+	StatusFailed   = "failed"
+	StatusFinished = "finished"
+)
+
+// Runner downloads the file of a job and returns the holder it downloaded from.
+// Holders that failed earlier attempts of the job are passed in so another one
+// can be tried. It must return once ctx is cancelled.
+type Runner func(ctx context.Context, job Job, failedHolders []string) (holder string, err error)
+
+type SchedulerConfig struct {
+	// Downloads running at the same time.
+	MaxActive int
+	// Attempts of a job before it fails for good.
+	MaxAttempts int
+	// Wait before the first retry, doubled for every further one up to MaxRetryDelay.
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+}
+
+var DefaultSchedulerConfig = SchedulerConfig{
+	MaxActive:     3,
+	MaxAttempts:   5,
+	RetryDelay:    5 * time.Second,
+	MaxRetryDelay: 5 * time.Minute,
+}
+
+/*
+ * The scheduler decides which jobs download. Jobs wait as queued until one of
+ * the MaxActive slots is free, the highest priority first and in the order they
+ * were queued otherwise. Every running job has its own context: pausing or
+ * terminating a job cancels it, and so does shutting the node down. A download
+ * that fails is retried after an exponentially growing delay, from another
+ * holder if there is one, until MaxAttempts is reached.
+ */
+type Scheduler struct {
+	mutex  sync.Mutex
+	config SchedulerConfig
+	ctx    context.Context
+	run    Runner
+	// Cancels the context of every running job
+	running map[string]context.CancelFunc
+	// Order jobs were queued in, to keep jobs of equal priority first come first served
+	queuedAt map[string]uint64
+	nextSeq  uint64
+	failed   map[string][]string
+	// Called with the job function, lets the node wait for running downloads on shutdown
+	spawn func(func())
+}
+
+// Default schedules the jobs of the node. Jobs queued before it is started wait
+// until it is.
+var Default = NewScheduler(DefaultSchedulerConfig)
+
+func NewScheduler(config SchedulerConfig) *Scheduler {
+	if config.MaxActive < 1 {
+		config.MaxActive = 1
+	}
+	if config.MaxAttempts < 1 {
+		config.MaxAttempts = 1
+	}
+	return &Scheduler{
+		config:   config,
+		running:  make(map[string]context.CancelFunc),
+		queuedAt: make(map[string]uint64),
+		failed:   make(map[string][]string),
+		spawn:    func(fn func()) { go fn() },
+	}
+}
+
+// Start runs queued jobs with run until ctx is cancelled. spawn starts the
+// goroutine of each download, nil uses the go statement.
+func (s *Scheduler) Start(ctx context.Context, run Runner, spawn func(func())) {
+	s.mutex.Lock()
+	s.ctx = ctx
+	s.run = run
+	if spawn != nil {
+		s.spawn = spawn
+	}
+	s.mutex.Unlock()
+	s.dispatch()
+}
+
+// Configure changes the limits, running jobs above a lowered MaxActive finish.
+func (s *Scheduler) Configure(config SchedulerConfig) {
+	s.mutex.Lock()
+	s.config = NewScheduler(config).config
+	s.mutex.Unlock()
+	s.dispatch()
+}
+
+// Enqueue adds job to the job list and queues it.
+func (s *Scheduler) Enqueue(job Job) {
+	job.Status = StatusQueued
+	s.mutex.Lock()
+	s.queue(job.JobId)
+	s.mutex.Unlock()
+	AddJob(job)
+	s.dispatch()
+}
+
+// Resume queues a paused, failed or terminated job again. A job waiting for
+// approval is checked against the limits again, e.g. after the budget was raised.
+func (s *Scheduler) Resume(jobId string) error {
+	s.mutex.Lock()
+	defer s.dispatch()
+	defer s.mutex.Unlock()
+	return updateJob(jobId, func(job *Job) error {
+		switch job.Status {
+		case StatusQueued, StatusActive, StatusRetrying:
+			return nil
+		case StatusFinished:
+			return errors.New("job " + jobId + " has already finished")
+		}
+		if job.Status != StatusPaused && job.Status != StatusApproval {
+			// A new start after failing gets all its attempts back
+			job.Attempts = 0
+			delete(s.failed, jobId)
+		}
+		job.RetryAt = ""
+		s.queue(jobId)
+		setJobStatus(job, StatusQueued)
+		return nil
+	})
+}
+
+// Pause stops a job until it is resumed.
+func (s *Scheduler) Pause(jobId string) error {
+	return s.stop(jobId, StatusPaused)
+}
+
+// Terminate stops a job for good.
+func (s *Scheduler) Terminate(jobId string) error {
+	return s.stop(jobId, StatusTerminated)
+}
+
+func (s *Scheduler) stop(jobId string, status string) error {
+	s.mutex.Lock()
+	defer s.dispatch()
+	defer s.mutex.Unlock()
+	return updateJob(jobId, func(job *Job) error {
+		if job.Status == StatusFinished {
+			return errors.New("job " + jobId + " has already finished")
+		}
+		if cancel, ok := s.running[jobId]; ok {
+			cancel()
+		}
+		job.RetryAt = ""
+		setJobStatus(job, status)
+		return nil
+	})
+}
+
+// SetPriority changes the priority of a job. Higher priorities are started first.
+func (s *Scheduler) SetPriority(jobId string, priority int) error {
+	return updateJob(jobId, func(job *Job) error {
+		job.Priority = priority
+		return nil
+	})
+}
+
+// Give jobId its place in the queue. s.mutex must be held.
+func (s *Scheduler) queue(jobId string) {
+	s.nextSeq++
+	s.queuedAt[jobId] = s.nextSeq
+}
+
+// Start queued jobs while there are free slots.
+func (s *Scheduler) dispatch() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.run == nil || s.ctx.Err() != nil {
+		return
+	}
+	for len(s.running) < s.config.MaxActive {
+		job, ok := s.next()
+		if !ok {
+			return
+		}
+		ctx, cancel := context.WithCancel(s.ctx)
+		s.running[job.JobId] = cancel
+		failed := append([]string(nil), s.failed[job.JobId]...)
+		s.spawn(func() {
+			holder, err := s.run(ctx, job, failed)
+			s.finish(ctx, job.JobId, holder, err)
+		})
+	}
+}
+
+// Mark the queued job that should run next as active. s.mutex must be held.
+func (s *Scheduler) next() (Job, bool) {
+	Manager.Mutex.Lock()
+	defer Manager.Mutex.Unlock()
+	queued := make([]int, 0)
+	for idx, job := range Manager.Jobs {
+		if job.Status == StatusQueued {
+			queued = append(queued, idx)
+		}
+	}
+	if len(queued) == 0 {
+		return Job{}, false
+	}
+	sort.Slice(queued, func(i, j int) bool {
+		a, b := Manager.Jobs[queued[i]], Manager.Jobs[queued[j]]
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		return s.queuedAt[a.JobId] < s.queuedAt[b.JobId]
+	})
+	job := &Manager.Jobs[queued[0]]
+	delete(s.queuedAt, job.JobId)
+	job.Attempts++
+	job.RetryAt = ""
+	setJobStatus(job, StatusActive)
+	Manager.Changed = true
+	return *job, true
+}
+
+// Record how a download ended and schedule a retry if it failed.
+func (s *Scheduler) finish(ctx context.Context, jobId string, holder string, err error) {
+	s.mutex.Lock()
+	delete(s.running, jobId)
+	config := s.config
+	stopping := s.ctx.Err() != nil
+	var retryIn time.Duration
+	updateJob(jobId, func(job *Job) error {
+		switch {
+		case err == nil:
+			job.Error = ""
+			job.ETA = 0
+			setJobStatus(job, StatusFinished)
+			delete(s.failed, jobId)
+		case ctx.Err() != nil:
+			// Paused or terminated, the status is already set, unless the
+			// node is shutting down. Leave it paused so it can be resumed.
+			if stopping && job.Status == StatusActive {
+				setJobStatus(job, StatusPaused)
+			}
+		case errors.As(err, new(*ApprovalError)):
+			// Nothing was paid past the limit, wait for the user
+			job.Error = err.Error()
+			setJobStatus(job, StatusApproval)
+		default:
+			job.Error = err.Error()
+			if holder != "" {
+				s.failed[jobId] = append(s.failed[jobId], holder)
+			}
+			if job.Attempts >= config.MaxAttempts {
+				setJobStatus(job, StatusFailed)
+				return nil
+			}
+			retryIn = retryDelay(config, job.Attempts)
+			job.RetryAt = time.Now().Add(retryIn).Format(time.RFC3339)
+			setJobStatus(job, StatusRetrying)
+		}
+		return nil
+	})
+	s.mutex.Unlock()
+
+	if retryIn > 0 {
+		time.AfterFunc(retryIn, func() { s.retry(jobId) })
+	}
+	s.dispatch()
+}
+
+// Queue a job again once its retry delay is over, unless it was paused or
+// terminated in the meantime.
+func (s *Scheduler) retry(jobId string) {
+	s.mutex.Lock()
+	if s.ctx.Err() != nil {
+		s.mutex.Unlock()
+		return
+	}
+	updateJob(jobId, func(job *Job) error {
+		if job.Status == StatusRetrying {
+			s.queue(jobId)
+			setJobStatus(job, StatusQueued)
+		}
+		return nil
+	})
+	s.mutex.Unlock()
+	s.dispatch()
+}
+
+func retryDelay(config SchedulerConfig, attempts int) time.Duration {
+	delay := config.RetryDelay
+	for i := 1; i < attempts && delay < config.MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if config.MaxRetryDelay > 0 && delay > config.MaxRetryDelay {
+		delay = config.MaxRetryDelay
+	}
+	return delay
+}
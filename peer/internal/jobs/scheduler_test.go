@@ -0,0 +1,142 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func waitForStatus(t *testing.T, jobId string, status string) Job {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := FindJob(jobId)
+		if err == nil && job.Status == status {
+			return job
+		}
+		time.Sleep(time.Millisecond)
+	}
+	job, _ := FindJob(jobId)
+	t.Fatalf("job %s is %s, want %s", jobId, job.Status, status)
+	return job
+}
+
+func TestSchedulerLimitAndPriority(t *testing.T) {
+	Manager = JobManager{Jobs: make([]Job, 0)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := NewScheduler(SchedulerConfig{MaxActive: 1, MaxAttempts: 1})
+	started := make(chan string, 3)
+	release := make(chan struct{})
+	s.Start(ctx, func(ctx context.Context, job Job, failed []string) (string, error) {
+		started <- job.JobId
+		<-release
+		return "holder", nil
+	}, nil)
+
+	s.Enqueue(Job{JobId: "first"})
+	if id := <-started; id != "first" {
+		t.Fatalf("started %s first", id)
+	}
+	s.Enqueue(Job{JobId: "low"})
+	s.Enqueue(Job{JobId: "high", Priority: 5})
+	waitForStatus(t, "low", StatusQueued)
+	waitForStatus(t, "high", StatusQueued)
+
+	for _, want := range []string{"high", "low"} {
+		release <- struct{}{}
+		if id := <-started; id != want {
+			t.Fatalf("started %s, want %s", id, want)
+		}
+	}
+	release <- struct{}{}
+	for _, id := range []string{"first", "high", "low"} {
+		waitForStatus(t, id, StatusFinished)
+	}
+}
+
+func TestSchedulerRetriesOtherHolders(t *testing.T) {
+	Manager = JobManager{Jobs: make([]Job, 0)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := NewScheduler(SchedulerConfig{MaxActive: 1, MaxAttempts: 3, RetryDelay: time.Millisecond, MaxRetryDelay: time.Millisecond})
+	attempts := make(chan []string, 3)
+	s.Start(ctx, func(ctx context.Context, job Job, failed []string) (string, error) {
+		attempts <- failed
+		holders := []string{"a", "b", "c"}
+		return holders[len(failed)], errors.New("holder went away")
+	}, nil)
+
+	s.Enqueue(Job{JobId: "job"})
+	job := waitForStatus(t, "job", StatusFailed)
+	if job.Attempts != 3 || job.Error != "holder went away" {
+		t.Fatalf("failed job made %d attempts, error %q", job.Attempts, job.Error)
+	}
+	if failed := <-attempts; len(failed) != 0 {
+		t.Fatalf("first attempt avoided %v", failed)
+	}
+	if failed := <-attempts; len(failed) != 1 || failed[0] != "a" {
+		t.Fatalf("second attempt avoided %v", failed)
+	}
+	if failed := <-attempts; len(failed) != 2 || failed[1] != "b" {
+		t.Fatalf("third attempt avoided %v", failed)
+	}
+
+	// Starting a failed job again gives it all attempts back
+	if err := s.Resume("job"); err != nil {
+		t.Fatal(err)
+	}
+	if failed := <-attempts; len(failed) != 0 {
+		t.Fatalf("restarted job avoided %v", failed)
+	}
+	waitForStatus(t, "job", StatusFailed)
+}
+
+func TestSchedulerPauseCancels(t *testing.T) {
+	Manager = JobManager{Jobs: make([]Job, 0)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := NewScheduler(SchedulerConfig{MaxActive: 1, MaxAttempts: 1})
+	started := make(chan struct{}, 2)
+	s.Start(ctx, func(ctx context.Context, job Job, failed []string) (string, error) {
+		started <- struct{}{}
+		<-ctx.Done()
+		return "holder", ctx.Err()
+	}, nil)
+
+	s.Enqueue(Job{JobId: "paused"})
+	s.Enqueue(Job{JobId: "waiting"})
+	<-started
+	if err := s.Pause("paused"); err != nil {
+		t.Fatal(err)
+	}
+	// The freed slot goes to the next job, the paused one is not retried
+	<-started
+	waitForStatus(t, "waiting", StatusActive)
+	if job, _ := FindJob("paused"); job.Status != StatusPaused || job.Attempts != 1 {
+		t.Fatalf("paused job is %s after %d attempts", job.Status, job.Attempts)
+	}
+
+	if err := s.Terminate("waiting"); err != nil {
+		t.Fatal(err)
+	}
+	waitForStatus(t, "waiting", StatusTerminated)
+	if err := s.Resume("paused"); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	waitForStatus(t, "paused", StatusActive)
+
+	// Jobs running when the node shuts down are left resumable
+	cancel()
+	waitForStatus(t, "paused", StatusPaused)
+}
+
+func TestRetryDelay(t *testing.T) {
+	config := SchedulerConfig{RetryDelay: time.Second, MaxRetryDelay: 5 * time.Second}
+	for attempts, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		if got := retryDelay(config, attempts); got != want {
+			t.Errorf("delay after %d attempts = %s, want %s", attempts, got, want)
+		}
+	}
+}
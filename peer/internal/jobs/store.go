@@ -0,0 +1,271 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var jobsBucket = []byte("jobs")
+
+/*
+ * Store keeps every job the node has run in a bbolt database, one JSON value per
+ * job keyed by its ID, and what was spent on downloads per day. Every write is a
+ * single transaction, so a crash leaves either the old or the new version of a
+ * job on disk, never a partial file.
+ * Manager.Jobs holds the unfinished jobs and those added since the node started,
+ * the store also the history of earlier runs.
+ */
+type Store struct {
+	db *bolt.DB
+}
+
+// OpenStore opens the job database at path, creating it if needed.
+func OpenStore(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(jobsBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(spendingBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Put writes jobs in one transaction.
+func (s *Store) Put(jobs ...Job) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(jobsBucket)
+		for _, job := range jobs {
+			value, err := json.Marshal(job)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(job.JobId), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Delete removes jobs in one transaction. Unknown IDs are ignored.
+func (s *Store) Delete(jobIds ...string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(jobsBucket)
+		for _, jobId := range jobIds {
+			if err := bucket.Delete([]byte(jobId)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Store) Get(jobId string) (Job, bool, error) {
+	var job Job
+	found := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(jobsBucket).Get([]byte(jobId))
+		if value == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(value, &job)
+	})
+	return job, found, err
+}
+
+func (s *Store) All() ([]Job, error) {
+	jobs := make([]Job, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).ForEach(func(key []byte, value []byte) error {
+			var job Job
+			if err := json.Unmarshal(value, &job); err != nil {
+				return err
+			}
+			jobs = append(jobs, job)
+			return nil
+		})
+	})
+	return jobs, err
+}
+
+// HistoryFilter selects jobs for Query. Zero values disable a criterion.
+type HistoryFilter struct {
+	// Only jobs in one of these statuses.
+	Statuses []string
+	FileHash string
+	// Only jobs queued at or after Since and before Until.
+	Since  time.Time
+	Until  time.Time
+	Offset int
+	Limit  int
+}
+
+// Query returns the page of jobs matching f, newest first, together with the
+// total number of matches before pagination.
+func (s *Store) Query(f HistoryFilter) ([]Job, int, error) {
+	all, err := s.All()
+	if err != nil {
+		return nil, 0, err
+	}
+	matches := make([]Job, 0)
+	for _, job := range all {
+		if len(f.Statuses) > 0 && !contains(f.Statuses, job.Status) {
+			continue
+		}
+		if f.FileHash != "" && job.FileHash != f.FileHash {
+			continue
+		}
+		if !f.Since.IsZero() || !f.Until.IsZero() {
+			queued, err := time.Parse(time.RFC3339, job.TimeQueued)
+			if err != nil {
+				continue
+			}
+			if !f.Since.IsZero() && queued.Before(f.Since) {
+				continue
+			}
+			if !f.Until.IsZero() && !queued.Before(f.Until) {
+				continue
+			}
+		}
+		matches = append(matches, job)
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		// RFC 3339 times of the same zone sort as strings
+		if matches[i].TimeQueued != matches[j].TimeQueued {
+			return matches[i].TimeQueued > matches[j].TimeQueued
+		}
+		return matches[i].JobId < matches[j].JobId
+	})
+
+	total := len(matches)
+	if f.Offset > 0 {
+		if f.Offset >= len(matches) {
+			return []Job{}, total, nil
+		}
+		matches = matches[f.Offset:]
+	}
+	if f.Limit > 0 && f.Limit < len(matches) {
+		matches = matches[:f.Limit]
+	}
+	return matches, total, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	store      *Store
+	storeMutex sync.Mutex
+)
+
+// InitStore opens the job database at path and makes it the store of the node.
+// Jobs of an old jobs.json at legacyPath are imported once. Unfinished jobs
+// are loaded into Manager: paused jobs and jobs waiting for approval keep their
+// status, the ones that were queued or running are queued again on the Default
+// scheduler.
+func InitStore(path string, legacyPath string) error {
+	s, err := OpenStore(path)
+	if err != nil {
+		return err
+	}
+	if err := importLegacyHistory(s, legacyPath); err != nil {
+		s.Close()
+		return err
+	}
+	all, err := s.All()
+	if err != nil {
+		s.Close()
+		return err
+	}
+	if err := loadSpending(s); err != nil {
+		s.Close()
+		return err
+	}
+	storeMutex.Lock()
+	store = s
+	storeMutex.Unlock()
+
+	sort.Slice(all, func(i, j int) bool { return all[i].TimeQueued < all[j].TimeQueued })
+	for _, job := range all {
+		switch job.Status {
+		case StatusPaused, StatusApproval:
+			AddJob(job)
+		case StatusQueued, StatusActive, StatusRetrying:
+			// The attempt running when the node stopped did not fail
+			job.Attempts = 0
+			job.RetryAt = ""
+			Default.Enqueue(job)
+		}
+	}
+	return nil
+}
+
+// Move the jobs of the JSON history used before the database into s and keep the
+// old file as jobs.json.imported.
+func importLegacyHistory(s *Store, legacyPath string) error {
+	if legacyPath == "" {
+		return nil
+	}
+	data, err := os.ReadFile(legacyPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var jobs []Job
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return err
+	}
+	if err := s.Put(jobs...); err != nil {
+		return err
+	}
+	return os.Rename(legacyPath, legacyPath+".imported")
+}
+
+// CloseStore saves the jobs and closes the database.
+func CloseStore() error {
+	err := Flush()
+	storeMutex.Lock()
+	defer storeMutex.Unlock()
+	if store == nil {
+		return err
+	}
+	if closeErr := store.Close(); err == nil {
+		err = closeErr
+	}
+	store = nil
+	return err
+}
+
+func currentStore() *Store {
+	storeMutex.Lock()
+	defer storeMutex.Unlock()
+	return store
+}
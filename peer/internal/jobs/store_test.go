@@ -0,0 +1,121 @@
+package jobs
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStoreQuery(t *testing.T) {
+	s, err := OpenStore(filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	err = s.Put(
+		Job{JobId: "1", FileHash: "a", Status: StatusFinished, TimeQueued: "2024-04-01T10:00:00Z"},
+		Job{JobId: "2", FileHash: "b", Status: StatusFailed, TimeQueued: "2024-04-02T10:00:00Z"},
+		Job{JobId: "3", FileHash: "a", Status: StatusFinished, TimeQueued: "2024-04-03T10:00:00Z"},
+		Job{JobId: "4", FileHash: "a", Status: StatusPaused, TimeQueued: "2024-04-04T10:00:00Z"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := func(jobs []Job) string {
+		s := ""
+		for _, job := range jobs {
+			s += job.JobId
+		}
+		return s
+	}
+	day := func(d int) time.Time { return time.Date(2024, 4, d, 0, 0, 0, 0, time.UTC) }
+	for _, test := range []struct {
+		filter HistoryFilter
+		want   string
+		total  int
+	}{
+		{HistoryFilter{}, "4321", 4},
+		{HistoryFilter{Statuses: []string{StatusFinished, StatusFailed}}, "321", 3},
+		{HistoryFilter{FileHash: "a"}, "431", 3},
+		{HistoryFilter{Since: day(2), Until: day(4)}, "32", 2},
+		{HistoryFilter{Offset: 1, Limit: 2}, "32", 4},
+		{HistoryFilter{Offset: 10}, "", 4},
+	} {
+		jobs, total, err := s.Query(test.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids(jobs) != test.want || total != test.total {
+			t.Errorf("%+v matched %s of %d, want %s of %d", test.filter, ids(jobs), total, test.want, test.total)
+		}
+	}
+
+	if err := s.Delete("2", "unknown"); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ := s.Get("2"); found {
+		t.Error("deleted job is still stored")
+	}
+}
+
+func TestInitStoreRestoresUnfinishedJobs(t *testing.T) {
+	Manager = JobManager{Jobs: make([]Job, 0)}
+	Default = NewScheduler(DefaultSchedulerConfig)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "jobs.db")
+	legacyPath := filepath.Join(dir, "jobs.json")
+
+	s, err := OpenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Put(
+		Job{JobId: "running", Status: StatusActive, Attempts: 2, TimeQueued: "2024-04-01T10:00:00Z"},
+		Job{JobId: "paused", Status: StatusPaused, TimeQueued: "2024-04-02T10:00:00Z"},
+		Job{JobId: "done", Status: StatusFinished, TimeQueued: "2024-04-03T10:00:00Z"},
+	)
+	s.Close()
+	legacy, _ := json.Marshal([]Job{{JobId: "old", Status: StatusFinished, TimeQueued: "2024-03-01T10:00:00Z"}})
+	if err := os.WriteFile(legacyPath, legacy, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := InitStore(path, legacyPath); err != nil {
+		t.Fatal(err)
+	}
+	defer CloseStore()
+	if _, err := os.Stat(legacyPath); !os.IsNotExist(err) {
+		t.Error("legacy history was not moved aside")
+	}
+	if job, err := FindJob("running"); err != nil || job.Status != StatusQueued || job.Attempts != 0 {
+		t.Errorf("running job restored as %+v, %v", job, err)
+	}
+	if job, err := FindJob("paused"); err != nil || job.Status != StatusPaused {
+		t.Errorf("paused job restored as %+v, %v", job, err)
+	}
+	if _, err := FindJob("done"); err == nil {
+		t.Error("finished job was loaded")
+	}
+
+	// Changes are written through to the database
+	if err := Default.Pause("running"); err != nil {
+		t.Fatal(err)
+	}
+	history, total, err := LoadHistory(HistoryFilter{Statuses: []string{StatusPaused}})
+	if err != nil || total != 2 {
+		t.Fatalf("history of paused jobs is %+v, %v", history, err)
+	}
+
+	if err := RemoveFromHistory("old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ClearHistory(); err != nil {
+		t.Fatal(err)
+	}
+	if _, total, _ := LoadHistory(HistoryFilter{}); total != 2 {
+		t.Errorf("%d jobs left after clearing the history, want the 2 paused ones", total)
+	}
+}
@@ -0,0 +1,151 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+/*
+ * The lifecycle package owns the root context of the node and the ordered list
+ * of things that have to happen when it stops. Long running goroutines select on
+ * Context().Done() and components register a hook with OnShutdown to release
+ * what they hold. Shutdown runs the hooks stage by stage:
+ *
+ *	StageServers    stop accepting HTTP and gRPC requests
+ *	StageWorkers    wait for download jobs to pause themselves
+ *	StageNetwork    close the DHT and the libp2p host
+ *	StageStorage    flush jobs, peers and devices to disk
+ *	StageProcesses  stop child processes such as the coin API server
+ */
+
+type Stage int
+
+const (
+	StageServers Stage = iota
+	StageWorkers
+	StageNetwork
+	StageStorage
+	StageProcesses
+)
+
+// How long Shutdown waits for all hooks by default.
+const DefaultTimeout = 30 * time.Second
+
+type hook struct {
+	stage Stage
+	name  string
+	fn    func(context.Context) error
+}
+
+var (
+	mutex   sync.Mutex
+	hooks   []hook
+	workers sync.WaitGroup
+
+	rootCtx, cancel = context.WithCancel(context.Background())
+	once            sync.Once
+	done            = make(chan struct{})
+)
+
+// Context is cancelled as soon as the node starts shutting down.
+func Context() context.Context {
+	return rootCtx
+}
+
+// Stopping reports whether shutdown has begun.
+func Stopping() bool {
+	return rootCtx.Err() != nil
+}
+
+// Done is closed once Shutdown has run every hook.
+func Done() <-chan struct{} {
+	return done
+}
+
+// OnShutdown registers fn to run during the given stage. Hooks of the same stage
+// run in reverse order of registration, like deferred calls, so something that
+// was started on top of another component is stopped before it.
+func OnShutdown(stage Stage, name string, fn func(context.Context) error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	hooks = append(hooks, hook{stage: stage, name: name, fn: fn})
+}
+
+// Go runs fn as a worker that StageWorkers waits for.
+func Go(fn func()) {
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		fn()
+	}()
+}
+
+func init() {
+	OnShutdown(StageWorkers, "workers", func(ctx context.Context) error {
+		finished := make(chan struct{})
+		go func() {
+			workers.Wait()
+			close(finished)
+		}()
+		select {
+		case <-finished:
+			return nil
+		case <-ctx.Done():
+			return errors.New("workers did not stop in time")
+		}
+	})
+}
+
+// Shutdown cancels the root context and runs the registered hooks in stage
+// order, giving all of them timeout to finish. Only the first call does any
+// work, later calls wait for it to complete.
+func Shutdown(timeout time.Duration) {
+	once.Do(func() {
+		defer close(done)
+		cancel()
+
+		mutex.Lock()
+		ordered := make([]hook, 0, len(hooks))
+		for i := len(hooks) - 1; i >= 0; i-- {
+			ordered = append(ordered, hooks[i])
+		}
+		mutex.Unlock()
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return ordered[i].stage < ordered[j].stage
+		})
+
+		ctx, cancelTimeout := context.WithTimeout(context.Background(), timeout)
+		defer cancelTimeout()
+		for _, h := range ordered {
+			if err := h.fn(ctx); err != nil {
+				fmt.Printf("Error stopping %s: %s\n", h.name, err)
+			}
+		}
+	})
+	<-done
+}
+
+// HandleSignals shuts the node down on SIGINT or SIGTERM and then calls exit.
+// A second signal while shutting down exits immediately.
+func HandleSignals(timeout time.Duration, exit func()) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		fmt.Printf("\nReceived %s, shutting down...\n", sig)
+		go func() {
+			<-signals
+			fmt.Println("Forced exit")
+			os.Exit(1)
+		}()
+		Shutdown(timeout)
+		exit()
+	}()
+}
@@ -0,0 +1,65 @@
+package lifecycle
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Shutdown only runs once per process, so everything is checked in one test.
+func TestShutdown(t *testing.T) {
+	var order []string
+	record := func(name string) func(context.Context) error {
+		return func(ctx context.Context) error {
+			order = append(order, name)
+			return nil
+		}
+	}
+	OnShutdown(StageProcesses, "child", record("child"))
+	OnShutdown(StageStorage, "jobs", record("jobs"))
+	OnShutdown(StageNetwork, "host", record("host"))
+	OnShutdown(StageNetwork, "dht", record("dht"))
+	OnShutdown(StageServers, "http", func(ctx context.Context) error {
+		if !Stopping() {
+			t.Error("context not cancelled before the first hook ran")
+		}
+		order = append(order, "http")
+		return nil
+	})
+
+	// A worker that only finishes once the root context is cancelled.
+	workerDone := false
+	Go(func() {
+		<-Context().Done()
+		time.Sleep(10 * time.Millisecond)
+		workerDone = true
+	})
+	OnShutdown(StageNetwork, "check workers", func(ctx context.Context) error {
+		if !workerDone {
+			t.Error("network stage ran before workers finished")
+		}
+		return nil
+	})
+
+	if Stopping() {
+		t.Fatal("stopping before Shutdown was called")
+	}
+	Shutdown(time.Second)
+	select {
+	case <-Done():
+	default:
+		t.Fatal("Done not closed after Shutdown")
+	}
+
+	want := []string{"http", "dht", "host", "jobs", "child"}
+	if !reflect.DeepEqual(order, want) {
+		t.Fatalf("hooks ran in order %v, want %v", order, want)
+	}
+
+	// Later calls return immediately without running the hooks again.
+	Shutdown(time.Second)
+	if len(order) != len(want) {
+		t.Fatalf("hooks ran again on the second Shutdown: %v", order)
+	}
+}
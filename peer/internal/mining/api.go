@@ -2,15 +2,27 @@ package mining
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	orcaBlockchain "orca-peer/internal/blockchain"
+	orcaRouter "orca-peer/internal/router"
+	"strconv"
+	"time"
 )
 
 type PutDeviceRequestBody struct {
-	PublicKey string `json:"pub_key"`
-	Switch    string `json:"switch"`
+	// Sent by older clients, not used
+	PublicKey string `json:"pub_key,omitempty"`
+	// The CPU miner when empty
+	DeviceId string `json:"device_id,omitempty"`
+	// "on" or "off"
+	Switch string `json:"switch" validate:"required"`
+	// Workers to run, the current number when 0. Changing it resizes a running miner.
+	Workers int `json:"workers,omitempty"`
 }
 
+// Start, stop or resize a mining device.
 func PutDeviceHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
 		contentType := r.Header.Get("Content-Type")
@@ -23,6 +35,17 @@ func PutDeviceHandler(w http.ResponseWriter, r *http.Request) {
 				writeStatusUpdate(w, "Cannot marshal payload in Go object. Does the payload have the correct body structure?")
 				return
 			}
+			if payload.Switch != "on" && payload.Switch != "off" {
+				w.WriteHeader(http.StatusBadRequest)
+				writeStatusUpdate(w, "switch must be on or off.")
+				return
+			}
+			device, err := SetDevice(payload.DeviceId, payload.Switch == "on", payload.Workers)
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			orcaRouter.WriteJSON(w, http.StatusOK, device)
 		default:
 			w.WriteHeader(http.StatusBadRequest)
 			writeStatusUpdate(w, "Request must have the content header set as application/json")
@@ -35,11 +58,60 @@ func PutDeviceHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-type GetDevicesRequestBody struct {
+// List the mining devices with their current hashrate.
+func GetDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	devices, err := GetDevices()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	orcaRouter.WriteJSON(w, http.StatusOK, devices)
 }
 
-func GetDeviceHandler(w http.ResponseWriter, r *http.Request) {
+// Hashrate samples of the last day, or since the since query parameter.
+func hashrateHandler(w http.ResponseWriter, r *http.Request) {
+	since := time.Now().Add(-24 * time.Hour)
+	if value := r.URL.Query().Get("since"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			orcaRouter.WriteError(w, orcaRouter.Errorf(http.StatusBadRequest, "since must be an RFC 3339 time"))
+			return
+		}
+		since = t
+	}
+	orcaRouter.WriteJSON(w, http.StatusOK, Samples(since))
+}
 
+func blocksHandler(w http.ResponseWriter, r *http.Request) {
+	orcaRouter.WriteJSON(w, http.StatusOK, Blocks())
+}
+
+func estimateHandler(w http.ResponseWriter, r *http.Request) {
+	hashesPerSec := -1.0
+	if value := r.URL.Query().Get("hashes_per_sec"); value != "" {
+		var err error
+		hashesPerSec, err = strconv.ParseFloat(value, 64)
+		if err != nil || hashesPerSec < 0 {
+			orcaRouter.WriteError(w, orcaRouter.Errorf(http.StatusBadRequest, "hashes_per_sec must be a positive number"))
+			return
+		}
+	}
+	estimate, err := EstimateProfit(hashesPerSec)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	orcaRouter.WriteJSON(w, http.StatusOK, estimate)
+}
+
+// Write err in the error envelope, with the status chosen for failed calls to
+// OrcaNet and OrcaWallet.
+func writeError(w http.ResponseWriter, err error) {
+	var rpcErr *orcaBlockchain.RPCError
+	if errors.As(err, &rpcErr) {
+		err = orcaRouter.Errorf(rpcErr.Status, "%s", rpcErr.Message)
+	}
+	orcaRouter.WriteError(w, err)
 }
 
 func writeStatusUpdate(w http.ResponseWriter, message string) {
@@ -54,3 +126,74 @@ func writeStatusUpdate(w http.ResponseWriter, message string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(responseMsgJsonString)
 }
+
+// Routes returns the HTTP routes of the mining devices.
+func Routes() []orcaRouter.Route {
+	return []orcaRouter.Route{
+		{
+			Method:   http.MethodGet,
+			Path:     "/devices",
+			Scope:    orcaRouter.ScopeRead,
+			Tag:      "mining",
+			Summary:  "List the mining devices",
+			Response: []Device{},
+			Handler:  GetDeviceHandler,
+		},
+		{
+			Method:  http.MethodPost,
+			Legacy:  "/device_list",
+			Scope:   orcaRouter.ScopeRead,
+			Handler: GetDeviceHandler,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/devices",
+			Legacy:  "/device",
+			Scope:   orcaRouter.ScopeAdmin,
+			Tag:     "mining",
+			Summary: "Start, stop or resize a mining device",
+			Description: "Switching the CPU miner on without a mining address set in OrcaNet pays its blocks to a new wallet address. " +
+				"Switching it on while it runs changes its number of workers.",
+			Body:     PutDeviceRequestBody{},
+			Response: Device{},
+			Handler:  PutDeviceHandler,
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/mining/hashrate",
+			Scope:       orcaRouter.ScopeRead,
+			Tag:         "mining",
+			Summary:     "Get the hashrate history of the miner",
+			Description: "A sample every 30 seconds, oldest first. Samples are kept for a day and across restarts.",
+			Query: []orcaRouter.Param{
+				{Name: "since", Description: "Only samples taken at or after this RFC 3339 time, the last day by default"},
+			},
+			Response: []HashrateSample{},
+			Handler:  hashrateHandler,
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/mining/blocks",
+			Scope:       orcaRouter.ScopeRead,
+			Tag:         "mining",
+			Summary:     "List the blocks found by the miner",
+			Description: "Blocks whose coinbase pays the mining addresses, newest first.",
+			Response:    []FoundBlock{},
+			Handler:     blocksHandler,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/mining/estimate",
+			Scope:   orcaRouter.ScopeRead,
+			Tag:     "mining",
+			Summary: "Estimate what mining earns",
+			Description: "Expected blocks and coins per day at the current difficulty and block subsidy, fees left out. " +
+				"Uses the current hashrate of the miner unless hashes_per_sec is given.",
+			Query: []orcaRouter.Param{
+				{Name: "hashes_per_sec", Type: "number", Description: "Hashrate to estimate for"},
+			},
+			Response: Estimate{},
+			Handler:  estimateHandler,
+		},
+	}
+}
@@ -1,24 +1,74 @@
 package mining
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	orcaDataDir "orca-peer/internal/datadir"
 	"os"
 	"sync"
 	"time"
 )
 
+const (
+	// How often the hashrate of the miner is recorded and the new blocks
+	// checked for blocks it found.
+	sampleInterval = 30 * time.Second
+	// Samples kept, a day at sampleInterval.
+	maxSamples = 2880
+	// Blocks found kept, the oldest are dropped first.
+	maxFoundBlocks = 500
+)
+
+// Device is a miner of the node. The CPU workers of OrcaNet are the only one
+// for now.
 type Device struct {
-	DeviceId      string `json:"device_id"`
-	DeviceName    string `json:"device_name"`
-	HashPower     string `json:"hash_power"`
-	Status        string `json:"status"`
-	Power         string `json:"power"`
-	Profitability string `json:"profitablity"`
+	DeviceId   string `json:"device_id"`
+	DeviceName string `json:"device_name"`
+	// Hashrate for people, e.g. "1.52 MH/s"
+	HashPower string `json:"hash_power"`
+	// "on" or "off"
+	Status string `json:"status"`
+	// Not measured for CPU workers
+	Power string `json:"power"`
+	// Expected earnings for people, e.g. "12.5 OrcaCoin/day"
+	Profitability string  `json:"profitablity"`
+	Workers       int     `json:"workers"`
+	HashesPerSec  float64 `json:"hashes_per_sec"`
+	CoinsPerDay   float64 `json:"coins_per_day"`
+	BlocksFound   int     `json:"blocks_found"`
+	// Addresses the blocks found are paid to
+	MiningAddresses []string `json:"mining_addresses,omitempty"`
+}
+
+// HashrateSample is the hashrate of the miner at one time. Workers is 0 while
+// the miner is off.
+type HashrateSample struct {
+	Time         time.Time `json:"time"`
+	HashesPerSec float64   `json:"hashes_per_sec"`
+	Workers      int       `json:"workers"`
+}
+
+// FoundBlock is a block paying the mining addresses of the node. Reward is
+// what its coinbase pays them, subsidy and fees, in coins.
+type FoundBlock struct {
+	Hash   string    `json:"hash"`
+	Height int64     `json:"height"`
+	Time   time.Time `json:"time"`
+	Reward float64   `json:"reward"`
+}
+
+// History is what is kept in devices.json, oldest first.
+type History struct {
+	Samples []HashrateSample `json:"samples"`
+	Blocks  []FoundBlock     `json:"blocks"`
 }
 
 type DeviceManager struct {
-	Devices []Device
+	History History
+	// Height of the last block checked for blocks we found, -1 until the
+	// first sample. Blocks found while the peer was not running are missed.
+	Height  int64
 	Changed bool
 	Mutex   sync.Mutex
 }
@@ -27,55 +77,134 @@ var Manager DeviceManager
 
 func InitDeviceTracker() {
 	Manager = DeviceManager{
-		Devices: make([]Device, 0), // Initialize an empty slice of jobs
-		Mutex:   sync.Mutex{},      // Initialize a mutex
+		Height:  -1,
+		Mutex:   sync.Mutex{},
 		Changed: false,
 	}
-	devs, err := LoadHistory()
+	history, err := LoadHistory()
 	if err != nil {
-		fmt.Println("Error loading devices, no devices will be shown.")
+		if !os.IsNotExist(err) {
+			fmt.Println("Error loading the mining history, starting a new one:", err)
+		}
 		return
 	}
-	Manager.Devices = devs
+	Manager.History = *history
+}
+
+// RunPeriodicSave saves the mining history every 10 seconds if it changed,
+// until ctx is cancelled.
+func RunPeriodicSave(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		Flush()
+	}
+}
+
+// Flush writes the mining history to disk if it changed since the last save.
+func Flush() error {
+	Manager.Mutex.Lock()
+	defer Manager.Mutex.Unlock()
+	if !Manager.Changed {
+		return nil
+	}
+	return SaveHistory(&Manager.History)
+}
+
+// RunSampler records the hashrate of the miner and the blocks it found every
+// sampleInterval until ctx is cancelled. Samples are skipped while OrcaNet is
+// not reachable.
+func RunSampler(ctx context.Context) {
+	ticker := time.NewTicker(sampleInterval)
+	defer ticker.Stop()
+	var lastErr string
 	for {
-		time.Sleep(10 * time.Second)
-		Manager.Mutex.Lock()
-		if Manager.Changed {
-			SaveHistory(Manager.Devices)
+		// The same error is only printed once
+		if err := sample(time.Now()); err != nil && ctx.Err() == nil && err.Error() != lastErr {
+			fmt.Println("Error sampling the miner:", err)
+			lastErr = err.Error()
+		} else if err == nil {
+			lastErr = ""
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
 		}
-		Manager.Mutex.Unlock()
 	}
 }
 
-func PutDevice() {
+// Add a sample, dropping the oldest beyond maxSamples. The caller holds the
+// mutex.
+func (m *DeviceManager) addSample(s HashrateSample) {
+	m.History.Samples = append(m.History.Samples, s)
+	if extra := len(m.History.Samples) - maxSamples; extra > 0 {
+		m.History.Samples = append(m.History.Samples[:0], m.History.Samples[extra:]...)
+	}
+	m.Changed = true
+}
 
+// Add a block found, dropping the oldest beyond maxFoundBlocks. The caller
+// holds the mutex.
+func (m *DeviceManager) addBlock(b FoundBlock) {
+	m.History.Blocks = append(m.History.Blocks, b)
+	if extra := len(m.History.Blocks) - maxFoundBlocks; extra > 0 {
+		m.History.Blocks = append(m.History.Blocks[:0], m.History.Blocks[extra:]...)
+	}
+	m.Changed = true
 }
 
-func LoadHistory() ([]Device, error) {
-	fileData, err := os.ReadFile("./internal/mining/devices.json")
+// Samples returns the samples taken at or after since, oldest first.
+func Samples(since time.Time) []HashrateSample {
+	Manager.Mutex.Lock()
+	defer Manager.Mutex.Unlock()
+	samples := make([]HashrateSample, 0)
+	for _, s := range Manager.History.Samples {
+		if !s.Time.Before(since) {
+			samples = append(samples, s)
+		}
+	}
+	return samples
+}
+
+// Blocks returns the blocks found, newest first.
+func Blocks() []FoundBlock {
+	Manager.Mutex.Lock()
+	defer Manager.Mutex.Unlock()
+	blocks := make([]FoundBlock, 0, len(Manager.History.Blocks))
+	for i := len(Manager.History.Blocks) - 1; i >= 0; i-- {
+		blocks = append(blocks, Manager.History.Blocks[i])
+	}
+	return blocks
+}
+
+func LoadHistory() (*History, error) {
+	fileData, err := os.ReadFile(orcaDataDir.DevicesFile())
 	if err != nil {
 		return nil, err
 	}
-	var jobs []Device
-	err = json.Unmarshal(fileData, &jobs)
+	var history History
+	err = json.Unmarshal(fileData, &history)
 	if err != nil {
 		return nil, err
 	}
-	return jobs, nil
+	return &history, nil
 }
-func SaveHistory(devices []Device) error {
+
+func SaveHistory(history *History) error {
 	Manager.Changed = false
-	jsonData, err := json.Marshal(devices)
+	jsonData, err := json.Marshal(history)
 	if err != nil {
 		return err
 	}
-	err = os.WriteFile("./internal/mining/devices.json", jsonData, 0644)
+	err = os.WriteFile(orcaDataDir.DevicesFile(), jsonData, 0644)
 	if err != nil {
 		return err
 	}
 	return nil
 }
-
-func GetDeviceList() {
-
-}
@@ -0,0 +1,34 @@
+package mining
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	Manager = DeviceManager{Height: -1}
+	start := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < maxSamples+10; i++ {
+		Manager.addSample(HashrateSample{Time: start.Add(time.Duration(i) * sampleInterval), HashesPerSec: float64(i)})
+	}
+	if len(Manager.History.Samples) != maxSamples || Manager.History.Samples[0].HashesPerSec != 10 {
+		t.Errorf("kept %d samples from %v, want %d from 10", len(Manager.History.Samples),
+			Manager.History.Samples[0].HashesPerSec, maxSamples)
+	}
+	since := start.Add(time.Duration(maxSamples+7) * sampleInterval)
+	if samples := Samples(since); len(samples) != 3 || !samples[0].Time.Equal(since) {
+		t.Errorf("got %d samples since %v, want 3", len(samples), since)
+	}
+
+	for i := 0; i < maxFoundBlocks+1; i++ {
+		Manager.addBlock(FoundBlock{Height: int64(i)})
+	}
+	blocks := Blocks()
+	if len(blocks) != maxFoundBlocks || blocks[0].Height != maxFoundBlocks || blocks[len(blocks)-1].Height != 1 {
+		t.Errorf("kept %d blocks from %d to %d, want %d from %d to 1", len(blocks), blocks[0].Height,
+			blocks[len(blocks)-1].Height, maxFoundBlocks, maxFoundBlocks)
+	}
+	if !Manager.Changed {
+		t.Error("history not marked as changed")
+	}
+}
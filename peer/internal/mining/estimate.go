@@ -0,0 +1,88 @@
+package mining
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	orcaBlockchain "orca-peer/internal/blockchain"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// Estimate is what mining at a hashrate is expected to earn at the current
+// difficulty and subsidy. Fees are left out.
+type Estimate struct {
+	HashesPerSec        float64 `json:"hashes_per_sec"`
+	Difficulty          float64 `json:"difficulty"`
+	NetworkHashesPerSec float64 `json:"network_hashes_per_sec"`
+	// Share of the hashrate of the network, 0 when unknown
+	NetworkShare float64 `json:"network_share"`
+	Height       int64   `json:"height"`
+	// Subsidy of the next block in coins
+	Subsidy      float64 `json:"subsidy"`
+	BlocksPerDay float64 `json:"blocks_per_day"`
+	CoinsPerDay  float64 `json:"coins_per_day"`
+	// Mean time to find a block, 0 when not hashing
+	SecondsPerBlock float64 `json:"seconds_per_block"`
+}
+
+// EstimateProfit estimates what mining at hashesPerSec earns, at the hashrate
+// of the miner when hashesPerSec is negative.
+func EstimateProfit(hashesPerSec float64) (*Estimate, error) {
+	info, err := miningInfo()
+	if err != nil {
+		return nil, err
+	}
+	if hashesPerSec < 0 {
+		hashesPerSec = info.HashesPerSec
+	}
+	return estimateFromInfo(info, hashesPerSec)
+}
+
+func estimateFromInfo(info *btcjson.GetMiningInfoResult, hashesPerSec float64) (*Estimate, error) {
+	params, err := orcaBlockchain.Params()
+	if err != nil {
+		return nil, err
+	}
+	e := estimate(hashesPerSec, info.Difficulty, info.Blocks, params)
+	e.NetworkHashesPerSec = info.NetworkHashPS
+	if info.NetworkHashPS > 0 {
+		e.NetworkShare = hashesPerSec / info.NetworkHashPS
+	}
+	return e, nil
+}
+
+// A block of difficulty d takes d times the hashes of a block at the proof of
+// work limit of the network, which takes 2^256 / (limit + 1) hashes on average.
+func estimate(hashesPerSec float64, difficulty float64, height int64, params *chaincfg.Params) *Estimate {
+	limit := new(big.Float).SetInt(new(big.Int).Add(params.PowLimit, big.NewInt(1)))
+	hashesAtLimit, _ := new(big.Float).Quo(new(big.Float).SetMantExp(big.NewFloat(1), 256), limit).Float64()
+	hashesPerBlock := difficulty * hashesAtLimit
+
+	e := &Estimate{
+		HashesPerSec: hashesPerSec,
+		Difficulty:   difficulty,
+		Height:       height,
+		Subsidy:      btcutil.Amount(blockchain.CalcBlockSubsidy(int32(height+1), params)).ToBTC(),
+	}
+	if hashesPerSec > 0 && hashesPerBlock > 0 {
+		e.SecondsPerBlock = hashesPerBlock / hashesPerSec
+		e.BlocksPerDay = 86400 / e.SecondsPerBlock
+		e.CoinsPerDay = e.BlocksPerDay * e.Subsidy
+	}
+	return e
+}
+
+// Format a hashrate for people, e.g. 1520000 as "1.52 MH/s".
+func formatHashrate(hashesPerSec float64) string {
+	units := []string{"H/s", "kH/s", "MH/s", "GH/s", "TH/s", "PH/s"}
+	i := 0
+	for i < len(units)-1 && math.Abs(hashesPerSec) >= 1000 {
+		hashesPerSec /= 1000
+		i++
+	}
+	return fmt.Sprintf("%.2f %s", hashesPerSec, units[i])
+}
@@ -0,0 +1,64 @@
+package mining
+
+import (
+	"math"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+func TestEstimate(t *testing.T) {
+	// A block of difficulty 1 on mainnet takes 2^32 hashes on average
+	hashesPerSec := math.Exp2(32) / 86400
+	e := estimate(hashesPerSec, 1, 100, &chaincfg.MainNetParams)
+	if math.Abs(e.BlocksPerDay-1) > 1e-9 || math.Abs(e.CoinsPerDay-50) > 1e-6 || math.Abs(e.SecondsPerBlock-86400) > 1e-6 {
+		t.Errorf("estimated %v blocks, %v coins per day and %v seconds per block, want 1, 50 and 86400",
+			e.BlocksPerDay, e.CoinsPerDay, e.SecondsPerBlock)
+	}
+	// Twice the difficulty halves the earnings
+	e = estimate(hashesPerSec, 2, 100, &chaincfg.MainNetParams)
+	if math.Abs(e.CoinsPerDay-25) > 1e-6 {
+		t.Errorf("estimated %v coins per day at difficulty 2, want 25", e.CoinsPerDay)
+	}
+	// Nothing is earned without hashing
+	e = estimate(0, 1, 100, &chaincfg.MainNetParams)
+	if e.BlocksPerDay != 0 || e.CoinsPerDay != 0 || e.SecondsPerBlock != 0 {
+		t.Errorf("estimated %+v at no hashrate", e)
+	}
+}
+
+// The subsidy is the one of the next block, halved like consensus does
+func TestEstimateSubsidy(t *testing.T) {
+	params := &chaincfg.MainNetParams
+	for _, test := range []struct {
+		height int64
+		want   btcutil.Amount
+	}{
+		{0, 50e8},
+		{209998, 50e8},
+		{209999, 25e8},
+		{419999, 12.5e8},
+		{64*210000 - 1, 0},
+	} {
+		if got := estimate(1, 1, test.height, params).Subsidy; got != test.want.ToBTC() {
+			t.Errorf("subsidy after height %d is %v, want %v", test.height, got, test.want.ToBTC())
+		}
+	}
+}
+
+func TestFormatHashrate(t *testing.T) {
+	for _, test := range []struct {
+		hashesPerSec float64
+		want         string
+	}{
+		{0, "0.00 H/s"},
+		{999, "999.00 H/s"},
+		{1520000, "1.52 MH/s"},
+		{3e18, "3000.00 PH/s"},
+	} {
+		if got := formatHashrate(test.hashesPerSec); got != test.want {
+			t.Errorf("formatHashrate(%v) = %q, want %q", test.hashesPerSec, got, test.want)
+		}
+	}
+}
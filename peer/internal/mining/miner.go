@@ -0,0 +1,239 @@
+package mining
+
+import (
+	"fmt"
+	"net/http"
+	orcaBlockchain "orca-peer/internal/blockchain"
+	orcaEvents "orca-peer/internal/events"
+	orcaRouter "orca-peer/internal/router"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/rpcclient"
+)
+
+/*
+ * The miner is the CPU miner of the OrcaNet node the peer runs. btcd reports
+ * how many workers it has and their hashrate through getmininginfo, and
+ * setgenerate starts, stops and resizes them. The peer adds what btcd does not
+ * keep: the hashrate over time, the blocks that paid the mining addresses and
+ * an estimate of what mining earns.
+ */
+
+const (
+	// ID of the CPU workers of OrcaNet.
+	CPUDeviceID = "cpu"
+	// New blocks checked for blocks found per sample. When OrcaNet catches up
+	// with a longer chain only the last blocks are checked.
+	maxBlocksChecked = 100
+)
+
+// Only one sample at a time, so the same blocks are not checked twice.
+var sampleMutex sync.Mutex
+
+func miningInfo() (*btcjson.GetMiningInfoResult, error) {
+	var info *btcjson.GetMiningInfoResult
+	err := orcaBlockchain.Node(func(client *rpcclient.Client) error {
+		var err error
+		info, err = client.GetMiningInfo()
+		return err
+	})
+	return info, err
+}
+
+// GetDevices returns the miners of the node.
+func GetDevices() ([]Device, error) {
+	info, err := miningInfo()
+	if err != nil {
+		return nil, err
+	}
+	device, err := cpuDevice(info)
+	if err != nil {
+		return nil, err
+	}
+	return []Device{*device}, nil
+}
+
+func cpuDevice(info *btcjson.GetMiningInfoResult) (*Device, error) {
+	estimate, err := estimateFromInfo(info, info.HashesPerSec)
+	if err != nil {
+		return nil, err
+	}
+	Manager.Mutex.Lock()
+	blocksFound := len(Manager.History.Blocks)
+	Manager.Mutex.Unlock()
+	device := &Device{
+		DeviceId:        CPUDeviceID,
+		DeviceName:      "OrcaNet CPU miner",
+		HashPower:       formatHashrate(info.HashesPerSec),
+		Status:          "off",
+		Profitability:   fmt.Sprintf("%.4f OrcaCoin/day", estimate.CoinsPerDay),
+		Workers:         int(info.GenProcLimit),
+		HashesPerSec:    info.HashesPerSec,
+		CoinsPerDay:     estimate.CoinsPerDay,
+		BlocksFound:     blocksFound,
+		MiningAddresses: info.MiningAddrs,
+	}
+	if info.Generate {
+		device.Status = "on"
+	}
+	return device, nil
+}
+
+// SetDevice switches a miner on or off. Workers is the number of workers to
+// run, 0 to keep the current number. A running miner is resized. When no
+// mining address is set yet, the blocks are paid to a new wallet address.
+func SetDevice(deviceID string, on bool, workers int) (*Device, error) {
+	if deviceID != "" && deviceID != CPUDeviceID {
+		return nil, orcaRouter.Errorf(http.StatusNotFound, "no mining device %q", deviceID)
+	}
+	if workers < 0 {
+		return nil, orcaRouter.Errorf(http.StatusBadRequest, "workers cannot be negative")
+	}
+	info, err := miningInfo()
+	if err != nil {
+		return nil, err
+	}
+	if !on {
+		err = orcaBlockchain.Node(func(client *rpcclient.Client) error {
+			return client.SetGenerate(false, 0)
+		})
+	} else {
+		if workers == 0 {
+			workers = int(info.GenProcLimit)
+		}
+		err = startMiner(workers, len(info.MiningAddrs) == 0)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := sample(time.Now()); err != nil {
+		return nil, err
+	}
+	if info, err = miningInfo(); err != nil {
+		return nil, err
+	}
+	return cpuDevice(info)
+}
+
+func startMiner(workers int, newAddress bool) error {
+	if !newAddress {
+		return orcaBlockchain.Node(func(client *rpcclient.Client) error {
+			return client.SetGenerate(true, workers)
+		})
+	}
+	var address btcutil.Address
+	err := orcaBlockchain.Wallet(func(client *rpcclient.Client) error {
+		var err error
+		address, err = client.GetNewAddress("default")
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return orcaBlockchain.Node(func(client *rpcclient.Client) error {
+		return client.SetGenerateToAddress(true, workers, address)
+	})
+}
+
+// Record the hashrate of the miner and check the blocks added since the last
+// sample for blocks paying the mining addresses.
+func sample(now time.Time) error {
+	sampleMutex.Lock()
+	defer sampleMutex.Unlock()
+
+	info, err := miningInfo()
+	if err != nil {
+		return err
+	}
+	s := HashrateSample{Time: now, HashesPerSec: info.HashesPerSec}
+	if info.Generate {
+		s.Workers = int(info.GenProcLimit)
+	}
+	Manager.Mutex.Lock()
+	Manager.addSample(s)
+	from := Manager.Height + 1
+	Manager.Mutex.Unlock()
+	// Only blocks added after the first sample are checked. A reorg to a
+	// shorter chain moves the height back.
+	if from == 0 || from > info.Blocks || len(info.MiningAddrs) == 0 {
+		setHeight(info.Blocks)
+		return nil
+	}
+	if from < info.Blocks-maxBlocksChecked+1 {
+		from = info.Blocks - maxBlocksChecked + 1
+	}
+	addresses := make(map[string]bool, len(info.MiningAddrs))
+	for _, address := range info.MiningAddrs {
+		addresses[address] = true
+	}
+	for height := from; height <= info.Blocks; height++ {
+		block, err := checkBlock(height, addresses)
+		if err != nil {
+			return err
+		}
+		if block != nil {
+			Manager.Mutex.Lock()
+			Manager.addBlock(*block)
+			Manager.Mutex.Unlock()
+			orcaEvents.Publish(orcaEvents.MiningBlockFound, orcaEvents.MiningBlockData{
+				Hash:   block.Hash,
+				Height: block.Height,
+				Reward: block.Reward,
+			})
+		}
+		setHeight(height)
+	}
+	return nil
+}
+
+func setHeight(height int64) {
+	Manager.Mutex.Lock()
+	Manager.Height = height
+	Manager.Mutex.Unlock()
+}
+
+// Return the block at height if its coinbase pays one of addresses.
+func checkBlock(height int64, addresses map[string]bool) (*FoundBlock, error) {
+	var block *btcjson.GetBlockVerboseTxResult
+	err := orcaBlockchain.Node(func(client *rpcclient.Client) error {
+		hash, err := client.GetBlockHash(height)
+		if err != nil {
+			return err
+		}
+		block, err = client.GetBlockVerboseTx(hash)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	// btcd sends the transactions as rawtx
+	txs := block.RawTx
+	if len(txs) == 0 {
+		txs = block.Tx
+	}
+	if len(txs) == 0 {
+		return nil, nil
+	}
+	var reward float64
+	for _, out := range txs[0].Vout {
+		paid := addresses[out.ScriptPubKey.Address]
+		for _, address := range out.ScriptPubKey.Addresses {
+			paid = paid || addresses[address]
+		}
+		if paid {
+			reward += out.Value
+		}
+	}
+	if reward == 0 {
+		return nil, nil
+	}
+	return &FoundBlock{
+		Hash:   block.Hash,
+		Height: block.Height,
+		Time:   time.Unix(block.Time, 0),
+		Reward: reward,
+	}, nil
+}
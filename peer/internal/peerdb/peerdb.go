@@ -0,0 +1,347 @@
+package peerdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	orcaGeo "orca-peer/internal/geo"
+)
+
+const (
+	// Number of latency samples kept per peer.
+	LatencyHistorySize = 20
+	// How often the database is written to disk if anything changed.
+	saveInterval = 10 * time.Second
+)
+
+type LatencySample struct {
+	Time  time.Time `json:"time"`
+	RTTMs float64   `json:"rttMs"`
+}
+
+// Record is everything we know about a peer we have been connected to.
+type Record struct {
+	PeerID         string           `json:"peerId"`
+	Addresses      []string         `json:"addresses"`
+	Connection     string           `json:"connection"`
+	AgentVersion   string           `json:"agentVersion"`
+	Protocols      []string         `json:"protocols"`
+	FirstSeen      time.Time        `json:"firstSeen"`
+	LastSeen       time.Time        `json:"lastSeen"`
+	Location       orcaGeo.Location `json:"location"`
+	LatencyHistory []LatencySample  `json:"latencyHistory"`
+	BytesSent      int64            `json:"bytesSent"`
+	BytesReceived  int64            `json:"bytesReceived"`
+	ChunksSent     int64            `json:"chunksSent"`
+	ChunksReceived int64            `json:"chunksReceived"`
+	Connected      bool             `json:"connected"`
+	ConnectedSince time.Time        `json:"connectedSince"`
+}
+
+// Latency returns the most recent round trip time in milliseconds, or -1 if the
+// peer has never answered a ping.
+func (r *Record) Latency() float64 {
+	if len(r.LatencyHistory) == 0 {
+		return -1
+	}
+	return r.LatencyHistory[len(r.LatencyHistory)-1].RTTMs
+}
+
+// Uptime returns the number of seconds the peer has been continuously connected.
+func (r *Record) Uptime(now time.Time) int64 {
+	if !r.Connected {
+		return 0
+	}
+	return int64(now.Sub(r.ConnectedSince).Seconds())
+}
+
+func (r *Record) clone() Record {
+	c := *r
+	c.Addresses = append([]string(nil), r.Addresses...)
+	c.Protocols = append([]string(nil), r.Protocols...)
+	c.LatencyHistory = append([]LatencySample(nil), r.LatencyHistory...)
+	return c
+}
+
+// Store is a concurrency safe peer database. Changes are kept in memory and
+// flushed to disk periodically by RunPeriodicSave, or explicitly with Save.
+type Store struct {
+	path    string
+	mutex   sync.RWMutex
+	records map[string]*Record
+	changed bool
+}
+
+// New returns an empty store that is never written to disk.
+func New() *Store {
+	return &Store{records: make(map[string]*Record)}
+}
+
+// Open loads the database stored at path, starting empty if the file does not
+// exist yet. Connection state is not carried over from the previous run.
+func Open(path string) (*Store, error) {
+	s := New()
+	s.path = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var records []Record
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, err
+	}
+	for i := range records {
+		record := records[i]
+		if record.PeerID == "" {
+			continue
+		}
+		record.Connected = false
+		s.records[record.PeerID] = &record
+	}
+	return s, nil
+}
+
+func (s *Store) Get(peerID string) (Record, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	record, ok := s.records[peerID]
+	if !ok {
+		return Record{}, false
+	}
+	return record.clone(), true
+}
+
+// All returns a copy of every record in the store.
+func (s *Store) All() []Record {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	records := make([]Record, 0, len(s.records))
+	for _, record := range s.records {
+		records = append(records, record.clone())
+	}
+	return records
+}
+
+// Update applies fn to the record of peerID under the store lock, creating the
+// record first if the peer has not been seen before. It reports whether the
+// record was created.
+func (s *Store) Update(peerID string, fn func(*Record)) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	record, ok := s.records[peerID]
+	if !ok {
+		record = &Record{PeerID: peerID, FirstSeen: time.Now()}
+		s.records[peerID] = record
+	}
+	fn(record)
+	s.changed = true
+	return !ok
+}
+
+// UpdateExisting is like Update but does nothing for unknown peers.
+func (s *Store) UpdateExisting(peerID string, fn func(*Record)) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	record, ok := s.records[peerID]
+	if !ok {
+		return false
+	}
+	fn(record)
+	s.changed = true
+	return true
+}
+
+func (s *Store) AddLatencySample(peerID string, rtt time.Duration) {
+	s.UpdateExisting(peerID, func(r *Record) {
+		r.LatencyHistory = append(r.LatencyHistory, LatencySample{
+			Time:  time.Now(),
+			RTTMs: float64(rtt.Microseconds()) / 1000,
+		})
+		if len(r.LatencyHistory) > LatencyHistorySize {
+			r.LatencyHistory = r.LatencyHistory[len(r.LatencyHistory)-LatencyHistorySize:]
+		}
+	})
+}
+
+// AddTransfer records a chunk exchanged with the peer. Either byte count may be zero.
+func (s *Store) AddTransfer(peerID string, sent int64, received int64) {
+	s.Update(peerID, func(r *Record) {
+		r.BytesSent += sent
+		r.BytesReceived += received
+		if sent > 0 {
+			r.ChunksSent++
+		}
+		if received > 0 {
+			r.ChunksReceived++
+		}
+	})
+}
+
+// Save writes the database to disk. It is a no-op for stores created with New.
+func (s *Store) Save() error {
+	if s.path == "" {
+		return nil
+	}
+	s.mutex.Lock()
+	records := make([]Record, 0, len(s.records))
+	for _, record := range s.records {
+		records = append(records, record.clone())
+	}
+	s.changed = false
+	s.mutex.Unlock()
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].FirstSeen.Before(records[j].FirstSeen)
+	})
+	data, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	// Write to a temporary file first so a crash never leaves a truncated database.
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.path)
+}
+
+// RunPeriodicSave flushes the database whenever it changed, until ctx is
+// cancelled.
+func (s *Store) RunPeriodicSave(ctx context.Context) {
+	ticker := time.NewTicker(saveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.mutex.RLock()
+		changed := s.changed
+		s.mutex.RUnlock()
+		if changed {
+			s.Save()
+		}
+	}
+}
+
+var (
+	defaultStore = New()
+	defaultMutex sync.RWMutex
+)
+
+// Init replaces the store shared by the node with the database at path and
+// saves it periodically until ctx is cancelled.
+func Init(ctx context.Context, path string) error {
+	store, err := Open(path)
+	if err != nil {
+		return err
+	}
+	defaultMutex.Lock()
+	defaultStore = store
+	defaultMutex.Unlock()
+	go store.RunPeriodicSave(ctx)
+	return nil
+}
+
+// Default returns the store shared by the node. Until Init is called it is an
+// in-memory store.
+func Default() *Store {
+	defaultMutex.RLock()
+	defer defaultMutex.RUnlock()
+	return defaultStore
+}
+
+// Filter selects and orders records for Query. Zero values disable a criterion.
+type Filter struct {
+	// Matches the country, country code, continent or region, case insensitive.
+	Region string
+	// Only peers whose last measured latency is at most MaxLatency milliseconds.
+	MaxLatency float64
+	// Only peers connected for at least MinUptime seconds.
+	MinUptime int64
+	// Only peers with an open connection.
+	ConnectedOnly bool
+	// One of "latency", "uptime", "lastSeen" or "firstSeen". Defaults to peer ID.
+	SortBy string
+	Offset int
+	Limit  int
+}
+
+// Query returns the page of records matching f together with the total number
+// of matches before pagination.
+func (s *Store) Query(f Filter) ([]Record, int) {
+	now := time.Now()
+	matches := make([]Record, 0)
+	for _, record := range s.All() {
+		if f.ConnectedOnly && !record.Connected {
+			continue
+		}
+		if f.Region != "" && !matchesRegion(record.Location, f.Region) {
+			continue
+		}
+		if f.MaxLatency > 0 {
+			latency := record.Latency()
+			if latency < 0 || latency > f.MaxLatency {
+				continue
+			}
+		}
+		if f.MinUptime > 0 && record.Uptime(now) < f.MinUptime {
+			continue
+		}
+		matches = append(matches, record)
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := &matches[i], &matches[j]
+		switch f.SortBy {
+		case "latency":
+			// Peers without a measurement go last.
+			la, lb := a.Latency(), b.Latency()
+			if la < 0 || lb < 0 {
+				return lb < 0 && la >= 0
+			}
+			return la < lb
+		case "uptime":
+			return a.Uptime(now) > b.Uptime(now)
+		case "lastSeen":
+			return a.LastSeen.After(b.LastSeen)
+		case "firstSeen":
+			return a.FirstSeen.Before(b.FirstSeen)
+		}
+		return a.PeerID < b.PeerID
+	})
+
+	total := len(matches)
+	if f.Offset > 0 {
+		if f.Offset >= len(matches) {
+			return []Record{}, total
+		}
+		matches = matches[f.Offset:]
+	}
+	if f.Limit > 0 && f.Limit < len(matches) {
+		matches = matches[:f.Limit]
+	}
+	return matches, total
+}
+
+func matchesRegion(location orcaGeo.Location, region string) bool {
+	for _, field := range []string{location.Country, location.CountryCode, location.Continent, location.Region} {
+		if strings.EqualFold(field, region) {
+			return true
+		}
+	}
+	return false
+}
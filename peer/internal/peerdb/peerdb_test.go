@@ -0,0 +1,79 @@
+package peerdb
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	orcaGeo "orca-peer/internal/geo"
+)
+
+func TestStorePersistsRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.json")
+	store, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Update("peer-a", func(r *Record) {
+		r.Connected = true
+		r.ConnectedSince = time.Now()
+		r.AgentVersion = "orcanet/1.0"
+	})
+	store.AddLatencySample("peer-a", 15*time.Millisecond)
+	store.AddTransfer("peer-a", 100, 0)
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, ok := reloaded.Get("peer-a")
+	if !ok {
+		t.Fatal("record was not loaded from disk")
+	}
+	if record.Connected {
+		t.Error("connection state should not survive a restart")
+	}
+	if record.AgentVersion != "orcanet/1.0" || record.BytesSent != 100 || record.Latency() != 15 {
+		t.Errorf("unexpected record %+v", record)
+	}
+	if record.FirstSeen.IsZero() {
+		t.Error("first seen time was not set")
+	}
+}
+
+func TestQueryFiltersAndPaginates(t *testing.T) {
+	store := New()
+	now := time.Now()
+	for _, p := range []struct {
+		id      string
+		country string
+		latency time.Duration
+		uptime  time.Duration
+	}{
+		{"peer-a", "US", 10 * time.Millisecond, time.Hour},
+		{"peer-b", "US", 80 * time.Millisecond, time.Minute},
+		{"peer-c", "DE", 20 * time.Millisecond, time.Hour},
+		{"peer-d", "US", 30 * time.Millisecond, 2 * time.Hour},
+	} {
+		p := p
+		store.Update(p.id, func(r *Record) {
+			r.Location = orcaGeo.Location{CountryCode: p.country}
+			r.Connected = true
+			r.ConnectedSince = now.Add(-p.uptime)
+		})
+		store.AddLatencySample(p.id, p.latency)
+	}
+
+	records, total := store.Query(Filter{Region: "us", MaxLatency: 50, SortBy: "latency"})
+	if total != 2 || len(records) != 2 || records[0].PeerID != "peer-a" || records[1].PeerID != "peer-d" {
+		t.Errorf("unexpected region and latency query result %v (total %d)", records, total)
+	}
+
+	records, total = store.Query(Filter{MinUptime: 3600, SortBy: "uptime", Offset: 1, Limit: 1})
+	if total != 3 || len(records) != 1 || records[0].PeerID != "peer-a" && records[0].PeerID != "peer-c" {
+		t.Errorf("unexpected uptime query result %v (total %d)", records, total)
+	}
+}
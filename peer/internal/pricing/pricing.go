@@ -0,0 +1,302 @@
+package pricing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"orca-peer/internal/fileshare"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Policy is how the node prices the files it holds. Prices are per MiB.
+// Surcharges and discounts are percentages of the price of a file; of several
+// that apply, the largest is used.
+type Policy struct {
+	// Price of files without their own price
+	Default int64 `json:"default"`
+	// Prices of single files by file hash
+	Files map[string]int64 `json:"files,omitempty"`
+	// Files up to this size in bytes are free, 0 for no free tier
+	FreeBytes int64 `json:"freeBytes,omitempty"`
+	// Peers that download every file for free
+	FreePeers       []string         `json:"freePeers,omitempty"`
+	TimeSurges      []TimeSurge      `json:"timeSurges,omitempty"`
+	LoadSurges      []LoadSurge      `json:"loadSurges,omitempty"`
+	VolumeDiscounts []VolumeDiscount `json:"volumeDiscounts,omitempty"`
+}
+
+// TimeSurge raises prices from StartHour until EndHour UTC. The window wraps
+// around midnight if EndHour is not after StartHour.
+type TimeSurge struct {
+	StartHour int `json:"startHour"`
+	EndHour   int `json:"endHour"`
+	Percent   int `json:"percent"`
+}
+
+// LoadSurge raises prices while the node serves at least Downloads peers.
+type LoadSurge struct {
+	Downloads int `json:"downloads"`
+	Percent   int `json:"percent"`
+}
+
+// VolumeDiscount lowers the price of files of at least MinBytes.
+type VolumeDiscount struct {
+	MinBytes int64 `json:"minBytes"`
+	Percent  int   `json:"percent"`
+}
+
+func (p Policy) Validate() error {
+	if p.Default < 0 {
+		return errors.New("default price cannot be negative")
+	}
+	for hash, price := range p.Files {
+		if price < 0 {
+			return fmt.Errorf("price of %s cannot be negative", hash)
+		}
+	}
+	if p.FreeBytes < 0 {
+		return errors.New("freeBytes cannot be negative")
+	}
+	for _, id := range p.FreePeers {
+		if _, err := peer.Decode(id); err != nil {
+			return fmt.Errorf("%s is not a peer ID: %w", id, err)
+		}
+	}
+	for _, surge := range p.TimeSurges {
+		if surge.StartHour < 0 || surge.StartHour > 23 || surge.EndHour < 0 || surge.EndHour > 24 {
+			return errors.New("hours of time surges must be between 0 and 24")
+		}
+		if surge.Percent < 0 {
+			return errors.New("surcharges cannot be negative")
+		}
+	}
+	for _, surge := range p.LoadSurges {
+		if surge.Downloads < 1 {
+			return errors.New("load surges need at least 1 download")
+		}
+		if surge.Percent < 0 {
+			return errors.New("surcharges cannot be negative")
+		}
+	}
+	for _, discount := range p.VolumeDiscounts {
+		if discount.MinBytes < 0 || discount.Percent < 0 || discount.Percent > 100 {
+			return errors.New("volume discounts need a size and a percentage between 0 and 100")
+		}
+	}
+	return nil
+}
+
+// Price returns the price of a file before surcharges and discounts.
+func (p Policy) Price(fileHash string) int64 {
+	if price, ok := p.Files[fileHash]; ok {
+		return price
+	}
+	return p.Default
+}
+
+// Schedule returns the schedule announced on the market with every file.
+func (p Policy) Schedule() *fileshare.PriceSchedule {
+	schedule := &fileshare.PriceSchedule{FreeBytes: p.FreeBytes}
+	for _, surge := range p.TimeSurges {
+		schedule.TimeSurges = append(schedule.TimeSurges, &fileshare.TimeSurge{
+			StartHour: int32(surge.StartHour),
+			EndHour:   int32(surge.EndHour),
+			Percent:   int32(surge.Percent),
+		})
+	}
+	for _, surge := range p.LoadSurges {
+		schedule.LoadSurges = append(schedule.LoadSurges, &fileshare.LoadSurge{
+			Downloads: int32(surge.Downloads),
+			Percent:   int32(surge.Percent),
+		})
+	}
+	for _, discount := range p.VolumeDiscounts {
+		schedule.VolumeDiscounts = append(schedule.VolumeDiscounts, &fileshare.VolumeDiscount{
+			MinBytes: discount.MinBytes,
+			Percent:  int32(discount.Percent),
+		})
+	}
+	return schedule
+}
+
+// Quote returns what peerId pays per MiB of a file of fileSize bytes at t while
+// the node serves downloads peers.
+func (p Policy) Quote(fileHash string, fileSize int64, peerId string, downloads int, t time.Time) int64 {
+	for _, id := range p.FreePeers {
+		if id == peerId {
+			return 0
+		}
+	}
+	return Evaluate(p.Price(fileHash), p.Schedule(), fileSize, downloads, t)
+}
+
+// Evaluate applies schedule to price for a file of fileSize bytes at t while
+// the holder serves downloads peers. A fileSize of 0 means the size is unknown,
+// the free tier and discounts are left out then.
+func Evaluate(price int64, schedule *fileshare.PriceSchedule, fileSize int64, downloads int, t time.Time) int64 {
+	if schedule == nil {
+		return price
+	}
+	if fileSize > 0 && fileSize <= schedule.GetFreeBytes() {
+		return 0
+	}
+	surcharge := int64(0)
+	hour := int32(t.UTC().Hour())
+	for _, surge := range schedule.GetTimeSurges() {
+		start, end := surge.GetStartHour(), surge.GetEndHour()
+		inWindow := hour >= start && hour < end
+		if end <= start {
+			inWindow = hour >= start || hour < end
+		}
+		if inWindow {
+			surcharge = max(surcharge, int64(surge.GetPercent()))
+		}
+	}
+	for _, surge := range schedule.GetLoadSurges() {
+		if downloads >= int(surge.GetDownloads()) {
+			surcharge = max(surcharge, int64(surge.GetPercent()))
+		}
+	}
+	discount := int64(0)
+	for _, volume := range schedule.GetVolumeDiscounts() {
+		if fileSize > 0 && fileSize >= volume.GetMinBytes() {
+			discount = max(discount, int64(volume.GetPercent()))
+		}
+	}
+	return price * (100 + surcharge) * (100 - discount) / 10000
+}
+
+// HolderPrice returns what holder announced it charges per MiB of a file of
+// fileSize bytes at t, without surcharges for its load that only the holder
+// knows.
+func HolderPrice(holder *fileshare.User, fileSize int64, t time.Time) int64 {
+	return Evaluate(holder.GetPrice(), holder.GetSchedule(), fileSize, 0, t)
+}
+
+// Store keeps the policy of the node in a JSON file and tells listeners when it
+// changes.
+type Store struct {
+	path      string
+	mutex     sync.RWMutex
+	policy    Policy
+	listeners []func(Policy)
+}
+
+// Open loads the policy stored at path. Until one is stored every file costs
+// defaultPrice.
+func Open(path string, defaultPrice int64) (*Store, error) {
+	s := &Store{path: path, policy: Policy{Default: defaultPrice}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.policy); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Policy returns a copy of the current policy.
+func (s *Store) Policy() Policy {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	policy := s.policy
+	policy.Files = make(map[string]int64, len(s.policy.Files))
+	for hash, price := range s.policy.Files {
+		policy.Files[hash] = price
+	}
+	return policy
+}
+
+// Set replaces the policy, saves it and calls the listeners.
+func (s *Store) Set(policy Policy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	s.policy = policy
+	err := s.save()
+	listeners := s.listeners
+	s.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	for _, listener := range listeners {
+		listener(policy)
+	}
+	return nil
+}
+
+// SetFilePrice gives a file its own price. Listeners are not called, the file
+// is expected to be announced right after.
+func (s *Store) SetFilePrice(fileHash string, price int64) error {
+	if price < 0 {
+		return errors.New("price cannot be negative")
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.policy.Files == nil {
+		s.policy.Files = make(map[string]int64)
+	}
+	s.policy.Files[fileHash] = price
+	return s.save()
+}
+
+// OnChange registers fn to be called with the new policy after every Set.
+func (s *Store) OnChange(fn func(Policy)) {
+	s.mutex.Lock()
+	s.listeners = append(s.listeners, fn)
+	s.mutex.Unlock()
+}
+
+// Write the policy to a temporary file first so a crash never leaves a
+// truncated file behind. Must be called with the mutex held.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.policy, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.path)
+}
+
+var (
+	defaultStore = &Store{}
+	defaultMutex sync.RWMutex
+)
+
+// Init makes the policy stored at path the policy of the node.
+func Init(path string, defaultPrice int64) error {
+	store, err := Open(path, defaultPrice)
+	if err != nil {
+		return err
+	}
+	defaultMutex.Lock()
+	defaultStore = store
+	defaultMutex.Unlock()
+	return nil
+}
+
+// Default returns the store of the node. Until Init is called it is an
+// in-memory store where every file is free.
+func Default() *Store {
+	defaultMutex.RLock()
+	defer defaultMutex.RUnlock()
+	return defaultStore
+}
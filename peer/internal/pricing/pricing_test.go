@@ -0,0 +1,104 @@
+package pricing
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testPeer = "12D3KooWDpJ7As7BWAwRMfu1VU2WCqNjvq387JEYKDBj4kx6nXTN"
+
+func TestQuote(t *testing.T) {
+	policy := Policy{
+		Default:         10,
+		Files:           map[string]int64{"special": 40},
+		FreeBytes:       1000,
+		FreePeers:       []string{testPeer},
+		TimeSurges:      []TimeSurge{{StartHour: 18, EndHour: 22, Percent: 50}, {StartHour: 23, EndHour: 2, Percent: 20}},
+		LoadSurges:      []LoadSurge{{Downloads: 5, Percent: 100}},
+		VolumeDiscounts: []VolumeDiscount{{MinBytes: 1 << 30, Percent: 25}},
+	}
+	if err := policy.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	hour := func(h int) time.Time { return time.Date(2024, 4, 1, h, 30, 0, 0, time.UTC) }
+	for _, test := range []struct {
+		name      string
+		fileHash  string
+		fileSize  int64
+		peerId    string
+		downloads int
+		at        time.Time
+		want      int64
+	}{
+		{"default price", "file", 1 << 20, "", 0, hour(12), 10},
+		{"own price", "special", 1 << 20, "", 0, hour(12), 40},
+		{"free tier", "special", 1000, "", 0, hour(12), 0},
+		{"unknown size", "file", 0, "", 0, hour(12), 10},
+		{"allow-listed peer", "special", 1 << 20, testPeer, 5, hour(19), 0},
+		{"evening surge", "file", 1 << 20, "", 0, hour(19), 15},
+		{"surge past midnight", "file", 1 << 20, "", 0, hour(1), 12},
+		{"largest surge applies", "file", 1 << 20, "", 5, hour(19), 20},
+		{"volume discount", "file", 2 << 30, "", 0, hour(12), 7},
+	} {
+		if got := policy.Quote(test.fileHash, test.fileSize, test.peerId, test.downloads, test.at); got != test.want {
+			t.Errorf("%s: quoted %d, want %d", test.name, got, test.want)
+		}
+	}
+
+	// Consumers get the same price from the announced schedule, apart from the
+	// surcharge for load
+	if got := Evaluate(policy.Price("file"), policy.Schedule(), 2<<30, 0, hour(19)); got != 11 {
+		t.Errorf("schedule evaluates to %d, want 11", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, policy := range []Policy{
+		{Default: -1},
+		{Files: map[string]int64{"file": -1}},
+		{FreePeers: []string{"not a peer"}},
+		{TimeSurges: []TimeSurge{{StartHour: 24, EndHour: 2}}},
+		{LoadSurges: []LoadSurge{{Downloads: 0, Percent: 10}}},
+		{VolumeDiscounts: []VolumeDiscount{{MinBytes: 1, Percent: 101}}},
+	} {
+		if policy.Validate() == nil {
+			t.Errorf("%+v is valid", policy)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pricing.json")
+	s, err := Open(path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Policy().Default != 3 {
+		t.Fatalf("default price without a stored policy is %d", s.Policy().Default)
+	}
+	changes := 0
+	s.OnChange(func(Policy) { changes++ })
+	if err := s.Set(Policy{Default: 5, LoadSurges: []LoadSurge{{Downloads: 2, Percent: 10}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetFilePrice("file", 8); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set(Policy{Default: -1}); err == nil {
+		t.Fatal("invalid policy was accepted")
+	}
+	if changes != 1 {
+		t.Errorf("listeners were called %d times, want 1", changes)
+	}
+
+	// The stored policy wins over the default price
+	s, err = Open(path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := s.Policy()
+	if policy.Default != 5 || policy.Price("file") != 8 || len(policy.LoadSurges) != 1 {
+		t.Errorf("reopened policy is %+v", policy)
+	}
+}
@@ -0,0 +1,164 @@
+package router
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+/*
+ * Every route declares the scope a token needs to call it. Tokens are sent as
+ * "Authorization: Bearer <token>", or as the access_token query parameter by
+ * clients like EventSource that can not set headers. Public routes are the ones
+ * other peers call to transfer files and payments and need no token; they are
+ * the only routes served by PublicHandler.
+ */
+const (
+	ScopePublic = "public"
+	// Reading node state without changing it
+	ScopeRead = "read"
+	// Importing, deleting and downloading files and controlling their jobs
+	ScopeFiles = "files"
+	// Anything that spends coins
+	ScopeWallet = "wallet"
+	// Everything, including node settings, peers and mining devices
+	ScopeAdmin = "admin"
+)
+
+var scopes = []string{ScopePublic, ScopeRead, ScopeFiles, ScopeWallet, ScopeAdmin}
+
+func validScope(scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Token grants its scopes to requests that present Secret.
+type Token struct {
+	Secret string
+	Scopes []string
+}
+
+// ParseToken reads a token written as "<scope>[+<scope>...]:<secret>", for
+// example "read+files:0b4f...".
+func ParseToken(s string) (Token, error) {
+	scopeList, secret, ok := strings.Cut(s, ":")
+	if !ok || secret == "" {
+		return Token{}, fmt.Errorf("api token must be written as <scope>[+<scope>]:<secret>")
+	}
+	token := Token{Secret: secret}
+	for _, scope := range strings.Split(scopeList, "+") {
+		if !validScope(scope) || scope == ScopePublic {
+			return Token{}, fmt.Errorf("unknown api token scope %q, use read, files, wallet or admin", scope)
+		}
+		token.Scopes = append(token.Scopes, scope)
+	}
+	return token, nil
+}
+
+func (t Token) allows(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteCookie creates a token with every scope and writes its secret to path,
+// readable only by the current user, like the RPC cookie of btcd. Local clients
+// read the file instead of being configured with a token.
+func WriteCookie(path string) (Token, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return Token{}, err
+	}
+	token := Token{Secret: hex.EncodeToString(secret), Scopes: []string{ScopeAdmin}}
+	if err := os.WriteFile(path, []byte(token.Secret), 0600); err != nil {
+		return Token{}, err
+	}
+	return token, nil
+}
+
+// Access controls who may call the routes of a router.
+type Access struct {
+	Tokens []Token
+	// Serve every route without a token. Only meant for an API bound to loopback.
+	NoAuth bool
+	// Origins browsers may call the API from, "*" allows any. Requests from
+	// other origins are refused.
+	Origins []string
+}
+
+// SetAccess replaces the access rules of the default router.
+func SetAccess(access Access) {
+	Default.SetAccess(access)
+}
+
+func (rt *Router) SetAccess(access Access) {
+	rt.mutex.Lock()
+	rt.access = access
+	rt.mutex.Unlock()
+}
+
+// Return the secret the request was sent with.
+func bearerToken(r *http.Request) string {
+	if scheme, secret, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(secret)
+	}
+	return r.URL.Query().Get("access_token")
+}
+
+// Check that the request may call a route of the given scope.
+func (access *Access) authorize(r *http.Request, scope string) *Error {
+	if scope == ScopePublic || access.NoAuth {
+		return nil
+	}
+	secret := bearerToken(r)
+	if secret == "" {
+		return Errorf(http.StatusUnauthorized, "an API token is required")
+	}
+	for _, token := range access.Tokens {
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(token.Secret)) != 1 {
+			continue
+		}
+		if !token.allows(scope) {
+			return Errorf(http.StatusForbidden, "the API token does not have the %s scope", scope)
+		}
+		return nil
+	}
+	return Errorf(http.StatusUnauthorized, "invalid API token")
+}
+
+// Report whether a browser on origin may call the API. Requests without an
+// Origin header do not come from a browser and same origin requests come from
+// pages the node serves itself.
+func (access *Access) allowsOrigin(r *http.Request, origin string) bool {
+	if origin == "" || origin == "http://"+r.Host || origin == "https://"+r.Host {
+		return true
+	}
+	for _, allowed := range access.Origins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// Set the CORS headers for an allowed cross origin request.
+func setCORSHeaders(w http.ResponseWriter, origin string, methods []string) {
+	header := w.Header()
+	header.Set("Access-Control-Allow-Origin", origin)
+	header.Add("Vary", "Origin")
+	header.Set("Access-Control-Allow-Methods", strings.Join(append(methods, http.MethodOptions), ", "))
+	header.Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+	header.Set("Access-Control-Expose-Headers", "Deprecation, Link, X-Total-Count")
+	header.Set("Access-Control-Max-Age", "600")
+}
@@ -0,0 +1,108 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func request(rt http.Handler, method string, target string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	rt.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestScopes(t *testing.T) {
+	rt := testRouter()
+	reader, err := ParseToken("read:reader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt.SetAccess(Access{Tokens: []Token{reader, {Secret: "root", Scopes: []string{ScopeAdmin}}}})
+
+	for _, test := range []struct {
+		method, target, authorization string
+		status                        int
+	}{
+		{http.MethodGet, "/api/v1/peers", "", http.StatusUnauthorized},
+		{http.MethodGet, "/get-peers", "", http.StatusUnauthorized},
+		{http.MethodGet, "/api/v1/peers", "Bearer wrong", http.StatusUnauthorized},
+		{http.MethodGet, "/api/v1/peers", "Bearer reader", http.StatusOK},
+		{http.MethodGet, "/api/v1/peers?access_token=reader", "", http.StatusOK},
+		{http.MethodPost, "/api/v1/peers/ban", "Bearer reader", http.StatusForbidden},
+		{http.MethodPost, "/ban-peer", "Bearer reader", http.StatusForbidden},
+		{http.MethodGet, "/api/v1/peers", "Bearer root", http.StatusOK},
+		{http.MethodGet, "/get-file", "", http.StatusOK},
+	} {
+		rec := request(rt, test.method, test.target, map[string]string{"Authorization": test.authorization})
+		if rec.Code != test.status {
+			t.Errorf("%s %s with %q: status %d, want %d", test.method, test.target, test.authorization, rec.Code, test.status)
+		}
+		if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s %s: 401 without WWW-Authenticate", test.method, test.target)
+		}
+	}
+
+	if _, err := ParseToken("spend:secret"); err == nil {
+		t.Error("unknown scope should not parse")
+	}
+	if _, err := ParseToken("read"); err == nil {
+		t.Error("token without a secret should not parse")
+	}
+}
+
+func TestPublicHandler(t *testing.T) {
+	public := testRouter().PublicHandler()
+	if rec := request(public, http.MethodGet, "/get-file", nil); rec.Code != http.StatusOK || rec.Body.String() != "chunk" {
+		t.Fatalf("GET /get-file = %d %q", rec.Code, rec.Body.String())
+	}
+	// Even without authentication the API is not served to peers
+	if rec := request(public, http.MethodGet, "/api/v1/peers", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("GET /api/v1/peers on the public handler = %d", rec.Code)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	rt := testRouter()
+	rt.SetAccess(Access{NoAuth: true, Origins: []string{"http://localhost:3000"}})
+
+	rec := request(rt, http.MethodOptions, "/api/v1/peers", map[string]string{
+		"Origin":                        "http://localhost:3000",
+		"Access-Control-Request-Method": http.MethodGet,
+	})
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Origin") != "http://localhost:3000" {
+		t.Fatalf("preflight = %d %v", rec.Code, rec.Header())
+	}
+
+	rec = request(rt, http.MethodGet, "/api/v1/peers", map[string]string{"Origin": "http://localhost:3000"})
+	if rec.Code != http.StatusOK || rec.Header().Get("Access-Control-Allow-Origin") != "http://localhost:3000" {
+		t.Fatalf("GET from allowed origin = %d %v", rec.Code, rec.Header())
+	}
+
+	// Pages on other sites can not use the API of a node running without auth
+	rec = request(rt, http.MethodGet, "/api/v1/peers", map[string]string{"Origin": "http://evil.example"})
+	if rec.Code != http.StatusForbidden || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("GET from other origin = %d %v", rec.Code, rec.Header())
+	}
+}
+
+func TestWriteCookie(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.cookie")
+	token, err := WriteCookie(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != token.Secret || len(token.Secret) != 64 {
+		t.Fatalf("cookie %q does not hold the token %q (%v)", data, token.Secret, err)
+	}
+	if !token.allows(ScopeWallet) {
+		t.Error("cookie should grant every scope")
+	}
+}
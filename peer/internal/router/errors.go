@@ -0,0 +1,67 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Error is the body of every failed request under Prefix.
+type Error struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Errorf returns an Error with the given status and a formatted message.
+func Errorf(status int, format string, args ...interface{}) *Error {
+	return &Error{Status: status, Message: fmt.Sprintf(format, args...)}
+}
+
+// Code turns a status into the machine readable code of the envelope, e.g.
+// 404 becomes "not_found".
+func Code(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+	return strings.ToLower(strings.NewReplacer(" ", "_", "-", "_", "'", "").Replace(text))
+}
+
+// WriteError writes err in the error envelope. Errors other than *Error are
+// reported as internal server errors.
+func WriteError(w http.ResponseWriter, err error) {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		apiErr = &Error{Status: http.StatusInternalServerError, Message: err.Error()}
+	}
+	if apiErr.Status == 0 {
+		apiErr.Status = http.StatusInternalServerError
+	}
+	if apiErr.Code == "" {
+		apiErr.Code = Code(apiErr.Status)
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(apiErr.Status)
+	}
+	WriteJSON(w, apiErr.Status, map[string]*Error{"error": apiErr})
+}
+
+// WriteJSON writes v as the JSON body of the response.
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		fmt.Println("Error:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
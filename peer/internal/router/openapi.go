@@ -0,0 +1,233 @@
+package router
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Version of the API reported in the OpenAPI document.
+const APIVersion = "1.0.0"
+
+type schemas struct {
+	defs  map[string]interface{}
+	names map[reflect.Type]string
+}
+
+// OpenAPI returns the OpenAPI 3 document of every route served under Prefix.
+func (rt *Router) OpenAPI() map[string]interface{} {
+	s := &schemas{
+		defs:  make(map[string]interface{}),
+		names: make(map[reflect.Type]string),
+	}
+	s.defs["ErrorResponse"] = map[string]interface{}{
+		"type":     "object",
+		"required": []string{"error"},
+		"properties": map[string]interface{}{
+			"error": s.schema(reflect.TypeOf(Error{})),
+		},
+	}
+
+	paths := make(map[string]interface{})
+	for _, route := range rt.Routes() {
+		if route.Path == "" {
+			continue
+		}
+		item, ok := paths[route.Path].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[route.Path] = item
+		}
+		item[strings.ToLower(route.Method)] = s.operation(route)
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "Orcanet peer node API",
+			"version":     APIVersion,
+			"description": "HTTP API of an Orcanet peer node. Errors are returned as an Error object with the HTTP status code.",
+		},
+		"servers": []interface{}{map[string]interface{}{"url": Prefix}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": s.defs,
+			"securitySchemes": map[string]interface{}{
+				"token": map[string]interface{}{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "An API token, or the contents of the api.cookie file in the data directory. The scope it needs is given by x-scope.",
+				},
+			},
+		},
+	}
+}
+
+func (s *schemas) operation(route Route) map[string]interface{} {
+	op := map[string]interface{}{
+		"operationId": operationId(route),
+		"summary":     route.Summary,
+	}
+	if route.Description != "" {
+		op["description"] = route.Description
+	}
+	if route.Tag != "" {
+		op["tags"] = []string{route.Tag}
+	}
+	if route.Legacy != "" {
+		op["x-legacy-path"] = route.Legacy
+	}
+	op["x-scope"] = route.Scope
+	if route.Scope == ScopePublic {
+		op["security"] = []interface{}{}
+	} else {
+		op["security"] = []interface{}{map[string]interface{}{"token": []string{}}}
+	}
+
+	parameters := make([]interface{}, 0)
+	for _, part := range strings.Split(route.Path, "/") {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			parameters = append(parameters, map[string]interface{}{
+				"name":     part[1 : len(part)-1],
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string"},
+			})
+		}
+	}
+	for _, param := range route.Query {
+		paramType := param.Type
+		if paramType == "" {
+			paramType = "string"
+		}
+		p := map[string]interface{}{
+			"name":     param.Name,
+			"in":       "query",
+			"required": param.Required,
+			"schema":   map[string]interface{}{"type": paramType},
+		}
+		if param.Description != "" {
+			p["description"] = param.Description
+		}
+		parameters = append(parameters, p)
+	}
+	if len(parameters) > 0 {
+		op["parameters"] = parameters
+	}
+
+	if route.Body != nil {
+		op["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": s.schema(reflect.TypeOf(route.Body))},
+			},
+		}
+	}
+
+	success := map[string]interface{}{"description": http.StatusText(http.StatusOK)}
+	if route.Response != nil {
+		success["content"] = map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": s.schema(reflect.TypeOf(route.Response))},
+		}
+	}
+	op["responses"] = map[string]interface{}{
+		"200": success,
+		"default": map[string]interface{}{
+			"description": "Error",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": ref("ErrorResponse")},
+			},
+		},
+	}
+	return op
+}
+
+// Build an operation id like "getPeers" or "postJobsPause" from the route.
+func operationId(route Route) string {
+	id := strings.ToLower(route.Method)
+	for _, part := range strings.FieldsFunc(route.Path, func(r rune) bool {
+		return r == '/' || r == '-' || r == '_' || r == '.' || r == '{' || r == '}'
+	}) {
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return id
+}
+
+func ref(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Return the JSON schema of t. Named structs are added to the components and
+// referenced.
+func (s *schemas) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json writes byte slices as base64
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": s.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.structSchema(t)
+		}
+		if name, ok := s.names[t]; ok {
+			return ref(name)
+		}
+		name := t.Name()
+		if _, taken := s.defs[name]; taken {
+			// Same name in another package
+			pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+			name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+		}
+		s.names[t] = name
+		s.defs[name] = map[string]interface{}{}
+		s.defs[name] = s.structSchema(t)
+		return ref(name)
+	}
+	return map[string]interface{}{}
+}
+
+func (s *schemas) structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := make([]string, 0)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := jsonName(f)
+		if name == "-" {
+			continue
+		}
+		properties[name] = s.schema(f.Type)
+		if isRequired(f) {
+			required = append(required, name)
+		}
+	}
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
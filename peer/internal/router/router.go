@@ -0,0 +1,394 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/*
+ * The router serves the whole HTTP API of the node. Every package describes its
+ * endpoints with a Route table, and the same table is used to dispatch requests,
+ * validate them and generate the OpenAPI document, so the published spec can not
+ * drift from what the node actually serves.
+ *
+ * Routes live under /api/v1. Most also keep their old unversioned path in Legacy
+ * so existing clients continue to work while they migrate. Versioned routes get
+ * method routing, request validation and errors in a single envelope:
+ *
+ *	{"error": {"status": 400, "code": "bad_request", "message": "..."}}
+ */
+
+const Prefix = "/api/v1"
+
+// Largest request body a route accepts unless it sets MaxBody.
+const DefaultMaxBody = 1 << 20
+
+// Param describes a query parameter.
+type Param struct {
+	Name        string
+	Description string
+	// One of "string", "integer", "number" or "boolean". Defaults to "string".
+	Type     string
+	Required bool
+}
+
+// Route describes one endpoint of the HTTP API.
+type Route struct {
+	Method string
+	// Path below Prefix. Segments written as {name} match any value which the
+	// handler reads with PathValue. Empty for routes only served under Legacy.
+	Path string
+	// Unversioned path the route used to be served at. A trailing slash matches
+	// every path below it, like http.ServeMux.
+	Legacy string
+	// Scope a token needs to call the route, see ScopeRead and the others.
+	Scope       string
+	Tag         string
+	Summary     string
+	Description string
+	Query       []Param
+	// A value of the type the handler decodes the request body into. Requests
+	// whose body does not decode into it, or leaves a field tagged
+	// validate:"required" empty, are rejected before the handler runs.
+	Body interface{}
+	// Largest request body in bytes, DefaultMaxBody when zero. Longer bodies
+	// are refused with 413 Request Entity Too Large.
+	MaxBody int64
+	// A value of the type written on success, only used for the OpenAPI document.
+	Response interface{}
+	Handler  http.HandlerFunc
+}
+
+type Router struct {
+	mutex  sync.RWMutex
+	routes []Route
+	access Access
+}
+
+// New returns a router that already serves its own OpenAPI document.
+func New() *Router {
+	rt := &Router{}
+	rt.Handle(Route{
+		Method:  http.MethodGet,
+		Path:    "/openapi.json",
+		Scope:   ScopeRead,
+		Tag:     "meta",
+		Summary: "OpenAPI document describing this API",
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			WriteJSON(w, http.StatusOK, rt.OpenAPI())
+		},
+	})
+	return rt
+}
+
+// Default is the router the node serves.
+var Default = New()
+
+// Handle adds routes to the default router.
+func Handle(routes ...Route) {
+	Default.Handle(routes...)
+}
+
+// Handle adds routes to the router. It panics if a method and path are already
+// taken, like http.ServeMux does.
+func (rt *Router) Handle(routes ...Route) {
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+	for _, route := range routes {
+		if route.Handler == nil || route.Method == "" || (route.Path == "" && route.Legacy == "") {
+			panic(fmt.Sprintf("router: incomplete route %s %s", route.Method, route.Path))
+		}
+		if !validScope(route.Scope) {
+			panic(fmt.Sprintf("router: route %s %s has no valid scope", route.Method, route.Path+route.Legacy))
+		}
+		for _, existing := range rt.routes {
+			if existing.Method != route.Method {
+				continue
+			}
+			if (route.Path != "" && existing.Path == route.Path) || (route.Legacy != "" && existing.Legacy == route.Legacy) {
+				panic(fmt.Sprintf("router: %s %s registered twice", route.Method, route.Path+route.Legacy))
+			}
+		}
+		rt.routes = append(rt.routes, route)
+	}
+}
+
+// Routes returns the registered routes sorted by path and method.
+func (rt *Router) Routes() []Route {
+	rt.mutex.RLock()
+	routes := append([]Route(nil), rt.routes...)
+	rt.mutex.RUnlock()
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.serve(w, r, false)
+}
+
+// PublicHandler serves only the public routes, for the listener other peers
+// connect to.
+func (rt *Router) PublicHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rt.serve(w, r, true)
+	})
+}
+
+func (rt *Router) serve(w http.ResponseWriter, r *http.Request, publicOnly bool) {
+	// http.ServeMux used to clean paths before routing. Paths with . or ..
+	// segments, repeated slashes or encoded slashes are refused instead, so
+	// they never reach a handler matching a prefix such as /requestFile/
+	if !canonicalPath(r) {
+		WriteError(w, Errorf(http.StatusBadRequest, "path %s is not canonical", r.URL.EscapedPath()))
+		return
+	}
+	versioned := r.URL.Path == Prefix || strings.HasPrefix(r.URL.Path, Prefix+"/")
+
+	rt.mutex.RLock()
+	access := rt.access
+	var match *Route
+	var params map[string]string
+	allowed := make([]string, 0)
+	for i := range rt.routes {
+		route := &rt.routes[i]
+		if publicOnly && route.Scope != ScopePublic {
+			continue
+		}
+		var ok bool
+		var p map[string]string
+		if versioned {
+			ok, p = matchPath(route.Path, strings.TrimPrefix(r.URL.Path, Prefix))
+		} else {
+			ok = matchLegacy(route.Legacy, r.URL.Path)
+		}
+		if !ok {
+			continue
+		}
+		allowed = append(allowed, route.Method)
+		// Literal segments win over {name} segments, so /peers/banned is not
+		// taken for the peer "banned"
+		if route.Method == r.Method && (match == nil || len(p) < len(params)) {
+			match, params = route, p
+		}
+	}
+	rt.mutex.RUnlock()
+
+	origin := r.Header.Get("Origin")
+	if !access.allowsOrigin(r, origin) {
+		WriteError(w, Errorf(http.StatusForbidden, "requests from %s are not allowed", origin))
+		return
+	}
+	if origin != "" && len(allowed) > 0 {
+		setCORSHeaders(w, origin, allowed)
+	}
+	if match == nil && r.Method == http.MethodOptions && len(allowed) > 0 {
+		// CORS preflight
+		w.Header().Set("Allow", strings.Join(append(allowed, http.MethodOptions), ", "))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if match == nil {
+		if len(allowed) == 0 {
+			WriteError(w, Errorf(http.StatusNotFound, "no route for %s", r.URL.Path))
+			return
+		}
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		WriteError(w, Errorf(http.StatusMethodNotAllowed, "%s is not allowed on %s, use %s", r.Method, r.URL.Path, strings.Join(allowed, " or ")))
+		return
+	}
+
+	if err := access.authorize(r, match.Scope); err != nil {
+		if err.Status == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="orcanet"`)
+		}
+		WriteError(w, err)
+		return
+	}
+	if r.Body != nil {
+		maxBody := match.MaxBody
+		if maxBody == 0 {
+			maxBody = DefaultMaxBody
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBody)
+	}
+
+	if !versioned {
+		// Older clients expect the responses exactly as they always were
+		w.Header().Set("Deprecation", "true")
+		if match.Path != "" {
+			w.Header().Set("Link", fmt.Sprintf("<%s%s>; rel=\"successor-version\"", Prefix, match.Path))
+		}
+		match.Handler(w, r)
+		return
+	}
+
+	if len(params) > 0 {
+		r = r.WithContext(context.WithValue(r.Context(), paramsKey{}, params))
+	}
+	if err := validate(match, r); err != nil {
+		WriteError(w, err)
+		return
+	}
+	ew := &envelopeWriter{ResponseWriter: w}
+	match.Handler(ew, r)
+	ew.finish()
+}
+
+// Whether the path of r is the same once cleaned like http.ServeMux does, and
+// has no encoded slashes that would turn into segments once decoded.
+func canonicalPath(r *http.Request) bool {
+	p := r.URL.Path
+	if p == "" || p[0] != '/' {
+		return false
+	}
+	cleaned := path.Clean(p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned == p && !strings.Contains(strings.ToLower(r.URL.RawPath), "%2f")
+}
+
+type paramsKey struct{}
+
+// PathValue returns the value of the {name} segment of the matched route path.
+func PathValue(r *http.Request, name string) string {
+	params, _ := r.Context().Value(paramsKey{}).(map[string]string)
+	return params[name]
+}
+
+func matchPath(pattern string, path string) (bool, map[string]string) {
+	if pattern == "" {
+		return false, nil
+	}
+	patternParts := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathParts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(patternParts) != len(pathParts) {
+		return false, nil
+	}
+	var params map[string]string
+	for i, part := range patternParts {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			if pathParts[i] == "" {
+				return false, nil
+			}
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[part[1:len(part)-1]] = pathParts[i]
+		} else if part != pathParts[i] {
+			return false, nil
+		}
+	}
+	return true, params
+}
+
+func matchLegacy(pattern string, path string) bool {
+	if pattern == "" {
+		return false
+	}
+	if strings.HasSuffix(pattern, "/") {
+		return strings.HasPrefix(path, pattern)
+	}
+	return path == pattern
+}
+
+// envelopeWriter passes successful responses through and collects the body of
+// error responses so they can be rewritten into the error envelope. Handlers
+// that set the status more than once only get the first one, like net/http.
+type envelopeWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	errorBody   bytes.Buffer
+}
+
+func (ew *envelopeWriter) WriteHeader(status int) {
+	if ew.wroteHeader {
+		return
+	}
+	ew.wroteHeader = true
+	ew.status = status
+	if status < http.StatusBadRequest {
+		ew.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (ew *envelopeWriter) Write(b []byte) (int, error) {
+	if !ew.wroteHeader {
+		ew.WriteHeader(http.StatusOK)
+	}
+	if ew.status >= http.StatusBadRequest {
+		return ew.errorBody.Write(b)
+	}
+	return ew.ResponseWriter.Write(b)
+}
+
+func (ew *envelopeWriter) Flush() {
+	if ew.status >= http.StatusBadRequest {
+		return
+	}
+	if flusher, ok := ew.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (ew *envelopeWriter) Unwrap() http.ResponseWriter {
+	return ew.ResponseWriter
+}
+
+func (ew *envelopeWriter) finish() {
+	if ew.status < http.StatusBadRequest {
+		return
+	}
+	body := ew.errorBody.Bytes()
+	var envelope struct {
+		Error *Error `json:"error"`
+	}
+	if json.Unmarshal(body, &envelope) == nil && envelope.Error != nil {
+		// Already an envelope
+		envelope.Error.Status = ew.status
+		WriteError(ew.ResponseWriter, envelope.Error)
+		return
+	}
+	WriteError(ew.ResponseWriter, &Error{Status: ew.status, Message: errorMessage(body)})
+}
+
+// Pull the message out of the {"status": "..."} objects and plain text bodies
+// handlers used to answer errors with.
+func errorMessage(body []byte) string {
+	var fields map[string]interface{}
+	if json.Unmarshal(body, &fields) == nil {
+		for _, key := range []string{"status", "message", "error"} {
+			if message, ok := fields[key].(string); ok && message != "" {
+				return message
+			}
+		}
+	}
+	return strings.TrimSpace(string(body))
+}
+
+// Read the request body and put it back so the handler can read it again. The
+// body is already capped at the MaxBody of the route.
+func peekBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, err
+}
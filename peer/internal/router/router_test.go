@@ -0,0 +1,270 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type payload struct {
+	PeerID string `json:"peerID" validate:"required"`
+	Count  int    `json:"count"`
+}
+
+// Answers the way handlers written before the router did.
+func legacyStatus(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"status": message})
+}
+
+func testRouter() *Router {
+	rt := New()
+	rt.Handle(
+		Route{
+			Method: http.MethodGet,
+			Path:   "/peers",
+			Legacy: "/get-peers",
+			Scope:  ScopeRead,
+			Query:  []Param{{Name: "limit", Type: "integer"}},
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				WriteJSON(w, http.StatusOK, []string{"a", "b"})
+			},
+		},
+		Route{
+			Method: http.MethodGet,
+			Path:   "/peers/{peerId}",
+			Scope:  ScopeRead,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				legacyStatus(w, http.StatusNotFound, "Peer "+PathValue(r, "peerId")+" not found")
+				// Handlers used to set the status again after answering
+				w.WriteHeader(http.StatusOK)
+			},
+		},
+		Route{
+			Method: http.MethodGet,
+			Path:   "/peers/banned",
+			Scope:  ScopeRead,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				WriteJSON(w, http.StatusOK, []string{})
+			},
+		},
+		Route{
+			Method: http.MethodPost,
+			Path:   "/peers/ban",
+			Legacy: "/ban-peer",
+			Scope:  ScopeAdmin,
+			Body:   payload{},
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				var p payload
+				if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+					legacyStatus(w, http.StatusInternalServerError, "body was consumed")
+					return
+				}
+				legacyStatus(w, http.StatusBadRequest, "cannot ban "+p.PeerID)
+			},
+		},
+		Route{
+			Method: http.MethodGet,
+			Legacy: "/get-file",
+			Scope:  ScopePublic,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("chunk"))
+			},
+		},
+	)
+	rt.SetAccess(Access{NoAuth: true})
+	return rt
+}
+
+func serve(rt *Router, method string, target string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	rt.ServeHTTP(rec, req)
+	return rec
+}
+
+func decodeError(t *testing.T, rec *httptest.ResponseRecorder) *Error {
+	var envelope struct {
+		Error *Error `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil || envelope.Error == nil {
+		t.Fatalf("response is not an error envelope: %q", rec.Body.String())
+	}
+	if envelope.Error.Status != rec.Code {
+		t.Fatalf("envelope status %d differs from response status %d", envelope.Error.Status, rec.Code)
+	}
+	return envelope.Error
+}
+
+func TestRouting(t *testing.T) {
+	rt := testRouter()
+
+	rec := serve(rt, http.MethodGet, "/api/v1/peers", "")
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `["a","b"]` {
+		t.Fatalf("GET /peers = %d %q", rec.Code, rec.Body.String())
+	}
+
+	rec = serve(rt, http.MethodDelete, "/api/v1/peers", "")
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET" {
+		t.Fatalf("DELETE /peers = %d, Allow %q", rec.Code, rec.Header().Get("Allow"))
+	}
+	if decodeError(t, rec).Code != "method_not_allowed" {
+		t.Fatal("wrong error code for 405")
+	}
+
+	rec = serve(rt, http.MethodGet, "/api/v1/nothing", "")
+	if rec.Code != http.StatusNotFound || decodeError(t, rec).Code != "not_found" {
+		t.Fatalf("unknown route = %d", rec.Code)
+	}
+
+	// Literal segments win over parameters regardless of registration order
+	rec = serve(rt, http.MethodGet, "/api/v1/peers/banned", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /peers/banned = %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestErrorsAreWrappedInEnvelope(t *testing.T) {
+	rt := testRouter()
+	rec := serve(rt, http.MethodGet, "/api/v1/peers/QmPeer", "")
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	if err := decodeError(t, rec); err.Message != "Peer QmPeer not found" {
+		t.Fatalf("message = %q", err.Message)
+	}
+}
+
+func TestValidation(t *testing.T) {
+	rt := testRouter()
+	for _, test := range []struct {
+		method, target, body, message string
+	}{
+		{http.MethodGet, "/api/v1/peers?limit=ten", "", `query parameter "limit" must be of type integer`},
+		{http.MethodPost, "/api/v1/peers/ban", "", "request body is required"},
+		{http.MethodPost, "/api/v1/peers/ban", "{", "request body is not valid JSON: unexpected end of JSON input"},
+		{http.MethodPost, "/api/v1/peers/ban", `{"peerID": "a", "count": "many"}`, `field "count" must be of type int`},
+		{http.MethodPost, "/api/v1/peers/ban", `{"count": 1}`, `field "peerID" is required`},
+	} {
+		rec := serve(rt, test.method, test.target, test.body)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s %s %q: status %d", test.method, test.target, test.body, rec.Code)
+			continue
+		}
+		if err := decodeError(t, rec); err.Message != test.message {
+			t.Errorf("%s %s %q: message %q, want %q", test.method, test.target, test.body, err.Message, test.message)
+		}
+	}
+
+	// A valid body is still readable by the handler
+	rec := serve(rt, http.MethodPost, "/api/v1/peers/ban", `{"peerID": "QmPeer"}`)
+	if err := decodeError(t, rec); err.Message != "cannot ban QmPeer" {
+		t.Fatalf("message = %q", err.Message)
+	}
+}
+
+func TestBodiesAreCapped(t *testing.T) {
+	rt := testRouter()
+	large := `{"peerID": "` + strings.Repeat("a", DefaultMaxBody) + `"}`
+	rec := serve(rt, http.MethodPost, "/api/v1/peers/ban", large)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("large body: status %d", rec.Code)
+	}
+
+	// Handlers reading the body themselves are capped too
+	rec = serve(rt, http.MethodPost, "/ban-peer", large)
+	if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), "body was consumed") {
+		t.Fatalf("large legacy body: %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestLegacyRoutesAreUnchanged(t *testing.T) {
+	rt := testRouter()
+	rec := serve(rt, http.MethodPost, "/ban-peer", `{}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body["status"] != "cannot ban " {
+		t.Fatalf("legacy body = %q", rec.Body.String())
+	}
+	if rec.Header().Get("Deprecation") != "true" || !strings.Contains(rec.Header().Get("Link"), "/api/v1/peers/ban") {
+		t.Fatalf("missing deprecation headers: %v", rec.Header())
+	}
+}
+
+func TestNonCanonicalPathsAreRefused(t *testing.T) {
+	rt := testRouter()
+	rt.Handle(Route{
+		Method: http.MethodGet,
+		Legacy: "/requestFile/",
+		Scope:  ScopePublic,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.URL.Path))
+		},
+	})
+	for _, target := range []string{
+		"/requestFile/..%2f..%2fapi.cookie",
+		"/requestFile/..%2F..%2Fconfig%2Fkey.priv",
+		"/requestFile/abc%2fdef",
+		"/requestFile/../../api.cookie",
+		"/requestFile/./abc",
+		"/requestFile//abc",
+		"/api/v1/peers/../peers",
+		"/api/v1/peers/QmPeer%2f..",
+	} {
+		rec := serve(rt, http.MethodGet, target, "")
+		if rec.Code != http.StatusBadRequest || decodeError(t, rec).Code != "bad_request" {
+			t.Errorf("%s = %d %q", target, rec.Code, rec.Body.String())
+		}
+		// The peer listener refuses them the same way
+		rec = httptest.NewRecorder()
+		rt.PublicHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("public %s = %d %q", target, rec.Code, rec.Body.String())
+		}
+	}
+
+	// Canonical paths, with or without a trailing slash, are routed as before
+	rec := serve(rt, http.MethodGet, "/requestFile/abc", "")
+	if rec.Code != http.StatusOK || rec.Body.String() != "/requestFile/abc" {
+		t.Fatalf("GET /requestFile/abc = %d %q", rec.Code, rec.Body.String())
+	}
+	rec = serve(rt, http.MethodGet, "/api/v1/peers/", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/v1/peers/ = %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	rt := testRouter()
+	rec := serve(rt, http.MethodGet, "/api/v1/openapi.json", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	var doc struct {
+		Paths      map[string]map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Required []string `json:"required"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/peers", "/peers/{peerId}", "/peers/ban", "/openapi.json"} {
+		if _, ok := doc.Paths[path]; !ok {
+			t.Errorf("path %s missing from document", path)
+		}
+	}
+	if _, ok := doc.Paths["/peers/ban"]["post"]; !ok {
+		t.Error("POST /peers/ban missing from document")
+	}
+	if required := doc.Components.Schemas["payload"].Required; len(required) != 1 || required[0] != "peerID" {
+		t.Errorf("payload schema required = %v", required)
+	}
+}
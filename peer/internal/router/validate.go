@@ -0,0 +1,131 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Check the query parameters and body of r against the route description.
+func validate(route *Route, r *http.Request) error {
+	query := r.URL.Query()
+	for _, param := range route.Query {
+		value := query.Get(param.Name)
+		if value == "" {
+			if param.Required {
+				return Errorf(http.StatusBadRequest, "missing query parameter %q", param.Name)
+			}
+			continue
+		}
+		var err error
+		switch param.Type {
+		case "integer":
+			_, err = strconv.ParseInt(value, 10, 64)
+		case "number":
+			_, err = strconv.ParseFloat(value, 64)
+		case "boolean":
+			_, err = strconv.ParseBool(value)
+		}
+		if err != nil {
+			return Errorf(http.StatusBadRequest, "query parameter %q must be of type %s", param.Name, param.Type)
+		}
+	}
+
+	if route.Body == nil {
+		return nil
+	}
+	body, err := peekBody(r)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return Errorf(http.StatusRequestEntityTooLarge, "request body is larger than %d bytes", tooLarge.Limit)
+	}
+	if err != nil {
+		return Errorf(http.StatusBadRequest, "unable to read request body: %s", err)
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return Errorf(http.StatusBadRequest, "request body is required")
+	}
+	value := reflect.New(reflect.TypeOf(route.Body))
+	if err := json.Unmarshal(body, value.Interface()); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			return Errorf(http.StatusBadRequest, "field %q must be of type %s", typeErr.Field, typeErr.Type)
+		}
+		return Errorf(http.StatusBadRequest, "request body is not valid JSON: %s", err)
+	}
+	if field := missingField(value.Elem(), ""); field != "" {
+		return Errorf(http.StatusBadRequest, "field %q is required", field)
+	}
+	return nil
+}
+
+// Validate checks v for empty fields tagged validate:"required", for handlers
+// that decode their body themselves.
+func Validate(v interface{}) error {
+	if field := missingField(reflect.ValueOf(v), ""); field != "" {
+		return Errorf(http.StatusBadRequest, "field %q is required", field)
+	}
+	return nil
+}
+
+// Return the path of the first required field left empty in v.
+func missingField(v reflect.Value, path string) string {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if field := missingField(v.Index(i), path+"["+strconv.Itoa(i)+"]"); field != "" {
+				return field
+			}
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name := jsonName(f)
+			if name == "-" {
+				continue
+			}
+			fieldPath := name
+			if path != "" {
+				fieldPath = path + "." + name
+			}
+			if isRequired(f) && v.Field(i).IsZero() {
+				return fieldPath
+			}
+			if field := missingField(v.Field(i), fieldPath); field != "" {
+				return field
+			}
+		}
+	}
+	return ""
+}
+
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+func isRequired(f reflect.StructField) bool {
+	for _, rule := range strings.Split(f.Tag.Get("validate"), ",") {
+		if rule == "required" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	errConfirmationPending = errors.New("another request is waiting for confirmation")
+	errConfirmationTimeout = errors.New("no confirmation was given in time")
+)
+
+// Confirmation asks the user of the REPL to accept or decline requests of other
+// peers, such as storing a file. Only one question waits for an answer at a
+// time. The node has no Confirmation in daemon mode, where nobody is there to
+// answer.
+type Confirmation struct {
+	mutex  sync.Mutex
+	answer chan bool
+}
+
+// Ask prints question and waits until it is answered with Answer, timeout
+// passed or ctx is done. It fails without asking while another question waits.
+func (c *Confirmation) Ask(ctx context.Context, question string, timeout time.Duration) (bool, error) {
+	c.mutex.Lock()
+	if c.answer != nil {
+		c.mutex.Unlock()
+		return false, errConfirmationPending
+	}
+	answer := make(chan bool, 1)
+	c.answer = answer
+	c.mutex.Unlock()
+	defer func() {
+		c.mutex.Lock()
+		c.answer = nil
+		c.mutex.Unlock()
+	}()
+
+	fmt.Print(question)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case yes := <-answer:
+		return yes, nil
+	case <-timer.C:
+		return false, errConfirmationTimeout
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+// Answer answers the question waiting for an answer and reports whether there
+// was one.
+func (c *Confirmation) Answer(yes bool) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.answer == nil {
+		return false
+	}
+	select {
+	case c.answer <- yes:
+	default:
+		// Already answered
+	}
+	return true
+}
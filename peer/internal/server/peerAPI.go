@@ -2,21 +2,39 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	orcaGater "orca-peer/internal/gater"
+	orcaPeerDB "orca-peer/internal/peerdb"
+	orcaRouter "orca-peer/internal/router"
+	"strconv"
+	"time"
 )
 
 type PeerIdPOSTPayload struct {
-	PeerID string `json:"peerID"`
+	PeerID string `json:"peerID" validate:"required"`
 }
 
+/*
+ * Lists peers from the peer database. All query parameters are optional:
+ *   region: country, country code, continent or region the peer is located in
+ *   maxLatency: only peers whose last ping took at most this many milliseconds
+ *   minUptime: only peers connected for at least this many seconds
+ *   connected: "true" to leave out peers we are no longer connected to
+ *   sort: latency, uptime, lastSeen or firstSeen
+ *   offset, limit: pagination, the total number of matches is sent in X-Total-Count
+ */
 func getAllPeers(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
-		peerTable := GetPeerTable()
-		var peers []PeerInfo
-		for _, peer := range peerTable {
-			peers = append(peers, peer)
+		filter, err := parsePeerFilter(r.URL.Query())
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			writeStatusUpdate(w, err.Error())
+			return
 		}
+		peers, total := QueryPeers(filter)
 		jsonPeers, err := json.Marshal(peers)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
@@ -24,6 +42,7 @@ func getAllPeers(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
 		w.WriteHeader(http.StatusOK)
 		w.Write(jsonPeers)
 	} else {
@@ -32,13 +51,50 @@ func getAllPeers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+func parsePeerFilter(query url.Values) (orcaPeerDB.Filter, error) {
+	filter := orcaPeerDB.Filter{
+		Region:        query.Get("region"),
+		ConnectedOnly: query.Get("connected") == "true",
+		SortBy:        query.Get("sort"),
+	}
+	switch filter.SortBy {
+	case "", "latency", "uptime", "lastSeen", "firstSeen":
+	default:
+		return filter, fmt.Errorf("Cannot sort peers by %s.", filter.SortBy)
+	}
+	var err error
+	if value := query.Get("maxLatency"); value != "" {
+		if filter.MaxLatency, err = strconv.ParseFloat(value, 64); err != nil || filter.MaxLatency < 0 {
+			return filter, errors.New("maxLatency must be a positive number of milliseconds.")
+		}
+	}
+	if value := query.Get("minUptime"); value != "" {
+		if filter.MinUptime, err = strconv.ParseInt(value, 10, 64); err != nil || filter.MinUptime < 0 {
+			return filter, errors.New("minUptime must be a positive number of seconds.")
+		}
+	}
+	if value := query.Get("offset"); value != "" {
+		if filter.Offset, err = strconv.Atoi(value); err != nil || filter.Offset < 0 {
+			return filter, errors.New("offset must be a positive integer.")
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		if filter.Limit, err = strconv.Atoi(value); err != nil || filter.Limit < 0 {
+			return filter, errors.New("limit must be a positive integer.")
+		}
+	}
+	return filter, nil
+}
+
 func getPeer(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
-		queryParams := r.URL.Query()
-		peerId := queryParams.Get("peer-id")
-		peerTable := GetPeerTable()
-		if peer, ok := peerTable[peerId]; ok {
-			jsonPeer, err := json.Marshal(peer)
+		peerId := orcaRouter.PathValue(r, "peerId")
+		if peerId == "" {
+			peerId = r.URL.Query().Get("peer-id")
+		}
+		if record, ok := orcaPeerDB.Default().Get(peerId); ok {
+			jsonPeer, err := json.Marshal(peerInfoFromRecord(record, time.Now()))
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				writeStatusUpdate(w, "Failed to convert Peer JSON Data into a string")
@@ -48,8 +104,8 @@ func getPeer(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusOK)
 			w.Write(jsonPeer)
 		} else {
-			w.WriteHeader(http.StatusBadRequest)
-			writeStatusUpdate(w, "Peer ID not found inside list of connected peer ids.")
+			w.WriteHeader(http.StatusNotFound)
+			writeStatusUpdate(w, "Peer ID not found inside the peer database.")
 			return
 		}
 	} else {
@@ -71,8 +127,10 @@ func removePeer(w http.ResponseWriter, r *http.Request) {
 		err := DisconnectPeer(payload.PeerID)
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
+			writeStatusUpdate(w, err.Error())
 		} else {
 			w.WriteHeader(http.StatusOK)
+			writeStatusUpdate(w, "Disconnected from peer.")
 		}
 	} else {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -81,6 +139,83 @@ func removePeer(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+type BanPeerPOSTPayload struct {
+	PeerID   string `json:"peerID" validate:"required"`
+	Duration int64  `json:"duration"` // seconds, 0 bans permanently
+	Reason   string `json:"reason"`
+}
+
+func banPeer(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		var payload BanPeerPOSTPayload
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&payload); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			writeStatusUpdate(w, "Cannot marshal payload in Go object. Does the payload have the correct body structure?")
+			return
+		}
+		if payload.Duration < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			writeStatusUpdate(w, "Ban duration cannot be negative.")
+			return
+		}
+		err := BanPeer(payload.PeerID, time.Duration(payload.Duration)*time.Second, payload.Reason)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			writeStatusUpdate(w, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		writeStatusUpdate(w, "Banned peer.")
+	} else {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		writeStatusUpdate(w, "Only POST requests will be handled.")
+	}
+}
+
+func unbanPeer(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		var payload PeerIdPOSTPayload
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&payload); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			writeStatusUpdate(w, "Cannot marshal payload in Go object. Does the payload have the correct body structure?")
+			return
+		}
+		if err := UnbanPeer(payload.PeerID); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			writeStatusUpdate(w, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		writeStatusUpdate(w, "Unbanned peer.")
+	} else {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		writeStatusUpdate(w, "Only POST requests will be handled.")
+	}
+}
+
+func getBannedPeers(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		bans := []orcaGater.Ban{}
+		if PeerGater != nil {
+			bans = PeerGater.Bans()
+		}
+		jsonBans, err := json.Marshal(bans)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			writeStatusUpdate(w, "Failed to convert ban list into a string")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonBans)
+	} else {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		writeStatusUpdate(w, "Only GET requests will be handled.")
+	}
+}
+
 func writeStatusUpdate(w http.ResponseWriter, message string) {
 	responseMsg := map[string]interface{}{
 		"status": message,
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	orcaEvents "orca-peer/internal/events"
+	orcaPeerDB "orca-peer/internal/peerdb"
+	"sort"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
+)
+
+const (
+	// How often every connected peer is pinged over its existing libp2p connection.
+	latencyProbeInterval = 30 * time.Second
+	// How long a single ping round trip may take before it is counted as a failure.
+	latencyProbeTimeout = 10 * time.Second
+)
+
+// MonitorPeers keeps the peer database up to date from libp2p connection and
+// identify events and periodically measures round trip time with the libp2p ping
+// protocol. It blocks until ctx is cancelled.
+func MonitorPeers(ctx context.Context, h host.Host) {
+	sub, err := h.EventBus().Subscribe(new(event.EvtPeerIdentificationCompleted))
+	if err != nil {
+		fmt.Println("Error subscribing to identify events:", err)
+	} else {
+		go func() {
+			defer sub.Close()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case e, ok := <-sub.Out():
+					if !ok {
+						return
+					}
+					recordIdentity(h, e.(event.EvtPeerIdentificationCompleted).Peer)
+				}
+			}
+		}()
+	}
+
+	h.Network().Notify(&network.NotifyBundle{
+		ConnectedF: func(n network.Network, c network.Conn) {
+			// Only the first connection to a peer is reported
+			if len(n.ConnsToPeer(c.RemotePeer())) == 1 {
+				orcaEvents.Publish(orcaEvents.PeerConnected, orcaEvents.PeerData{
+					PeerID:  c.RemotePeer().String(),
+					Address: c.RemoteMultiaddr().String(),
+				})
+			}
+			markPeerConnected(c.RemotePeer(), c.RemoteMultiaddr().String())
+		},
+		DisconnectedF: func(n network.Network, c network.Conn) {
+			// A peer can have several connections open, only mark it as gone
+			// once the last one is closed.
+			if n.Connectedness(c.RemotePeer()) != network.Connected {
+				orcaEvents.Publish(orcaEvents.PeerDisconnected, orcaEvents.PeerData{PeerID: c.RemotePeer().String()})
+				markPeerDisconnected(c.RemotePeer())
+			}
+		},
+	})
+
+	// Pick up connections that were opened before we subscribed.
+	for _, conn := range h.Network().Conns() {
+		markPeerConnected(conn.RemotePeer(), conn.RemoteMultiaddr().String())
+	}
+
+	ticker := time.NewTicker(latencyProbeInterval)
+	defer ticker.Stop()
+	for {
+		for _, p := range h.Network().Peers() {
+			go probeLatency(ctx, h, p)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Send a single libp2p ping to the peer and record the result in the peer table.
+func probeLatency(ctx context.Context, h host.Host, p peer.ID) {
+	pingCtx, cancel := context.WithTimeout(ctx, latencyProbeTimeout)
+	defer cancel()
+
+	result, ok := <-ping.Ping(pingCtx, h, p)
+	if !ok || result.Error != nil {
+		return
+	}
+	recordLatency(p, result.RTT)
+}
+
+func markPeerConnected(p peer.ID, connection string) {
+	now := time.Now()
+	isNew := orcaPeerDB.Default().Update(p.String(), func(r *orcaPeerDB.Record) {
+		if !r.Connected {
+			r.ConnectedSince = now
+		}
+		r.Connected = true
+		r.Connection = connection
+		r.LastSeen = now
+	})
+	if isNew {
+		go getLocationFromIP(p.String())
+	}
+}
+
+func markPeerDisconnected(p peer.ID) {
+	orcaPeerDB.Default().UpdateExisting(p.String(), func(r *orcaPeerDB.Record) {
+		r.Connected = false
+		r.LastSeen = time.Now()
+	})
+}
+
+func recordLatency(p peer.ID, rtt time.Duration) {
+	orcaPeerDB.Default().AddLatencySample(p.String(), rtt)
+}
+
+// Store what the peer told us about itself during the identify exchange.
+func recordIdentity(h host.Host, p peer.ID) {
+	agentVersion := ""
+	if v, err := h.Peerstore().Get(p, "AgentVersion"); err == nil {
+		agentVersion, _ = v.(string)
+	}
+	protocols := make([]string, 0)
+	if protos, err := h.Peerstore().GetProtocols(p); err == nil {
+		for _, proto := range protos {
+			protocols = append(protocols, string(proto))
+		}
+	}
+	sort.Strings(protocols)
+	addresses := make([]string, 0)
+	for _, addr := range h.Peerstore().Addrs(p) {
+		addresses = append(addresses, addr.String())
+	}
+
+	orcaPeerDB.Default().UpdateExisting(p.String(), func(r *orcaPeerDB.Record) {
+		r.AgentVersion = agentVersion
+		r.Protocols = protocols
+		r.Addresses = addresses
+	})
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	orcaPricing "orca-peer/internal/pricing"
+)
+
+func getPricing(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		writePolicy(w, orcaPricing.Default().Policy())
+	} else {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		writeStatusUpdate(w, "Only GET requests will be handled.")
+	}
+}
+
+// Replaces the whole policy. The files we hold are announced again with the new
+// prices in the background.
+func setPricing(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut {
+		var policy orcaPricing.Policy
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&policy); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			writeStatusUpdate(w, "Cannot marshal payload in Go object. Does the payload have the correct body structure?")
+			return
+		}
+		if err := policy.Validate(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			writeStatusUpdate(w, err.Error())
+			return
+		}
+		if err := orcaPricing.Default().Set(policy); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			writeStatusUpdate(w, "Unable to save the pricing policy.")
+			return
+		}
+		writePolicy(w, orcaPricing.Default().Policy())
+	} else {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		writeStatusUpdate(w, "Only PUT requests will be handled.")
+	}
+}
+
+func writePolicy(w http.ResponseWriter, policy orcaPricing.Policy) {
+	jsonData, err := json.Marshal(policy)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		writeStatusUpdate(w, "Failed to convert JSON Data into a string")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"net/http"
+	orcaGater "orca-peer/internal/gater"
+	orcaPricing "orca-peer/internal/pricing"
+	orcaRouter "orca-peer/internal/router"
+)
+
+// Routes returns the HTTP routes of the market server. The file transfer
+// routes at the end are only used between peers and keep their old paths.
+func Routes(server *HTTPServer, confirmation *Confirmation) []orcaRouter.Route {
+	return []orcaRouter.Route{
+		{
+			Method:      http.MethodGet,
+			Path:        "/peers",
+			Legacy:      "/get-peers",
+			Scope:       orcaRouter.ScopeRead,
+			Tag:         "peers",
+			Summary:     "List peers from the peer database",
+			Description: "The total number of matching peers before pagination is sent in the X-Total-Count header.",
+			Query: []orcaRouter.Param{
+				{Name: "region", Description: "Country, country code, continent or region of the peer"},
+				{Name: "maxLatency", Type: "number", Description: "Only peers whose last ping took at most this many milliseconds"},
+				{Name: "minUptime", Type: "integer", Description: "Only peers connected for at least this many seconds"},
+				{Name: "connected", Type: "boolean", Description: "Leave out peers we are no longer connected to"},
+				{Name: "sort", Description: "latency, uptime, lastSeen or firstSeen"},
+				{Name: "offset", Type: "integer"},
+				{Name: "limit", Type: "integer"},
+			},
+			Response: []PeerInfo{},
+			Handler:  getAllPeers,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/peers/{peerId}",
+			Scope:    orcaRouter.ScopeRead,
+			Tag:      "peers",
+			Summary:  "Get a peer from the peer database",
+			Response: PeerInfo{},
+			Handler:  getPeer,
+		},
+		{
+			Method:  http.MethodGet,
+			Legacy:  "/get-peer",
+			Scope:   orcaRouter.ScopeRead,
+			Handler: getPeer,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/peers/find",
+			Legacy:   "/find-peer",
+			Scope:    orcaRouter.ScopeRead,
+			Tag:      "peers",
+			Summary:  "Find the peers holding a file",
+			Query:    []orcaRouter.Param{{Name: "fileHash", Required: true}},
+			Response: []Peer{},
+			Handler:  FindPeersForHash,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/peers/disconnect",
+			Legacy:  "/remove-peer",
+			Scope:   orcaRouter.ScopeAdmin,
+			Tag:     "peers",
+			Summary: "Close all connections to a peer",
+			Body:    PeerIdPOSTPayload{},
+			Handler: removePeer,
+		},
+		{
+			Method:      http.MethodPost,
+			Path:        "/peers/ban",
+			Legacy:      "/ban-peer",
+			Scope:       orcaRouter.ScopeAdmin,
+			Tag:         "peers",
+			Summary:     "Ban a peer and disconnect from it",
+			Description: "duration is in seconds, 0 bans the peer permanently.",
+			Body:        BanPeerPOSTPayload{},
+			Handler:     banPeer,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/peers/unban",
+			Legacy:  "/unban-peer",
+			Scope:   orcaRouter.ScopeAdmin,
+			Tag:     "peers",
+			Summary: "Lift the ban of a peer",
+			Body:    PeerIdPOSTPayload{},
+			Handler: unbanPeer,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/peers/banned",
+			Legacy:   "/banned-peers",
+			Scope:    orcaRouter.ScopeRead,
+			Tag:      "peers",
+			Summary:  "List banned peers",
+			Response: []orcaGater.Ban{},
+			Handler:  getBannedPeers,
+		},
+		{
+			Method:      http.MethodPut,
+			Path:        "/jobs",
+			Legacy:      "/add-job",
+			Scope:       orcaRouter.ScopeWallet,
+			Tag:         "jobs",
+			Summary:     "Queue a job downloading a file",
+			Description: "peer selects the holder to download from, otherwise the cheapest holder is used. Jobs with a higher priority are started first.",
+			Body:        AddJobReqPayload{},
+			Response:    AddJobResPayload{},
+			Handler:     AddJobHandler,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/pricing",
+			Scope:    orcaRouter.ScopeRead,
+			Tag:      "files",
+			Summary:  "Get the pricing policy for the files we hold",
+			Response: orcaPricing.Policy{},
+			Handler:  getPricing,
+		},
+		{
+			Method:  http.MethodPut,
+			Path:    "/pricing",
+			Scope:   orcaRouter.ScopeFiles,
+			Tag:     "files",
+			Summary: "Replace the pricing policy and announce our files with the new prices",
+			Description: "Prices are per MiB. files maps file hashes to their own price, freeBytes makes smaller files free, " +
+				"freePeers download everything for free. Of the timeSurges, loadSurges and volumeDiscounts that apply, the largest " +
+				"surcharge and the largest discount are used.",
+			Body:     orcaPricing.Policy{},
+			Response: orcaPricing.Policy{},
+			Handler:  setPricing,
+		},
+
+		// Between peers only
+		{
+			Method: http.MethodGet,
+			Legacy: "/requestFile/",
+			Scope:  orcaRouter.ScopePublic,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				server.sendFile(w, r, confirmation)
+			},
+		},
+		{
+			Method:  http.MethodPost,
+			Legacy:  "/storeFile/",
+			Scope:   orcaRouter.ScopePublic,
+			MaxBody: maxStoreFileBody,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				server.storeFile(w, r, confirmation)
+			},
+		},
+		{
+			Method:  http.MethodPost,
+			Legacy:  "/sendTransaction",
+			Scope:   orcaRouter.ScopePublic,
+			Handler: handleTransaction,
+		},
+	}
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/json"
@@ -8,23 +9,41 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"math/big"
+	"net"
 	"net/http"
 	orcaClient "orca-peer/internal/client"
+	orcaDataDir "orca-peer/internal/datadir"
 	"orca-peer/internal/fileshare"
+	orcaGeo "orca-peer/internal/geo"
 	"orca-peer/internal/hash"
+	orcaEvents "orca-peer/internal/events"
 	orcaJobs "orca-peer/internal/jobs"
+	orcaLifecycle "orca-peer/internal/lifecycle"
+	orcaPricing "orca-peer/internal/pricing"
+	orcaRouter "orca-peer/internal/router"
 	"github.com/libp2p/go-libp2p/core/host"
 	libp2pcrypto "github.com/libp2p/go-libp2p/core/crypto"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"time"
 	"github.com/google/uuid"
 )
 
 const keyServerAddr = "serverAddr"
 
+// How long requests of other peers wait for the user to confirm them.
+var confirmationTimeout = 2 * time.Minute
+
+// Largest /storeFile/ body. Files are sent whole, base64 encoded in JSON.
+const maxStoreFileBody = 64 << 20
+
+// Only one storage request is confirmed at a time, so the others are refused
+// before their body is read.
+var storeSlots = make(chan struct{}, 1)
+
 var (
 	eventChannel chan bool
 	Client       *orcaClient.Client
@@ -71,7 +90,7 @@ func handleTransaction(w http.ResponseWriter, r *http.Request) {
 	}
 	timestamp := time.Now()
 	timestampStr := timestamp.Format(time.RFC3339Nano)
-	err = os.WriteFile("./files/transactions/"+timestampStr, body, 0644)
+	err = os.WriteFile(filepath.Join(orcaDataDir.TransactionsDir(), timestampStr), body, 0644)
 	if err != nil {
 		fmt.Println("Error writing transaction to file:", err)
 		return
@@ -94,50 +113,53 @@ func handleTransaction(w http.ResponseWriter, r *http.Request) {
 		fmt.Println("UUID:")
 		fmt.Println(transaction.Uuid)
 	}
+	orcaEvents.Publish(orcaEvents.PaymentReceived, orcaEvents.PaymentData{
+		Amount: transaction.Price,
+		Peer:   r.RemoteAddr,
+	})
 	eventChannel <- true
 	fmt.Println("> ")
 }
 
 // Start HTTP/RPC server
-func StartServer(httpPort string, dhtPort string, rpcPort string, serverReady chan bool, confirming *bool, confirmation *string, libp2pPrivKey libp2pcrypto.PrivKey, passKey string, client *orcaClient.Client, startAPIRoutes func(*map[string]fileshare.FileInfo), host host.Host, hostMultiAddr string) {
+func StartServer(apiAddr string, peerListener net.Listener, dhtPort string, rpcPort string, serverReady chan bool, confirmation *Confirmation, libp2pPrivKey libp2pcrypto.PrivKey, passKey string, client *orcaClient.Client, startAPIRoutes func(*map[string]fileshare.FileInfo), host host.Host, hostMultiAddr string) {
 	eventChannel = make(chan bool)
 	server := HTTPServer{
-		storage: hash.NewDataStore("files/stored/"),
+		storage: hash.NewDataStore(orcaDataDir.StoredDir()),
 	}
-	go orcaJobs.InitPeriodicJobSave()
 	Client = client
 	PassKey = passKey
 	fileShareServer := FileShareServerNode{
 		StoredFileInfoMap: make(map[string]fileshare.FileInfo),
 	}
 
-	//Why are there routes in 2 different spots?
-	http.HandleFunc("/requestFile/", func(w http.ResponseWriter, r *http.Request) {
-		server.sendFile(w, r, confirming, confirmation)
-	})
-	http.HandleFunc("/storeFile/", func(w http.ResponseWriter, r *http.Request) {
-		server.storeFile(w, r, confirming, confirmation)
-	})
-	http.HandleFunc("/sendTransaction", handleTransaction)
-	http.HandleFunc("/get-peers", getAllPeers)
-	http.HandleFunc("/get-peer", getPeer)
-	http.HandleFunc("/find-peer", FindPeersForHash)
-	http.HandleFunc("/remove-peer", removePeer)
-
-	http.HandleFunc("/add-job", AddJobHandler)
+	orcaRouter.Handle(Routes(&server, confirmation)...)
 
-	fmt.Printf("HTTP Listening on port %s...\n", httpPort)
+	fmt.Printf("HTTP API listening on %s, peers connect on %s...\n", apiAddr, peerListener.Addr())
 	go CreateMarketServer(libp2pPrivKey, dhtPort, rpcPort, serverReady, &fileShareServer, host, hostMultiAddr)
 	startAPIRoutes(&fileShareServer.StoredFileInfoMap)
 
-	http.ListenAndServe(":"+httpPort, nil)
+	peerServer := &http.Server{Handler: orcaRouter.Default.PublicHandler()}
+	orcaLifecycle.OnShutdown(orcaLifecycle.StageServers, "peer HTTP server", peerServer.Shutdown)
+	go func() {
+		if err := peerServer.Serve(peerListener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("Peer HTTP server stopped: %s\n", err)
+		}
+	}()
+
+	httpServer := &http.Server{Addr: apiAddr, Handler: orcaRouter.Default}
+	orcaLifecycle.OnShutdown(orcaLifecycle.StageServers, "HTTP server", httpServer.Shutdown)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Printf("HTTP server stopped: %s\n", err)
+	}
 }
 
 type Peer struct {
-	PeerId string  `json:"peerID"`
-	Ip     string  `json:"ip"`
-	Region string  `json:"region"`
-	Price  float32 `json:"price"`
+	PeerId  string  `json:"peerID"`
+	Ip      string  `json:"ip"`
+	Region  string  `json:"region"`
+	FlagUrl string  `json:"flagUrl"`
+	Price   float32 `json:"price"`
 }
 
 func FindPeersForHash(w http.ResponseWriter, r *http.Request) {
@@ -146,7 +168,7 @@ func FindPeersForHash(w http.ResponseWriter, r *http.Request) {
 		hash := queryParams.Get("fileHash")
 		peers, err := findPeersForHash(hash)
 		if err != nil {
-			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.WriteHeader(http.StatusInternalServerError)
 			writeStatusUpdate(w, "Errors retrieving information about peers holding this hash.")
 			return
 		}
@@ -173,40 +195,46 @@ func findPeersForHash(fileHash string) ([]Peer, error) {
 	}
 	peers := make([]Peer, 0)
 	for _, holder := range holders.Holders {
-		location, err := getLocationFromIP(string(holder.GetId()))
-		if err != nil {
-			return []Peer{}, errors.New("unable to get location about peer")
-		}
+		// Holders advertise the multiaddr of their libp2p host, an unresolvable
+		// address only costs us the region.
+		location, _ := orcaGeo.LookupMultiaddr(holder.Ip)
 		peers = append(peers, Peer{
-			PeerId: string(holder.GetId()),
-			Ip:     holder.Ip,
-			Region: location,
+			PeerId:  string(holder.GetId()),
+			Ip:      holder.Ip,
+			Region:  location.Country,
+			FlagUrl: location.FlagUrl,
+			Price:   float32(orcaPricing.HolderPrice(holder, 0, time.Now())),
 		})
 	}
 	return peers, nil
 }
 
-func (server *HTTPServer) sendFile(w http.ResponseWriter, r *http.Request, confirming *bool, confirmation *string) {
+var storedNamePattern = regexp.MustCompile("^[a-fA-F0-9]{64}$")
+
+// isStoredName reports whether name is the name of a file in the stored folder,
+// the SHA-256 hash of a chunk or file in hex.
+func isStoredName(name string) bool {
+	return filepath.Base(name) == name && !strings.Contains(name, "..") && storedNamePattern.MatchString(name)
+}
+
+func (server *HTTPServer) sendFile(w http.ResponseWriter, r *http.Request, confirmation *Confirmation) {
 	// Extract filename from URL path
 	filename := r.URL.Path[len("/requestFile/"):]
 
 	// Ask for confirmation
-	// *confirming = true
-	// fmt.Printf("You have just received a request to send file '%s'. Do you want to send the file? (yes/no): ", filename)
-
-	// // Check if confirmation is received
-	// for *confirmation != "yes" {
-	// 	if *confirmation != "" {
-	// 		http.Error(w, fmt.Sprintf("Client declined to send file '%s'.", filename), http.StatusUnauthorized)
-	// 		*confirmation = ""
-	// 		*confirming = false
-	// 		return
-	// 	}
+	// question := fmt.Sprintf("You have just received a request to send file '%s'. Do you want to send the file? (yes/no): ", filename)
+	// if yes, _ := confirmation.Ask(r.Context(), question, confirmationTimeout); !yes {
+	// 	http.Error(w, fmt.Sprintf("Client declined to send file '%s'.", filename), http.StatusUnauthorized)
+	// 	return
 	// }
-	// *confirmation = ""
-	// *confirming = false
 
-	file, err := os.Open("./files/stored/" + filename)
+	// Only stored chunks and files are served, never a path out of the stored
+	// folder such as ../../api.cookie
+	if !isStoredName(filename) {
+		http.NotFound(w, r)
+		return
+	}
+	file, err := os.Open(filepath.Join(orcaDataDir.StoredDir(), filename))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
@@ -282,30 +310,47 @@ type FileData struct {
 	Content  []byte `json:"content"`
 }
 
-func (server *HTTPServer) storeFile(w http.ResponseWriter, r *http.Request, confirming *bool, confirmation *string) {
+func (server *HTTPServer) storeFile(w http.ResponseWriter, r *http.Request, confirmation *Confirmation) {
+	// Nobody is there to confirm storage requests in daemon mode
+	if confirmation == nil {
+		http.Error(w, "This node does not accept storage requests in daemon mode.", http.StatusForbidden)
+		return
+	}
+	select {
+	case storeSlots <- struct{}{}:
+		defer func() { <-storeSlots }()
+	default:
+		http.Error(w, "Another storage request is waiting for confirmation, try again later.", http.StatusServiceUnavailable)
+		return
+	}
+
 	// Parse JSON object from request body
 	var fileData FileData
 	err := json.NewDecoder(r.Body).Decode(&fileData)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, fmt.Sprintf("Files larger than %d bytes are not stored.", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to parse JSON data", http.StatusBadRequest)
 		return
 	}
 
 	// Ask for confirmation
-	*confirming = true
-	fmt.Printf("\nYou have just received a request to store file '%s'. Do you want to store the file? (yes/no): ", fileData.FileName)
-
-	// Check if confirmation is received
-	for *confirmation != "yes" {
-		if *confirmation != "" {
-			http.Error(w, fmt.Sprintf("Client declined to store file '%s'.", fileData.FileName), http.StatusUnauthorized)
-			*confirmation = ""
-			*confirming = false
-			return
-		}
+	question := fmt.Sprintf("\nYou have just received a request to store file '%s'. Do you want to store the file? (yes/no): ", fileData.FileName)
+	yes, err := confirmation.Ask(r.Context(), question, confirmationTimeout)
+	switch {
+	case errors.Is(err, errConfirmationPending):
+		http.Error(w, "Another storage request is waiting for confirmation, try again later.", http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		http.Error(w, fmt.Sprintf("Client did not confirm storing file '%s': %s.", fileData.FileName, err), http.StatusServiceUnavailable)
+		return
+	case !yes:
+		http.Error(w, fmt.Sprintf("Client declined to store file '%s'.", fileData.FileName), http.StatusUnauthorized)
+		return
 	}
-	*confirmation = ""
-	*confirming = false
 
 	// Create file
 	file_hash, err := server.storage.PutFile(fileData.Content)
@@ -383,53 +428,88 @@ func ConvertKeyToString(n *big.Int, e int) string {
 	publicKeyString := string(pem.EncodeToMemory(&publicKeyPEM))
 	return publicKeyString
 }
-func jobRoutine(jobId string, hash string, peerId string) {
-	holders, err := SetupCheckHolders(hash)
+// DownloadJob is the runner of the job scheduler. It downloads the file of job
+// from the holder the job asked for, or else from the cheapest one, and skips
+// holders that failed earlier attempts as long as there are others.
+func DownloadJob(ctx context.Context, job orcaJobs.Job, failedHolders []string) (string, error) {
+	holders, err := SetupCheckHolders(job.FileHash)
 	if err != nil {
-		fmt.Printf("Error finding holders for file: %x", err)
-		return
+		return "", fmt.Errorf("error finding holders for file: %w", err)
+	}
+	failed := make(map[string]bool)
+	for _, holder := range failedHolders {
+		failed[holder] = true
+	}
+	candidates := make([]*fileshare.User, 0)
+	for _, holder := range holders.Holders {
+		if !failed[holder.GetIp()] {
+			candidates = append(candidates, holder)
+		}
+	}
+	if len(candidates) == 0 {
+		// Every holder failed before, give them another chance
+		candidates = holders.Holders
 	}
 	var bestHolder *fileshare.User
 	var selectedHolder *fileshare.User
 	bestHolder = nil
 	selectedHolder = nil
-	for _, holder := range holders.Holders {
+	now := time.Now()
+	for _, holder := range candidates {
 		if bestHolder == nil {
 			bestHolder = holder
-		} else if holder.GetPrice() < bestHolder.GetPrice() {
+		} else if orcaPricing.HolderPrice(holder, 0, now) < orcaPricing.HolderPrice(bestHolder, 0, now) {
 			bestHolder = holder
 		}
-		if string(holder.Id) == peerId {
+		if string(holder.Id) == job.PeerId {
 			selectedHolder = holder
 		}
 	}
-	if bestHolder == nil && selectedHolder == nil {
-		fmt.Println("Unable to find holder for this hash.")
-		return
+	if bestHolder == nil {
+		return "", errors.New("unable to find holder for this hash")
 	}
 	if selectedHolder != nil {
 		bestHolder = selectedHolder
 	}
-	fmt.Printf("%s - %d OrcaCoin\n", bestHolder.GetIp(), bestHolder.GetPrice())
 
 	pubKeyInterface, err := x509.ParsePKIXPublicKey(bestHolder.Id)
 	if err != nil {
-		log.Fatal("failed to parse DER encoded public key: ", err)
+		return bestHolder.GetIp(), fmt.Errorf("failed to parse DER encoded public key: %w", err)
 	}
 	rsaPubKey, ok := pubKeyInterface.(*rsa.PublicKey)
 	if !ok {
-		log.Fatal("not an RSA public key")
+		return bestHolder.GetIp(), errors.New("not an RSA public key")
 	}
 	key := ConvertKeyToString(rsaPubKey.N, rsaPubKey.E)
-	err = Client.GetFileOnce(bestHolder.GetIp(), bestHolder.GetPort(), hash, key, fmt.Sprintf("%d", bestHolder.GetPrice()), PassKey, jobId)
+
+	// Stop before paying anything if the download would exceed a limit
+	fileSize, price, err := Client.GetFileQuote(ctx, bestHolder.GetIp(), job.FileHash)
+	if err != nil {
+		return bestHolder.GetIp(), fmt.Errorf("failed to get the size of the file: %w", err)
+	}
+	if price < 0 {
+		price = orcaPricing.HolderPrice(bestHolder, fileSize, now)
+	}
+	fmt.Printf("%s - %d OrcaCoin per MiB\n", bestHolder.GetIp(), price)
+	err = orcaJobs.PlanCost(job.JobId, fileSize, int(price))
 	if err != nil {
-		fmt.Printf("Error getting file %s", err)
+		// Not the fault of the holder
+		return "", err
+	}
+	err = Client.ResumeFile(ctx, bestHolder.GetIp(), bestHolder.GetPort(), job.FileHash, key, fmt.Sprint(price), PassKey, job.JobId, job.ChunksReceived, job.BytesReceived)
+	if err != nil && ctx.Err() == nil {
+		fmt.Printf("Error getting file %s\n", err)
 	}
+	return bestHolder.GetIp(), err
 }
 
 type AddJobReqPayload struct {
-	FileHash string `json:"fileHash"`
+	FileHash string `json:"fileHash" validate:"required"`
 	PeerId   string `json:"peer"`
+	// Jobs with a higher priority are started first
+	Priority int `json:"priority"`
+	// Coins the job may spend before it waits for approval, 0 for no limit
+	MaxCost int `json:"maxCost"`
 }
 
 type AddJobResPayload struct {
@@ -445,21 +525,26 @@ func AddJobHandler(w http.ResponseWriter, r *http.Request) {
 			writeStatusUpdate(w, "Cannot marshal payload in Go object. Does the payload have the correct body structure?")
 			return
 		}
+		if payload.MaxCost < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			writeStatusUpdate(w, "maxCost cannot be negative.")
+			return
+		}
 		id := uuid.New()
 		timeString := time.Now().Format(time.RFC3339)
 		newJob := orcaJobs.Job{
 			FileHash:        payload.FileHash,
 			JobId:           id.String(),
 			TimeQueued:      timeString,
-			Status:          "active",
+			Status:          orcaJobs.StatusQueued,
 			AccumulatedCost: 0,
 			ProjectedCost:   -1,
 			ETA:             -1,
 			PeerId:          payload.PeerId,
+			Priority:        payload.Priority,
+			MaxCost:         payload.MaxCost,
 		}
-		orcaJobs.AddJob(newJob)
-		go jobRoutine(newJob.JobId, payload.FileHash, payload.PeerId)
-		w.WriteHeader(http.StatusOK)
+		orcaJobs.Default.Enqueue(newJob)
 		response := AddJobResPayload{JobId: newJob.JobId}
 		jsonData, err := json.Marshal(response)
 		if err != nil {
@@ -15,19 +15,26 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"log"
 	"net"
 	"net/http"
+	orcaBandwidth "orca-peer/internal/bandwidth"
+	orcaDataDir "orca-peer/internal/datadir"
 	"orca-peer/internal/fileshare"
+	orcaGater "orca-peer/internal/gater"
+	orcaGeo "orca-peer/internal/geo"
 	orcaHash "orca-peer/internal/hash"
+	orcaEvents "orca-peer/internal/events"
 	orcaJobs "orca-peer/internal/jobs"
+	orcaLifecycle "orca-peer/internal/lifecycle"
+	orcaPeerDB "orca-peer/internal/peerdb"
+	orcaPricing "orca-peer/internal/pricing"
 	"os"
-	"strings"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"encoding/json"
 	"encoding/binary"
 	"time"
-	"github.com/go-ping/ping"
 	dht "github.com/libp2p/go-libp2p-kad-dht"
 	record "github.com/libp2p/go-libp2p-record"
 	libp2pcrypto "github.com/libp2p/go-libp2p/core/crypto"
@@ -38,7 +45,6 @@ import (
 	drouting "github.com/libp2p/go-libp2p/p2p/discovery/routing"
 	dutil "github.com/libp2p/go-libp2p/p2p/discovery/util"
 	ma "github.com/multiformats/go-multiaddr"
-	"github.com/oschwald/geoip2-golang"
 	"google.golang.org/grpc"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/emptypb"
@@ -57,14 +63,19 @@ type FileShareServerNode struct {
 
 var (
 	serverStruct FileShareServerNode
-	peerTable    map[string]PeerInfo
-	peerTableMUT sync.Mutex
+	PeerGater    *orcaGater.ConnectionGater
+	// Peers the DHT is bootstrapped from, set before the market server starts.
+	BootstrapPeers []ma.Multiaddr
+	// Port announced with our files
+	announcedPort int32
+	// Peers downloading from us right now, for load based prices
+	activeDownloads atomic.Int32
 )
 
 func CreateMarketServer(privKey libp2pcrypto.PrivKey, dhtPort string, rpcPort string, serverReady chan bool, fileShareServer *FileShareServerNode, host host.Host, hostMultiAddr string) {
-	ctx := context.Background()
+	ctx := orcaLifecycle.Context()
 
-	bootstrapPeers := ReadBootstrapPeers()
+	bootstrapPeers := BootstrapPeers
 	pubKey := privKey.GetPublic()
 
 	// Start a DHT, for now we will start in client mode until we can implement a way to
@@ -77,6 +88,9 @@ func CreateMarketServer(privKey libp2pcrypto.PrivKey, dhtPort string, rpcPort st
 	if err != nil {
 		panic(err)
 	}
+	orcaLifecycle.OnShutdown(orcaLifecycle.StageNetwork, "DHT", func(ctx context.Context) error {
+		return kDHT.Close()
+	})
 
 	// Bootstrap the DHT. In the default configuration, this spawns a Background
 	// thread that will refresh the peer table every five minutes.
@@ -110,6 +124,21 @@ func CreateMarketServer(privKey libp2pcrypto.PrivKey, dhtPort string, rpcPort st
 	}
 
 	s := grpc.NewServer()
+	orcaLifecycle.OnShutdown(orcaLifecycle.StageServers, "gRPC server", func(ctx context.Context) error {
+		// Let running streams finish unless they take longer than the shutdown allows
+		stopped := make(chan struct{})
+		go func() {
+			s.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+			return nil
+		case <-ctx.Done():
+			s.Stop()
+			return ctx.Err()
+		}
+	})
 	fileShareServer.K_DHT = kDHT
 	fileShareServer.PrivKey = privKey
 	fileShareServer.PubKey = pubKey
@@ -117,7 +146,7 @@ func CreateMarketServer(privKey libp2pcrypto.PrivKey, dhtPort string, rpcPort st
 	fileShareServer.Host = host
 	fileShareServer.HostMultiAddr = hostMultiAddr
 	fileshare.RegisterFileShareServer(s, fileShareServer)
-	go ListAllDHTPeers(ctx, host)
+	go MonitorPeers(ctx, host)
 	fmt.Printf("Market RPC Server listening at %v\n\n", lis.Addr())
 
 	serverReady <- true
@@ -127,136 +156,156 @@ func CreateMarketServer(privKey libp2pcrypto.PrivKey, dhtPort string, rpcPort st
 	}
 }
 
+// PeerInfo is the view of a peer database record served over HTTP.
 type PeerInfo struct {
-	Location    string `json:"location"`
-	Latency     string `json:"latency"`
-	PeerID      string `json:"peerId"`
-	Connection  string `json:"connection"`
-	OpenStreams string `json:"openStreams"`
-	FlagUrl     string `json:"flagUrl"`
+	Location       string                     `json:"location"`
+	Latency        string                     `json:"latency"`
+	LatencyHistory []orcaPeerDB.LatencySample `json:"latencyHistory"`
+	PeerID         string                     `json:"peerId"`
+	Connection     string                     `json:"connection"`
+	OpenStreams    string                     `json:"openStreams"`
+	FlagUrl        string                     `json:"flagUrl"`
+	FirstSeen      time.Time                  `json:"firstSeen"`
+	LastSeen       time.Time                  `json:"lastSeen"`
+	Uptime         int64                      `json:"uptime"`
+	Addresses      []string                   `json:"addresses"`
+	AgentVersion   string                     `json:"agentVersion"`
+	Protocols      []string                   `json:"protocols"`
+	Geo            orcaGeo.Location           `json:"geo"`
+	BytesSent      int64                      `json:"bytesSent"`
+	BytesReceived  int64                      `json:"bytesReceived"`
+}
+
+func peerInfoFromRecord(record orcaPeerDB.Record, now time.Time) PeerInfo {
+	info := PeerInfo{
+		Location:       record.Location.Country,
+		Latency:        "",
+		LatencyHistory: record.LatencyHistory,
+		PeerID:         record.PeerID,
+		Connection:     record.Connection,
+		OpenStreams:    "NO",
+		FlagUrl:        record.Location.FlagUrl,
+		FirstSeen:      record.FirstSeen,
+		LastSeen:       record.LastSeen,
+		Uptime:         record.Uptime(now),
+		Addresses:      record.Addresses,
+		AgentVersion:   record.AgentVersion,
+		Protocols:      record.Protocols,
+		Geo:            record.Location,
+		BytesSent:      record.BytesSent,
+		BytesReceived:  record.BytesReceived,
+	}
+	if info.Location == "" {
+		info.Location = orcaGeo.Unknown
+	}
+	if latency := record.Latency(); latency >= 0 {
+		info.Latency = fmt.Sprintf("%.2f", latency)
+	}
+	if record.Connected {
+		info.OpenStreams = "YES"
+	}
+	return info
 }
 
+// GetPeerTable returns a snapshot of every peer in the peer database keyed by
+// peer ID. Uptime is the number of seconds the peer has been continuously
+// connected, or 0 if it is not.
 func GetPeerTable() map[string]PeerInfo {
-	return peerTable
+	now := time.Now()
+	records := orcaPeerDB.Default().All()
+	snapshot := make(map[string]PeerInfo, len(records))
+	for _, record := range records {
+		snapshot[record.PeerID] = peerInfoFromRecord(record, now)
+	}
+	return snapshot
 }
+
+// QueryPeers returns one page of the peers matching filter and the total number of matches.
+func QueryPeers(filter orcaPeerDB.Filter) ([]PeerInfo, int) {
+	now := time.Now()
+	records, total := orcaPeerDB.Default().Query(filter)
+	peers := make([]PeerInfo, 0, len(records))
+	for _, record := range records {
+		peers = append(peers, peerInfoFromRecord(record, now))
+	}
+	return peers, total
+}
+
+// DisconnectPeer closes every connection to the peer. Unless the peer is also
+// banned it is free to connect again.
 func DisconnectPeer(peerId string) error {
-	peerTableMUT.Lock()
-	if val, ok := peerTable[peerId]; ok {
-		val.OpenStreams = "NO"
-		peerTable[peerId] = val
-	} else {
-		peerTableMUT.Unlock()
-		return errors.New("key does not exist")
-	}
-	peerTableMUT.Unlock()
+	id, err := peer.Decode(peerId)
+	if err != nil {
+		return err
+	}
+	if serverStruct.Host == nil {
+		return errors.New("market server is not running")
+	}
+	if err := serverStruct.Host.Network().ClosePeer(id); err != nil {
+		return err
+	}
+	markPeerDisconnected(id)
 	return nil
 }
 
-func getLocationFromIP(peerId string) (string, error) {
-	location := ""
-	peerTableMUT.Lock()
-	if val, ok := peerTable[peerId]; ok {
-		mAddr, err := ma.NewMultiaddr(val.Connection)
-		if err != nil {
-			return "", errors.New("cannot convert multiaddress to IP")
-		}
-		ipStr, err := mAddr.ValueForProtocol(ma.P_IP4)
-		if err != nil || strings.Contains(ipStr, "127.0.0.1") {
-			return "", nil
-		}
-		ip := net.ParseIP(ipStr)
-
-		db, err := geoip2.Open("./rsrc/GeoLite2-Country.mmdb")
-		if err != nil {
-			log.Fatal(err)
-		}
-		record, err := db.Country(ip)
-		if err != nil {
-			log.Fatal(err)
-		}
-		val.Location = record.Country.Names["en"]
-		peerTable[peerId] = val
-	} else {
-		peerTableMUT.Unlock()
-		return "", errors.New("key does not exist")
-	}
-	peerTableMUT.Unlock()
-	return location, nil
+// BanPeer bans the peer for duration, or permanently if duration is zero, and
+// drops any open connections to it.
+func BanPeer(peerId string, duration time.Duration, reason string) error {
+	id, err := peer.Decode(peerId)
+	if err != nil {
+		return err
+	}
+	if PeerGater == nil {
+		return errors.New("connection gater is not configured")
+	}
+	if err := PeerGater.Ban(id, duration, reason); err != nil {
+		return err
+	}
+	if serverStruct.Host != nil {
+		serverStruct.Host.Network().ClosePeer(id)
+		markPeerDisconnected(id)
+	}
+	return nil
 }
 
-func getLatency(peerId string) error {
-	peerTableMUT.Lock()
-	if val, ok := peerTable[peerId]; ok {
-		mAddr, err := ma.NewMultiaddr(val.Connection)
-		if err != nil {
-			return errors.New("cannot convert multiaddress to IP")
-		}
-		ipStr, err := mAddr.ValueForProtocol(ma.P_IP4)
-		if err != nil {
-			return nil
-		}
-		pinger, err := ping.NewPinger(ipStr)
-		if err != nil {
-			fmt.Printf("Error creating pinger: %s\n", err)
-			return errors.New("cant create pinger")
-		}
-
-		pinger.Count = 3
-		pinger.Timeout = time.Second * 2
-		pinger.Size = 64
-		pinger.Run()
-		stats := pinger.Statistics()
-		// fmt.Printf("  Packets: Sent = %d, Received = %d, Lost = %d (%.2f%% loss),\n",
-		// 	stats.PacketsSent, stats.PacketsRecv, stats.PacketsSent-stats.PacketsRecv,
-		// 	stats.PacketLoss*100)
-		val.Latency = fmt.Sprint(stats.AvgRtt.Seconds() * 1000)
-		// fmt.Printf("  Minimum = %.2fms, Maximum = %.2fms, Average = %.2fms\n",
-		// 	stats.MinRtt.Seconds()*1000, stats.MaxRtt.Seconds()*1000, stats.AvgRtt.Seconds()*1000)
-		peerTable[peerId] = val
-	} else {
-		peerTableMUT.Unlock()
-		return errors.New("key does not exist")
-	}
-	peerTableMUT.Unlock()
-	return nil
+func UnbanPeer(peerId string) error {
+	id, err := peer.Decode(peerId)
+	if err != nil {
+		return err
+	}
+	if PeerGater == nil {
+		return errors.New("connection gater is not configured")
+	}
+	return PeerGater.Unban(id)
 }
-func UpdateAllPeerLatency() {
-	for peerId := range peerTable {
-		go getLatency(peerId)
+
+// Holders advertise the multiaddr of their libp2p host, which ends in their peer ID.
+func isBannedHolder(user *fileshare.User) bool {
+	if PeerGater == nil {
+		return false
+	}
+	info, err := peer.AddrInfoFromString(user.GetIp())
+	if err != nil {
+		return false
 	}
+	return PeerGater.IsBanned(info.ID)
 }
-func ListAllDHTPeers(ctx context.Context, host host.Host) {
-	peerTable = make(map[string]PeerInfo)
-	for {
-		time.Sleep(time.Second * 3)
-		peers := serverStruct.K_DHT.RoutingTable().ListPeers()
-		// Should make a channel that waits for this
 
-		for _, p := range peers {
-			addr, err := serverStruct.K_DHT.FindPeer(ctx, p)
-			if err != nil {
-				fmt.Printf("Error finding peer %s: %s\n", p, err)
-				continue
-			}
-			key := addr.ID.String()
-			if _, ok := peerTable[key]; !ok {
-				connection := ""
-				if len(addr.Addrs) > 0 {
-					connection = addr.Addrs[0].String()
-				}
-				peerTable[key] = PeerInfo{
-					Location:    "",
-					Latency:     "",
-					PeerID:      addr.ID.String(),
-					Connection:  connection,
-					OpenStreams: "YES",
-					FlagUrl:     "",
-				}
-				go getLocationFromIP(key)
-			}
-		}
-		go UpdateAllPeerLatency()
+// Resolve the peer's location from its connection address and store it in the peer database.
+func getLocationFromIP(peerId string) (string, error) {
+	record, ok := orcaPeerDB.Default().Get(peerId)
+	if !ok {
+		return orcaGeo.Unknown, errors.New("key does not exist")
+	}
+	location, err := orcaGeo.LookupMultiaddr(record.Connection)
+	if err != nil {
+		return orcaGeo.Unknown, err
 	}
+
+	orcaPeerDB.Default().UpdateExisting(peerId, func(r *orcaPeerDB.Record) {
+		r.Location = location
+	})
+	return location.Country, nil
 }
 
 /*
@@ -282,6 +331,9 @@ func DiscoverPeers(ctx context.Context, h host.Host, kDHT *dht.IpfsDHT, advertis
 	for {
 		peerChan, err := routingDiscovery.FindPeers(ctx, advertise)
 		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
 			panic(err)
 		}
 		for peer := range peerChan {
@@ -290,7 +342,11 @@ func DiscoverPeers(ctx context.Context, h host.Host, kDHT *dht.IpfsDHT, advertis
 			}
 			h.Connect(ctx, peer)
 		}
-		time.Sleep(time.Second * 10)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second * 10):
+		}
 	}
 }
 
@@ -340,8 +396,11 @@ func sendFileToConsumer(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// SetupRegisterFile stores a file from the files folder and announces it on the
+// market. A price above 0 becomes the price of the file in the pricing policy,
+// otherwise the default price of the policy applies.
 func SetupRegisterFile(filePath string, fileName string, amountPerMB int64, ip string, port int32) error {
-	srcFilePath := fmt.Sprintf("./files/%s", fileName)
+	srcFilePath := filepath.Join(orcaDataDir.FilesDir(), fileName)
 	osFileInfo, err := os.Stat(srcFilePath)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -362,14 +421,14 @@ func SetupRegisterFile(filePath string, fileName string, amountPerMB int64, ip s
 	serverStruct.StoredFileInfoMap[fileKey] = orcaFileInfo
 	fmt.Printf("Final Hashed: %s\n", fileKey)
 
-	ctx := context.Background()
-	fileReq := fileshare.RegisterFileRequest{}
-	fileReq.User = &fileshare.User{}
-	fileReq.User.Price = amountPerMB
-	fileReq.User.Ip = serverStruct.HostMultiAddr
-	fileReq.User.Port = port
-	fileReq.FileKey = fileKey
-	_, err = serverStruct.RegisterFile(ctx, &fileReq)
+	if amountPerMB > 0 {
+		err = orcaPricing.Default().SetFilePrice(fileKey, amountPerMB)
+		if err != nil {
+			return err
+		}
+	}
+	announcedPort = port
+	err = announceFile(context.Background(), fileKey)
 	if err != nil {
 		return err
 	}
@@ -380,6 +439,8 @@ func SetupRegisterFile(filePath string, fileName string, amountPerMB int64, ip s
 
 func HandleStoredFileStream(s network.Stream) {
 	defer s.Close()
+	activeDownloads.Add(1)
+	defer activeDownloads.Add(-1)
 	for {
 		buf := bufio.NewReader(s)
 		lengthBytes := make([]byte, 0)
@@ -404,9 +465,25 @@ func HandleStoredFileStream(s network.Stream) {
 		}
 		
 		orcaFileInfo := serverStruct.StoredFileInfoMap[fileChunkReq.FileHash]
+		if fileChunkReq.Info {
+			// Only the size and price of the file, so the client can plan what it costs
+			price := orcaPricing.Default().Policy().Quote(fileChunkReq.FileHash, orcaFileInfo.GetFileSize(), s.Conn().RemotePeer().String(), int(activeDownloads.Load()), time.Now())
+			err = writeFileChunk(s, orcaJobs.FileChunk{
+				FileHash: fileChunkReq.FileHash,
+				MaxChunk: len(orcaFileInfo.GetChunkHashes()),
+				FileSize: orcaFileInfo.GetFileSize(),
+				JobId:    fileChunkReq.JobId,
+				Price:    &price,
+			})
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			continue
+		}
 		chunkHash := orcaFileInfo.GetChunkHashes()[fileChunkReq.ChunkIndex]
 
-		file, err := os.Open("./files/stored/" + chunkHash)
+		file, err := os.Open(filepath.Join(orcaDataDir.StoredDir(), chunkHash))
 		if err != nil {
 			fmt.Println("Error:", err)
 			return 
@@ -439,6 +516,11 @@ func HandleStoredFileStream(s network.Stream) {
 
 		respLengthHeader := make([]byte, 4)
 		binary.LittleEndian.PutUint32(respLengthHeader, uint32(len(payloadBytes)))
+		err = orcaBandwidth.ThrottleUpload(context.Background(), s.Conn().RemotePeer(), fileChunkReq.JobId, len(respLengthHeader)+len(payloadBytes))
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
 		_, err = s.Write(respLengthHeader)
 		if err != nil {
 			fmt.Println(err)
@@ -450,9 +532,59 @@ func HandleStoredFileStream(s network.Stream) {
 			fmt.Println(err)
 			return
 		}
+		orcaPeerDB.Default().AddTransfer(s.Conn().RemotePeer().String(), int64(len(respLengthHeader)+len(payloadBytes)), 0)
+		orcaEvents.Publish(orcaEvents.ChunkServed, orcaEvents.ChunkServedData{
+			PeerID:   s.Conn().RemotePeer().String(),
+			FileHash: fileChunk.FileHash,
+			Chunk:    fileChunk.ChunkIndex,
+			Chunks:   fileChunk.MaxChunk,
+			Bytes:    len(chunkDataBytes),
+			JobID:    fileChunk.JobId,
+		})
 	}
 }
 
+// Put our record for fileKey on the market with the price schedule of the
+// pricing policy.
+func announceFile(ctx context.Context, fileKey string) error {
+	policy := orcaPricing.Default().Policy()
+	fileReq := fileshare.RegisterFileRequest{}
+	fileReq.User = &fileshare.User{}
+	fileReq.User.Price = policy.Price(fileKey)
+	fileReq.User.Schedule = policy.Schedule()
+	fileReq.User.Ip = serverStruct.HostMultiAddr
+	fileReq.User.Port = announcedPort
+	fileReq.FileKey = fileKey
+	_, err := serverStruct.RegisterFile(ctx, &fileReq)
+	return err
+}
+
+// ReannounceFiles puts the records of every file we hold on the market again,
+// e.g. after the pricing policy changed.
+func ReannounceFiles(ctx context.Context) {
+	fileKeys := make([]string, 0)
+	for fileKey := range serverStruct.StoredFileInfoMap {
+		fileKeys = append(fileKeys, fileKey)
+	}
+	for _, fileKey := range fileKeys {
+		if err := announceFile(ctx, fileKey); err != nil {
+			fmt.Printf("Error announcing %s: %s\n", fileKey, err)
+		}
+	}
+}
+
+// Write fileChunk to s with the length prefix used by the fileshare stream.
+func writeFileChunk(s network.Stream, fileChunk orcaJobs.FileChunk) error {
+	payloadBytes, err := json.Marshal(fileChunk)
+	if err != nil {
+		return err
+	}
+	lengthHeader := make([]byte, 4)
+	binary.LittleEndian.PutUint32(lengthHeader, uint32(len(payloadBytes)))
+	_, err = s.Write(append(lengthHeader, payloadBytes...))
+	return err
+}
+
 /*
  * gRPC service to register a file on the DHT market.
  *
@@ -586,35 +718,12 @@ func (s *FileShareServerNode) CheckHolders(ctx context.Context, in *fileshare.Ch
 			return nil, err
 		}
 
-		users = append(users, user)
+		if !isBannedHolder(user) {
+			users = append(users, user)
+		}
 		i = i + 4 + int(contentLength) - 1
 	}
 
 	return &fileshare.HoldersResponse{Holders: users}, nil
 }
 
-// Find file bootstrap.peers and parse it to get multiaddrs of bootstrap peers
-func ReadBootstrapPeers() []ma.Multiaddr {
-	peers := []ma.Multiaddr{}
-
-	// For now bootstrap.peers can be in cli folder but it can be moved
-	file, err := os.Open("internal/cli/bootstrap.peers")
-	if err != nil {
-		panic(err)
-	}
-
-	scanner := bufio.NewScanner(file)
-	scanner.Split(bufio.ScanLines)
-
-	for scanner.Scan() {
-		line := scanner.Text()
-
-		multiadd, err := ma.NewMultiaddr(line)
-		if err != nil {
-			panic(err)
-		}
-		peers = append(peers, multiadd)
-	}
-
-	return peers
-}
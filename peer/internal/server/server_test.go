@@ -0,0 +1,163 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	orcaDataDir "orca-peer/internal/datadir"
+	"orca-peer/internal/hash"
+	orcaRouter "orca-peer/internal/router"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSendFileOnlyServesStoredFiles(t *testing.T) {
+	if err := orcaDataDir.Init(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { orcaDataDir.Close() })
+	if err := os.WriteFile(orcaDataDir.APICookieFile(), []byte("admin-token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	chunk := strings.Repeat("ab", 32)
+	if err := os.WriteFile(filepath.Join(orcaDataDir.StoredDir(), chunk), []byte("chunk"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server := &HTTPServer{storage: hash.NewDataStore(orcaDataDir.StoredDir())}
+	rt := orcaRouter.New()
+	rt.Handle(Routes(server, nil)...)
+	peers := httptest.NewServer(rt.PublicHandler())
+	defer peers.Close()
+
+	get := func(path string) (int, string) {
+		resp, err := http.Get(peers.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, string(body)
+	}
+
+	if status, body := get("/requestFile/" + chunk); status != http.StatusOK || body != "chunk" {
+		t.Fatalf("stored chunk: got %d %q", status, body)
+	}
+	for _, path := range []string{
+		"/requestFile/..%2f..%2fapi.cookie",
+		"/requestFile/..%2F..%2Fconfig%2Fkey.priv",
+		"/requestFile/" + chunk + "%2f..%2f..%2f..%2fapi.cookie",
+		"/requestFile/api.cookie",
+	} {
+		if status, body := get(path); status == http.StatusOK || strings.Contains(body, "admin-token") {
+			t.Errorf("%s: got %d %q", path, status, body)
+		}
+	}
+
+	// The handler itself refuses names out of the stored folder, whatever the
+	// router lets through
+	for _, name := range []string{"../../api.cookie", "..", chunk + "/..", "", "api.cookie"} {
+		r := httptest.NewRequest(http.MethodGet, "/requestFile/", nil)
+		r.URL.Path = "/requestFile/" + name
+		w := httptest.NewRecorder()
+		server.sendFile(w, r, nil)
+		if w.Code != http.StatusNotFound || strings.Contains(w.Body.String(), "admin-token") {
+			t.Errorf("%q: got %d %q", name, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestStoreFileAsksForConfirmation(t *testing.T) {
+	if err := orcaDataDir.Init(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { orcaDataDir.Close() })
+	timeout := confirmationTimeout
+	confirmationTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { confirmationTimeout = timeout })
+
+	server := &HTTPServer{storage: hash.NewDataStore(orcaDataDir.StoredDir())}
+	store := func(confirmation *Confirmation) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(FileData{FileName: "notes.txt", Content: []byte("notes")})
+		r := httptest.NewRequest(http.MethodPost, "/storeFile/", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		server.storeFile(w, r, confirmation)
+		return w
+	}
+	answer := func(confirmation *Confirmation, yes bool) {
+		for !confirmation.Answer(yes) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// Nobody answers in daemon mode
+	if w := store(nil); w.Code != http.StatusForbidden {
+		t.Fatalf("daemon mode: got %d %q", w.Code, w.Body.String())
+	}
+
+	confirmation := &Confirmation{}
+	if w := store(confirmation); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("unanswered: got %d %q", w.Code, w.Body.String())
+	}
+	if confirmation.Answer(true) {
+		t.Fatal("answered a question that timed out")
+	}
+
+	go answer(confirmation, false)
+	if w := store(confirmation); w.Code != http.StatusUnauthorized {
+		t.Fatalf("declined: got %d %q", w.Code, w.Body.String())
+	}
+
+	go answer(confirmation, true)
+	w := store(confirmation)
+	if w.Code != http.StatusOK {
+		t.Fatalf("accepted: got %d %q", w.Code, w.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(orcaDataDir.StoredDir(), w.Body.String())); err != nil {
+		t.Fatalf("accepted file was not stored: %v", err)
+	}
+}
+
+func TestStoreFileIsLimited(t *testing.T) {
+	if err := orcaDataDir.Init(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { orcaDataDir.Close() })
+
+	server := &HTTPServer{storage: hash.NewDataStore(orcaDataDir.StoredDir())}
+	confirmation := &Confirmation{}
+	rt := orcaRouter.New()
+	rt.Handle(Routes(server, confirmation)...)
+	peers := httptest.NewServer(rt.PublicHandler())
+	defer peers.Close()
+	store := func(content []byte) (int, string) {
+		body, _ := json.Marshal(FileData{FileName: "big.bin", Content: content})
+		resp, err := http.Post(peers.URL+"/storeFile/", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(message)
+	}
+
+	if status, message := store(make([]byte, maxStoreFileBody)); status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("large file: got %d %q", status, message)
+	}
+
+	// A request waiting for confirmation turns the others away
+	storeSlots <- struct{}{}
+	status, message := store([]byte("notes"))
+	<-storeSlots
+	if status != http.StatusServiceUnavailable {
+		t.Fatalf("concurrent request: got %d %q", status, message)
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
+	orcaGeo "orca-peer/internal/geo"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/cbergoon/speedtest-go"
 )
@@ -89,49 +91,34 @@ func GetNetworkInfo() NetworkStatus {
 	}
 	return NetworkStatus{Success: false}
 }
-func GetLocationData() string {
-	ipapiClient := http.Client{}
+// Public IP lookups are the only part of location detection that needs the network.
+const publicIpTimeout = 5 * time.Second
 
-	ipv4Req, err := http.NewRequest("GET", "http://httpbin.org/ip", nil)
+// GetLocationData finds this node's public IP and resolves it against the local
+// geo database. It never fails, unknown fields are reported as geo.Unknown.
+func GetLocationData() orcaGeo.Location {
+	ip, err := getPublicIP()
 	if err != nil {
-		log.Fatal(err)
+		fmt.Println("Unable to establish public IP:", err)
+		return orcaGeo.LookupString("")
 	}
-	resp, err := ipapiClient.Do(ipv4Req)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	ipv4Body := string(body)
-	var ipv4JSON map[string]interface{}
-	err = json.Unmarshal([]byte(ipv4Body), &ipv4JSON)
-	if err != nil {
-		log.Fatal("Unable to establish user IP, please try again")
-		return ""
-	}
-
-	req, err := http.NewRequest("GET", fmt.Sprintf("https://ipapi.co/%s/json/", ipv4JSON["origin"].(string)), nil)
-	if err != nil {
-		log.Fatal(err)
-	}
-	req.Header.Set("User-Agent", "ipapi.co/#go-v1.4.01")
+	return orcaGeo.LookupString(ip)
+}
 
-	resp, err = ipapiClient.Do(req)
+func getPublicIP() (string, error) {
+	ipClient := http.Client{Timeout: publicIpTimeout}
+	resp, err := ipClient.Get("http://httpbin.org/ip")
 	if err != nil {
-		log.Fatal(err)
+		return "", err
 	}
-
 	defer resp.Body.Close()
 
-	body, err = io.ReadAll(resp.Body)
-	if err != nil {
-		log.Fatal(err)
+	var ipv4JSON struct {
+		Origin string `json:"origin"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&ipv4JSON); err != nil {
+		return "", err
 	}
-	return string(body)
+	// httpbin reports every hop when the request was proxied, the first one is ours.
+	return strings.TrimSpace(strings.Split(ipv4JSON.Origin, ",")[0]), nil
 }
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	orcaDataDir "orca-peer/internal/datadir"
 	"os"
 	"path/filepath"
 )
@@ -24,13 +25,13 @@ type Transaction struct {
 var AllTransactions []Transaction
 
 func LoadInTransactions() {
-	folderPath := "./files/transactions"
+	folderPath := orcaDataDir.TransactionsDir()
 	if _, err := os.Stat(folderPath); os.IsNotExist(err) {
 		return
 	}
-	if _, err := os.Stat("./files/transactions/transactions.json"); !os.IsNotExist(err) {
+	if _, err := os.Stat(filepath.Join(orcaDataDir.TransactionsDir(), "transactions.json")); !os.IsNotExist(err) {
 		// Open the file
-		file, err := os.Open("./files/transactions/transactions.json")
+		file, err := os.Open(filepath.Join(orcaDataDir.TransactionsDir(), "transactions.json"))
 		if err != nil {
 			return
 		}
@@ -75,7 +76,7 @@ func LoadInTransactions() {
 }
 
 func CompressTransactions() error {
-	folderPath := "./files/transactions"
+	folderPath := orcaDataDir.TransactionsDir()
 	if _, err := os.Stat(folderPath); os.IsNotExist(err) {
 		return err
 	}
@@ -126,7 +127,7 @@ func CompressTransactions() error {
 	if err != nil {
 		return err
 	}
-	file, err := os.Create("./files/transactions/transactions.json")
+	file, err := os.Create(filepath.Join(orcaDataDir.TransactionsDir(), "transactions.json"))
 	if err != nil {
 		return err
 	}
@@ -2,7 +2,9 @@ package store
 
 import (
 	"log"
+	orcaDataDir "orca-peer/internal/datadir"
 	"os"
+	"path/filepath"
 	"time"
 )
 
@@ -15,13 +17,13 @@ type FileInfo struct {
 
 //Searches for files in stored. 
 func GetAllLocalFiles() []FileInfo {
-	files, err := os.ReadDir("files/stored")
+	files, err := os.ReadDir(orcaDataDir.StoredDir())
 	if err != nil {
 		log.Fatal(err)
 	}
 	fileNames := make([]FileInfo, 0)
 	for _, file := range files {
-		fileInfo, err := os.Stat("files/stored/" + file.Name())
+		fileInfo, err := os.Stat(filepath.Join(orcaDataDir.StoredDir(), file.Name()))
 		if err == nil{
 			if len(file.Name()) >= 64 {
 				fileNames = append(fileNames, 